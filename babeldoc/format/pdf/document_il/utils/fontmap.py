@@ -1,6 +1,7 @@
 import enum
 import functools
 import logging
+import os
 import re
 from pathlib import Path
 
@@ -13,6 +14,11 @@ from babeldoc.format.pdf.translation_config import TranslationConfig
 
 logger = logging.getLogger(__name__)
 
+# Extra fonts are embedded through page.insert_font() like the bundled fonts,
+# which writes them as Type0 fonts with Identity-H encoding (2-byte codes).
+# This is why every entry in EMBEDDING_FONT_METADATA has encoding_length 2.
+EXTRA_FONT_ENCODING_LENGTH = 2
+
 
 class PrimaryFontFamily(enum.IntEnum):
     SERIF = 1
@@ -63,26 +69,21 @@ class FontMapper:
             if font_file_name in self.fontid2fontpath:
                 continue
             font_path, font_metadata = assets.get_font_and_metadata(font_file_name)
-            pymupdf_font = pymupdf.Font(fontfile=str(font_path))
-            pymupdf_font.has_glyph = functools.lru_cache(maxsize=10240, typed=True)(
-                pymupdf_font.has_glyph,
-            )
-            pymupdf_font.char_lengths = functools.lru_cache(maxsize=10240, typed=True)(
-                pymupdf_font.char_lengths,
+            self._add_font(
+                font_file_name,
+                font_path,
+                pymupdf.Font(fontfile=str(font_path)),
+                font_metadata["ascent"],
+                font_metadata["descent"],
+                font_metadata["encoding_length"],
             )
-            self.fonts[font_file_name] = pymupdf_font
-            self.fontid2fontpath[font_file_name] = font_path
-            self.fonts[font_file_name].font_id = font_file_name
-            self.fonts[font_file_name].font_path = font_path
-            self.fonts[font_file_name].ascent_fontmap = font_metadata["ascent"]
-            self.fonts[font_file_name].descent_fontmap = font_metadata["descent"]
-            self.fonts[font_file_name].encoding_length = font_metadata[
-                "encoding_length"
-            ]
+        extra_font_ids = self._load_extra_fonts()
 
         self.normal_font_ids: list[str] = font_family["normal"]
         self.script_font_ids: list[str] = font_family["script"]
-        self.fallback_font_ids: list[str] = font_family["fallback"]
+        # Extra fonts come after the built-in fallbacks, so they are only used
+        # for characters that none of the bundled fonts can render.
+        self.fallback_font_ids: list[str] = font_family["fallback"] + extra_font_ids
         self.base_font_ids: list[str] = font_family["base"]
         self.fontid2fontpath["base"] = self.fontid2fontpath[font_family["base"][0]]
 
@@ -116,6 +117,59 @@ class FontMapper:
             self.map_in_type
         )
 
+    def _add_font(
+        self,
+        font_id: str,
+        font_path: Path,
+        pymupdf_font: pymupdf.Font,
+        ascent: int,
+        descent: int,
+        encoding_length: int,
+    ):
+        pymupdf_font.has_glyph = functools.lru_cache(maxsize=10240, typed=True)(
+            pymupdf_font.has_glyph,
+        )
+        pymupdf_font.char_lengths = functools.lru_cache(maxsize=10240, typed=True)(
+            pymupdf_font.char_lengths,
+        )
+        self.fonts[font_id] = pymupdf_font
+        self.fontid2fontpath[font_id] = font_path
+        pymupdf_font.font_id = font_id
+        pymupdf_font.font_path = font_path
+        pymupdf_font.ascent_fontmap = ascent
+        pymupdf_font.descent_fontmap = descent
+        pymupdf_font.encoding_length = encoding_length
+
+    def _load_extra_fonts(self) -> list[str]:
+        """Load additional fallback fonts (.ttf/.otf) from BABELDOC_EXTRA_FONTS_DIR."""
+        extra_fonts_dir = os.environ.get("BABELDOC_EXTRA_FONTS_DIR")
+        if not extra_fonts_dir or not Path(extra_fonts_dir).is_dir():
+            return []
+        font_ids = []
+        for font_path in sorted(Path(extra_fonts_dir).iterdir()):
+            if font_path.suffix.lower() not in (".ttf", ".otf"):
+                continue
+            # The font id becomes the PDF font resource name; keep only safe characters.
+            font_id = "extra_" + re.sub(r"[^0-9A-Za-z_-]", "_", font_path.stem)
+            if font_id in self.fonts:
+                continue
+            try:
+                pymupdf_font = pymupdf.Font(fontfile=str(font_path))
+            except Exception as e:
+                logger.warning(f"Failed to load extra font {font_path}: {e}")
+                continue
+            self._add_font(
+                font_id,
+                font_path,
+                pymupdf_font,
+                round(pymupdf_font.ascender * 1000),
+                round(pymupdf_font.descender * 1000),
+                EXTRA_FONT_ENCODING_LENGTH,
+            )
+            font_ids.append(font_id)
+            logger.info(f"Loaded extra font {font_path} as {font_id}")
+        return font_ids
+
     def has_char(self, char_unicode: str):
         if len(char_unicode) != 1:
             return False
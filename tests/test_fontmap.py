@@ -0,0 +1,90 @@
+from types import SimpleNamespace
+
+import pymupdf
+import pytest
+
+from babeldoc.format.pdf.document_il.utils import fontmap
+from babeldoc.format.pdf.document_il.utils.fontmap import FontMapper
+
+FONT_FAMILY = {
+    "normal": ["normal.ttf"],
+    "script": ["normal.ttf"],
+    "fallback": ["fallback.ttf"],
+    "base": ["normal.ttf"],
+}
+
+
+@pytest.fixture
+def builtin_fonts(tmp_path, monkeypatch):
+    """Replace the downloaded font assets with copies of a font shipped with pymupdf."""
+    font_buffer = pymupdf.Font("helv").buffer
+    assets_dir = tmp_path / "assets"
+    assets_dir.mkdir()
+    for name in ("normal.ttf", "fallback.ttf"):
+        (assets_dir / name).write_bytes(font_buffer)
+
+    monkeypatch.setattr(
+        fontmap.assets, "get_font_family", lambda lang_out: FONT_FAMILY
+    )
+    monkeypatch.setattr(
+        fontmap.assets,
+        "get_font_and_metadata",
+        lambda name: (
+            assets_dir / name,
+            {"ascent": 800, "descent": -200, "encoding_length": 1},
+        ),
+    )
+    monkeypatch.delenv("BABELDOC_EXTRA_FONTS_DIR", raising=False)
+    return font_buffer
+
+
+def new_font_mapper():
+    return FontMapper(SimpleNamespace(primary_font_family=None, lang_out="zh"))
+
+
+@pytest.mark.parametrize(
+    ("files", "expected"),
+    [
+        ({}, []),
+        ({"Noto Sans.ttf": "font"}, ["extra_Noto_Sans"]),
+        (
+            {"b.OTF": "font", "a.ttf": "font", "readme.txt": "text"},
+            ["extra_a", "extra_b"],
+        ),
+        ({"broken.ttf": "garbage", "ok.ttf": "font"}, ["extra_ok"]),
+    ],
+)
+def test_extra_fonts_appended_to_fallback(
+    builtin_fonts, tmp_path, monkeypatch, files, expected
+):
+    extra_dir = tmp_path / "extra"
+    extra_dir.mkdir()
+    for name, kind in files.items():
+        content = builtin_fonts if kind == "font" else b"not a font"
+        (extra_dir / name).write_bytes(content)
+    monkeypatch.setenv("BABELDOC_EXTRA_FONTS_DIR", str(extra_dir))
+
+    mapper = new_font_mapper()
+
+    assert mapper.fallback_font_ids == ["fallback.ttf", *expected]
+    assert [f.font_id for f in mapper.fallback_fonts] == mapper.fallback_font_ids
+    assert mapper.type2font["fallback"] == mapper.fallback_fonts
+    for font_id in expected:
+        font = mapper.fontid2font[font_id]
+        assert mapper.fontid2fontpath[font_id] == font.font_path
+        assert font.encoding_length == 2
+
+
+def test_without_extra_fonts_dir(builtin_fonts):
+    mapper = new_font_mapper()
+
+    assert mapper.fallback_font_ids == ["fallback.ttf"]
+    assert FONT_FAMILY["fallback"] == ["fallback.ttf"]
+
+
+def test_missing_extra_fonts_dir(builtin_fonts, tmp_path, monkeypatch):
+    monkeypatch.setenv("BABELDOC_EXTRA_FONTS_DIR", str(tmp_path / "missing"))
+
+    mapper = new_font_mapper()
+
+    assert mapper.fallback_font_ids == ["fallback.ttf"]
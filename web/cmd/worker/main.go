@@ -0,0 +1,9 @@
+package main
+
+import "babeldoc-web/internal/server"
+
+// 独立 worker：从共享队列（QUEUE_BACKEND=db 或 redis）领取任务并运行 babeldoc，
+// 与 Web 服务共享数据目录和数据库，可以单独重启或扩容而不中断 Web 服务，反之亦然
+func main() {
+	server.RunWorker()
+}
@@ -0,0 +1,848 @@
+// e2e 端到端测试：在临时目录中启动服务，用 fake-babeldoc 替代真实的 babeldoc，
+// 自动验证提交、进度、失败、重试、取消、分享链接、队列暂停、压缩下载和清理流程。
+//
+// 用法（在 web 目录下）：
+//
+//	go run ./e2e                 构建服务并运行全部场景
+//	go run ./e2e -run cancel     只运行名称包含 cancel 的场景
+//	go run ./e2e -keep           保留临时目录（数据目录、服务日志）便于排查
+//	go run ./e2e -server ./bin   使用已构建的服务程序
+//
+// 替身的行为由任务参数控制（见 fake-babeldoc 文件头部），场景之间互不依赖。
+// 需要特殊配置（结果保留、输出压缩等）的场景使用单独启动的服务实例，数据目录和日志在临时目录下以场景名命名的子目录中。
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed fake-babeldoc
+var fakeBabeldoc []byte
+
+var (
+	serverBinary = flag.String("server", "", "服务程序路径（默认用 go build 构建当前目录）")
+	workDir      = flag.String("dir", "..", "服务的工作目录（需要能找到 ./web/static）")
+	keepTemp     = flag.Bool("keep", false, "结束后保留临时目录")
+	runFilter    = flag.String("run", "", "只运行名称包含该字符串的场景")
+)
+
+// adminToken 服务启动时设置的 ADMIN_TOKEN，访问管理端点时携带
+const adminToken = "e2e-admin-token"
+
+// harness 一个运行中的服务实例
+type harness struct {
+	baseURL string
+	dataDir string
+	logPath string
+	client  *http.Client
+}
+
+// scenario 一个测试场景
+type scenario struct {
+	name string
+	run  func(h *harness) error
+	env  []string // 额外的环境变量，设置时为该场景单独启动服务
+}
+
+var scenarios = []scenario{
+	{"submit-success", testSubmitSuccess, nil},
+	{"failure-exit-code", testFailureExitCode, nil},
+	{"no-output-files", testNoOutputFiles, nil},
+	{"transient-retry", testTransientRetry, nil},
+	{"cancel-queued", testCancelQueued, nil},
+	{"share-link-limit", testShareLinkLimit, nil},
+	{"delete-cleanup", testDeleteCleanup, nil},
+	{"signed-link-expiry", testSignedLinkExpiry, nil},
+	{"queue-pause-resume", testQueuePauseResume, nil},
+	{"retention-cleanup", testRetentionCleanup, []string{"RESULT_RETENTION=2s", "RETENTION_CHECK_INTERVAL=1s"}},
+	{"compressed-download", testCompressedDownload, []string{"OUTPUT_COMPRESSION=gzip"}},
+}
+
+func main() {
+	flag.Parse()
+	log.SetFlags(0)
+
+	tmp, err := os.MkdirTemp("", "babeldoc-e2e-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	binDir, server, err := installBinaries(tmp)
+	if err != nil {
+		os.RemoveAll(tmp)
+		log.Fatal(err)
+	}
+	h, stop, err := startServer(tmp, binDir, server, nil)
+	if err != nil {
+		os.RemoveAll(tmp)
+		log.Fatal(err)
+	}
+
+	failed := 0
+	for _, sc := range scenarios {
+		if *runFilter != "" && !strings.Contains(sc.name, *runFilter) {
+			continue
+		}
+		start := time.Now()
+		if err := runScenario(sc, h, tmp, binDir, server); err != nil {
+			failed++
+			log.Printf("FAIL %s (%s): %v", sc.name, time.Since(start).Round(time.Millisecond), err)
+			continue
+		}
+		log.Printf("PASS %s (%s)", sc.name, time.Since(start).Round(time.Millisecond))
+	}
+
+	stop()
+	if failed > 0 {
+		log.Printf("%d 个场景失败，服务日志末尾：\n%s", failed, tailFile(h.logPath, 40))
+	}
+	if *keepTemp {
+		log.Printf("临时目录: %s", tmp)
+	} else {
+		os.RemoveAll(tmp)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runScenario 运行一个场景；场景有额外的环境变量时在 tmp/<场景名> 下单独启动服务，结束后停止
+func runScenario(sc scenario, shared *harness, tmp, binDir, server string) error {
+	if len(sc.env) == 0 {
+		return sc.run(shared)
+	}
+	h, stop, err := startServer(filepath.Join(tmp, sc.name), binDir, server, sc.env)
+	if err != nil {
+		return err
+	}
+	err = sc.run(h)
+	stop()
+	if err != nil {
+		return fmt.Errorf("%w\n服务日志末尾：\n%s", err, tailFile(h.logPath, 40))
+	}
+	return nil
+}
+
+// installBinaries 安装 fake-babeldoc 并构建服务，返回 fake-babeldoc 所在目录和服务程序路径
+func installBinaries(tmp string) (string, string, error) {
+	binDir := filepath.Join(tmp, "bin")
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(filepath.Join(binDir, "babeldoc"), fakeBabeldoc, 0755); err != nil {
+		return "", "", err
+	}
+
+	server := *serverBinary
+	if server == "" {
+		server = filepath.Join(binDir, "babeldoc-web")
+		build := exec.Command("go", "build", "-o", server, ".")
+		build.Stdout, build.Stderr = os.Stdout, os.Stderr
+		if err := build.Run(); err != nil {
+			return "", "", fmt.Errorf("构建服务失败: %w", err)
+		}
+	} else if abs, err := filepath.Abs(server); err == nil {
+		server = abs
+	}
+	return binDir, server, nil
+}
+
+// startServer 以 dir 下的数据目录启动服务，env 为额外的环境变量，返回停止函数
+func startServer(dir, binDir, server string, env []string) (*harness, func(), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	port, err := freePort()
+	if err != nil {
+		return nil, nil, err
+	}
+	h := &harness{
+		baseURL: fmt.Sprintf("http://127.0.0.1:%d", port),
+		dataDir: filepath.Join(dir, "data"),
+		logPath: filepath.Join(dir, "server.log"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+	logFile, err := os.Create(h.logPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmd := exec.Command(server)
+	cmd.Dir = *workDir
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	cmd.Env = append(os.Environ(),
+		"PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		fmt.Sprintf("PORT=%d", port),
+		"DATA_DIR="+h.dataDir,
+		"TRANSLATOR=babeldoc",
+		"OPENAI_API_KEY=e2e-fake-key",
+		"WORKER_COUNT=1",
+		"TASK_MAX_ATTEMPTS=2",
+		"TASK_RETRY_BACKOFF=1s",
+		"ADMIN_TOKEN="+adminToken,
+	)
+	cmd.Env = append(cmd.Env, env...)
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, nil, fmt.Errorf("启动服务失败: %w", err)
+	}
+	stop := func() {
+		cmd.Process.Signal(os.Interrupt)
+		done := make(chan struct{})
+		go func() { cmd.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			cmd.Process.Kill()
+			<-done
+		}
+		logFile.Close()
+	}
+
+	if err := h.waitReady(30 * time.Second); err != nil {
+		stop()
+		return nil, nil, fmt.Errorf("%w\n%s", err, tailFile(h.logPath, 40))
+	}
+	return h, stop, nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (h *harness) waitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		resp, err := h.client.Get(h.baseURL + "/api/v1/languages")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return errors.New("服务未在规定时间内就绪")
+}
+
+// ---- 场景 ----
+
+func testSubmitSuccess(h *harness) error {
+	id, err := h.submit(map[string]string{"fake-delay": "0.2"})
+	if err != nil {
+		return err
+	}
+
+	// 执行期间应能观察到介于 0 和 100 之间的进度
+	sawProgress := false
+	task, err := h.waitFor(id, 30*time.Second, func(status string, progress int) {
+		if status == "running" && progress > 0 && progress < 100 {
+			sawProgress = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if task.Status != "success" {
+		return fmt.Errorf("任务状态为 %s（%s），期望 success", task.Status, task.Error)
+	}
+	if !sawProgress {
+		return errors.New("执行期间没有观察到中间进度")
+	}
+	if task.EnvSnapshot == nil || task.EnvSnapshot.BabeldocVersion != "fake-babeldoc 0.0.0" {
+		return errors.New("任务详情中没有记录运行环境快照")
+	}
+	if len(task.OutputFiles) != 2 {
+		return fmt.Errorf("输出文件 %v，期望 mono 和 dual 两个", task.OutputFiles)
+	}
+	for _, file := range task.OutputFiles {
+		body, status, err := h.get("/api/v1/tasks/" + id + "/download?file=" + file)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK || !bytes.HasPrefix(body, []byte("%PDF")) {
+			return fmt.Errorf("下载 %s 返回 %d", file, status)
+		}
+	}
+
+	// 断点续传：从第 4 个字节继续下载
+	req, _ := http.NewRequest(http.MethodGet, h.baseURL+"/api/v1/tasks/"+id+"/download", nil)
+	req.Header.Set("Range", "bytes=4-")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	partial, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(partial, samplePDF[4:]) {
+		return fmt.Errorf("范围请求返回 %d（%d 字节），期望 206", resp.StatusCode, len(partial))
+	}
+	return nil
+}
+
+func testFailureExitCode(h *harness) error {
+	id, err := h.submit(map[string]string{
+		"fake-exit-code": "3",
+		"fake-stderr":    "fake-babeldoc: simulated crash",
+	})
+	if err != nil {
+		return err
+	}
+	task, err := h.waitFor(id, 30*time.Second, nil)
+	if err != nil {
+		return err
+	}
+	if task.Status != "failed" {
+		return fmt.Errorf("任务状态为 %s，期望 failed", task.Status)
+	}
+	if task.Attempts != 1 {
+		return fmt.Errorf("执行了 %d 次，非临时错误不应重试", task.Attempts)
+	}
+	logs, _, err := h.get("/api/v1/tasks/" + id + "/logs")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(logs), "simulated crash") {
+		return errors.New("任务日志中没有 babeldoc 的错误输出")
+	}
+	return nil
+}
+
+func testNoOutputFiles(h *harness) error {
+	id, err := h.submit(map[string]string{"fake-outputs": "none"})
+	if err != nil {
+		return err
+	}
+	task, err := h.waitFor(id, 30*time.Second, nil)
+	if err != nil {
+		return err
+	}
+	if task.Status != "failed" || !strings.Contains(task.Error, "未找到输出文件") {
+		return fmt.Errorf("任务状态为 %s（%s），期望因未找到输出文件而失败", task.Status, task.Error)
+	}
+	return nil
+}
+
+func testTransientRetry(h *harness) error {
+	// 429 属于临时错误，任务等待重试后由计划任务调度重新入队（约 15 秒一次）
+	id, err := h.submit(map[string]string{
+		"fake-exit-code": "1",
+		"fake-stderr":    "Error code: 429 - rate limit exceeded",
+	})
+	if err != nil {
+		return err
+	}
+	sawScheduled := false
+	task, err := h.waitFor(id, 60*time.Second, func(status string, _ int) {
+		if status == "scheduled" {
+			sawScheduled = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !sawScheduled {
+		return errors.New("临时错误后任务没有进入等待重试状态")
+	}
+	if task.Status != "failed" || task.Attempts != 2 {
+		return fmt.Errorf("任务状态为 %s，执行 %d 次，期望用完 TASK_MAX_ATTEMPTS=2 后失败", task.Status, task.Attempts)
+	}
+	return nil
+}
+
+func testCancelQueued(h *harness) error {
+	// 只有一个 worker：第一个任务执行期间，第二个任务在排队，此时删除即取消
+	blocker, err := h.submit(map[string]string{"fake-delay": "0.3"})
+	if err != nil {
+		return err
+	}
+	queued, err := h.submit(nil)
+	if err != nil {
+		return err
+	}
+	if status, _, err := h.status(queued); err != nil {
+		return err
+	} else if status != "queued" {
+		return fmt.Errorf("第二个任务状态为 %s，期望 queued", status)
+	}
+	if _, status, err := h.do(http.MethodDelete, "/api/v1/tasks/"+queued, nil, ""); err != nil {
+		return err
+	} else if status != http.StatusOK {
+		return fmt.Errorf("删除排队中的任务返回 %d", status)
+	}
+
+	if _, err := h.waitFor(blocker, 30*time.Second, nil); err != nil {
+		return err
+	}
+	// 给 worker 取出已删除任务的时间，它不应被执行
+	time.Sleep(time.Second)
+	if _, status, err := h.status(queued); err != nil {
+		return err
+	} else if status != http.StatusNotFound {
+		return fmt.Errorf("已取消的任务仍可查询（%d）", status)
+	}
+	if h.hasTaskLog(queued) {
+		return errors.New("已取消的任务被执行了（存在任务日志）")
+	}
+	return h.assertNoFiles(queued)
+}
+
+func testShareLinkLimit(h *harness) error {
+	id, err := h.submit(nil)
+	if err != nil {
+		return err
+	}
+	if task, err := h.waitFor(id, 30*time.Second, nil); err != nil {
+		return err
+	} else if task.Status != "success" {
+		return fmt.Errorf("任务状态为 %s（%s），期望 success", task.Status, task.Error)
+	}
+
+	link, err := h.createShareLink(id, `{"max_downloads": 1}`)
+	if err != nil {
+		return err
+	}
+	if _, status, err := h.get(link); err != nil {
+		return err
+	} else if status != http.StatusOK {
+		return fmt.Errorf("第一次通过分享链接下载返回 %d", status)
+	}
+	if _, status, err := h.get(link); err != nil {
+		return err
+	} else if status != http.StatusGone {
+		return fmt.Errorf("下载次数用完后返回 %d，期望 410", status)
+	}
+	if _, status, err := h.get(strings.Replace(link, "sig=", "sig=0", 1)); err != nil {
+		return err
+	} else if status != http.StatusForbidden {
+		return fmt.Errorf("篡改签名后返回 %d，期望 403", status)
+	}
+	return nil
+}
+
+func testDeleteCleanup(h *harness) error {
+	id, err := h.submit(nil)
+	if err != nil {
+		return err
+	}
+	task, err := h.waitFor(id, 30*time.Second, nil)
+	if err != nil {
+		return err
+	}
+	if task.Status != "success" {
+		return fmt.Errorf("任务状态为 %s（%s），期望 success", task.Status, task.Error)
+	}
+	if _, status, err := h.do(http.MethodDelete, "/api/v1/tasks/"+id, nil, ""); err != nil {
+		return err
+	} else if status != http.StatusOK {
+		return fmt.Errorf("删除任务返回 %d", status)
+	}
+	if _, status, err := h.get("/api/v1/tasks/" + id); err != nil {
+		return err
+	} else if status != http.StatusNotFound {
+		return fmt.Errorf("删除后查询任务返回 %d，期望 404", status)
+	}
+	return h.assertNoFiles(id)
+}
+
+func testSignedLinkExpiry(h *harness) error {
+	task, err := h.runToSuccess(nil)
+	if err != nil {
+		return err
+	}
+	link, err := h.createShareLink(task.ID, `{"expires_in": 1}`)
+	if err != nil {
+		return err
+	}
+	if _, status, err := h.get(link); err != nil {
+		return err
+	} else if status != http.StatusOK {
+		return fmt.Errorf("有效期内通过分享链接下载返回 %d", status)
+	}
+
+	// 过期时间包含在签名中，延长后签名不再有效
+	path, rawQuery, _ := strings.Cut(link, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return err
+	}
+	query.Set("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	if _, status, err := h.get(path + "?" + query.Encode()); err != nil {
+		return err
+	} else if status != http.StatusForbidden {
+		return fmt.Errorf("修改过期时间后返回 %d，期望 403", status)
+	}
+
+	// 过期时间精确到秒
+	time.Sleep(2100 * time.Millisecond)
+	if _, status, err := h.get(link); err != nil {
+		return err
+	} else if status != http.StatusForbidden {
+		return fmt.Errorf("链接过期后返回 %d，期望 403", status)
+	}
+	return nil
+}
+
+func testQueuePauseResume(h *harness) error {
+	if _, status, err := h.do(http.MethodPost, "/api/v1/admin/queue/pause", nil, ""); err != nil {
+		return err
+	} else if status != http.StatusOK {
+		return fmt.Errorf("暂停队列返回 %d", status)
+	}
+	// 无论结果如何都恢复队列，避免影响之后的场景
+	defer h.do(http.MethodPost, "/api/v1/admin/queue/resume", nil, "")
+
+	id, err := h.submit(nil)
+	if err != nil {
+		return err
+	}
+	// 暂停期间 worker 可以取出任务，但不会开始执行
+	time.Sleep(2 * time.Second)
+	body, _, err := h.get("/api/v1/tasks/" + id)
+	if err != nil {
+		return err
+	}
+	var task taskInfo
+	if err := json.Unmarshal(body, &task); err != nil {
+		return err
+	}
+	if task.Status != "queued" || !task.QueuePaused {
+		return fmt.Errorf("暂停期间任务状态为 %s（queue_paused=%t），期望排队中且 queue_paused=true", task.Status, task.QueuePaused)
+	}
+	body, _, err = h.get("/api/v1/admin/queue/status")
+	if err != nil {
+		return err
+	}
+	var queue struct {
+		Paused bool `json:"paused"`
+	}
+	if json.Unmarshal(body, &queue) != nil || !queue.Paused {
+		return fmt.Errorf("队列状态中没有标记暂停: %s", body)
+	}
+
+	if _, status, err := h.do(http.MethodPost, "/api/v1/admin/queue/resume", nil, ""); err != nil {
+		return err
+	} else if status != http.StatusOK {
+		return fmt.Errorf("恢复队列返回 %d", status)
+	}
+	// worker 每 5 秒检查一次暂停状态
+	done, err := h.waitFor(id, 30*time.Second, nil)
+	if err != nil {
+		return err
+	}
+	if done.Status != "success" {
+		return fmt.Errorf("恢复后任务状态为 %s（%s），期望 success", done.Status, done.Error)
+	}
+	return nil
+}
+
+func testRetentionCleanup(h *harness) error {
+	// 服务以 RESULT_RETENTION=2s、RETENTION_CHECK_INTERVAL=1s 启动
+	task, err := h.runToSuccess(nil)
+	if err != nil {
+		return err
+	}
+	if task.ExpiresAt == nil {
+		return errors.New("启用结果保留后任务详情中没有 expires_at")
+	}
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		_, status, err := h.get("/api/v1/tasks/" + task.ID)
+		if err != nil {
+			return err
+		}
+		if status == http.StatusNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("任务在 %s 过期后没有被清理（查询返回 %d）", task.ExpiresAt.Format(time.RFC3339), status)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return h.assertNoFiles(task.ID)
+}
+
+func testCompressedDownload(h *harness) error {
+	// 服务以 OUTPUT_COMPRESSION=gzip 启动，输出文件压缩保存
+	task, err := h.runToSuccess(nil)
+	if err != nil {
+		return err
+	}
+	if len(task.OutputFiles) == 0 {
+		return errors.New("任务没有输出文件")
+	}
+	path := "/api/v1/tasks/" + task.ID + "/download?file=" + task.OutputFiles[0]
+
+	// 接受 gzip 时直接发送压缩数据
+	resp, body, err := h.fetch(path, map[string]string{"Accept-Encoding": "gzip"})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "gzip" {
+		return fmt.Errorf("接受 gzip 时返回 %d（Content-Encoding %q），期望压缩数据", resp.StatusCode, resp.Header.Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("压缩数据无效: %w", err)
+	}
+	plain, err := io.ReadAll(gz)
+	if err != nil || !bytes.Equal(plain, samplePDF) {
+		return errors.New("解压后的内容与输出文件不一致")
+	}
+
+	// 不接受压缩编码时解压后发送
+	resp, body, err = h.fetch(path, map[string]string{"Accept-Encoding": "identity"})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" || !bytes.Equal(body, samplePDF) {
+		return fmt.Errorf("不接受压缩时返回 %d（Content-Encoding %q，%d 字节），期望解压后的内容", resp.StatusCode, resp.Header.Get("Content-Encoding"), len(body))
+	}
+
+	// 范围请求不能作用于压缩数据，返回完整的解压内容
+	resp, body, err = h.fetch(path, map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=4-"})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" || !bytes.Equal(body, samplePDF) {
+		return fmt.Errorf("范围请求返回 %d（Content-Encoding %q，%d 字节），期望 200 和完整的解压内容", resp.StatusCode, resp.Header.Get("Content-Encoding"), len(body))
+	}
+	return nil
+}
+
+// ---- 工具函数 ----
+
+// taskInfo 场景关心的任务字段
+type taskInfo struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error"`
+	OutputFiles []string   `json:"output_files"`
+	Attempts    int        `json:"attempts"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	QueuePaused bool       `json:"queue_paused"`
+	EnvSnapshot *struct {
+		BabeldocVersion string `json:"babeldoc_version"`
+	} `json:"env_snapshot"`
+}
+
+// submit 上传示例 PDF 提交任务，params 作为表单字段传入（即 babeldoc 参数）
+func (h *harness) submit(params map[string]string) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "e2e-sample.pdf")
+	part.Write(samplePDF)
+	mw.WriteField("lang_in", "en")
+	mw.WriteField("lang_out", "zh")
+	for key, value := range params {
+		mw.WriteField(key, value)
+	}
+	mw.Close()
+
+	resp, status, err := h.do(http.MethodPost, "/api/v1/tasks", &body, mw.FormDataContentType())
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		TaskID string `json:"task_id"`
+	}
+	if status != http.StatusOK || json.Unmarshal(resp, &result) != nil || result.TaskID == "" {
+		return "", fmt.Errorf("提交任务返回 %d: %s", status, resp)
+	}
+	return result.TaskID, nil
+}
+
+// runToSuccess 提交任务并等待其成功
+func (h *harness) runToSuccess(params map[string]string) (*taskInfo, error) {
+	id, err := h.submit(params)
+	if err != nil {
+		return nil, err
+	}
+	task, err := h.waitFor(id, 30*time.Second, nil)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != "success" {
+		return nil, fmt.Errorf("任务状态为 %s（%s），期望 success", task.Status, task.Error)
+	}
+	return task, nil
+}
+
+// createShareLink 为任务生成分享链接，request 为请求体，返回第一个链接的路径和参数
+func (h *harness) createShareLink(id, request string) (string, error) {
+	body, status, err := h.do(http.MethodPost, "/api/v1/tasks/"+id+"/links", strings.NewReader(request), "application/json")
+	if err != nil {
+		return "", err
+	}
+	var created struct {
+		Links []struct {
+			URL string `json:"url"`
+		} `json:"links"`
+	}
+	if status != http.StatusCreated || json.Unmarshal(body, &created) != nil || len(created.Links) == 0 {
+		return "", fmt.Errorf("生成分享链接返回 %d: %s", status, body)
+	}
+	// 分享链接指向 PUBLIC_BASE_URL（默认 localhost:PORT），只取路径和参数
+	link := created.Links[0].URL
+	return link[strings.Index(link, "/api/"):], nil
+}
+
+// status 返回任务状态和查询的 HTTP 状态码
+func (h *harness) status(id string) (string, int, error) {
+	body, code, err := h.get("/api/v1/tasks/" + id + "/status")
+	if err != nil || code != http.StatusOK {
+		return "", code, err
+	}
+	var result struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", code, err
+	}
+	return result.Status, code, nil
+}
+
+// waitFor 轮询任务直到成功或失败，每次轮询都会调用 observe
+func (h *harness) waitFor(id string, timeout time.Duration, observe func(status string, progress int)) (*taskInfo, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		body, code, err := h.get("/api/v1/tasks/" + id + "/status")
+		if err != nil {
+			return nil, err
+		}
+		if code != http.StatusOK {
+			return nil, fmt.Errorf("查询任务 %s 状态返回 %d", id, code)
+		}
+		var result struct {
+			Status   string `json:"status"`
+			Progress int    `json:"progress"`
+		}
+		json.Unmarshal(body, &result)
+		if observe != nil {
+			observe(result.Status, result.Progress)
+		}
+		if result.Status == "success" || result.Status == "failed" {
+			detail, _, err := h.get("/api/v1/tasks/" + id)
+			if err != nil {
+				return nil, err
+			}
+			var task taskInfo
+			if err := json.Unmarshal(detail, &task); err != nil {
+				return nil, err
+			}
+			return &task, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil, fmt.Errorf("任务 %s 在 %s 内没有结束", id, timeout)
+}
+
+// assertNoFiles 检查数据目录中不再有任务的输入、输出和日志文件
+func (h *harness) assertNoFiles(id string) error {
+	var leftover []string
+	filepath.WalkDir(h.dataDir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && strings.Contains(d.Name(), id) {
+			leftover = append(leftover, path)
+		}
+		return nil
+	})
+	if len(leftover) > 0 {
+		return fmt.Errorf("任务文件没有清理: %v", leftover)
+	}
+	return nil
+}
+
+// hasTaskLog 任务是否有日志文件，文件名与服务的 taskLogPath 一致（<id>.jsonl，早期版本为 <id>.log）
+func (h *harness) hasTaskLog(id string) bool {
+	for _, name := range []string{id + ".jsonl", id + ".log"} {
+		if _, err := os.Stat(filepath.Join(h.dataDir, "logs", name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch 发送带有指定请求头的 GET 请求。设置了 Accept-Encoding 时客户端不会自动解压，返回的正文与服务发送的一致
+func (h *harness) fetch(path string, header map[string]string) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, h.baseURL+path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+func (h *harness) get(path string) ([]byte, int, error) {
+	return h.do(http.MethodGet, path, nil, "")
+}
+
+func (h *harness) do(method, path string, body io.Reader, contentType string) ([]byte, int, error) {
+	req, err := http.NewRequest(method, h.baseURL+path, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if strings.HasPrefix(path, "/api/v1/admin/") {
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return data, resp.StatusCode, err
+}
+
+func tailFile(path string, lines int) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	all := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return strings.Join(all, "\n")
+}
+
+// samplePDF 最小的单页 PDF，用作提交的输入文件
+var samplePDF = []byte(`%PDF-1.4
+1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj
+2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >> endobj
+trailer << /Root 1 0 R >>
+%%EOF
+`)
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// 管理端点配置：
+//
+//	ADMIN_TOKEN  管理端点的访问令牌，请求需携带 Authorization: Bearer <token>；
+//	             未设置时管理端点一律返回 401，只有经 ADMIN_LISTEN 访问的请求不校验（访问控制依赖监听地址本身）
+var adminToken = os.Getenv("ADMIN_TOKEN")
+
+const settingQueuePaused = "queue_paused"
+
+// requireAdmin 校验管理端点的访问令牌
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			if !viaAdminListener(r) {
+				writeError(w, http.StatusUnauthorized, codeUnauthorized, "Admin endpoints are disabled: ADMIN_TOKEN is not set")
+				return
+			}
+		} else {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				writeError(w, http.StatusUnauthorized, codeUnauthorized, "Unauthorized")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// isQueuePaused 返回队列是否处于暂停状态（保存在数据库中，重启及多实例间共享）
+func isQueuePaused() bool {
+	return getSetting(settingQueuePaused) == "true"
+}
+
+// waitWhileQueuePaused 在队列暂停期间阻塞 worker，并在心跳中标记为 paused
+func waitWhileQueuePaused(hb *workerHeartbeat) {
+	if !isQueuePaused() {
+		return
+	}
+	hb.setStage(stagePaused)
+	for isQueuePaused() {
+		time.Sleep(5 * time.Second)
+	}
+	hb.setStage(stageIdle)
+}
+
+// QueueStatus 队列状态
+type QueueStatus struct {
+	Paused  bool          `json:"paused"`
+	Queued  int           `json:"queued"`
+	Running int           `json:"running"`
+	Queues  []QueueDetail `json:"queues"`
+	Uploads UploadStats   `json:"uploads"`
+
+	PendingWrites int `json:"pending_writes"` // 写入数据库失败、等待重试的任务状态更新数
+
+	DiskLow *DiskSpaceWarning `json:"disk_low,omitempty"` // 本实例的磁盘空间不足、已暂停领取新任务（见 diskmonitor.go）
+}
+
+// QueueDetail 单个命名队列的状态
+type QueueDetail struct {
+	Name    string `json:"name"`
+	Workers int    `json:"workers"`
+	Queued  int    `json:"queued"`
+	Running int    `json:"running"`
+
+	Windows      []string   `json:"windows,omitempty"`        // 执行时段
+	NextWindowAt *time.Time `json:"next_window_at,omitempty"` // 当前在执行时段之外时，下一个时段的开始时间
+}
+
+// 队列状态
+func queueStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentQueueStatus())
+}
+
+func currentQueueStatus() *QueueStatus {
+	status := &QueueStatus{Paused: isQueuePaused(), Uploads: uploads.stats(), PendingWrites: pendingWriteCount(), DiskLow: diskSpaceLow()}
+	counts := make(map[string]map[string]int)
+
+	rows, err := db.Query(`SELECT COALESCE(queue, ''), status, COUNT(*) FROM tasks WHERE status IN ('queued', 'running') GROUP BY 1, 2`)
+	if err == nil {
+		for rows.Next() {
+			var queue, taskStatus string
+			var n int
+			if err := rows.Scan(&queue, &taskStatus, &n); err != nil {
+				continue
+			}
+			// 旧任务没有记录队列，归入第一个队列
+			if findQueueConfig(queue) == nil {
+				queue = queueConfigs[0].Name
+			}
+			if counts[queue] == nil {
+				counts[queue] = make(map[string]int)
+			}
+			counts[queue][taskStatus] += n
+		}
+		rows.Close()
+	}
+
+	for _, qc := range queueConfigs {
+		detail := QueueDetail{
+			Name:    qc.Name,
+			Workers: qc.Workers,
+			Queued:  counts[qc.Name]["queued"],
+			Running: counts[qc.Name]["running"],
+
+			Windows:      qc.Windows,
+			NextWindowAt: qc.nextWindowStart(time.Now()),
+		}
+		status.Queued += detail.Queued
+		status.Running += detail.Running
+		status.Queues = append(status.Queues, detail)
+	}
+	return status
+}
+
+// 暂停队列：正在执行的任务会继续完成，不再领取新任务
+func pauseQueueHandler(w http.ResponseWriter, r *http.Request) {
+	setQueuePaused(w, r, true)
+}
+
+// 恢复队列
+func resumeQueueHandler(w http.ResponseWriter, r *http.Request) {
+	setQueuePaused(w, r, false)
+}
+
+func setQueuePaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	value := "false"
+	if paused {
+		value = "true"
+	}
+	if err := setSetting(settingQueuePaused, value); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	log.Printf("任务队列已%s", map[bool]string{true: "暂停", false: "恢复"}[paused])
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"queue":   currentQueueStatus(),
+	})
+}
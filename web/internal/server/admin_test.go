@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		adminListener bool
+		want          int
+	}{
+		{"no token configured", "", "", false, http.StatusUnauthorized},
+		{"no token configured, any bearer", "", "Bearer ", false, http.StatusUnauthorized},
+		{"no token configured, admin listener", "", "", true, http.StatusOK},
+		{"missing bearer", "secret", "", false, http.StatusUnauthorized},
+		{"wrong bearer", "secret", "Bearer nope", false, http.StatusUnauthorized},
+		{"wrong bearer, admin listener", "secret", "Bearer nope", true, http.StatusUnauthorized},
+		{"correct bearer", "secret", "Bearer secret", false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := adminToken
+			adminToken = tt.token
+			defer func() { adminToken = saved }()
+
+			handler := requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/backup", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.adminListener {
+				req = req.WithContext(context.WithValue(req.Context(), adminListenerKey{}, true))
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+)
+
+// ADMIN_LISTEN 设置后，管理接口（/api/v1/admin/*）和 /metrics 只在该地址提供，不再出现在公开端口上，
+// 同时在该地址提供 pprof（/debug/pprof/）及运行时诊断（见 diagnostics.go）。取值为 host:port（如 127.0.0.1:9090）或 unix:/path/to/admin.sock
+var adminListen = os.Getenv("ADMIN_LISTEN")
+
+// adminListenerKey 标记经 ADMIN_LISTEN 建立的连接上的请求
+type adminListenerKey struct{}
+
+// viaAdminListener 请求是否来自 ADMIN_LISTEN，未设置 ADMIN_TOKEN 时只有这类请求可以访问管理端点
+func viaAdminListener(r *http.Request) bool {
+	return r.Context().Value(adminListenerKey{}) != nil
+}
+
+// newAdminRouter 注册管理接口、pprof 及运行时诊断
+func newAdminRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", apiNotFoundHandler)
+	for _, rt := range apiRoutes() {
+		if isAdminRoute(rt) {
+			registerRoute(mux, rt)
+		}
+	}
+
+	mux.HandleFunc("GET /metrics", requireAdmin(metricsHandler))
+
+	// /debug/ 下的接口不校验 ADMIN_TOKEN（go tool pprof 无法携带请求头），访问控制依赖监听地址本身
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", goroutineDumpHandler)
+	return mux
+}
+
+// serveAdmin 在 ADMIN_LISTEN 上提供管理接口，监听失败时退出
+func serveAdmin() {
+	network, address := "tcp", adminListen
+	if path, ok := strings.CutPrefix(adminListen, "unix:"); ok {
+		network, address = "unix", path
+	}
+
+	// 平滑升级时沿用旧进程的监听套接字（见 upgrade.go）
+	listener, inherited := inheritedListener(listenerAdmin)
+	if !inherited {
+		if network == "unix" {
+			// 清理上次运行遗留的套接字文件
+			os.Remove(address)
+		}
+		var err error
+		listener, err = net.Listen(network, address)
+		if err != nil {
+			log.Fatalf("无法监听管理地址 %s: %v", adminListen, err)
+		}
+		if network == "unix" {
+			// 只允许同一用户和用户组访问
+			os.Chmod(address, 0660)
+		}
+	}
+
+	publishDiagnostics()
+	log.Printf("Admin server listening on %s", adminListen)
+	srv := &http.Server{
+		Handler:           newAdminRouter(),
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ConnContext: func(ctx context.Context, _ net.Conn) context.Context {
+			return context.WithValue(ctx, adminListenerKey{}, true)
+		},
+	}
+	trackServer(listenerAdmin, srv, listener)
+	if err := srv.Serve(listener); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Azure Blob 存储配置：
+//
+//	AZURE_STORAGE_ACCOUNT   存储账户名
+//	AZURE_STORAGE_KEY       存储账户访问密钥（base64）
+//	AZURE_STORAGE_ENDPOINT  Blob 服务地址（默认 https://<account>.blob.core.windows.net，Azurite 为 http://127.0.0.1:10000/<account>）
+//
+// 请求使用 Shared Key 签名；签名链接为只读的服务 SAS。
+const azureAPIVersion = "2021-08-06"
+
+var azureHTTPClient = &http.Client{Timeout: 10 * time.Minute}
+
+type azureClient struct {
+	account  string
+	key      []byte
+	endpoint string
+}
+
+func newAzureClientFromEnv() (*azureClient, error) {
+	account, key := os.Getenv("AZURE_STORAGE_ACCOUNT"), os.Getenv("AZURE_STORAGE_KEY")
+	if account == "" || key == "" {
+		return nil, fmt.Errorf("未配置 AZURE_STORAGE_ACCOUNT / AZURE_STORAGE_KEY")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("AZURE_STORAGE_KEY 不是有效的 base64: %w", err)
+	}
+	return &azureClient{
+		account:  account,
+		key:      decoded,
+		endpoint: strings.TrimRight(envOrDefault("AZURE_STORAGE_ENDPOINT", "https://"+account+".blob.core.windows.net"), "/"),
+	}, nil
+}
+
+func (c *azureClient) blobURL(container, name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return c.endpoint + "/" + container + "/" + strings.Join(segments, "/")
+}
+
+// do 发送 Shared Key 签名的请求，非 2xx 响应返回错误（404 时错误包含 os.ErrNotExist）
+func (c *azureClient) do(method, rawURL string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("Authorization", "SharedKey "+c.account+":"+c.sign(req))
+
+	resp, err := azureHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		err := fmt.Errorf("Azure %s: HTTP %d: %s", method, resp.StatusCode, strings.TrimSpace(string(msg)))
+		if resp.StatusCode == http.StatusNotFound {
+			err = fmt.Errorf("%w: %v", os.ErrNotExist, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// sign 按 Shared Key 规则计算请求的签名
+func (c *azureClient) sign(req *http.Request) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	var msHeaders []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower+":"+strings.TrimSpace(req.Header.Get(name)))
+		}
+	}
+	sort.Strings(msHeaders)
+
+	resource := "/" + c.account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date，使用 x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		strings.Join(msHeaders, "\n"),
+		resource,
+	}, "\n")
+	return base64.StdEncoding.EncodeToString(hmacSHA256(c.key, stringToSign))
+}
+
+// azureStorage 以 Azure Blob 的 container/prefix 作为存储
+type azureStorage struct {
+	client    *azureClient
+	container string
+	prefix    string
+}
+
+func (s *azureStorage) Put(key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header := http.Header{"X-Ms-Blob-Type": {"BlockBlob"}, "Content-Type": {"application/pdf"}}
+	resp, err := s.client.do(http.MethodPut, s.client.blobURL(s.container, joinKeyPrefix(s.prefix, key)), f, info.Size(), header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *azureStorage) Get(key, path string) error {
+	resp, err := s.client.do(http.MethodGet, s.client.blobURL(s.container, joinKeyPrefix(s.prefix, key)), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return writeFileAtomic(path, resp.Body)
+}
+
+func (s *azureStorage) Delete(key string) error {
+	resp, err := s.client.do(http.MethodDelete, s.client.blobURL(s.container, joinKeyPrefix(s.prefix, key)), nil, 0, nil)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// azureListResult List Blobs 的响应
+type azureListResult struct {
+	Blobs []struct {
+		Name       string `xml:"Name"`
+		Properties struct {
+			ContentLength int64  `xml:"Content-Length"`
+			LastModified  string `xml:"Last-Modified"`
+		} `xml:"Properties"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+func (s *azureStorage) List(prefix string) ([]StoredObject, error) {
+	var objects []StoredObject
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {joinKeyPrefix(s.prefix, prefix)}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := s.client.do(http.MethodGet, s.client.endpoint+"/"+s.container+"?"+query.Encode(), nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result azureListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Azure list %s: %v", prefix, err)
+		}
+		for _, blob := range result.Blobs {
+			modTime, _ := time.Parse(http.TimeFormat, blob.Properties.LastModified)
+			objects = append(objects, StoredObject{Key: blob.Name, Size: blob.Properties.ContentLength, ModTime: modTime})
+		}
+		if result.NextMarker == "" {
+			return trimObjectPrefix(objects, s.prefix), nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// SignedURL 生成只读的服务 SAS 链接
+func (s *azureStorage) SignedURL(key, filename string, expires time.Duration) (string, error) {
+	return s.client.signedURL(s.container, joinKeyPrefix(s.prefix, key), filename, expires, time.Now().UTC())
+}
+
+func (c *azureClient) signedURL(container, name, filename string, expires time.Duration, now time.Time) (string, error) {
+	if expires <= 0 {
+		return "", fmt.Errorf("Azure 签名链接的有效期必须大于 0")
+	}
+	expiry := now.Add(expires).Format("2006-01-02T15:04:05Z")
+	disposition := ""
+	if filename != "" {
+		disposition = attachmentDisposition(filename)
+	}
+	protocol := ""
+	if strings.HasPrefix(c.endpoint, "https://") {
+		protocol = "https"
+	}
+	// 服务 SAS 的签名字符串（2020-12-06 及之后的版本）
+	stringToSign := strings.Join([]string{
+		"r",    // signedPermissions
+		"",     // signedStart
+		expiry, // signedExpiry
+		"/blob/" + c.account + "/" + container + "/" + name, // canonicalizedResource
+		"",              // signedIdentifier
+		"",              // signedIP
+		protocol,        // signedProtocol
+		azureAPIVersion, // signedVersion
+		"b",             // signedResource
+		"",              // signedSnapshotTime
+		"",              // signedEncryptionScope
+		"",              // rscc
+		disposition,     // rscd
+		"",              // rsce
+		"",              // rscl
+		"",              // rsct
+	}, "\n")
+	signature := base64.StdEncoding.EncodeToString(hmacSHA256(c.key, stringToSign))
+
+	query := url.Values{
+		"sv":  {azureAPIVersion},
+		"sr":  {"b"},
+		"sp":  {"r"},
+		"se":  {expiry},
+		"sig": {signature},
+	}
+	if protocol != "" {
+		query.Set("spr", protocol)
+	}
+	if disposition != "" {
+		query.Set("rscd", disposition)
+	}
+	return c.blobURL(container, name) + "?" + query.Encode(), nil
+}
+
+func (s *azureStorage) String() string { return "azure://" + s.container + "/" + s.prefix }
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// babeldoc 的缓存目录：babeldoc 把翻译缓存（cache.v1.db）、下载的字体、版面分析模型和 tiktoken 数据保存在
+// ~/.cache/babeldoc 下，长期运行的部署中会悄悄占用数 GB。磁盘用量（GET /api/v1/storage）的 babeldoc_cache 列出
+// 该目录各项的大小，管理员可以清理其中的项目（POST /api/v1/admin/babeldoc-cache/clear），
+// 或把整个目录移到其他磁盘（POST /api/v1/admin/babeldoc-cache/relocate，原位置替换为指向新位置的符号链接，
+// babeldoc 不需要任何配置）。
+//
+//	BABELDOC_CACHE_DIR  babeldoc 的缓存目录（默认 $HOME/.cache/babeldoc，babeldoc 以其他用户运行时需要设置）
+//
+// 清理和移动不需要等待执行中的任务：要删除的项和原目录先重命名到一旁再删除，新位置就绪后才原子地替换符号链接，
+// 执行中的 babeldoc 已打开的文件不受影响，之后启动的 babeldoc 直接使用清理后的目录或新位置。
+// 跨文件系统移动时，复制期间执行中的任务新写入的缓存可能不会出现在新位置（下次执行时重新生成）。
+// 统计和操作的都是收到请求的进程所在主机上的目录；独立 worker 进程的缓存需要在 worker 主机上处理。
+var babeldocCacheDir = envOrDefault("BABELDOC_CACHE_DIR", defaultBabeldocCacheDir())
+
+// babeldocCacheLock 同一时间只进行一次清理或移动
+var babeldocCacheLock sync.Mutex
+
+// BabeldocCacheUsage babeldoc 缓存目录的用量
+type BabeldocCacheUsage struct {
+	Path    string               `json:"path"`
+	Target  string               `json:"target,omitempty"` // 缓存目录是符号链接时的实际位置
+	Total   int64                `json:"total"`
+	Entries []BabeldocCacheEntry `json:"entries"` // 按大小从大到小排列
+}
+
+// BabeldocCacheEntry 缓存目录下的一项（文件或子目录）
+type BabeldocCacheEntry struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+	Dir   bool   `json:"dir,omitempty"`
+}
+
+// BabeldocCacheClearRequest 清理缓存的请求体
+type BabeldocCacheClearRequest struct {
+	Entries []string `json:"entries,omitempty"` // 要删除的项，为空时清空整个目录
+}
+
+// BabeldocCacheRelocateRequest 移动缓存目录的请求体
+type BabeldocCacheRelocateRequest struct {
+	Path string `json:"path"` // 新位置的绝对路径，不存在或为空目录
+}
+
+func defaultBabeldocCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cache", "babeldoc")
+}
+
+// babeldocCacheTarget 返回缓存目录的实际位置（解析符号链接）
+func babeldocCacheTarget() string {
+	if target, err := filepath.EvalSymlinks(babeldocCacheDir); err == nil {
+		return target
+	}
+	return babeldocCacheDir
+}
+
+// collectBabeldocCacheUsage 统计缓存目录各项的大小，目录不存在时返回 nil
+func collectBabeldocCacheUsage() *BabeldocCacheUsage {
+	if babeldocCacheDir == "" {
+		return nil
+	}
+	target := babeldocCacheTarget()
+	entries, err := os.ReadDir(target)
+	if err != nil {
+		return nil
+	}
+	usage := &BabeldocCacheUsage{Path: babeldocCacheDir, Entries: []BabeldocCacheEntry{}}
+	if target != babeldocCacheDir {
+		usage.Target = target
+	}
+	for _, entry := range entries {
+		item := BabeldocCacheEntry{Name: entry.Name(), Dir: entry.IsDir()}
+		if entry.IsDir() {
+			item.Bytes = dirSize(filepath.Join(target, entry.Name()))
+		} else {
+			item.Bytes = fileSize(filepath.Join(target, entry.Name()))
+		}
+		usage.Total += item.Bytes
+		usage.Entries = append(usage.Entries, item)
+	}
+	sort.SliceStable(usage.Entries, func(i, j int) bool { return usage.Entries[i].Bytes > usage.Entries[j].Bytes })
+	return usage
+}
+
+// lockBabeldocCache 取得缓存目录的操作锁，另一个清理或移动正在进行时写出 409 并返回 false
+func lockBabeldocCache(w http.ResponseWriter) bool {
+	if !babeldocCacheLock.TryLock() {
+		writeError(w, http.StatusConflict, codeBabeldocCacheBusy, "another babeldoc cache operation is in progress")
+		return false
+	}
+	return true
+}
+
+// babeldocCacheTrashPath 返回 path 旁边用于暂放待删除内容的路径（同一目录下，重命名不会跨文件系统）
+func babeldocCacheTrashPath(path string) string {
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.deleting-%d", filepath.Base(path), time.Now().UnixNano()))
+}
+
+// removeBabeldocCacheEntry 删除缓存目录中的一项：先重命名到一旁，之后启动的 babeldoc 看不到它，
+// 执行中的 babeldoc 已打开的文件在删除后仍然可用
+func removeBabeldocCacheEntry(path string) error {
+	trash := babeldocCacheTrashPath(path)
+	if err := os.Rename(path, trash); err != nil {
+		return err
+	}
+	return os.RemoveAll(trash)
+}
+
+// 清理 babeldoc 的缓存：删除指定的项，未指定时清空整个目录（目录本身保留）
+func clearBabeldocCacheHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// 请求体可以省略
+	var req BabeldocCacheClearRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && err != io.EOF {
+		writeAPIError(w, invalidJSONError(err))
+		return
+	}
+	if !lockBabeldocCache(w) {
+		return
+	}
+	defer babeldocCacheLock.Unlock()
+
+	before := collectBabeldocCacheUsage()
+	if before == nil {
+		writeError(w, http.StatusNotFound, codeNotFound, "babeldoc cache directory not found: "+babeldocCacheDir)
+		return
+	}
+	sizes := make(map[string]int64, len(before.Entries))
+	for _, entry := range before.Entries {
+		sizes[entry.Name] = entry.Bytes
+	}
+	names := req.Entries
+	if len(names) == 0 {
+		for _, entry := range before.Entries {
+			names = append(names, entry.Name)
+		}
+	}
+	for _, name := range names {
+		if _, ok := sizes[name]; !ok || name != filepath.Base(name) {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "no such entry in babeldoc cache: "+name)
+			return
+		}
+	}
+
+	target := babeldocCacheTarget()
+	removed := []string{}
+	var freed int64
+	for _, name := range names {
+		if err := removeBabeldocCacheEntry(filepath.Join(target, name)); err != nil {
+			log.Printf("无法删除 babeldoc 缓存 %s: %v", name, err)
+			continue
+		}
+		removed = append(removed, name)
+		freed += sizes[name]
+	}
+	log.Printf("已清理 babeldoc 缓存 %s，释放 %d 字节", strings.Join(removed, ", "), freed)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"removed": removed,
+		"freed":   freed,
+		"cache":   collectBabeldocCacheUsage(),
+	})
+}
+
+// 移动 babeldoc 的缓存目录到 path，原位置替换为指向新位置的符号链接
+func relocateBabeldocCacheHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req BabeldocCacheRelocateRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeAPIError(w, invalidJSONError(err))
+		return
+	}
+	dst := filepath.Clean(req.Path)
+	if !filepath.IsAbs(req.Path) {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "path must be absolute")
+		return
+	}
+	if babeldocCacheDir == "" {
+		writeError(w, http.StatusNotFound, codeNotFound, "babeldoc cache directory is unknown, set BABELDOC_CACHE_DIR")
+		return
+	}
+	if !lockBabeldocCache(w) {
+		return
+	}
+	defer babeldocCacheLock.Unlock()
+
+	src := babeldocCacheTarget()
+	if dst == src {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "the cache is already at "+dst)
+		return
+	}
+	if pathWithin(dst, src) || pathWithin(dst, babeldocCacheDir) {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "path must not be inside the current cache directory")
+		return
+	}
+	if entries, err := os.ReadDir(dst); err == nil && len(entries) > 0 {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "path already exists and is not empty")
+		return
+	} else if err != nil && !os.IsNotExist(err) {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	if err := moveBabeldocCache(src, dst); err != nil {
+		log.Printf("无法移动 babeldoc 缓存目录到 %s: %v", dst, err)
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	log.Printf("babeldoc 缓存目录已移动到 %s，%s 为指向它的符号链接", dst, babeldocCacheDir)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"cache":   collectBabeldocCacheUsage(),
+	})
+}
+
+// moveBabeldocCache 把 src 的内容移动到 dst，然后把 babeldocCacheDir 替换为指向 dst 的符号链接。
+// 同一文件系统内直接重命名（执行中的 babeldoc 已打开的文件随之移动），否则复制后删除原目录；src 不存在时只创建 dst 和链接
+func moveBabeldocCache(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	os.Remove(dst) // 空目录
+	copied := false
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+	} else if err := os.Rename(src, dst); err != nil {
+		if !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+		if err := copyTree(src, dst); err != nil {
+			os.RemoveAll(dst)
+			return fmt.Errorf("复制缓存目录失败: %w", err)
+		}
+		copied = true
+	}
+
+	stale, err := linkBabeldocCache(dst)
+	if err != nil {
+		return err
+	}
+	switch {
+	case stale != "":
+		// 原位置是复制过的目录，已被重命名到一旁
+		return os.RemoveAll(stale)
+	case copied:
+		// 原位置是之前移动时留下的符号链接，src 是它原来指向的目录
+		return os.RemoveAll(src)
+	}
+	return nil
+}
+
+// linkBabeldocCache 把 babeldocCacheDir 原子地替换为指向 dst 的符号链接。
+// 原位置仍是目录（第一次跨文件系统移动）时先把它重命名到一旁，返回其路径，由调用方删除
+func linkBabeldocCache(dst string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(babeldocCacheDir), 0755); err != nil {
+		return "", err
+	}
+	link := babeldocCacheTrashPath(babeldocCacheDir) + ".link"
+	if err := os.Symlink(dst, link); err != nil {
+		return "", err
+	}
+	stale := ""
+	if info, err := os.Lstat(babeldocCacheDir); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		stale = babeldocCacheTrashPath(babeldocCacheDir)
+		if err := os.Rename(babeldocCacheDir, stale); err != nil {
+			os.Remove(link)
+			return "", err
+		}
+	}
+	// 重命名会替换原来的符号链接，期间启动的 babeldoc 不会看到缺失的目录
+	if err := os.Rename(link, babeldocCacheDir); err != nil {
+		os.Remove(link)
+		if stale != "" {
+			os.Rename(stale, babeldocCacheDir)
+		}
+		return "", fmt.Errorf("无法把 %s 替换为符号链接: %w", babeldocCacheDir, err)
+	}
+	return stale, nil
+}
+
+// copyTree 复制目录树，保留文件权限和符号链接
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			if err := copyFileAtomic(path, target); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 备份与恢复：把数据库、上传文件、输出文件、任务日志、附加字体和加密分享包打包为一个 tar.gz，便于迁移到其他主机。
+//
+//	GET /api/v1/admin/backup              以流式响应下载备份
+//	babeldoc-web backup [-o 文件]          命令行备份（默认写入当前目录的 babeldoc-backup-<时间>.tar.gz，- 为标准输出）
+//	babeldoc-web restore [-force] 文件     恢复到当前配置的数据目录（见 datadirs.go），需要先停止服务
+//
+// 压缩包中数据库为 tasks.db，目录为 uploads/、outputs/、logs/、fonts/（FONTS_DIR，见 fonts.go）和 bundles/（见 bundles.go），
+// 另有记录格式版本的 manifest.json。DATA_DIR 下的 previews/ 和 text/ 是页面预览和纯文本版本的缓存，需要时重新生成，
+// babeldoc 的缓存目录（BABELDOC_CACHE_DIR）同样可以重新生成，都不包含在备份中。
+// 数据库的一致快照由数据库后端生成（SQLite 用 VACUUM INTO，PostgreSQL 和 MySQL 在只读事务中复制各表，见 store.go），
+// 格式都是 SQLite 文件，服务运行中也能备份；文件按目录逐个写入，备份期间新写入的文件不一定包含在内。
+// 恢复时各部分写入新主机配置的数据库（DATABASE_URL 或 DB_PATH）和 UPLOAD_DIR、OUTPUT_DIR、LOGS_DIR、FONTS_DIR 等目录，两台主机的目录布局和数据库类型都可以不同。
+// 启用对象存储或冷存储时，只在对象存储或冷存储中的文件不包含在备份中。
+const (
+	backupArg  = "backup"
+	restoreArg = "restore"
+
+	// backupFormatVersion 压缩包格式的版本，恢复时拒绝更新的版本
+	backupFormatVersion = 1
+
+	backupDatabaseName = "tasks.db"
+	backupManifestName = "manifest.json"
+)
+
+// backupLock 同一时间只进行一次备份
+var backupLock sync.Mutex
+
+// backupManifest 压缩包中的 manifest.json
+type backupManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Sections  []string  `json:"sections"`
+}
+
+// backupSection 压缩包中的一个目录及其在本机的位置
+type backupSection struct {
+	name string
+	dir  string
+}
+
+func backupSections() []backupSection {
+	return []backupSection{
+		{"uploads", uploadDir},
+		{"outputs", outputDir},
+		{"logs", logsDir},
+		{"fonts", fontsDir},
+		{"bundles", bundlesDir},
+	}
+}
+
+// backupHandler 下载备份
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	if !backupLock.TryLock() {
+		writeError(w, http.StatusConflict, codeBackupInProgress, "another backup is in progress")
+		return
+	}
+	defer backupLock.Unlock()
+
+	// 先复制数据库，失败时还能返回错误状态码
+	snapshot, err := snapshotDatabase(db)
+	if err != nil {
+		log.Printf("备份时无法复制数据库: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error copying database: "+err.Error())
+		return
+	}
+	defer os.Remove(snapshot)
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+backupFileName())
+	if err := writeBackupArchive(w, snapshot); err != nil {
+		// 响应已经开始，无法再返回错误状态码
+		log.Printf("备份失败: %v", err)
+		return
+	}
+	log.Printf("已生成备份")
+}
+
+func backupFileName() string {
+	return fmt.Sprintf("babeldoc-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+}
+
+// snapshotDatabase 把数据库的快照写入 DB_PATH 所在目录下的临时 SQLite 文件，返回其路径
+func snapshotDatabase(database *sql.DB) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(dbPath), ".backup-*.db")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	// VACUUM INTO 要求目标文件不存在
+	os.Remove(f.Name())
+	if err := dbStore.Snapshot(database, f.Name()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// writeBackupArchive 把数据库快照和各数据目录写成 tar.gz
+func writeBackupArchive(w io.Writer, snapshot string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest := backupManifest{Version: backupFormatVersion, CreatedAt: time.Now()}
+	for _, section := range backupSections() {
+		manifest.Sections = append(manifest.Sections, section.name)
+	}
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := tw.WriteHeader(&tar.Header{Name: backupManifestName, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	if err := addFileToTar(tw, snapshot, backupDatabaseName); err != nil {
+		return fmt.Errorf("数据库: %w", err)
+	}
+	for _, section := range backupSections() {
+		err := filepath.WalkDir(section.dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				// 遍历期间被删除的文件或目录
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !entry.Type().IsRegular() || isBackupTempFile(entry.Name()) {
+				return nil
+			}
+			rel, err := filepath.Rel(section.dir, path)
+			if err != nil {
+				return err
+			}
+			return addFileToTar(tw, path, section.name+"/"+filepath.ToSlash(rel))
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", section.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// isBackupTempFile 是否为写入中的临时文件（上传、原子写入、可写检查），不需要备份
+func isBackupTempFile(name string) bool {
+	for _, prefix := range []string{".upload-", ".tmp-", ".write-check-", ".backup-"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addFileToTar 写入一个文件；文件在此期间被删除时跳过，继续增长的文件（如执行中任务的日志）只写入开始时的长度
+func addFileToTar(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
+
+// runBackupCommand backup 和 restore 命令的入口，返回进程退出码
+func runBackupCommand(command string, args []string) int {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	output := flags.String("o", "", "备份文件路径，- 为标准输出（默认 ./babeldoc-backup-<时间>.tar.gz）")
+	force := flags.Bool("force", false, "数据库已存在时仍然恢复（覆盖数据库和同名文件）")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if command == restoreArg {
+		if flags.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "用法: babeldoc-web restore [-force] <备份文件>")
+			return 2
+		}
+		if err := restoreBackup(flags.Arg(0), *force); err != nil {
+			fmt.Fprintf(os.Stderr, "恢复失败: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "已恢复到 %s\n", dataDir)
+		return 0
+	}
+
+	database, err := openDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法打开数据库: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+	snapshot, err := snapshotDatabase(database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法复制数据库 %s: %v\n", dbPath, err)
+		return 1
+	}
+	defer os.Remove(snapshot)
+
+	target := *output
+	if target == "" {
+		target = backupFileName()
+	}
+	var w io.Writer = os.Stdout
+	if target != "-" {
+		f, err := os.Create(target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "无法创建 %s: %v\n", target, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeBackupArchive(w, snapshot); err != nil {
+		fmt.Fprintf(os.Stderr, "备份失败: %v\n", err)
+		if target != "-" {
+			os.Remove(target)
+		}
+		return 1
+	}
+	if target != "-" {
+		fmt.Fprintf(os.Stderr, "已备份到 %s\n", target)
+	}
+	return 0
+}
+
+// restoreBackup 把备份恢复到当前配置的数据目录
+func restoreBackup(archive string, force bool) error {
+	if err := prepareDataDirs(); err != nil {
+		return err
+	}
+	store, err := newStore()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dbPath); err == nil && !force && isSQLite(store) {
+		return fmt.Errorf("数据库 %s 已存在，确认要覆盖时使用 -force", dbPath)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("不是有效的备份文件: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	sections := make(map[string]string)
+	for _, section := range backupSections() {
+		sections[section.name] = section.dir
+	}
+	restoredDB := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("不是有效的备份文件: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(header.Name)
+
+		switch {
+		case name == backupManifestName:
+			var manifest backupManifest
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return fmt.Errorf("无法读取 %s: %w", backupManifestName, err)
+			}
+			if manifest.Version > backupFormatVersion {
+				return fmt.Errorf("备份格式版本 %d 高于当前支持的版本 %d，请升级后再恢复", manifest.Version, backupFormatVersion)
+			}
+		case name == backupDatabaseName:
+			// 数据库在文件之前恢复，PostgreSQL 和 MySQL 中已有任务且没有 -force 时不会写入任何文件
+			if err := restoreDatabase(store, tr, force); err != nil {
+				return fmt.Errorf("数据库: %w", err)
+			}
+			restoredDB = true
+		default:
+			section, rel, _ := strings.Cut(name, "/")
+			dir, ok := sections[section]
+			if !ok || rel == "" {
+				continue
+			}
+			target := filepath.Join(dir, filepath.FromSlash(rel))
+			if !pathWithin(target, dir) {
+				return fmt.Errorf("备份中的路径无效: %s", header.Name)
+			}
+			if err := writeFileAtomic(target, tr); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			os.Chmod(target, header.FileInfo().Mode().Perm())
+			os.Chtimes(target, header.ModTime, header.ModTime)
+		}
+	}
+	if !restoredDB {
+		return fmt.Errorf("备份中没有数据库 %s", backupDatabaseName)
+	}
+	return nil
+}
+
+// restoreDatabase 把备份中的 SQLite 快照写入临时文件，再由数据库后端替换当前数据库的内容
+func restoreDatabase(store Store, r io.Reader, force bool) error {
+	f, err := os.CreateTemp(filepath.Dir(dbPath), ".backup-*.db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return store.Restore(f.Name(), force)
+}
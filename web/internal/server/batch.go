@@ -0,0 +1,269 @@
+package server
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const maxBatchDownloadTasks = 500
+
+// BatchDownloadRequest 批量下载请求
+type BatchDownloadRequest struct {
+	TaskIDs []string `json:"task_ids"`
+}
+
+// 批量下载多个任务的输出文件，按任务分目录打包为 zip 流式返回
+func batchDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	var req BatchDownloadRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidJSON, "Invalid request body")
+		return
+	}
+	if len(req.TaskIDs) == 0 {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "task_ids is required")
+		return
+	}
+	if len(req.TaskIDs) > maxBatchDownloadTasks {
+		writeError(w, http.StatusBadRequest, codeTooManyTasks, fmt.Sprintf("At most %d tasks per batch", maxBatchDownloadTasks))
+		return
+	}
+
+	// 先查出所有任务，确保开始写响应前能返回错误
+	var tasks []*Task
+	seen := make(map[string]bool)
+	for _, id := range req.TaskIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id))
+		if err == sql.ErrNoRows {
+			writeErrorDetails(w, http.StatusNotFound, codeTaskNotFound, "Task not found: "+id, map[string]interface{}{"task_id": id})
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Error loading task")
+			return
+		}
+		tasks = append(tasks, task)
+	}
+
+	// 有任务的文件已归档时全部取回后再打包
+	var archived []*Task
+	for _, task := range tasks {
+		if task.StorageTier != "" {
+			archived = append(archived, task)
+		}
+	}
+	if len(archived) > 0 {
+		writeRestoring(w, archived...)
+		return
+	}
+
+	archiveName := fmt.Sprintf("babeldoc-%s.zip", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", archiveName))
+
+	// zip 直接写入响应，逐个文件读取，不在内存中缓存整个压缩包
+	zw := zip.NewWriter(w)
+	for _, task := range tasks {
+		for _, file := range taskOutputFiles(task) {
+			if err := addFileToZip(zw, taskOutputPath(task, file), task.ID+"/"+strings.TrimPrefix(file, task.ID+"_")); err != nil {
+				// 响应已经开始，无法再返回错误状态码
+				log.Printf("批量下载时无法打包 %s: %v", file, err)
+				zw.Close()
+				return
+			}
+		}
+	}
+	zw.Close()
+}
+
+// taskOutputFiles 返回任务的全部输出文件名，兼容只记录了 output_file 的旧任务
+func taskOutputFiles(task *Task) []string {
+	if len(task.OutputFiles) > 0 {
+		return task.OutputFiles
+	}
+	if task.OutputFile != "" {
+		return []string{task.OutputFile}
+	}
+	return nil
+}
+
+func addFileToZip(zw *zip.Writer, path, name string) error {
+	ensureLocal(path)
+	f, info, err := openOutputFile(path)
+	if os.IsNotExist(err) {
+		// 文件可能已被清理，跳过
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, f)
+	return err
+}
+
+const maxBatchDeleteTasks = 1000
+
+// BatchDeleteRequest 批量删除请求，task_ids 与 filter 二选一；
+// filter 的键值与任务列表接口的筛选参数相同（q、status、lang_in、lang_out、external_id、created_after、created_before）
+type BatchDeleteRequest struct {
+	TaskIDs []string          `json:"task_ids,omitempty"`
+	Filter  map[string]string `json:"filter,omitempty"`
+}
+
+// BatchDeleteResult 单个任务的删除结果，status 为 deleted、not_found、skipped 或 error
+type BatchDeleteResult struct {
+	TaskID string `json:"task_id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// 批量删除任务的记录、输入、输出和日志文件，返回每个任务的结果；执行中的任务会被跳过
+func batchDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req BatchDeleteRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidJSON, "Invalid request body")
+		return
+	}
+	if (len(req.TaskIDs) == 0) == (len(req.Filter) == 0) {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "Exactly one of task_ids and filter is required")
+		return
+	}
+
+	taskIDs := req.TaskIDs
+	truncated := false
+	if len(req.Filter) > 0 {
+		values := url.Values{}
+		for key, value := range req.Filter {
+			if !batchDeleteFilters[key] {
+				writeError(w, http.StatusBadRequest, codeBadRequest, "Unsupported filter: "+key)
+				return
+			}
+			values.Set(key, value)
+		}
+		query, err := parseListQuery(values)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		if taskIDs, truncated, err = matchingTaskIDs(query); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+	} else if len(taskIDs) > maxBatchDeleteTasks {
+		writeError(w, http.StatusBadRequest, codeTooManyTasks, fmt.Sprintf("At most %d tasks per batch", maxBatchDeleteTasks))
+		return
+	}
+
+	results := make([]BatchDeleteResult, 0, len(taskIDs))
+	deleted := 0
+	seen := make(map[string]bool)
+	for _, id := range taskIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result := deleteTaskForBatch(id)
+		if result.Status == "deleted" {
+			deleted++
+		}
+		results = append(results, result)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"deleted":   deleted,
+		"results":   results,
+		"truncated": truncated,
+	})
+}
+
+// batchDeleteFilters 批量删除支持的筛选条件
+var batchDeleteFilters = map[string]bool{
+	"q":              true,
+	"status":         true,
+	"lang_in":        true,
+	"lang_out":       true,
+	"external_id":    true,
+	"created_after":  true,
+	"created_before": true,
+}
+
+// matchingTaskIDs 返回符合筛选条件的任务ID（最多 maxBatchDeleteTasks 个），以及是否还有更多
+func matchingTaskIDs(query *listQuery) ([]string, bool, error) {
+	sqlQuery := `SELECT id FROM tasks`
+	if len(query.where) > 0 {
+		sqlQuery += ` WHERE ` + strings.Join(query.where, " AND ")
+	}
+	sqlQuery += ` ORDER BY created_at ASC LIMIT ?`
+	rows, err := db.Query(sqlQuery, append(append([]interface{}{}, query.args...), maxBatchDeleteTasks+1)...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, false, err
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) > maxBatchDeleteTasks {
+		return ids[:maxBatchDeleteTasks], true, rows.Err()
+	}
+	return ids, false, rows.Err()
+}
+
+func deleteTaskForBatch(taskID string) BatchDeleteResult {
+	var status string
+	var version int
+	err := db.QueryRow(`SELECT status, version FROM tasks WHERE id = ?`, taskID).Scan(&status, &version)
+	if err == sql.ErrNoRows {
+		return BatchDeleteResult{TaskID: taskID, Status: "not_found"}
+	}
+	if err != nil {
+		return BatchDeleteResult{TaskID: taskID, Status: "error", Error: err.Error()}
+	}
+	if status == "running" {
+		return BatchDeleteResult{TaskID: taskID, Status: "skipped", Error: "task is running"}
+	}
+	// 读取状态后任务被领取或修改时跳过
+	var conflict *versionConflictError
+	if err := deleteTask(taskID, version); err == sql.ErrNoRows {
+		return BatchDeleteResult{TaskID: taskID, Status: "not_found"}
+	} else if errors.As(err, &conflict) {
+		return BatchDeleteResult{TaskID: taskID, Status: "skipped", Error: "task was modified concurrently"}
+	} else if err != nil {
+		return BatchDeleteResult{TaskID: taskID, Status: "error", Error: err.Error()}
+	}
+	return BatchDeleteResult{TaskID: taskID, Status: "deleted"}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// BibTeX 导出：GET /api/v1/tasks/export.bib 为已成功的任务生成 BibTeX 条目，便于在 Zotero、JabRef 等文献管理工具中
+// 管理译文。条目信息优先取自引用信息（citation，见 citation.go），没有时使用任务备注（notes，见 pdfmetadata.go），
+// 再没有时以文件名作为标题。file 字段链接到译文 PDF 的本地路径（JabRef 格式，Zotero 也能识别）。
+//
+//	BIBTEX_FILE_ROOT  file 字段中替代 OUTPUT_DIR 的目录，例如输出目录在用户电脑上的挂载位置（默认 OUTPUT_DIR 的绝对路径）
+//
+// 输出文件压缩存储（OUTPUT_COMPRESSION）或已归档到冷存储的任务，本地文件不是可直接打开的 PDF，不输出 file 字段。
+var bibtexFileRoot = os.Getenv("BIBTEX_FILE_ROOT")
+
+// bibtexEntryTypes Crossref 作品类型对应的 BibTeX 条目类型，其他类型使用 misc
+var bibtexEntryTypes = map[string]string{
+	"journal-article":     "article",
+	"proceedings-article": "inproceedings",
+	"book":                "book",
+	"monograph":           "book",
+	"edited-book":         "book",
+	"book-chapter":        "incollection",
+	"book-section":        "incollection",
+	"dissertation":        "phdthesis",
+	"report":              "techreport",
+}
+
+var (
+	bibtexKeyPattern = regexp.MustCompile(`[^a-z0-9]+`)
+	// PDF 元数据中的多个作者常以分号、逗号或 and 分隔
+	noteAuthorSeparator = regexp.MustCompile(`\s*(;|,|\band\b|&)\s*`)
+)
+
+// exportBibTeXHandler 导出 BibTeX。ids 为逗号分隔的任务 ID，未指定时按与任务列表相同的筛选参数导出，只包含成功的任务
+func exportBibTeXHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	query.limit, query.offset, query.cursor = 0, 0, nil
+	if ids := strings.TrimSpace(r.URL.Query().Get("ids")); ids != "" {
+		var placeholders []string
+		for _, id := range strings.Split(ids, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				placeholders = append(placeholders, "?")
+				query.args = append(query.args, id)
+			}
+		}
+		if len(placeholders) > maxBatchDownloadTasks {
+			writeError(w, http.StatusBadRequest, codeTooManyTasks, fmt.Sprintf("At most %d tasks per export", maxBatchDownloadTasks))
+			return
+		}
+		query.where = append(query.where, "id IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	query.where = append(query.where, "status = 'success'")
+
+	sqlQuery, args := query.sql()
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "application/x-bibtex; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=babeldoc-%s.bib", time.Now().Format("20060102-150405")))
+	buf := bufio.NewWriter(w)
+	keys := make(map[string]bool)
+	n := 0
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		if n > 0 {
+			buf.WriteString("\n")
+		}
+		writeBibTeXEntry(buf, task, keys)
+		n++
+		if n%exportFlushRows == 0 {
+			if err := buf.Flush(); err != nil {
+				// 客户端已断开
+				return
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		// 响应已经开始，无法再返回错误状态码
+		log.Printf("导出 BibTeX 时查询失败: %v", err)
+	}
+	buf.Flush()
+}
+
+// writeBibTeXEntry 写出任务的 BibTeX 条目，keys 记录已使用的引用键，重复时依次加上 a、b、c… 后缀
+func writeBibTeXEntry(buf *bufio.Writer, task *Task, keys map[string]bool) {
+	var fields [][2]string
+	add := func(name, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			fields = append(fields, [2]string{name, value})
+		}
+	}
+
+	entryType := "misc"
+	var authors []string
+	title, year := "", 0
+	if c := task.Citation; c != nil && c.ResolvedAt != nil {
+		if t, ok := bibtexEntryTypes[c.Type]; ok {
+			entryType = t
+		}
+		title, authors, year = c.Title, c.Authors, c.Year
+	}
+	if task.Notes != nil {
+		if title == "" {
+			title = task.Notes.Title
+		}
+		if len(authors) == 0 && task.Notes.Author != "" {
+			authors = splitNoteAuthors(task.Notes.Author)
+		}
+	}
+	if title == "" {
+		title = strings.TrimSuffix(task.Filename, filepath.Ext(task.Filename))
+	}
+
+	add("title", bibtexEscape(title))
+	add("author", bibtexEscape(strings.Join(authors, " and ")))
+	if c := task.Citation; c != nil {
+		switch entryType {
+		case "article":
+			add("journal", bibtexEscape(c.Venue))
+		case "inproceedings", "incollection":
+			add("booktitle", bibtexEscape(c.Venue))
+		}
+		if year > 0 {
+			add("year", strconv.Itoa(year))
+		}
+		add("volume", bibtexEscape(c.Volume))
+		add("number", bibtexEscape(c.Issue))
+		add("pages", bibtexEscape(strings.ReplaceAll(c.Pages, "-", "--")))
+		add("publisher", bibtexEscape(c.Publisher))
+		add("doi", c.DOI)
+		add("url", c.URL)
+	}
+	if task.Notes != nil {
+		add("abstract", bibtexEscape(task.Notes.Subject))
+	}
+	add("language", task.LangOut)
+	add("note", bibtexEscape(fmt.Sprintf("Translated from %s to %s by BabelDOC (task %s)", task.LangIn, task.LangOut, task.ID)))
+	add("file", bibtexFileField(task))
+
+	key := bibtexKey(task, authors, year, title)
+	unique := key
+	for suffix := 'a'; keys[unique]; suffix++ {
+		unique = key + string(suffix)
+	}
+	keys[unique] = true
+
+	fmt.Fprintf(buf, "@%s{%s,\n", entryType, unique)
+	for i, field := range fields {
+		fmt.Fprintf(buf, "  %s = {%s}", field[0], field[1])
+		if i < len(fields)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+}
+
+// bibtexKey 生成「第一作者姓氏 + 年份 + 标题首词」形式的引用键，无法生成时使用任务 ID
+func bibtexKey(task *Task, authors []string, year int, title string) string {
+	var parts []string
+	if len(authors) > 0 {
+		if words := strings.Fields(authors[0]); len(words) > 0 {
+			parts = append(parts, words[len(words)-1])
+		}
+	}
+	if year > 0 {
+		parts = append(parts, strconv.Itoa(year))
+	}
+	for _, word := range strings.Fields(title) {
+		if word = bibtexKeyPattern.ReplaceAllString(strings.ToLower(word), ""); len(word) > 3 {
+			parts = append(parts, word)
+			break
+		}
+	}
+	key := bibtexKeyPattern.ReplaceAllString(strings.ToLower(strings.Join(parts, "")), "")
+	if key == "" || unicode.IsDigit(rune(key[0])) {
+		return "babeldoc" + bibtexKeyPattern.ReplaceAllString(task.ID, "")
+	}
+	return key
+}
+
+// splitNoteAuthors 拆分备注中的作者
+func splitNoteAuthors(value string) []string {
+	var authors []string
+	for _, name := range noteAuthorSeparator.Split(value, -1) {
+		if name = strings.TrimSpace(name); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	return authors
+}
+
+// bibtexFileField 返回 JabRef 格式的 file 字段（:路径:PDF，多个文件以分号分隔），本地文件不可直接打开时返回空字符串
+func bibtexFileField(task *Task) string {
+	if outputCompression != nil || task.StorageTier != "" {
+		return ""
+	}
+	root := bibtexFileRoot
+	if root == "" {
+		root, _ = filepath.Abs(outputDir)
+	}
+	var links []string
+	for _, file := range taskOutputFiles(task) {
+		path := filepath.Join(root, task.OutputDir, file)
+		// JabRef 格式中冒号、分号和反斜杠需要转义
+		path = strings.NewReplacer(`\`, `\\`, ":", `\:`, ";", `\;`).Replace(path)
+		links = append(links, ":"+path+":PDF")
+	}
+	return strings.Join(links, ";")
+}
+
+// bibtexEscape 转义 LaTeX 特殊字符，非 ASCII 字符原样保留（biblatex 和主流文献管理工具都支持 UTF-8）
+var bibtexEscape = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"{", `\{`,
+	"}", `\}`,
+	"&", `\&`,
+	"%", `\%`,
+	"$", `\$`,
+	"#", `\#`,
+	"_", `\_`,
+	"~", `\textasciitilde{}`,
+	"^", `\textasciicircum{}`,
+).Replace
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// 按内容寻址的输入文件：提交时计算上传文件的 SHA-256，文件以 uploads/blobs/<前两位>/<sha256>.pdf 保存，
+// 任务记录 input_sha256。再次上传相同内容的文件时引用已有的文件，不再保存副本。
+// upload_blobs 表记录每个文件被多少个任务引用：删除任务（或按个人策略删除源文件）时减少引用，没有任务引用时删除文件。
+// 此前提交的任务没有 input_sha256，仍使用 uploads/<时间戳>_<文件名>。
+var blobsMutex sync.Mutex
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func createBlobsTable() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS upload_blobs (
+		sha256 ` + t.Key + ` PRIMARY KEY,
+		size ` + t.Integer + ` NOT NULL,
+		refs ` + t.Integer + ` NOT NULL,
+		created_at ` + t.Time + ` NOT NULL
+	)`)
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+}
+
+// blobPath 返回内容为 sum 的输入文件的路径
+func blobPath(sum string) string {
+	return filepath.Join(uploadDir, "blobs", sum[:2], sum+".pdf")
+}
+
+// storeInputBlob 把刚保存的输入文件 path 转为内容寻址的文件并增加一次引用，返回文件路径；
+// 已有相同内容的文件时删除 path。成功后 path 不再存在
+func storeInputBlob(path, sum string) (string, error) {
+	if !sha256Pattern.MatchString(sum) {
+		return "", fmt.Errorf("无效的 SHA-256: %q", sum)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	dst := blobPath(sum)
+
+	blobsMutex.Lock()
+	defer blobsMutex.Unlock()
+
+	var refs int
+	err = db.QueryRow(`SELECT refs FROM upload_blobs WHERE sha256 = ?`, sum).Scan(&refs)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	existing := err == nil && refs > 0
+
+	// 已有文件时只有本地副本和对象存储都不可用才重新写入（内容相同，覆盖无妨）
+	if existing && ensureLocal(dst) == nil {
+		if _, err := os.Stat(dst); err == nil {
+			os.Remove(path)
+			if _, err := execWithRetry(`UPDATE upload_blobs SET refs = refs + 1 WHERE sha256 = ?`, sum); err != nil {
+				return "", err
+			}
+			return dst, nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(path, dst); err != nil {
+		return "", err
+	}
+	if err := persistFile(dst); err != nil {
+		if !existing {
+			os.Remove(dst)
+		}
+		return "", err
+	}
+	_, err = execWithRetry(`INSERT INTO upload_blobs (sha256, size, refs, created_at) VALUES (?, ?, 1, ?)
+		`+dbStore.Upsert("sha256")+` refs = CASE WHEN upload_blobs.refs > 0 THEN upload_blobs.refs + 1 ELSE 1 END`, sum, info.Size(), time.Now())
+	if err != nil && !existing {
+		os.Remove(dst)
+		removeStoredFile(dst)
+	}
+	return dst, err
+}
+
+// releaseInputBlob 减少一次引用，没有任务引用时删除文件
+func releaseInputBlob(sum string) {
+	if !sha256Pattern.MatchString(sum) {
+		return
+	}
+	blobsMutex.Lock()
+	defer blobsMutex.Unlock()
+
+	if _, err := execWithRetry(`UPDATE upload_blobs SET refs = refs - 1 WHERE sha256 = ? AND refs > 0`, sum); err != nil {
+		log.Printf("无法更新输入文件 %s 的引用数: %v", sum, err)
+		return
+	}
+	var refs int
+	if err := db.QueryRow(`SELECT refs FROM upload_blobs WHERE sha256 = ?`, sum).Scan(&refs); err != nil || refs > 0 {
+		return
+	}
+	path := blobPath(sum)
+	removeStoredFile(path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("无法删除输入文件 %s: %v", path, err)
+		return
+	}
+	os.Remove(filepath.Dir(path))
+	execWithRetry(`DELETE FROM upload_blobs WHERE sha256 = ? AND refs <= 0`, sum)
+}
+
+// stageTaskInput 返回传给 babeldoc 的输入文件路径。babeldoc 以输入文件名命名输出文件，
+// 按内容保存的文件以原来的文件名链接（跨文件系统时复制）到任务的临时目录 dir 下，随临时目录一起删除
+func stageTaskInput(task *Task, dir string) (string, error) {
+	path := taskInputPath(task)
+	if task.InputSHA256 == "" {
+		return path, nil
+	}
+	staged := filepath.Join(dir, "input", inputFileName(task))
+	if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
+		return "", err
+	}
+	os.Remove(staged)
+	if err := os.Link(path, staged); err != nil {
+		if err := copyFileAtomic(path, staged); err != nil {
+			return "", err
+		}
+	}
+	return staged, nil
+}
+
+// removeTaskInput 删除任务的输入文件：内容寻址的文件减少一次引用（其他任务仍引用时保留文件），旧任务的文件直接删除
+func removeTaskInput(task *Task) error {
+	now := time.Now()
+	if task.InputSHA256 != "" {
+		releaseInputBlob(task.InputSHA256)
+		// 清除引用，之后任务按原路径查找输入文件（已不存在），也不会重复减少引用
+		execWithRetry(`UPDATE tasks SET input_sha256 = NULL, input_removed_at = ? WHERE id = ?`, now, task.ID)
+		task.InputSHA256 = ""
+		task.InputRemovedAt = &now
+		return nil
+	}
+	path := taskInputPath(task)
+	removeStoredFile(path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	execWithRetry(`UPDATE tasks SET input_removed_at = ? WHERE id = ?`, now, task.ID)
+	task.InputRemovedAt = &now
+	return nil
+}
@@ -0,0 +1,425 @@
+package server
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 加密分享包：把任务选定的输出文件（可选包括上传的原文件）打包为 AES-256 加密的 zip（WinZip AES，见 zipaes.go），
+// 用于只允许传递加密附件的渠道。分享包在服务端生成，作为任务的派生文件保存在 DATA_DIR/bundles/<任务 ID>/ 下，
+// 记录在 task_bundles 表中，任务删除时一并删除；启用对象存储时同样上传一份副本。
+//
+// 未指定密码时生成随机密码，只在创建时返回一次，服务端不保存密码。
+// 设置 max_part_size 时按文件拆分为多个分卷，每个分卷都是可以单独解压的加密 zip（单个文件超过上限时独占一个分卷）。
+const (
+	maxTaskBundles        = 10
+	minBundlePasswordLen  = 8
+	minBundlePartSize     = 1 << 20
+	generatedPasswordSize = 15 // 随机字节数，编码后为 24 个字符
+)
+
+var bundlesDir = filepath.Join(dataDir, "bundles")
+
+// BundleRequest 生成加密分享包的请求体，所有字段可选
+type BundleRequest struct {
+	Files        []string `json:"files,omitempty"`         // 要打包的输出文件名，未设置时打包全部输出文件
+	IncludeInput bool     `json:"include_input,omitempty"` // 同时打包上传的原文件
+	Password     string   `json:"password,omitempty"`      // 解压密码，至少 8 个字符；未设置时随机生成
+	MaxPartSize  int64    `json:"max_part_size,omitempty"` // 每个分卷的大小上限（字节，按原文件大小估算），0 表示不拆分
+}
+
+// BundlePart 分享包的一个分卷
+type BundlePart struct {
+	Name  string   `json:"name"`
+	Size  int64    `json:"size"`
+	Files []string `json:"files"`
+	URL   string   `json:"url"`
+}
+
+// TaskBundle 任务的一个加密分享包
+type TaskBundle struct {
+	ID           string       `json:"id"`
+	Files        []string     `json:"files"`
+	IncludeInput bool         `json:"include_input"`
+	Parts        []BundlePart `json:"parts"`
+	Size         int64        `json:"size"`
+	CreatedAt    time.Time    `json:"created_at"`
+	Password     string       `json:"password,omitempty"` // 随机生成的密码，只在创建时返回
+}
+
+func createBundlesTable() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS task_bundles (
+		id ` + t.Key + ` PRIMARY KEY,
+		task_id ` + t.Key + ` NOT NULL,
+		files ` + t.Text + ` NOT NULL,
+		include_input ` + t.Integer + ` NOT NULL DEFAULT 0,
+		parts ` + t.Text + ` NOT NULL,
+		size ` + t.Integer + ` NOT NULL DEFAULT 0,
+		created_at ` + t.Time + ` NOT NULL
+	)`)
+	if err == nil {
+		err = dbStore.CreateIndex("idx_task_bundles_task", "task_bundles", "task_id", "", false)
+	}
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+}
+
+// 生成加密分享包
+func createBundleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	var req BundleRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil && err != io.EOF {
+		writeAPIError(w, invalidJSONError(err))
+		return
+	}
+	if req.Password != "" && utf8.RuneCountInString(req.Password) < minBundlePasswordLen {
+		writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("password must be at least %d characters", minBundlePasswordLen))
+		return
+	}
+	if req.MaxPartSize != 0 && req.MaxPartSize < minBundlePartSize {
+		writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("max_part_size must be at least %d bytes", minBundlePartSize))
+		return
+	}
+
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, r.PathValue("id")))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	outputs := taskOutputFiles(task)
+	if task.Status != "success" || len(outputs) == 0 {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "Task has no output files")
+		return
+	}
+	files := outputs
+	if len(req.Files) > 0 {
+		files = nil
+		for _, file := range req.Files {
+			found := false
+			for _, f := range outputs {
+				found = found || f == file
+			}
+			if !found {
+				writeErrorDetails(w, http.StatusNotFound, codeFileNotFound, "File not found: "+file, map[string]interface{}{"file": file})
+				return
+			}
+			files = append(files, file)
+		}
+	}
+	// 已归档的输出文件先取回
+	if task.StorageTier != "" {
+		writeRestoring(w, task)
+		return
+	}
+
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM task_bundles WHERE task_id = ?`, task.ID).Scan(&count)
+	if count >= maxTaskBundles {
+		writeError(w, http.StatusConflict, codeTooManyBundles, fmt.Sprintf("At most %d bundles per task, delete an existing bundle first", maxTaskBundles))
+		return
+	}
+
+	// 收集要打包的文件：zip 中的文件名去掉任务 ID 前缀
+	type bundleEntry struct{ path, name string }
+	var entries []bundleEntry
+	if req.IncludeInput {
+		path := taskInputPath(task)
+		ensureLocal(path)
+		if _, err := os.Stat(path); err != nil {
+			writeError(w, http.StatusGone, codeInputFileGone, "The task's input file has been removed")
+			return
+		}
+		entries = append(entries, bundleEntry{path, task.Filename})
+	}
+	for _, file := range files {
+		path := taskOutputPath(task, file)
+		ensureLocal(path)
+		if _, err := os.Stat(path); err != nil {
+			writeErrorDetails(w, http.StatusNotFound, codeFileNotFound, "File not found: "+file, map[string]interface{}{"file": file})
+			return
+		}
+		entries = append(entries, bundleEntry{path, strings.TrimPrefix(file, task.ID+"_")})
+	}
+
+	password := req.Password
+	generated := password == ""
+	if generated {
+		buf := make([]byte, generatedPasswordSize)
+		rand.Read(buf)
+		password = base32.StdEncoding.EncodeToString(buf)
+	}
+
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	bundle := &TaskBundle{
+		ID:           hex.EncodeToString(buf),
+		Files:        files,
+		IncludeInput: req.IncludeInput,
+		CreatedAt:    time.Now().Truncate(time.Second),
+	}
+	dir := filepath.Join(bundlesDir, task.ID, bundle.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	// 按原文件大小分组：加入下一个文件会超过上限时开始新的分卷
+	var groups [][]bundleEntry
+	var groupSize int64
+	for _, entry := range entries {
+		info, _ := statOutputFile(entry.path)
+		if len(groups) == 0 || (req.MaxPartSize > 0 && groupSize > 0 && groupSize+info.Size() > req.MaxPartSize) {
+			groups = append(groups, nil)
+			groupSize = 0
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], entry)
+		groupSize += info.Size()
+	}
+
+	for i, group := range groups {
+		name := task.ID + "-share.zip"
+		if len(groups) > 1 {
+			name = fmt.Sprintf("%s-share.part%d.zip", task.ID, i+1)
+		}
+		path := filepath.Join(dir, name)
+		part := BundlePart{Name: name}
+		for _, entry := range group {
+			part.Files = append(part.Files, entry.name)
+		}
+		part.Size, err = writeEncryptedZip(path, func(zw *zip.Writer) error {
+			for _, entry := range group {
+				if err := addEncryptedFileToZip(zw, entry.path, entry.name, password); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			err = persistFile(path)
+		}
+		if err != nil {
+			log.Printf("无法生成任务 %s 的分享包: %v", task.ID, err)
+			removeBundleFiles(task.ID, bundle)
+			writeError(w, http.StatusInternalServerError, codeInternal, "Error creating bundle: "+err.Error())
+			return
+		}
+		bundle.Parts = append(bundle.Parts, part)
+		bundle.Size += part.Size
+	}
+
+	filesJSON, _ := json.Marshal(bundle.Files)
+	partsJSON, _ := json.Marshal(bundle.Parts)
+	_, err = execWithRetry(`INSERT INTO task_bundles (id, task_id, files, include_input, parts, size, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		bundle.ID, task.ID, string(filesJSON), bundle.IncludeInput, string(partsJSON), bundle.Size, bundle.CreatedAt)
+	if err != nil {
+		removeBundleFiles(task.ID, bundle)
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error saving bundle: "+err.Error())
+		return
+	}
+	recordTaskEvent(task.ID, "bundle.created", fmt.Sprintf("已生成加密分享包 %s：%d 个文件，%d 个分卷", bundle.ID, len(entries), len(bundle.Parts)))
+
+	setBundleURLs(task.ID, bundle)
+	if generated {
+		bundle.Password = password
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(bundle)
+}
+
+// writeEncryptedZip 把 fill 写入的文件保存为 path，返回压缩包大小
+func writeEncryptedZip(path string, fill func(zw *zip.Writer) error) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	if err := fill(zw); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// 列出任务的加密分享包
+func listBundlesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	taskID := r.PathValue("id")
+	var exists int
+	if err := db.QueryRow(`SELECT 1 FROM tasks WHERE id = ?`, taskID).Scan(&exists); err != nil {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+	bundles, err := loadTaskBundles(taskID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	for _, bundle := range bundles {
+		setBundleURLs(taskID, bundle)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"bundles": bundles})
+}
+
+// 下载分享包的一个分卷，part 从 1 开始，默认为 1
+func downloadBundleHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := r.PathValue("id")
+	bundle, err := loadTaskBundle(taskID, r.PathValue("bundle"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeBundleNotFound, "Bundle not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	index := 1
+	if v := r.URL.Query().Get("part"); v != "" {
+		index, err = strconv.Atoi(v)
+		if err != nil || index < 1 || index > len(bundle.Parts) {
+			writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("part must be between 1 and %d", len(bundle.Parts)))
+			return
+		}
+	}
+	part := bundle.Parts[index-1]
+
+	path := filepath.Join(bundlesDir, taskID, bundle.ID, part.Name)
+	ensureLocal(path)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error opening file")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error opening file")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", part.Name))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, part.Name, info.ModTime(), f)
+}
+
+// 删除加密分享包
+func deleteBundleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	taskID := r.PathValue("id")
+	bundle, err := loadTaskBundle(taskID, r.PathValue("bundle"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeBundleNotFound, "Bundle not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	if _, err := execWithRetry(`DELETE FROM task_bundles WHERE id = ?`, bundle.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	removeBundleFiles(taskID, bundle)
+	recordTaskEvent(taskID, "bundle.deleted", "已删除加密分享包 "+bundle.ID)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+func loadTaskBundles(taskID string) ([]*TaskBundle, error) {
+	rows, err := db.Query(`SELECT id, files, include_input, parts, size, created_at FROM task_bundles WHERE task_id = ? ORDER BY created_at, id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bundles := []*TaskBundle{}
+	for rows.Next() {
+		bundle, err := scanTaskBundle(rows)
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, bundle)
+	}
+	return bundles, rows.Err()
+}
+
+func loadTaskBundle(taskID, bundleID string) (*TaskBundle, error) {
+	return scanTaskBundle(db.QueryRow(`SELECT id, files, include_input, parts, size, created_at FROM task_bundles WHERE task_id = ? AND id = ?`, taskID, bundleID))
+}
+
+func scanTaskBundle(row interface{ Scan(...interface{}) error }) (*TaskBundle, error) {
+	var bundle TaskBundle
+	var filesJSON, partsJSON string
+	if err := row.Scan(&bundle.ID, &filesJSON, &bundle.IncludeInput, &partsJSON, &bundle.Size, &bundle.CreatedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(filesJSON), &bundle.Files)
+	json.Unmarshal([]byte(partsJSON), &bundle.Parts)
+	return &bundle, nil
+}
+
+// setBundleURLs 填写各分卷的下载地址
+func setBundleURLs(taskID string, bundle *TaskBundle) {
+	for i := range bundle.Parts {
+		bundle.Parts[i].URL = fmt.Sprintf("%s/tasks/%s/bundles/%s/download?part=%d", apiVersionPrefix, taskID, bundle.ID, i+1)
+	}
+}
+
+// removeBundleFiles 删除分享包的本地文件和对象存储中的副本
+func removeBundleFiles(taskID string, bundle *TaskBundle) {
+	dir := filepath.Join(bundlesDir, taskID, bundle.ID)
+	for _, part := range bundle.Parts {
+		removeStoredFile(filepath.Join(dir, part.Name))
+	}
+	os.RemoveAll(dir)
+	os.Remove(filepath.Join(bundlesDir, taskID))
+}
+
+// deleteTaskBundles 删除任务的全部分享包
+func deleteTaskBundles(taskID string) {
+	bundles, err := loadTaskBundles(taskID)
+	if err != nil {
+		log.Printf("无法查询任务 %s 的分享包: %v", taskID, err)
+		return
+	}
+	for _, bundle := range bundles {
+		removeBundleFiles(taskID, bundle)
+	}
+	execWithRetry(`DELETE FROM task_bundles WHERE task_id = ?`, taskID)
+	os.RemoveAll(filepath.Join(bundlesDir, taskID))
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 任务结束回调：提交时设置 callback_url，任务成功或失败（不含将要重试的失败）后向该地址 POST CallbackEvent。
+//
+//	CALLBACK_SIGNING_SECRET  请求签名的 HMAC 密钥（默认使用 DOWNLOAD_SIGNING_SECRET，均未设置时不签名）
+//	CALLBACK_LINK_TTL        回调中下载链接的有效期（默认 168h）
+//	CALLBACK_MAX_ATTEMPTS    回调失败（网络错误或非 2xx 响应）时的最多尝试次数（默认 5）
+//
+// 签名放在 X-BabelDOC-Signature 头中，为 "sha256=" + HMAC-SHA256(密钥, X-BabelDOC-Timestamp + "." + 请求体) 的十六进制。
+var (
+	callbackSigningSecret = envOrDefault("CALLBACK_SIGNING_SECRET", os.Getenv("DOWNLOAD_SIGNING_SECRET"))
+	callbackLinkTTL       = parseDurationEnv("CALLBACK_LINK_TTL", 7*24*time.Hour)
+	callbackMaxAttempts   = max(parseIntEnv("CALLBACK_MAX_ATTEMPTS", 5), 1)
+)
+
+const (
+	callbackTimeout    = 10 * time.Second
+	callbackRetryDelay = 10 * time.Second
+)
+
+// CallbackEvent 任务结束回调的请求体
+type CallbackEvent struct {
+	Event       string         `json:"event"` // task.succeeded 或 task.failed
+	TaskID      string         `json:"task_id"`
+	ExternalID  string         `json:"external_id,omitempty"`
+	Status      string         `json:"status"`
+	Filename    string         `json:"filename"`
+	Error       string         `json:"error,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+	Files       []CallbackFile `json:"files,omitempty"`
+	DetailURL   string         `json:"detail_url"`
+}
+
+// CallbackFile 回调中的输出文件及其签名下载链接
+type CallbackFile struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// parseCallbackURL 校验提交时的 callback_url
+func parseCallbackURL(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value != "" && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+		return "", fmt.Errorf("callback_url must be an http(s) URL")
+	}
+	return value, nil
+}
+
+// sendTaskCallback 向任务的 callback_url 发送结束回调，失败时按指数退避重试
+func sendTaskCallback(task *Task) {
+	if task.CallbackURL == "" {
+		return
+	}
+
+	event := taskCallbackEvent(task)
+	body, _ := json.Marshal(event)
+
+	delay := callbackRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := postCallback(task.CallbackURL, event.Event, body)
+		if err == nil {
+			log.Printf("任务 %s 的结束回调已发送", task.ID)
+			return
+		}
+		if attempt >= callbackMaxAttempts {
+			log.Printf("任务 %s 的结束回调失败，已放弃: %v", task.ID, err)
+			return
+		}
+		log.Printf("任务 %s 的结束回调失败（第 %d 次），%s 后重试: %v", task.ID, attempt, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// taskCallbackEvent 构造任务结束回调的请求体
+func taskCallbackEvent(task *Task) *CallbackEvent {
+	event := &CallbackEvent{
+		Event:       "task.failed",
+		TaskID:      task.ID,
+		ExternalID:  task.ExternalID,
+		Status:      task.Status,
+		Filename:    task.Filename,
+		Error:       task.Error,
+		CreatedAt:   task.CreatedAt,
+		CompletedAt: task.CompletedAt,
+		DetailURL:   publicBaseURL() + apiVersionPrefix + "/tasks/" + task.ID,
+	}
+	if task.Status == "success" {
+		event.Event = "task.succeeded"
+		expiresAt := time.Now().Add(callbackLinkTTL)
+		for _, file := range task.OutputFiles {
+			event.Files = append(event.Files, CallbackFile{
+				Name:      file,
+				URL:       signedDownloadURL(task.ID, file, callbackLinkTTL),
+				ExpiresAt: expiresAt,
+			})
+		}
+	}
+	return event
+}
+
+func postCallback(url, event string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-BabelDOC-Event", event)
+	req.Header.Set("X-BabelDOC-Timestamp", timestamp)
+	if callbackSigningSecret != "" {
+		req.Header.Set("X-BabelDOC-Signature", "sha256="+callbackSignature(timestamp, body))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func callbackSignature(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(callbackSigningSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
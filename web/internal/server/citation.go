@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DOI 与引用信息：
+//
+//	DOI_LOOKUP       on 时提交后通过 Crossref 查询 DOI 对应的引用信息（默认 off）
+//	CROSSREF_API     Crossref API 地址（默认 https://api.crossref.org）
+//	CROSSREF_MAILTO  联系邮箱，随请求发送，Crossref 对带有邮箱的请求使用更稳定的服务池
+//
+// DOI 取自提交时的 doi 字段；未提供且启用了查询时在 PDF 的元数据中查找（文档信息字典、XMP 的 prism:doi / dc:identifier），
+// 有 pdftotext 时还会查找第一页的文本。查询在提交之后进行，不影响提交的响应时间；结果保存在任务的 citation 中，
+// 并补全任务备注中缺少的标题和作者（见 pdfmetadata.go）。未启用查询或查询失败时 citation 只包含 DOI。
+var (
+	doiLookupEnabled = envOrDefault("DOI_LOOKUP", "off") == "on"
+	crossrefAPI      = strings.TrimRight(envOrDefault("CROSSREF_API", "https://api.crossref.org"), "/")
+	crossrefMailto   = strings.TrimSpace(envOrDefault("CROSSREF_MAILTO", ""))
+)
+
+const crossrefTimeout = 15 * time.Second
+
+var (
+	// Crossref 推荐的 DOI 匹配规则
+	doiPattern = regexp.MustCompile(`(?i)\b10\.\d{4,9}/[-._;()/:a-z0-9]+[a-z0-9]`)
+	// 提交的 doi 字段可以是 DOI 本身、doi: 前缀或 doi.org 链接
+	doiPrefixPattern = regexp.MustCompile(`(?i)^(doi:\s*|https?://(dx\.)?doi\.org/)`)
+	xmpDOIPattern    = regexp.MustCompile(`(?is)<prism:doi>\s*([^<]+?)\s*</prism:doi>|<dc:identifier>.*?(10\.\d{4,9}/[^<\s]+)`)
+	crossrefClient   = &http.Client{Timeout: crossrefTimeout}
+)
+
+// Citation 任务所译论文的引用信息
+type Citation struct {
+	DOI        string     `json:"doi"`
+	Title      string     `json:"title,omitempty"`
+	Authors    []string   `json:"authors,omitempty"`
+	Venue      string     `json:"venue,omitempty"` // 期刊或会议名
+	Year       int        `json:"year,omitempty"`
+	Type       string     `json:"type,omitempty"` // Crossref 的作品类型，如 journal-article、proceedings-article
+	Publisher  string     `json:"publisher,omitempty"`
+	Volume     string     `json:"volume,omitempty"`
+	Issue      string     `json:"issue,omitempty"`
+	Pages      string     `json:"pages,omitempty"`
+	URL        string     `json:"url,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"` // 从 Crossref 查询到的时间，未查询或查询失败时为空
+}
+
+// normalizeDOI 规范化提交的 DOI，格式无效时返回错误
+func normalizeDOI(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	raw := doiPrefixPattern.ReplaceAllString(value, "")
+	if unescaped, err := url.PathUnescape(raw); err == nil {
+		raw = unescaped
+	}
+	doi := doiPattern.FindString(raw)
+	if doi == "" || doi != raw {
+		return "", fmt.Errorf("invalid doi: %s", value)
+	}
+	return strings.ToLower(doi), nil
+}
+
+// findPDFDOI 在 PDF 的元数据和第一页文本中查找 DOI，找不到时返回空字符串
+func findPDFDOI(path string) string {
+	chunks := readPDFChunks(path)
+	for _, chunk := range chunks {
+		if m := xmpDOIPattern.FindSubmatch(chunk); m != nil {
+			value := string(m[1])
+			if value == "" {
+				value = string(m[2])
+			}
+			if doi, err := normalizeDOI(html.UnescapeString(value)); err == nil && doi != "" {
+				return doi
+			}
+		}
+	}
+	if info := findPDFInfoDict(chunks); info != nil {
+		for _, key := range []string{"doi", "DOI", "Subject", "Keywords"} {
+			if doi := doiPattern.FindString(pdfDictString(info, key)); doi != "" {
+				return strings.ToLower(doi)
+			}
+		}
+	}
+	if _, err := exec.LookPath("pdftotext"); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), pdftotextTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "pdftotext", "-l", "1", "-enc", "UTF-8", "-q", path, "-").Output()
+		if err == nil {
+			if doi := doiPattern.Find(out); doi != nil {
+				return strings.ToLower(string(doi))
+			}
+		}
+	}
+	return ""
+}
+
+// resolveTaskCitation 查询 DOI 的引用信息并保存到任务上，在后台执行
+func resolveTaskCitation(taskID, doi string) {
+	citation, err := lookupCrossref(doi)
+	if err != nil {
+		log.Printf("无法查询任务 %s 的 DOI %s: %v", taskID, doi, err)
+		recordTaskEvent(taskID, "citation.failed", fmt.Sprintf("%s: %v", doi, err))
+		return
+	}
+	data, _ := json.Marshal(citation)
+	if _, err := execWithRetry(`UPDATE tasks SET citation = ? WHERE id = ?`, string(data), taskID); err != nil {
+		log.Printf("无法保存任务 %s 的引用信息: %v", taskID, err)
+		return
+	}
+
+	// 补全备注中缺少的标题和作者
+	var notesJSON *string
+	if err := db.QueryRow(`SELECT notes FROM tasks WHERE id = ?`, taskID).Scan(&notesJSON); err == nil {
+		notes := &TaskNotes{}
+		if notesJSON != nil {
+			json.Unmarshal([]byte(*notesJSON), notes)
+		}
+		changed := false
+		if notes.Title == "" && citation.Title != "" {
+			notes.Title, changed = citation.Title, true
+		}
+		if notes.Author == "" && len(citation.Authors) > 0 {
+			notes.Author, changed = strings.Join(citation.Authors, "; "), true
+		}
+		if changed {
+			notes.normalize()
+			execWithRetry(`UPDATE tasks SET notes = ? WHERE id = ?`, notesColumn(notes), taskID)
+		}
+	}
+	recordTaskEvent(taskID, "citation.resolved", fmt.Sprintf("%s: %s", doi, citation.Title))
+}
+
+// crossrefWork Crossref /works/{doi} 响应中用到的字段
+type crossrefWork struct {
+	Message struct {
+		DOI            string   `json:"DOI"`
+		Title          []string `json:"title"`
+		ContainerTitle []string `json:"container-title"`
+		Author         []struct {
+			Given  string `json:"given"`
+			Family string `json:"family"`
+			Name   string `json:"name"` // 机构作者
+		} `json:"author"`
+		Issued struct {
+			DateParts [][]int `json:"date-parts"`
+		} `json:"issued"`
+		Type      string `json:"type"`
+		Publisher string `json:"publisher"`
+		Volume    string `json:"volume"`
+		Issue     string `json:"issue"`
+		Page      string `json:"page"`
+		URL       string `json:"URL"`
+		Link      []struct {
+			URL         string `json:"URL"`
+			ContentType string `json:"content-type"`
+		} `json:"link"` // 出版商提供的全文链接（见 imports.go）
+	} `json:"message"`
+}
+
+// lookupCrossref 从 Crossref 查询 DOI 的引用信息
+func lookupCrossref(doi string) (*Citation, error) {
+	work, err := fetchCrossrefWork(doi)
+	if err != nil {
+		return nil, err
+	}
+
+	m := work.Message
+	now := time.Now()
+	citation := &Citation{
+		DOI:        doi,
+		Type:       m.Type,
+		Publisher:  m.Publisher,
+		Volume:     m.Volume,
+		Issue:      m.Issue,
+		Pages:      m.Page,
+		URL:        m.URL,
+		ResolvedAt: &now,
+	}
+	if m.DOI != "" {
+		citation.DOI = strings.ToLower(m.DOI)
+	}
+	if len(m.Title) > 0 {
+		citation.Title = cleanCrossrefText(m.Title[0])
+	}
+	if len(m.ContainerTitle) > 0 {
+		citation.Venue = cleanCrossrefText(m.ContainerTitle[0])
+	}
+	for _, author := range m.Author {
+		name := strings.TrimSpace(author.Given + " " + author.Family)
+		if name == "" {
+			name = strings.TrimSpace(author.Name)
+		}
+		if name != "" {
+			citation.Authors = append(citation.Authors, name)
+		}
+	}
+	if len(m.Issued.DateParts) > 0 && len(m.Issued.DateParts[0]) > 0 {
+		citation.Year = m.Issued.DateParts[0][0]
+	}
+	return citation, nil
+}
+
+// fetchCrossrefWork 请求 Crossref 的 /works/{doi}
+func fetchCrossrefWork(doi string) (*crossrefWork, error) {
+	endpoint := crossrefAPI + "/works/" + url.PathEscape(doi)
+	if crossrefMailto != "" {
+		endpoint += "?mailto=" + url.QueryEscape(crossrefMailto)
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := "babeldoc-web"
+	if crossrefMailto != "" {
+		userAgent += " (mailto:" + crossrefMailto + ")"
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := crossrefClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("Crossref 中没有该 DOI")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Crossref 返回 HTTP %d", resp.StatusCode)
+	}
+	var work crossrefWork
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&work); err != nil {
+		return nil, fmt.Errorf("无法解析 Crossref 的响应: %v", err)
+	}
+	return &work, nil
+}
+
+var markupTagPattern = regexp.MustCompile(`<[^>]+>`)
+
+// cleanCrossrefText 去掉 Crossref 标题中的 JATS 标记（如 <i>、<sub>）和多余的空白
+func cleanCrossrefText(value string) string {
+	value = html.UnescapeString(markupTagPattern.ReplaceAllString(value, ""))
+	return strings.Join(strings.Fields(value), " ")
+}
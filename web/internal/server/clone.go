@@ -0,0 +1,91 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// 以已有任务的输入文件和参数创建新任务，无需重新上传 PDF。请求体可选，为 TaskSubmission 格式的覆盖字段
+// （不能包含文件字段）；params 中值为 null 的参数会从新任务中移除。外部标识和计划时间不会复制。
+func cloneTaskHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var overrides TaskSubmission
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&overrides); err != nil && err != io.EOF {
+		writeAPIError(w, invalidJSONError(err))
+		return
+	}
+	if overrides.UploadID != "" || overrides.FileBase64 != "" || overrides.FileURL != "" || overrides.Filename != "" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "The input file of a cloned task cannot be replaced")
+		return
+	}
+	overrideForm, err := submissionForm(&overrides)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, r.PathValue("id")))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	ensureLocal(taskInputPath(task))
+	f, err := os.Open(taskInputPath(task))
+	if err != nil {
+		writeError(w, http.StatusGone, codeInputFileGone, "The input file of this task no longer exists")
+		return
+	}
+	defer f.Close()
+
+	form := cloneForm(task)
+	for key, values := range overrideForm {
+		form[key] = values
+	}
+	for key, value := range overrides.Params {
+		if value == nil {
+			form.Del(key)
+		}
+	}
+
+	createTask(w, &submissionInput{form: form, file: f, filename: task.Filename, userID: currentUserID(r), orgID: currentUserOrg(r), notes: task.Notes, citation: task.Citation})
+}
+
+// cloneForm 将任务的设置还原为提交表单字段
+func cloneForm(task *Task) url.Values {
+	form := url.Values{}
+	var params map[string]string
+	if task.Params != "" {
+		json.Unmarshal([]byte(task.Params), &params)
+	}
+	for key, value := range params {
+		form.Set(key, value)
+	}
+
+	form.Set("lang_in", task.LangIn)
+	form.Set("lang_out", task.LangOut)
+	form.Set("pages", task.Pages)
+	form.Set("notify_email", task.NotifyEmail)
+	form.Set("tags", strings.Join(task.Tags, ","))
+	form.Set("callback_url", task.CallbackURL)
+	// 早期的任务只记录了队列，用该队列的第一个预设名路由到同一队列
+	if task.Preset != "" {
+		form.Set("preset", task.Preset)
+	} else if qc := findQueueConfig(task.Queue); qc != nil && len(qc.Presets) > 0 {
+		form.Set("preset", qc.Presets[0])
+	}
+	if webhook := task.ProgressWebhook; webhook != nil {
+		webhook.setForm(form)
+	}
+	return form
+}
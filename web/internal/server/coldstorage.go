@@ -0,0 +1,287 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// 冷存储：成功任务完成一段时间后，把输出文件移到更便宜但取回较慢的存储层，释放本地磁盘。
+//
+//	COLD_STORAGE_AFTER  任务完成（或上次取回）多久后归档，例如 720h；未设置时不归档
+//	COLD_STORAGE_DIR    冷存储目录，例如挂载的低速磁盘或网络存储
+//	COLD_STORAGE_S3     冷存储位置 bucket/prefix（S3 兼容存储，需配置 S3_* 环境变量）
+//	COLD_STORAGE_GCS    冷存储位置 bucket/prefix（Google Cloud Storage，需配置 GCS_* 环境变量）
+//	COLD_STORAGE_AZURE  冷存储位置 container/prefix（Azure Blob，需配置 AZURE_STORAGE_* 环境变量）
+//
+// 以上位置只能设置一个。
+//
+// 归档后任务的 storage_tier 为 archived，本地只保留任务记录。下载归档任务的文件时返回 202，
+// 并在后台取回文件（storage_tier 为 restoring），取回完成后 storage_tier 清空，重新请求即可下载；
+// 取回的文件在 COLD_STORAGE_AFTER 后再次归档。归档和取回的结果记录为任务事件。
+var (
+	coldStorageAfter = parseDurationEnv("COLD_STORAGE_AFTER", 0)
+	coldStorage      Storage
+)
+
+const (
+	storageTierArchived  = "archived"
+	storageTierRestoring = "restoring"
+
+	coldStorageCheckInterval = 10 * time.Minute
+	// 客户端重新请求下载前建议等待的时间
+	coldStorageRetryAfter = 30 * time.Second
+)
+
+// loadColdStore 按 COLD_STORAGE_* 创建冷存储，未启用时返回 nil
+func loadColdStore() (Storage, error) {
+	var backend, name, location string
+	for _, candidate := range []struct{ backend, env string }{
+		{"dir", "COLD_STORAGE_DIR"},
+		{"s3", "COLD_STORAGE_S3"},
+		{"gcs", "COLD_STORAGE_GCS"},
+		{"azure", "COLD_STORAGE_AZURE"},
+	} {
+		value := os.Getenv(candidate.env)
+		if value == "" {
+			continue
+		}
+		if name != "" {
+			return nil, fmt.Errorf("%s 和 %s 只能设置一个", name, candidate.env)
+		}
+		backend, name, location = candidate.backend, candidate.env, value
+	}
+	if coldStorageAfter <= 0 {
+		if name != "" {
+			log.Printf("未设置 COLD_STORAGE_AFTER，不归档输出文件")
+		}
+		return nil, nil
+	}
+	if name == "" {
+		return nil, fmt.Errorf("设置了 COLD_STORAGE_AFTER，但未设置 COLD_STORAGE_DIR、COLD_STORAGE_S3、COLD_STORAGE_GCS 或 COLD_STORAGE_AZURE")
+	}
+	store, err := newStorage(backend, location)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return store, nil
+}
+
+func coldStorageKey(task *Task, file string) string {
+	return task.ID + "/" + file
+}
+
+// coldStorageWorker 定期归档完成时间超过 COLD_STORAGE_AFTER 的成功任务
+func coldStorageWorker() {
+	if coldStorage == nil {
+		return
+	}
+	// 重启前未完成的取回需要重新请求
+	execWithRetry(`UPDATE tasks SET storage_tier = ? WHERE storage_tier = ?`, storageTierArchived, storageTierRestoring)
+	log.Printf("已启用冷存储，成功的任务将在 %s 后归档到 %s", coldStorageAfter, coldStorage)
+
+	for {
+		archiveOldTasks()
+		time.Sleep(coldStorageCheckInterval)
+	}
+}
+
+func archiveOldTasks() {
+	cutoff := time.Now().Add(-coldStorageAfter)
+	rows, err := db.Query(`SELECT `+taskColumns+` FROM tasks
+		WHERE status = 'success' AND storage_tier IS NULL AND COALESCE(restored_at, completed_at) < ?`, cutoff)
+	if err != nil {
+		log.Printf("无法查询待归档的任务: %v", err)
+		return
+	}
+	var tasks []*Task
+	for rows.Next() {
+		if task, err := scanTask(rows); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	rows.Close()
+
+	for _, task := range tasks {
+		if err := archiveTask(task); err != nil {
+			log.Printf("无法归档任务 %s: %v", task.ID, err)
+			recordTaskEvent(task.ID, "storage.archive_failed", err.Error())
+		}
+	}
+}
+
+// archiveTask 上传任务的输出文件到冷存储后删除本地文件
+func archiveTask(task *Task) error {
+	files := taskOutputFiles(task)
+	for _, file := range files {
+		// 文件已在外部被删除时无法归档，保持原状
+		ensureLocal(taskOutputPath(task, file))
+		if _, err := os.Stat(taskOutputPath(task, file)); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	for _, file := range files {
+		if err := coldStorage.Put(coldStorageKey(task, file), taskOutputPath(task, file)); err != nil {
+			return err
+		}
+	}
+	// 上传期间任务可能被删除或已由其他实例归档
+	res, err := execWithRetry(`UPDATE tasks SET storage_tier = ? WHERE id = ? AND storage_tier IS NULL`, storageTierArchived, task.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	for _, file := range files {
+		os.Remove(taskOutputPath(task, file))
+		removeStoredFile(taskOutputPath(task, file))
+	}
+	removeOutputDir(task.OutputDir)
+	log.Printf("任务 %s 的 %d 个输出文件已归档", task.ID, len(files))
+	recordTaskEvent(task.ID, "storage.archived", fmt.Sprintf("已归档 %d 个输出文件", len(files)))
+	return nil
+}
+
+// requestRestore 开始在后台取回归档任务的文件，任务已在取回中时不重复取回
+func requestRestore(task *Task) {
+	if coldStorage == nil || task.StorageTier != storageTierArchived {
+		return
+	}
+	res, err := execWithRetry(`UPDATE tasks SET storage_tier = ? WHERE id = ? AND storage_tier = ?`,
+		storageTierRestoring, task.ID, storageTierArchived)
+	if err != nil {
+		log.Printf("无法开始取回任务 %s: %v", task.ID, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	task.StorageTier = storageTierRestoring
+	go restoreTask(task)
+}
+
+func restoreTask(task *Task) {
+	started := time.Now()
+	files := taskOutputFiles(task)
+	for _, file := range files {
+		if err := coldStorage.Get(coldStorageKey(task, file), taskOutputPath(task, file)); err != nil {
+			log.Printf("无法取回任务 %s 的文件 %s: %v", task.ID, file, err)
+			recordTaskEvent(task.ID, "storage.restore_failed", fmt.Sprintf("%s: %v", file, err))
+			execWithRetry(`UPDATE tasks SET storage_tier = ? WHERE id = ? AND storage_tier = ?`,
+				storageTierArchived, task.ID, storageTierRestoring)
+			return
+		}
+	}
+	res, err := execWithRetry(`UPDATE tasks SET storage_tier = NULL, restored_at = ? WHERE id = ? AND storage_tier = ?`,
+		time.Now(), task.ID, storageTierRestoring)
+	if err != nil {
+		log.Printf("无法更新任务 %s 的存储状态: %v", task.ID, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// 取回期间任务被删除
+		for _, file := range files {
+			os.Remove(taskOutputPath(task, file))
+		}
+		return
+	}
+	for _, file := range files {
+		// 启用对象存储时重新上传取回的文件
+		if err := persistFile(taskOutputPath(task, file)); err != nil {
+			log.Printf("无法上传任务 %s 取回的文件 %s 到对象存储: %v", task.ID, file, err)
+			continue
+		}
+		coldStorage.Delete(coldStorageKey(task, file))
+	}
+	log.Printf("任务 %s 的输出文件已从冷存储取回（%s）", task.ID, time.Since(started).Round(time.Second))
+	recordTaskEvent(task.ID, "storage.restored", fmt.Sprintf("已取回 %d 个输出文件", len(files)))
+}
+
+// removeColdCopies 删除任务在冷存储中的文件（任务删除时调用），包括之前执行留下、已不在任务记录中的文件；
+// 无法列出时只删除 files
+func removeColdCopies(taskID string, files []string) {
+	if coldStorage == nil {
+		return
+	}
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		keys = append(keys, taskID+"/"+file)
+	}
+	if objects, err := coldStorage.List(taskID + "/"); err == nil {
+		keys = keys[:0]
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+	}
+	for _, key := range keys {
+		if err := coldStorage.Delete(key); err != nil {
+			log.Printf("无法删除任务 %s 在冷存储中的文件 %s: %v", taskID, key, err)
+		}
+	}
+}
+
+// RestoreStatus 归档文件正在取回时下载接口的 202 响应
+type RestoreStatus struct {
+	TaskID      string   `json:"task_id"`
+	StorageTier string   `json:"storage_tier"`
+	TaskIDs     []string `json:"task_ids,omitempty"` // 批量下载时正在取回的任务
+	RetryAfter  int      `json:"retry_after"`        // 建议多少秒后重新请求
+	Message     string   `json:"message"`
+}
+
+// writeRestoring 开始取回任务的文件并返回 202
+func writeRestoring(w http.ResponseWriter, tasks ...*Task) {
+	if coldStorage == nil {
+		writeError(w, http.StatusServiceUnavailable, codeStorageUnavailable, "Output files are archived but cold storage is not configured")
+		return
+	}
+	status := &RestoreStatus{
+		StorageTier: storageTierRestoring,
+		RetryAfter:  int(coldStorageRetryAfter.Seconds()),
+		Message:     "The output files are archived and are being restored, retry the download later",
+	}
+	for _, task := range tasks {
+		requestRestore(task)
+		status.TaskIDs = append(status.TaskIDs, task.ID)
+	}
+	if len(tasks) == 1 {
+		status.TaskID, status.TaskIDs = tasks[0].ID, nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", fmt.Sprint(status.RetryAfter))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
+
+// archivedTask 返回文件已归档（或正在取回）的任务，文件在本地时返回 nil
+func archivedTask(taskID string) *Task {
+	var tier string
+	err := db.QueryRow(`SELECT COALESCE(storage_tier, '') FROM tasks WHERE id = ?`, taskID).Scan(&tier)
+	if err != nil || tier == "" {
+		return nil
+	}
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, taskID))
+	if err != nil {
+		return nil
+	}
+	return task
+}
+
+// 取回归档任务的输出文件，完成前 storage_tier 为 restoring
+func restoreTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, r.PathValue("id")))
+	if err != nil {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+	if task.StorageTier == "" {
+		writeError(w, http.StatusConflict, codeNotArchived, "Task output files are not archived")
+		return
+	}
+	writeRestoring(w, task)
+}
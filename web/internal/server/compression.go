@@ -0,0 +1,385 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 输出文件压缩保存：
+//
+//	OUTPUT_COMPRESSION        zstd（需要 PATH 中有 zstd 命令，Docker 镜像已包含）或 gzip：任务成功后压缩保存输出文件，文件名不变；未设置时不压缩
+//	OUTPUT_COMPRESSION_LEVEL  压缩级别（zstd 为 1-19，默认 3；gzip 为 1-9，默认 6）
+//
+// 读取时按文件头识别压缩格式，因此修改设置后已保存的文件照常可用；压缩后没有变小的文件保持原样。
+// 下载时客户端接受对应的编码（Accept-Encoding）且不是范围请求时直接发送压缩数据（Content-Encoding），
+// 否则解压后发送（不支持 Range）。批量下载、打包、投递、邮件附件、WebDAV 和全文索引读取解压后的内容；
+// 成功后命令和任务钩子收到解压到临时目录的同名副本（见 taskOutputPaths）。
+// 对象存储中保存的同样是压缩后的文件，启用压缩时下载不重定向到签名链接。
+var outputCompression *outputCodec
+
+// outputCodec 一种压缩格式
+type outputCodec struct {
+	name       string // OUTPUT_COMPRESSION 的取值，同时也是 Content-Encoding
+	magic      []byte
+	level      int
+	compress   func(dst io.Writer, src string, level int) error
+	decompress func(src io.Reader) (io.ReadCloser, error)
+	// size 返回解压后的大小，无法从文件头尾得到时返回 -1
+	size func(f *os.File, compressedSize int64) int64
+}
+
+var outputCodecs = []*outputCodec{
+	{name: "zstd", magic: []byte{0x28, 0xB5, 0x2F, 0xFD}, level: 3, compress: zstdCompress, decompress: zstdDecompress, size: zstdContentSize},
+	{name: "gzip", magic: []byte{0x1F, 0x8B}, level: gzip.DefaultCompression, compress: gzipCompress, decompress: gzipDecompress, size: gzipContentSize},
+}
+
+// loadOutputCompression 读取 OUTPUT_COMPRESSION，未设置时返回 nil
+func loadOutputCompression() (*outputCodec, error) {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("OUTPUT_COMPRESSION")))
+	if name == "" || name == "off" || name == "none" {
+		return nil, nil
+	}
+	for _, codec := range outputCodecs {
+		if codec.name != name {
+			continue
+		}
+		configured := *codec
+		if value := os.Getenv("OUTPUT_COMPRESSION_LEVEL"); value != "" {
+			level, err := strconv.Atoi(value)
+			maxLevel := 9
+			if name == "zstd" {
+				maxLevel = 19
+			}
+			if err != nil || level < 1 || level > maxLevel {
+				return nil, fmt.Errorf("OUTPUT_COMPRESSION_LEVEL 无效: %s（%s 为 1-%d）", value, name, maxLevel)
+			}
+			configured.level = level
+		}
+		if name == "zstd" {
+			if _, err := exec.LookPath("zstd"); err != nil {
+				return nil, fmt.Errorf("OUTPUT_COMPRESSION=zstd 需要 zstd 命令: %v", err)
+			}
+		}
+		log.Printf("输出文件以 %s 压缩保存", name)
+		return &configured, nil
+	}
+	return nil, fmt.Errorf("OUTPUT_COMPRESSION 无效: %s（可选 zstd、gzip）", name)
+}
+
+// compressOutputFile 按 OUTPUT_COMPRESSION 压缩文件并替换原文件，压缩后没有变小时保持原样
+func compressOutputFile(path string) error {
+	codec := outputCompression
+	if codec == nil {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".compress.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = codec.compress(dst, path, codec.level)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if compressed := fileSize(tmp); compressed >= info.Size() {
+		os.Remove(tmp)
+		return nil
+	}
+	return os.Rename(tmp, path)
+}
+
+// detectOutputCodec 按文件头识别压缩格式，未压缩时返回 nil
+func detectOutputCodec(f *os.File) *outputCodec {
+	header := make([]byte, 4)
+	n, _ := f.ReadAt(header, 0)
+	for _, codec := range outputCodecs {
+		if bytes.HasPrefix(header[:n], codec.magic) {
+			return codec
+		}
+	}
+	return nil
+}
+
+// outputFileInfo 压缩文件的信息，Size 为解压后的大小
+type outputFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i outputFileInfo) Size() int64 { return i.size }
+
+// openOutputFile 打开输出文件，返回解压后的内容和文件信息（Size 为解压后的大小，无法确定时为压缩后的大小）
+func openOutputFile(path string) (io.ReadCloser, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	codec := detectOutputCodec(f)
+	if codec == nil {
+		return f, info, nil
+	}
+	if size := codec.size(f, info.Size()); size >= 0 {
+		info = outputFileInfo{info, size}
+	}
+	reader, err := codec.decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return &stackedReadCloser{ReadCloser: reader, file: f}, info, nil
+}
+
+// statOutputFile 返回输出文件的信息，Size 为解压后的大小
+func statOutputFile(path string) (os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if codec := detectOutputCodec(f); codec != nil {
+		if size := codec.size(f, info.Size()); size >= 0 {
+			return outputFileInfo{info, size}, nil
+		}
+	}
+	return info, nil
+}
+
+// readOutputFile 读取输出文件解压后的全部内容
+func readOutputFile(path string) ([]byte, error) {
+	reader, _, err := openOutputFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// decompressedOutputCopy 需要文件路径的调用方（外部命令等）使用：文件已压缩时解压到临时目录中的同名文件，
+// 返回其路径和清理函数；未压缩时直接返回原路径
+func decompressedOutputCopy(path string) (string, func(), error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	codec := detectOutputCodec(f)
+	f.Close()
+	if codec == nil {
+		return path, func() {}, nil
+	}
+	dir, err := os.MkdirTemp("", "babeldoc-output-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	reader, _, err := openOutputFile(path)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	defer reader.Close()
+	copyPath := filepath.Join(dir, filepath.Base(path))
+	if err := writeFileAtomic(copyPath, reader); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return copyPath, cleanup, nil
+}
+
+// stackedReadCloser 关闭解压器后再关闭底层文件
+type stackedReadCloser struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (r *stackedReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.file.Close()
+	return err
+}
+
+// serveCompressedOutput 发送压缩保存的输出文件：客户端接受该编码且不是范围请求时直接发送压缩数据，否则解压后发送
+func serveCompressedOutput(w http.ResponseWriter, r *http.Request, f *os.File, info os.FileInfo, codec *outputCodec) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if r.Header.Get("Range") == "" && acceptsEncoding(r, codec.name) {
+		w.Header().Set("Content-Encoding", codec.name)
+		w.Header().Set("ETag", fmt.Sprintf(`"%x-%x-%s"`, info.Size(), info.ModTime().UnixNano(), codec.name))
+		http.ServeContent(w, r, "", info.ModTime(), f)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Ranges", "none")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	reader, err := codec.decompress(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error opening file")
+		return
+	}
+	defer reader.Close()
+	if size := codec.size(f, info.Size()); size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("无法发送 %s: %v", f.Name(), err)
+	}
+}
+
+// acceptsEncoding 判断请求的 Accept-Encoding 是否接受 encoding（q=0 表示不接受）
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, item := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+			if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func gzipCompress(dst io.Writer, src string, level int) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw, err := gzip.NewWriterLevel(dst, level)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, f); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func gzipDecompress(src io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(src)
+}
+
+// gzipContentSize 读取 gzip 尾部记录的原始大小（对 2^32 取模，输出的 PDF 不会达到 4 GiB）
+func gzipContentSize(f *os.File, compressedSize int64) int64 {
+	trailer := make([]byte, 4)
+	if compressedSize < 18 || compressedSize >= 1<<32 {
+		return -1
+	}
+	if _, err := f.ReadAt(trailer, compressedSize-4); err != nil {
+		return -1
+	}
+	return int64(binary.LittleEndian.Uint32(trailer))
+}
+
+func zstdCompress(dst io.Writer, src string, level int) error {
+	// 以文件路径作为参数，zstd 会在帧头中记录原始大小
+	cmd := exec.Command("zstd", "-q", "-c", "-"+strconv.Itoa(level), "--", src)
+	cmd.Stdout = dst
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("zstd: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func zstdDecompress(src io.Reader) (io.ReadCloser, error) {
+	cmd := exec.Command("zstd", "-d", "-q", "-c")
+	cmd.Stdin = src
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandReader{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// commandReader 读取外部命令的标准输出，关闭时等待命令退出
+type commandReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *commandReader) Close() error {
+	r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
+
+// zstdContentSize 读取 zstd 帧头中的原始大小（Frame_Content_Size），帧头中没有记录时返回 -1
+func zstdContentSize(f *os.File, compressedSize int64) int64 {
+	header := make([]byte, 18)
+	n, _ := f.ReadAt(header, 0)
+	if n < 6 {
+		return -1
+	}
+	descriptor := header[4]
+	singleSegment := descriptor&0x20 != 0
+	offset := 5
+	if !singleSegment {
+		offset++ // Window_Descriptor
+	}
+	offset += []int{0, 1, 2, 4}[descriptor&0x03] // Dictionary_ID
+	var fieldSize int
+	switch descriptor >> 6 {
+	case 0:
+		if singleSegment {
+			fieldSize = 1
+		}
+	case 1:
+		fieldSize = 2
+	case 2:
+		fieldSize = 4
+	case 3:
+		fieldSize = 8
+	}
+	if fieldSize == 0 || offset+fieldSize > n {
+		return -1
+	}
+	field := make([]byte, 8)
+	copy(field, header[offset:offset+fieldSize])
+	size := int64(binary.LittleEndian.Uint64(field))
+	if fieldSize == 2 {
+		size += 256
+	}
+	return size
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// 乐观并发控制：任务的 version 字段在每次修改时递增（见 etag.go 中的触发器）。
+// 修改或删除任务时可以带上读取时的 version，任务在此期间已被其他客户端或 worker 修改时返回 409，
+// 避免基于过期状态的操作覆盖他人的修改。未提供 version 时不做检查。
+
+// versionConflictError 任务的当前版本号与请求的不一致
+type versionConflictError struct {
+	current int
+}
+
+func (e *versionConflictError) Error() string {
+	return fmt.Sprintf("task was modified concurrently (current version is %d)", e.current)
+}
+
+// parseExpectedVersion 解析请求中的 version 参数，未提供时返回 0
+func parseExpectedVersion(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("version must be a positive integer")
+	}
+	return version, nil
+}
+
+// writeVersionConflict 写出版本冲突的错误响应，带有任务的当前版本号
+func writeVersionConflict(w http.ResponseWriter, current int) {
+	writeErrorDetails(w, http.StatusConflict, codeVersionConflict, (&versionConflictError{current: current}).Error(),
+		map[string]interface{}{"version": current})
+}
@@ -0,0 +1,289 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 译文内容搜索：任务成功后用 pdftotext 提取译文（优先单语版本）的文本，保存在 task_content 表并建立全文索引，
+// 通过 GET /api/v1/search/content 按内容搜索。索引与文件名索引相同，使用 FTS5 trigram 分词器，不支持时退化为 LIKE 查询。
+//
+//	CONTENT_INDEX            为 false 时不提取文本（默认 true；找不到 pdftotext 时同样不提取）
+//	CONTENT_INDEX_MAX_CHARS  每个任务保存的最多字符数（默认 1000000），超出部分不参与搜索
+//
+// 启动时在后台为尚未提取文本的成功任务补建索引；输出文件已归档或已删除的任务记为空文本，不再重试。
+var (
+	contentIndexEnabled  = os.Getenv("CONTENT_INDEX") != "false"
+	contentIndexMaxChars = parseIntEnv("CONTENT_INDEX_MAX_CHARS", 1000000)
+
+	contentIndexAvailable bool
+	contentSearchColumns  = []string{"content"}
+
+	pdftotextOnce  sync.Once
+	pdftotextFound bool
+)
+
+const (
+	pdftotextTimeout = 2 * time.Minute
+
+	// 搜索结果中每个片段的大约字符数
+	contentSnippetChars = 80
+
+	defaultContentSearchLimit = 20
+	maxContentSearchLimit     = 100
+)
+
+// ContentSearchResult 按内容搜索的一条结果
+type ContentSearchResult struct {
+	TaskID      string     `json:"task_id"`
+	Filename    string     `json:"filename"`
+	LangIn      string     `json:"lang_in"`
+	LangOut     string     `json:"lang_out"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Snippet     string     `json:"snippet"` // 匹配位置附近的译文，匹配部分以 [ ] 标出
+}
+
+func createContentIndex() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS task_content (
+		task_id ` + t.Key + ` PRIMARY KEY,
+		content ` + t.Text + ` NOT NULL,
+		indexed_at ` + t.Time + ` NOT NULL
+	)`)
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+	// 任务被删除（手动、批量或过期清理）时一并删除提取的文本
+	if err := dbStore.CreateTrigger("task_content_cleanup", "tasks", "DELETE", `DELETE FROM task_content WHERE task_id = old.id`); err != nil {
+		log.Printf("无法创建触发器 task_content_cleanup: %v", err)
+	}
+
+	if err := dbStore.CreateSearchIndex("task_content_fts", "task_content", contentSearchColumns); err != nil {
+		log.Printf("无法创建译文全文索引，内容搜索将使用 LIKE 查询: %v", err)
+		return
+	}
+	contentIndexAvailable = true
+}
+
+// contentSourceFile 选择用于提取文本的输出文件：优先单语版本，双语版本中原文会干扰搜索
+func contentSourceFile(task *Task) string {
+	files := task.OutputFiles
+	if len(files) == 0 && task.OutputFile != "" {
+		files = []string{task.OutputFile}
+	}
+	for _, file := range files {
+		if strings.Contains(file, ".mono.") {
+			return file
+		}
+	}
+	if len(files) > 0 {
+		return files[0]
+	}
+	return ""
+}
+
+// canExtractContent 是否提取译文文本
+func canExtractContent() bool {
+	return contentIndexEnabled && hasPdftotext()
+}
+
+// hasPdftotext 是否安装了 pdftotext，第一次调用时检查
+func hasPdftotext() bool {
+	pdftotextOnce.Do(func() {
+		if _, err := exec.LookPath("pdftotext"); err != nil {
+			log.Printf("找不到 pdftotext，内容搜索和纯文本版本不可用")
+			return
+		}
+		pdftotextFound = true
+	})
+	return pdftotextFound
+}
+
+// extractPDFText 用 pdftotext 提取 PDF 的文本
+func extractPDFText(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pdftotextTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "pdftotext", "-enc", "UTF-8", "-q", path, "-").Output()
+	if err != nil {
+		return "", err
+	}
+	text := strings.Join(strings.Fields(string(out)), " ")
+	if utf8.RuneCountInString(text) > contentIndexMaxChars {
+		text = string([]rune(text)[:contentIndexMaxChars])
+	}
+	return text, nil
+}
+
+// indexTaskContent 提取成功任务的译文文本并写入索引，文件不存在时记为空文本
+func indexTaskContent(task *Task) {
+	if !canExtractContent() {
+		return
+	}
+	var text string
+	if file := contentSourceFile(task); file != "" {
+		path := taskOutputPath(task, file)
+		ensureLocal(path)
+		if copyPath, cleanup, err := decompressedOutputCopy(path); err == nil {
+			extracted, err := extractPDFText(copyPath)
+			cleanup()
+			if err != nil {
+				log.Printf("无法提取任务 %s 的译文文本: %v", task.ID, err)
+				return
+			}
+			text = extracted
+		}
+	}
+	if _, err := execWithRetry(`INSERT INTO task_content (task_id, content, indexed_at) VALUES (?, ?, ?)
+		`+dbStore.Upsert("task_id")+` content = excluded.content, indexed_at = excluded.indexed_at`,
+		task.ID, text, time.Now()); err != nil {
+		log.Printf("无法保存任务 %s 的译文文本: %v", task.ID, err)
+	}
+}
+
+// contentIndexBackfill 为尚未提取文本的成功任务补建索引
+func contentIndexBackfill() {
+	if !canExtractContent() {
+		return
+	}
+	rows, err := db.Query(`SELECT id FROM tasks WHERE status = 'success' AND storage_tier IS NULL
+		AND id NOT IN (SELECT task_id FROM task_content) ORDER BY completed_at`)
+	if err != nil {
+		log.Printf("无法查询待建立内容索引的任务: %v", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return
+	}
+
+	log.Printf("为 %d 个已完成的任务建立译文内容索引", len(ids))
+	for _, id := range ids {
+		if task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id)); err == nil {
+			indexTaskContent(task)
+		}
+	}
+	log.Printf("译文内容索引建立完成")
+}
+
+// contentSearchCondition 返回按译文内容搜索的条件，用于 task_content 表（别名 c）
+func contentSearchCondition(q string) (string, []interface{}) {
+	if contentIndexAvailable && utf8.RuneCountInString(q) >= minIndexedQueryLength {
+		return dbStore.SearchCondition("task_content_fts", "c", contentSearchColumns, q)
+	}
+	return likeSearchCondition("c", contentSearchColumns, q)
+}
+
+// contentSnippet 截取第一个匹配位置附近的文本，匹配部分以 [ ] 标出（不区分大小写）
+func contentSnippet(content, q string) string {
+	lower, needle := strings.ToLower(content), strings.ToLower(q)
+	index := -1
+	// 大小写转换可能改变字节数，此时无法对应到原文的位置，只从开头截取
+	if len(lower) == len(content) && len(needle) == len(q) {
+		index = strings.Index(lower, needle)
+	}
+	if index < 0 {
+		if utf8.RuneCountInString(content) > contentSnippetChars {
+			return string([]rune(content)[:contentSnippetChars]) + "…"
+		}
+		return content
+	}
+	matchEnd := index + len(needle)
+	start := index
+	for n := 0; n < contentSnippetChars/2 && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(content[:start])
+		start -= size
+	}
+	end := matchEnd
+	for n := 0; n < contentSnippetChars/2 && end < len(content); n++ {
+		_, size := utf8.DecodeRuneInString(content[end:])
+		end += size
+	}
+	snippet := content[start:index] + "[" + content[index:matchEnd] + "]" + content[matchEnd:end]
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(content) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// 按译文内容搜索成功的任务，按完成时间倒序
+func contentSearchHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "q is required")
+		return
+	}
+	limit, offset := defaultContentSearchLimit, 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxContentSearchLimit {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "limit must be between 1 and "+strconv.Itoa(maxContentSearchLimit))
+			return
+		}
+		limit = n
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		offset = n
+	}
+
+	condition, args := contentSearchCondition(q)
+	rows, err := db.Query(`SELECT t.id, t.filename, t.lang_in, t.lang_out, t.completed_at, c.content
+		FROM task_content c JOIN tasks t ON t.id = c.task_id
+		WHERE t.status = 'success' AND `+condition+`
+		ORDER BY t.completed_at DESC, t.id DESC LIMIT ? OFFSET ?`, append(args, limit+1, offset)...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Failed to search content")
+		return
+	}
+	defer rows.Close()
+
+	results := []ContentSearchResult{}
+	for rows.Next() {
+		var result ContentSearchResult
+		var completedAt sql.NullTime
+		var content string
+		if err := rows.Scan(&result.TaskID, &result.Filename, &result.LangIn, &result.LangOut, &completedAt, &content); err != nil {
+			continue
+		}
+		if completedAt.Valid {
+			result.CompletedAt = &completedAt.Time
+		}
+		result.Snippet = contentSnippet(content, q)
+		results = append(results, result)
+	}
+	more := len(results) > limit
+	if more {
+		results = results[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+		"offset":  offset,
+		"more":    more,
+	})
+}
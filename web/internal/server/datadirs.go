@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 数据目录：上传文件、输出文件、日志和数据库默认都在 DATA_DIR 下，也可以分别放到其他位置（例如数据库放在本地磁盘、输出文件放在大容量卷上）。
+//
+//	DATA_DIR    数据目录（默认为工作目录下的 data，Docker 镜像中为 /app/data）
+//	UPLOAD_DIR  上传文件目录（默认 DATA_DIR/uploads）
+//	OUTPUT_DIR  输出文件目录（默认 DATA_DIR/outputs）
+//	LOGS_DIR    任务日志目录（默认 DATA_DIR/logs）
+//	DB_PATH     SQLite 数据库文件（默认 DATA_DIR/tasks.db；设置 DATABASE_URL 时以其为准，使用 PostgreSQL 或 MySQL 时其所在目录只存放备份的临时文件，见 store.go）
+//
+// 相对路径相对于工作目录。启动时创建缺少的目录并检查是否可写，配置无效（目录相互嵌套、数据库路径是目录等）时拒绝启动。
+// 旧版本的默认位置是 /tmp/babeldoc，重启后可能被清空；未设置 DATA_DIR 且新位置还没有数据库时，如果 /tmp/babeldoc 下有数据库则继续使用并提示迁移。
+const legacyDataDir = "/tmp/babeldoc"
+
+var (
+	dataDir   = defaultDataDir()
+	uploadDir = dataPath("UPLOAD_DIR", "uploads")
+	outputDir = dataPath("OUTPUT_DIR", "outputs")
+	logsDir   = dataPath("LOGS_DIR", "logs")
+	dbPath    = databasePath()
+)
+
+// usingLegacyDataDir 是否因为找到旧数据而沿用了 /tmp/babeldoc
+var usingLegacyDataDir bool
+
+func defaultDataDir() string {
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		return absPath(dir)
+	}
+	dir := absPath("data")
+	if _, err := os.Stat(filepath.Join(dir, "tasks.db")); os.IsNotExist(err) && os.Getenv("DB_PATH") == "" && os.Getenv(databaseURLEnv) == "" {
+		if _, err := os.Stat(filepath.Join(legacyDataDir, "tasks.db")); err == nil {
+			usingLegacyDataDir = true
+			return legacyDataDir
+		}
+	}
+	return dir
+}
+
+// dataPath 返回环境变量 name 指定的路径，未设置时为 DATA_DIR 下的 name
+func dataPath(name, def string) string {
+	if path := os.Getenv(name); path != "" {
+		return absPath(path)
+	}
+	return filepath.Join(dataDir, def)
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// prepareDataDirs 检查数据目录的配置，创建缺少的目录并确认可写
+func prepareDataDirs() error {
+	if err := checkDatabaseURL(); err != nil {
+		return err
+	}
+	dirs := []struct{ name, path string }{
+		{"UPLOAD_DIR", uploadDir},
+		{"OUTPUT_DIR", outputDir},
+		{"LOGS_DIR", logsDir},
+		{"DATA_DIR/bundles", bundlesDir},
+		{"DATA_DIR/previews", previewsDir},
+		{"DATA_DIR/text", textVariantsDir},
+	}
+	// 各目录的清理逻辑互不知晓，不能相同或相互嵌套
+	for i, a := range dirs {
+		for _, b := range dirs[i+1:] {
+			if pathWithin(a.path, b.path) || pathWithin(b.path, a.path) {
+				return fmt.Errorf("%s（%s）与 %s（%s）不能相同或相互嵌套", a.name, a.path, b.name, b.path)
+			}
+		}
+		if pathWithin(dbPath, a.path) && a.path != logsDir {
+			return fmt.Errorf("DB_PATH（%s）不能位于 %s（%s）下", dbPath, a.name, a.path)
+		}
+	}
+	if info, err := os.Stat(dbPath); err == nil && info.IsDir() {
+		return fmt.Errorf("DB_PATH（%s）是一个目录", dbPath)
+	}
+
+	for _, dir := range append(dirs, struct{ name, path string }{"DB_PATH 所在目录", filepath.Dir(dbPath)}) {
+		if err := os.MkdirAll(dir.path, 0755); err != nil {
+			return fmt.Errorf("无法创建 %s: %w", dir.name, err)
+		}
+		f, err := os.CreateTemp(dir.path, ".write-check-*")
+		if err != nil {
+			return fmt.Errorf("%s（%s）不可写: %w", dir.name, dir.path, err)
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	if usingLegacyDataDir {
+		log.Printf("警告: 在旧的默认位置 %s 找到数据，继续使用；该目录重启后可能被清空，请迁移到持久目录并设置 DATA_DIR", legacyDataDir)
+	}
+	tmp := absPath(os.TempDir())
+	for _, path := range []string{uploadDir, outputDir, logsDir, dbPath} {
+		if pathWithin(path, tmp) && !usingLegacyDataDir {
+			log.Printf("警告: %s 位于临时目录 %s 下，重启后可能被清空", path, tmp)
+		}
+	}
+	return nil
+}
+
+// pathWithin path 是否为 dir 或位于 dir 下
+func pathWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
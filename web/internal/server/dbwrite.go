@@ -0,0 +1,141 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 数据库写入：SQLite 在其他连接持有写锁时返回 SQLITE_BUSY，写入按指数退避重试 DB_WRITE_RETRIES 次。
+// 任务状态的写入仍然失败时记录日志并暂存在内存中，由 pendingWriteFlusher 定期重试，
+// 期间及恢复后任务带有 persistence_warning，避免状态静默丢失。
+var dbWriteRetries = parseIntEnv("DB_WRITE_RETRIES", 5)
+
+const (
+	dbWriteRetryDelay    = 100 * time.Millisecond
+	dbWriteMaxRetryDelay = 2 * time.Second
+	pendingWriteInterval = 30 * time.Second
+)
+
+// pendingWrite 写入失败、等待重试的任务状态更新
+type pendingWrite struct {
+	taskID string
+	query  string
+	args   []interface{}
+	err    string
+	since  time.Time
+}
+
+var (
+	pendingWritesMutex sync.Mutex
+	pendingWrites      []*pendingWrite
+)
+
+// isBusyError 是否为数据库被锁定的临时错误（PostgreSQL 和 MySQL 为死锁和锁等待超时，重试即可）
+func isBusyError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "SQLITE_BUSY") || strings.Contains(msg, "database is locked") ||
+		strings.Contains(msg, "database table is locked") ||
+		strings.Contains(msg, "deadlock detected") || strings.Contains(msg, "Deadlock found") ||
+		strings.Contains(msg, "Lock wait timeout")
+}
+
+// execWithRetry 执行写入语句，数据库被锁定时退避重试
+func execWithRetry(query string, args ...interface{}) (sql.Result, error) {
+	delay := dbWriteRetryDelay
+	for attempt := 0; ; attempt++ {
+		res, err := db.Exec(query, args...)
+		if err == nil || !isBusyError(err) || attempt >= dbWriteRetries {
+			return res, err
+		}
+		time.Sleep(delay)
+		delay = min(delay*2, dbWriteMaxRetryDelay)
+	}
+}
+
+// writeTaskState 写入任务状态。失败时记录日志并暂存，由 pendingWriteFlusher 按顺序重试；
+// 同一任务已有暂存的写入时，新的写入排在其后，保证状态不会倒退
+func writeTaskState(taskID, query string, args ...interface{}) (sql.Result, error) {
+	pendingWritesMutex.Lock()
+	for _, pw := range pendingWrites {
+		if pw.taskID == taskID {
+			pendingWrites = append(pendingWrites, &pendingWrite{taskID: taskID, query: query, args: args, err: pw.err, since: time.Now()})
+			pendingWritesMutex.Unlock()
+			return nil, fmt.Errorf("earlier state of task %s is still pending: %s", taskID, pw.err)
+		}
+	}
+	pendingWritesMutex.Unlock()
+
+	res, err := execWithRetry(query, args...)
+	if err != nil {
+		log.Printf("无法保存任务 %s 的状态，稍后重试: %v", taskID, err)
+		pendingWritesMutex.Lock()
+		pendingWrites = append(pendingWrites, &pendingWrite{taskID: taskID, query: query, args: args, err: err.Error(), since: time.Now()})
+		pendingWritesMutex.Unlock()
+	}
+	return res, err
+}
+
+// pendingWriteWarning 返回任务尚未写入数据库的状态更新说明，没有时返回空字符串
+func pendingWriteWarning(taskID string) string {
+	pendingWritesMutex.Lock()
+	defer pendingWritesMutex.Unlock()
+	for _, pw := range pendingWrites {
+		if pw.taskID == taskID {
+			return fmt.Sprintf("任务状态自 %s 起未能写入数据库（%s），正在重试，显示的状态可能不是最新的", pw.since.Format(time.RFC3339), pw.err)
+		}
+	}
+	return ""
+}
+
+// pendingWriteCount 返回等待重试的写入数
+func pendingWriteCount() int {
+	pendingWritesMutex.Lock()
+	defer pendingWritesMutex.Unlock()
+	return len(pendingWrites)
+}
+
+// pendingWriteFlusher 定期按顺序重试暂存的写入，成功后在任务上记录 persistence_warning
+func pendingWriteFlusher() {
+	ticker := time.NewTicker(pendingWriteInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		flushPendingWrites()
+	}
+}
+
+func flushPendingWrites() {
+	pendingWritesMutex.Lock()
+	writes := append([]*pendingWrite(nil), pendingWrites...)
+	pendingWritesMutex.Unlock()
+
+	blocked := make(map[string]bool)
+	for _, pw := range writes {
+		if blocked[pw.taskID] {
+			continue
+		}
+		if _, err := execWithRetry(pw.query, pw.args...); err != nil {
+			log.Printf("重试保存任务 %s 的状态失败: %v", pw.taskID, err)
+			blocked[pw.taskID] = true
+			continue
+		}
+
+		warning := fmt.Sprintf("任务状态曾在 %s 写入数据库失败（%s），已于 %s 补写", pw.since.Format(time.RFC3339), pw.err, time.Now().Format(time.RFC3339))
+		if _, err := execWithRetry(`UPDATE tasks SET persistence_warning = ? WHERE id = ?`, warning, pw.taskID); err != nil {
+			log.Printf("无法记录任务 %s 的持久化警告: %v", pw.taskID, err)
+		}
+		log.Printf("已补写任务 %s 的状态", pw.taskID)
+
+		pendingWritesMutex.Lock()
+		for i, p := range pendingWrites {
+			if p == pw {
+				pendingWrites = append(pendingWrites[:i], pendingWrites[i+1:]...)
+				break
+			}
+		}
+		pendingWritesMutex.Unlock()
+	}
+}
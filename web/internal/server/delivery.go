@@ -0,0 +1,320 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 结果投递：任务成功后把输出文件自动上传到 WebDAV 或 SFTP 目标，例如团队网盘或归档服务器。
+//
+//	DELIVERY_TARGETS       投递目标配置文件（JSON 数组），未设置时不投递
+//	DELIVERY_MAX_ATTEMPTS  每个目标的最多尝试次数（默认 5），重试间隔从 1 分钟开始翻倍
+//
+// 目标可以按提交任务的用户（users）或提交时的预设（presets）筛选，两者都未设置时接收全部任务。
+// 每次投递的结果记录为任务事件（delivery.succeeded、delivery.retrying、delivery.failed），
+// 可通过 GET /api/v1/tasks/{id}/events 查看。投递失败不影响任务状态。
+var (
+	deliveryTargets     []*DeliveryTarget
+	deliveryMaxAttempts = max(parseIntEnv("DELIVERY_MAX_ATTEMPTS", 5), 1)
+)
+
+const (
+	deliveryRetryDelay  = time.Minute
+	deliveryFileTimeout = 10 * time.Minute
+)
+
+// DeliveryTarget 投递目标
+type DeliveryTarget struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"` // webdav 或 sftp
+	URL      string   `json:"url"`  // 例如 https://dav.example.com/remote.php/dav/files/me、sftp://user@host:22/srv/translations
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"` // 仅 WebDAV；SFTP 只支持密钥认证
+	KeyFile  string   `json:"key_file,omitempty"` // SFTP 私钥文件，未设置时使用 ssh 的默认密钥
+	Path     string   `json:"path,omitempty"`     // URL 下的目录，可使用 {user}、{preset}、{date}、{task_id}
+	Users    []string `json:"users,omitempty"`
+	Presets  []string `json:"presets,omitempty"`
+}
+
+// loadDeliveryTargets 读取 DELIVERY_TARGETS，未配置时返回空列表
+func loadDeliveryTargets() ([]*DeliveryTarget, error) {
+	file := os.Getenv("DELIVERY_TARGETS")
+	if file == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var targets []*DeliveryTarget
+	if err := json.Unmarshal(content, &targets); err != nil {
+		return nil, fmt.Errorf("无法解析 %s: %v", file, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		if target.Name == "" {
+			return nil, fmt.Errorf("%s 中存在未命名的投递目标", file)
+		}
+		if seen[target.Name] {
+			return nil, fmt.Errorf("%s 中投递目标名 %s 重复", file, target.Name)
+		}
+		seen[target.Name] = true
+
+		u, err := url.Parse(target.URL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("投递目标 %s 的 url 无效", target.Name)
+		}
+		switch target.Type {
+		case "webdav":
+			if u.Scheme != "http" && u.Scheme != "https" {
+				return nil, fmt.Errorf("投递目标 %s 的 url 必须是 http(s) 地址", target.Name)
+			}
+		case "sftp":
+			if u.Scheme != "sftp" {
+				return nil, fmt.Errorf("投递目标 %s 的 url 必须是 sftp:// 地址", target.Name)
+			}
+			if target.Password != "" {
+				return nil, fmt.Errorf("投递目标 %s: SFTP 只支持密钥认证", target.Name)
+			}
+		default:
+			return nil, fmt.Errorf("投递目标 %s 的类型 %q 无效（webdav 或 sftp）", target.Name, target.Type)
+		}
+	}
+	return targets, nil
+}
+
+// matches 任务是否需要投递到该目标
+func (t *DeliveryTarget) matches(task *Task) bool {
+	if len(t.Users) > 0 && !containsString(t.Users, task.UserID) {
+		return false
+	}
+	if len(t.Presets) > 0 && !containsString(t.Presets, task.Preset) {
+		return false
+	}
+	return true
+}
+
+// remoteDir 返回任务在目标上的目录（以 / 分隔，不含 URL 中的路径）
+func (t *DeliveryTarget) remoteDir(task *Task) string {
+	user := unsafePathChars.ReplaceAllString(task.UserID, "_")
+	if user == "" {
+		user = "_anonymous"
+	}
+	preset := unsafePathChars.ReplaceAllString(task.Preset, "_")
+	if preset == "" {
+		preset = "_default"
+	}
+	dir := strings.NewReplacer(
+		"{user}", user,
+		"{preset}", preset,
+		"{date}", task.CreatedAt.Format("2006-01-02"),
+		"{task_id}", task.ID,
+	).Replace(t.Path)
+	// 不允许通过 .. 离开 URL 指定的目录
+	return strings.TrimPrefix(path.Clean("/"+dir), "/")
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverTaskOutputs 把成功任务的输出文件投递到所有匹配的目标，各目标独立重试
+func deliverTaskOutputs(task *Task) {
+	if task.Status != "success" || len(task.OutputFiles) == 0 {
+		return
+	}
+	var files []string
+	var cleanups []func()
+	for _, file := range task.OutputFiles {
+		path := taskOutputPath(task, file)
+		ensureLocal(path)
+		// 压缩保存的文件解压后投递（见 compression.go）
+		if copyPath, cleanup, err := decompressedOutputCopy(path); err == nil {
+			path = copyPath
+			cleanups = append(cleanups, cleanup)
+		}
+		files = append(files, path)
+	}
+	var wg sync.WaitGroup
+	for _, target := range deliveryTargets {
+		if target.matches(task) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				deliverToTarget(task, target, files)
+			}()
+		}
+	}
+	wg.Wait()
+	for _, cleanup := range cleanups {
+		cleanup()
+	}
+}
+
+func deliverToTarget(task *Task, target *DeliveryTarget, files []string) {
+	dir := target.remoteDir(task)
+	delay := deliveryRetryDelay
+	for attempt := 1; ; attempt++ {
+		var err error
+		if target.Type == "sftp" {
+			err = deliverSFTP(target, dir, files)
+		} else {
+			err = deliverWebDAV(target, dir, files)
+		}
+		if err == nil {
+			log.Printf("任务 %s 的输出已投递到 %s", task.ID, target.Name)
+			recordTaskEvent(task.ID, "delivery.succeeded", fmt.Sprintf("%s: 已上传 %d 个文件到 /%s", target.Name, len(files), dir))
+			return
+		}
+		if attempt >= deliveryMaxAttempts {
+			log.Printf("任务 %s 的输出投递到 %s 失败，已放弃: %v", task.ID, target.Name, err)
+			recordTaskEvent(task.ID, "delivery.failed", fmt.Sprintf("%s: 第 %d 次尝试失败，已放弃: %v", target.Name, attempt, err))
+			return
+		}
+		log.Printf("任务 %s 的输出投递到 %s 失败（第 %d 次），%s 后重试: %v", task.ID, target.Name, attempt, delay, err)
+		recordTaskEvent(task.ID, "delivery.retrying", fmt.Sprintf("%s: 第 %d 次尝试失败，%s 后重试: %v", target.Name, attempt, delay, err))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// deliverWebDAV 逐级创建目录（MKCOL）后用 PUT 上传文件
+func deliverWebDAV(target *DeliveryTarget, dir string, files []string) error {
+	base := strings.TrimSuffix(target.URL, "/")
+	current := base
+	if dir != "" {
+		for _, part := range strings.Split(dir, "/") {
+			current += "/" + url.PathEscape(part)
+			// 目录已存在时返回 405
+			status, err := webdavRequest(target, "MKCOL", current+"/", nil)
+			if err != nil {
+				return err
+			}
+			if status != http.StatusCreated && status != http.StatusMethodNotAllowed && (status < 200 || status >= 300) {
+				return fmt.Errorf("MKCOL /%s: HTTP %d", dir, status)
+			}
+		}
+	}
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		status, err := webdavRequest(target, http.MethodPut, current+"/"+url.PathEscape(filepath.Base(file)), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if status < 200 || status >= 300 {
+			return fmt.Errorf("PUT %s: HTTP %d", filepath.Base(file), status)
+		}
+	}
+	return nil
+}
+
+func webdavRequest(target *DeliveryTarget, method, rawURL string, body *os.File) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryFileTimeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		reader = body
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		if info, err := body.Stat(); err == nil {
+			req.ContentLength = info.Size()
+		}
+		req.Header.Set("Content-Type", "application/pdf")
+	}
+	if target.Username != "" {
+		req.SetBasicAuth(target.Username, target.Password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// deliverSFTP 调用 OpenSSH 的 sftp 客户端以批处理模式上传，要求服务端已允许目标的公钥登录
+func deliverSFTP(target *DeliveryTarget, dir string, files []string) error {
+	u, _ := url.Parse(target.URL)
+	remote := strings.TrimSuffix(u.Path, "/")
+	if remote == "" {
+		// 未指定路径时相对于登录用户的主目录
+		remote = "."
+	}
+
+	// 以 - 开头的命令失败时不中止批处理，用于创建已存在的目录
+	var script bytes.Buffer
+	if dir != "" {
+		for _, part := range strings.Split(dir, "/") {
+			remote += "/" + part
+			fmt.Fprintf(&script, "-mkdir %s\n", sftpQuote(remote))
+		}
+	}
+	for _, file := range files {
+		fmt.Fprintf(&script, "put %s %s\n", sftpQuote(file), sftpQuote(remote+"/"+filepath.Base(file)))
+	}
+
+	args := []string{"-b", "-", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new"}
+	if target.KeyFile != "" {
+		args = append(args, "-i", target.KeyFile)
+	}
+	if port := u.Port(); port != "" {
+		args = append(args, "-P", port)
+	}
+	user := target.Username
+	if user == "" && u.User != nil {
+		user = u.User.Username()
+	}
+	host := u.Hostname()
+	if user != "" {
+		host = user + "@" + host
+	}
+	args = append(args, host)
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryFileTimeout*time.Duration(len(files)))
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sftp", args...)
+	cmd.Stdin = &script
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return fmt.Errorf("sftp: %v: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
+
+// sftpQuote 为 sftp 批处理命令的参数加引号
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 演示模式：
+//
+//	DEMO_MODE  为 true 时启动时写入几个带有预先翻译结果的示例任务（标签 demo），无需配置 API Key 即可体验界面和接口
+//
+// 示例任务以外部标识 demo-* 识别，已存在时不重复写入；删除后下次启动会重新写入。
+// 示例 PDF 由代码生成，不依赖外部文件。
+var demoMode = os.Getenv("DEMO_MODE") == "true"
+
+// demoSample 一个示例任务
+type demoSample struct {
+	externalID string
+	filename   string
+	status     string
+	langIn     string
+	langOut    string
+	pages      string
+	age        time.Duration // 创建时间距现在
+	duration   time.Duration // 执行耗时
+	errorMsg   string
+	source     []string // 原文，每行一段
+	translated []string // 译文，与原文逐行对应
+}
+
+var demoSamples = []demoSample{
+	{
+		externalID: "demo-research-note",
+		filename:   "research-note.pdf",
+		status:     "success",
+		langIn:     "en",
+		langOut:    "zh",
+		age:        26 * time.Hour,
+		duration:   5*time.Minute + 12*time.Second,
+		source: []string{
+			"A Short Note on Layout-Preserving Translation",
+			"Scientific documents mix prose, formulas, figures and tables.",
+			"Translating them page by page keeps the original layout intact,",
+			"so readers can compare both versions side by side.",
+		},
+		translated: []string{
+			"关于保留版式的翻译的简短说明",
+			"科技文献中混排着正文、公式、插图和表格。",
+			"逐页翻译可以完整保留原有的版式，",
+			"读者可以将两个版本并排对照阅读。",
+		},
+	},
+	{
+		externalID: "demo-user-guide",
+		filename:   "user-guide.pdf",
+		status:     "success",
+		langIn:     "en",
+		langOut:    "zh",
+		pages:      "1",
+		age:        3 * time.Hour,
+		duration:   1*time.Minute + 47*time.Second,
+		source: []string{
+			"Getting Started",
+			"Upload a PDF, choose the target language and submit the task.",
+			"When the task finishes, download the translated document.",
+		},
+		translated: []string{
+			"快速入门",
+			"上传 PDF，选择目标语言并提交任务。",
+			"任务完成后即可下载翻译后的文档。",
+		},
+	},
+	{
+		externalID: "demo-failed-scan",
+		filename:   "scanned-contract.pdf",
+		status:     "failed",
+		langIn:     "en",
+		langOut:    "zh",
+		age:        40 * time.Minute,
+		duration:   18 * time.Second,
+		errorMsg:   "演示数据：文档为扫描件，没有可提取的文字",
+		source: []string{
+			"(This page stands in for a scanned image without a text layer.)",
+		},
+	},
+}
+
+// seedDemoTasks 写入尚不存在的示例任务
+func seedDemoTasks() {
+	for _, sample := range demoSamples {
+		if _, err := taskIDByExternalID(sample.externalID); err == nil {
+			continue
+		}
+		if err := seedDemoTask(sample); err != nil {
+			log.Printf("无法写入示例任务 %s: %v", sample.externalID, err)
+			continue
+		}
+		log.Printf("已写入示例任务 %s", sample.externalID)
+	}
+}
+
+func seedDemoTask(sample demoSample) error {
+	createdAt := time.Now().Add(-sample.age).Truncate(time.Second)
+	startedAt := createdAt.Add(5 * time.Second)
+	completedAt := startedAt.Add(sample.duration)
+	timestamp := createdAt.Format("20060102-150405")
+	task := &Task{
+		ID:          fmt.Sprintf("%s_%d", timestamp, time.Now().UnixNano()%10000),
+		Filename:    sample.filename,
+		Status:      sample.status,
+		LangIn:      sample.langIn,
+		LangOut:     sample.langOut,
+		Pages:       sample.pages,
+		CreatedAt:   createdAt,
+		StartedAt:   &startedAt,
+		CompletedAt: &completedAt,
+		Error:       sample.errorMsg,
+		Tags:        []string{"demo"},
+		ExternalID:  sample.externalID,
+	}
+
+	if err := os.WriteFile(taskInputPath(task), buildSamplePDF(sample.langIn, sample.source, nil), 0644); err != nil {
+		return err
+	}
+
+	logText := fmt.Sprintf("==> 演示任务，未实际调用翻译服务\n==> 开始翻译 %s（%s → %s）\n", task.Filename, task.LangIn, task.LangOut)
+	if task.Status == "success" {
+		base := strings.TrimSuffix(task.Filename, filepath.Ext(task.Filename))
+		task.OutputDir = outputLayoutDir(task)
+		if err := os.MkdirAll(outputPath(task.OutputDir, ""), 0755); err != nil {
+			return err
+		}
+		// 与 babeldoc 相同，生成纯译文版和双语对照版
+		outputs := []struct {
+			name    string
+			content []byte
+		}{
+			{fmt.Sprintf("%s_%s.%s.mono.pdf", task.ID, base, task.LangOut), buildSamplePDF(task.LangOut, sample.translated, nil)},
+			{fmt.Sprintf("%s_%s.%s.dual.pdf", task.ID, base, task.LangOut), buildSamplePDF(task.LangOut, sample.source, sample.translated)},
+		}
+		for _, output := range outputs {
+			name := output.name
+			if err := os.WriteFile(taskOutputPath(task, name), output.content, 0644); err != nil {
+				return err
+			}
+			task.OutputFiles = append(task.OutputFiles, name)
+			logText += "==> 生成文件: " + name + "\n"
+		}
+		task.OutputFile = task.OutputFiles[0]
+		logText += "\n==> 任务完成！\n"
+	} else {
+		logText += "ERROR: " + task.Error + "\n"
+	}
+	writeStaticTaskLog(task, logText, task.CreatedAt)
+
+	outputFilesJSON, _ := json.Marshal(task.OutputFiles)
+	tagsJSON, _ := json.Marshal(task.Tags)
+	// 示例任务直接以结束状态写入，不经过队列和状态机
+	_, err := execWithRetry(`
+		INSERT INTO tasks (id, filename, status, lang_in, lang_out, pages, params, created_at, started_at, completed_at, error,
+			output_file, output_files, output_dir, attempts, tags, external_id)
+		VALUES (?, ?, ?, ?, ?, ?, '{}', ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)
+	`, task.ID, task.Filename, task.Status, task.LangIn, task.LangOut, task.Pages, task.CreatedAt, task.StartedAt, task.CompletedAt,
+		nullIfEmpty(task.Error), nullIfEmpty(task.OutputFile), string(outputFilesJSON), nullIfEmpty(task.OutputDir), string(tagsJSON), task.ExternalID)
+	return err
+}
+
+// buildSamplePDF 生成单页 A4 的示例 PDF：lines 为正文，interleaved 不为空时每行之后插入对应的译文（双语版）。
+// 中文使用 PDF 阅读器内置的 STSong-Light 字体，无需嵌入字体文件
+func buildSamplePDF(lang string, lines, interleaved []string) []byte {
+	var content bytes.Buffer
+	y := 780
+	for i, line := range lines {
+		size := 12
+		if i == 0 {
+			size = 18
+		}
+		writePDFTextLine(&content, line, size, y)
+		y -= size * 2
+		if i < len(interleaved) {
+			writePDFTextLine(&content, interleaved[i], size, y)
+			y -= size * 2
+		}
+	}
+
+	objects := [][]byte{
+		[]byte(fmt.Sprintf("<< /Type /Catalog /Pages 2 0 R /Lang (%s) >>", lang)),
+		[]byte("<< /Type /Pages /Kids [3 0 R] /Count 1 >>"),
+		[]byte("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>"),
+		[]byte("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"),
+		[]byte("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [7 0 R] >>"),
+		streamObject("", content.Bytes()),
+		[]byte("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 8 0 R /DW 1000 >>"),
+		[]byte("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>"),
+	}
+	return assemblePDF(objects)
+}
+
+// writePDFTextLine 写出一行文字：ASCII 使用 Helvetica，含其他字符时整行使用 STSong-Light（UCS-2 编码）
+func writePDFTextLine(content *bytes.Buffer, text string, size, y int) {
+	ascii := true
+	for _, r := range text {
+		if r > 0x7e {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		escaped := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(text)
+		fmt.Fprintf(content, "BT /F1 %d Tf 56 %d Td (%s) Tj ET\n", size, y, escaped)
+		return
+	}
+	var hex strings.Builder
+	for _, r := range text {
+		if r > 0xffff {
+			r = '?'
+		}
+		fmt.Fprintf(&hex, "%04X", r)
+	}
+	fmt.Fprintf(content, "BT /F2 %d Tf 56 %d Td <%s> Tj ET\n", size, y, hex.String())
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// 运行时诊断，与 pprof 一起只在 ADMIN_LISTEN 上提供：
+//
+//	/debug/vars        expvar 计数器：队列深度、goroutine 数、打开的文件数、执行中的进程数、HTTP 连接等
+//	/debug/goroutines  全部 goroutine 的调用栈（含等待时长），用于排查泄漏的处理函数或卡住的输出读取
+var processStartTime = time.Now()
+
+// publishDiagnostics 注册 expvar 计数器，只能调用一次
+func publishDiagnostics() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("open_files", expvar.Func(func() interface{} {
+		return openFileCount()
+	}))
+	expvar.Publish("running_processes", expvar.Func(func() interface{} {
+		tasksMutex.RLock()
+		defer tasksMutex.RUnlock()
+		return len(runningProcesses)
+	}))
+	expvar.Publish("queue", expvar.Func(func() interface{} {
+		return currentQueueStatus()
+	}))
+	expvar.Publish("http", expvar.Func(func() interface{} {
+		return connMetrics.stats()
+	}))
+	expvar.Publish("uptime_seconds", expvar.Func(func() interface{} {
+		return int64(time.Since(processStartTime).Seconds())
+	}))
+}
+
+// openFileCount 返回本进程打开的文件描述符数，无法统计（非 Linux）时返回 -1
+func openFileCount() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+// 输出全部 goroutine 的调用栈
+func goroutineDumpHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	pprof.Lookup("goroutine").WriteTo(w, 2)
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// 按标签的每周结果汇总配置：
+//
+//	TAG_DIGEST_CONFIG  配置文件路径（JSON），未设置时不启用
+//
+// 配置示例：
+//
+//	{
+//	  "weekday": "monday",
+//	  "hour": 8,
+//	  "targets": [
+//	    {"tag": "project-a", "email": "team@example.com", "s3": "bucket/digests", "webhook": "https://example.com/hook"}
+//	  ]
+//	}
+//
+// 每周在指定的星期和小时（服务器本地时区）将过去 7 天内成功完成、带有该标签的任务输出打包为 zip，
+// 投递到配置的邮箱、S3 位置和/或 webhook。上次执行时间保存在数据库中，重启不会重复或遗漏。
+type DigestConfig struct {
+	Weekday string         `json:"weekday"`
+	Hour    int            `json:"hour"`
+	Targets []DigestTarget `json:"targets"`
+}
+
+// DigestTarget 单个标签的投递目标
+type DigestTarget struct {
+	Tag     string `json:"tag"`
+	Email   string `json:"email,omitempty"`
+	S3      string `json:"s3,omitempty"`
+	Webhook string `json:"webhook,omitempty"`
+}
+
+const (
+	settingDigestLastRun = "tag_digest_last_run"
+	digestCheckInterval  = 10 * time.Minute
+	digestWebhookTimeout = 5 * time.Minute
+)
+
+func loadDigestConfig() (*DigestConfig, error) {
+	path := os.Getenv("TAG_DIGEST_CONFIG")
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &DigestConfig{}
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("无法解析 %s: %v", path, err)
+	}
+	if config.Weekday == "" {
+		config.Weekday = "monday"
+	}
+	if _, ok := parseWeekday(config.Weekday); !ok {
+		return nil, fmt.Errorf("无效的 weekday: %s", config.Weekday)
+	}
+	if config.Hour < 0 || config.Hour > 23 {
+		return nil, fmt.Errorf("无效的 hour: %d", config.Hour)
+	}
+	return config, nil
+}
+
+func parseWeekday(value string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), value) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// lastDigestTime 返回 now 之前最近一次的计划汇总时间
+func (c *DigestConfig) lastDigestTime(now time.Time) time.Time {
+	weekday, _ := parseWeekday(c.Weekday)
+	t := time.Date(now.Year(), now.Month(), now.Day(), c.Hour, 0, 0, 0, now.Location())
+	for t.Weekday() != weekday || t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t
+}
+
+// tagDigestWorker 定期检查是否到了汇总时间
+func tagDigestWorker() {
+	config, err := loadDigestConfig()
+	if err != nil {
+		log.Printf("无法加载 TAG_DIGEST_CONFIG，每周汇总未启用: %v", err)
+		return
+	}
+	if config == nil || len(config.Targets) == 0 {
+		return
+	}
+
+	for {
+		due := config.lastDigestTime(time.Now())
+		lastRun, _ := time.Parse(time.RFC3339, getSetting(settingDigestLastRun))
+		if lastRun.Before(due) {
+			// 首次启用时不补发历史汇总
+			if !lastRun.IsZero() {
+				for _, target := range config.Targets {
+					runTagDigest(target, due.AddDate(0, 0, -7), due)
+				}
+			}
+			setSetting(settingDigestLastRun, due.Format(time.RFC3339))
+		}
+		time.Sleep(digestCheckInterval)
+	}
+}
+
+// runTagDigest 打包 [from, to) 期间带有标签的任务输出并投递
+func runTagDigest(target DigestTarget, from, to time.Time) {
+	tagPattern, _ := json.Marshal(target.Tag)
+	rows, err := db.Query(`SELECT `+taskColumns+` FROM tasks WHERE status = 'success' AND completed_at >= ? AND completed_at < ? AND tags LIKE ? ORDER BY completed_at ASC`,
+		from, to, "%"+string(tagPattern)+"%")
+	if err != nil {
+		log.Printf("标签 %s 的每周汇总查询失败: %v", target.Tag, err)
+		return
+	}
+	var tasks []*Task
+	for rows.Next() {
+		if task, err := scanTask(rows); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	rows.Close()
+
+	if len(tasks) == 0 {
+		log.Printf("标签 %s 本周没有完成的任务，跳过汇总", target.Tag)
+		return
+	}
+
+	archiveName := fmt.Sprintf("babeldoc-%s-%s.zip", safeFileName(target.Tag), from.Format("20060102"))
+	archivePath, err := buildTaskArchive(tasks)
+	if err != nil {
+		log.Printf("标签 %s 的每周汇总打包失败: %v", target.Tag, err)
+		return
+	}
+	defer os.Remove(archivePath)
+
+	if target.Email != "" {
+		if err := deliverDigestEmail(target, tasks, archivePath, archiveName, from, to); err != nil {
+			log.Printf("标签 %s 的每周汇总邮件发送失败: %v", target.Tag, err)
+		}
+	}
+	if target.S3 != "" {
+		if err := deliverDigestS3(target, archivePath, archiveName); err != nil {
+			log.Printf("标签 %s 的每周汇总上传 S3 失败: %v", target.Tag, err)
+		}
+	}
+	if target.Webhook != "" {
+		if err := deliverDigestWebhook(target, archivePath, archiveName, from, to); err != nil {
+			log.Printf("标签 %s 的每周汇总 webhook 投递失败: %v", target.Tag, err)
+		}
+	}
+	log.Printf("标签 %s 的每周汇总已完成（%d 个任务）", target.Tag, len(tasks))
+}
+
+// buildTaskArchive 将任务输出按任务分目录打包到临时 zip 文件，返回文件路径
+func buildTaskArchive(tasks []*Task) (string, error) {
+	f, err := os.CreateTemp("", "babeldoc-digest-*.zip")
+	if err != nil {
+		return "", err
+	}
+	zw := zip.NewWriter(f)
+	for _, task := range tasks {
+		for _, file := range taskOutputFiles(task) {
+			if err := addFileToZip(zw, taskOutputPath(task, file), task.ID+"/"+strings.TrimPrefix(file, task.ID+"_")); err != nil {
+				zw.Close()
+				f.Close()
+				os.Remove(f.Name())
+				return "", err
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+func deliverDigestEmail(target DigestTarget, tasks []*Task, archivePath, archiveName string, from, to time.Time) error {
+	if smtpHost == "" {
+		return fmt.Errorf("未配置 SMTP_HOST")
+	}
+
+	var attachments []emailAttachment
+	if info, err := os.Stat(archivePath); err == nil && emailAttachmentMaxSize > 0 && info.Size() <= emailAttachmentMaxSize {
+		content, err := os.ReadFile(archivePath)
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, emailAttachment{name: archiveName, data: content, contentType: "application/zip"})
+	}
+
+	period := fmt.Sprintf("%s ~ %s", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"))
+	var text, htmlBody strings.Builder
+	fmt.Fprintf(&text, "标签 %s 在 %s 期间共完成 %d 个翻译任务。\n\n", target.Tag, period, len(tasks))
+	fmt.Fprintf(&htmlBody, "<p>标签 <strong>%s</strong> 在 %s 期间共完成 %d 个翻译任务。</p>\n<ul>\n", html.EscapeString(target.Tag), period, len(tasks))
+	for _, task := range tasks {
+		fmt.Fprintf(&text, "- %s（%s）\n", task.Filename, task.ID)
+		fmt.Fprintf(&htmlBody, "<li>%s（%s）", html.EscapeString(task.Filename), task.ID)
+		// 附件过大时改为逐个文件的签名下载链接
+		if attachments == nil {
+			for _, file := range taskOutputFiles(task) {
+				link := signedDownloadURL(task.ID, file, emailLinkTTL)
+				fmt.Fprintf(&text, "  %s\n", link)
+				fmt.Fprintf(&htmlBody, "<br><a href=\"%s\">%s</a>", html.EscapeString(link), html.EscapeString(file))
+			}
+		}
+		htmlBody.WriteString("</li>\n")
+	}
+	htmlBody.WriteString("</ul>\n")
+	if attachments != nil {
+		text.WriteString("\n全部结果已作为附件发送。\n")
+		htmlBody.WriteString("<p>全部结果已作为附件发送。</p>\n")
+	}
+
+	sender := envOrDefault("SMTP_FROM", os.Getenv("SMTP_USERNAME"))
+	subject := fmt.Sprintf("[BabelDOC] %s 每周翻译汇总（%s）", target.Tag, period)
+	msg := buildEmail(sender, target.Email, subject, text.String(), htmlBody.String(), attachments)
+	return sendEmail(sender, []string{target.Email}, msg)
+}
+
+func deliverDigestS3(target DigestTarget, archivePath, archiveName string) error {
+	client, err := newS3ClientFromEnv()
+	if err != nil {
+		return err
+	}
+	bucket, prefix := parseS3Location(target.S3)
+	key := archiveName
+	if prefix != "" {
+		key = prefix + "/" + archiveName
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return client.putObject(bucket, key, f, info.Size(), "application/zip")
+}
+
+// deliverDigestWebhook 以 application/zip 请求体 POST 压缩包，元数据放在请求头中
+func deliverDigestWebhook(target DigestTarget, archivePath, archiveName string, from, to time.Time) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), digestWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Webhook, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/zip")
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", archiveName))
+	req.Header.Set("X-BabelDOC-Tag", target.Tag)
+	req.Header.Set("X-BabelDOC-Period-Start", from.Format(time.RFC3339))
+	req.Header.Set("X-BabelDOC-Period-End", to.Format(time.RFC3339))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// safeFileName 将任意字符串转换为可用作文件名的形式
+func safeFileName(name string) string {
+	var b bytes.Buffer
+	for _, r := range name {
+		if r == '/' || r == '\\' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|' || r < ' ' {
+			b.WriteRune('_')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
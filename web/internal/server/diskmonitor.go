@@ -0,0 +1,100 @@
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// 磁盘空间监控：定期检查数据目录所在卷的剩余空间，低于阈值时暂停领取新任务，恢复后自动继续。
+//
+//	DISK_MIN_FREE        剩余空间的阈值，单位字节（默认 1073741824，即 1 GiB；0 为不监控）
+//	DISK_CHECK_INTERVAL  检查间隔（默认 30s）
+//
+// 检查的是 UPLOAD_DIR、OUTPUT_DIR、LOGS_DIR 和数据库所在的卷（见 storageusage.go），任一卷低于阈值即暂停。
+// 暂停期间正在执行的任务继续完成，worker 的心跳状态为 disk_low；剩余空间超过阈值的 110% 后恢复，避免在阈值附近反复切换。
+// 与手动暂停（/admin/queue/pause）相互独立：磁盘空间恢复不会解除手动暂停，手动恢复也不会解除磁盘空间不足的暂停。
+// 每个实例检查本机的卷，多节点部署时只暂停磁盘空间不足的节点上的 worker。
+var (
+	diskMinFree       = parseSizeEnv("DISK_MIN_FREE", 1<<30)
+	diskCheckInterval = parseDurationEnv("DISK_CHECK_INTERVAL", 30*time.Second)
+)
+
+// diskResumeFactor 剩余空间超过阈值的这一倍数后才恢复
+const diskResumeFactor = 1.1
+
+// DiskSpaceWarning 磁盘空间不足的卷
+type DiskSpaceWarning struct {
+	Paths          []string  `json:"paths"`
+	AvailableBytes uint64    `json:"available_bytes"`
+	MinFreeBytes   int64     `json:"min_free_bytes"`
+	Since          time.Time `json:"since"` // 开始暂停的时间
+}
+
+var (
+	diskLowMu sync.RWMutex
+	diskLow   *DiskSpaceWarning
+)
+
+// diskSpaceLow 返回磁盘空间不足的警告，空间充足或未启用监控时返回 nil
+func diskSpaceLow() *DiskSpaceWarning {
+	diskLowMu.RLock()
+	defer diskLowMu.RUnlock()
+	return diskLow
+}
+
+// diskSpaceMonitor 定期检查剩余空间
+func diskSpaceMonitor() {
+	if diskMinFree <= 0 {
+		return
+	}
+	for {
+		checkDiskSpace()
+		time.Sleep(diskCheckInterval)
+	}
+}
+
+// checkDiskSpace 检查一次各卷的剩余空间并更新暂停状态
+func checkDiskSpace() {
+	threshold := uint64(diskMinFree)
+	diskLowMu.Lock()
+	defer diskLowMu.Unlock()
+	if diskLow != nil {
+		// 已暂停：恢复的阈值更高
+		threshold = uint64(float64(diskMinFree) * diskResumeFactor)
+	}
+
+	var lowest *StorageVolume
+	for _, volume := range diskVolumes() {
+		if volume.AvailableBytes < threshold && (lowest == nil || volume.AvailableBytes < lowest.AvailableBytes) {
+			v := volume
+			lowest = &v
+		}
+	}
+
+	switch {
+	case lowest != nil && diskLow == nil:
+		diskLow = &DiskSpaceWarning{Paths: lowest.Paths, AvailableBytes: lowest.AvailableBytes, MinFreeBytes: diskMinFree, Since: time.Now()}
+		log.Printf("磁盘空间不足：%v 所在卷剩余 %d 字节，低于 DISK_MIN_FREE %d，暂停领取新任务", lowest.Paths, lowest.AvailableBytes, diskMinFree)
+	case lowest != nil:
+		// 返回给调用方的警告不再修改，更新时替换为新的值
+		updated := *diskLow
+		updated.Paths, updated.AvailableBytes = lowest.Paths, lowest.AvailableBytes
+		diskLow = &updated
+	case diskLow != nil:
+		log.Printf("磁盘空间已恢复，继续领取新任务（暂停了 %s）", time.Since(diskLow.Since).Round(time.Second))
+		diskLow = nil
+	}
+}
+
+// waitWhileDiskLow 在磁盘空间不足期间阻塞 worker，并在心跳中标记为 disk_low
+func waitWhileDiskLow(hb *workerHeartbeat) {
+	if diskSpaceLow() == nil {
+		return
+	}
+	hb.setStage(stageDiskLow)
+	for diskSpaceLow() != nil {
+		time.Sleep(5 * time.Second)
+	}
+	hb.setStage(stageIdle)
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// diskSpace 返回 path 所在文件系统的总容量、可用空间（非特权用户可用）和设备号
+func diskSpace(path string) (total, available, device uint64, err error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, 0, 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		device = uint64(st.Dev)
+	}
+	return uint64(fs.Blocks) * uint64(fs.Bsize), uint64(fs.Bavail) * uint64(fs.Bsize), device, nil
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// serveOutputFile 下载输出文件，支持断点续传：
+// 响应带有 Accept-Ranges 和由文件大小、修改时间计算的 ETag，客户端可以用 Range（配合 If-Range）
+// 从中断处继续下载；携带 If-None-Match 且文件未变化时返回 304。文件不存在时返回 404。
+// 启用 STORAGE_REDIRECT_DOWNLOADS 时，本地没有副本的文件重定向到对象存储的签名链接（见 storage.go）
+func serveOutputFile(w http.ResponseWriter, r *http.Request, filePath, fileName string) {
+	if redirectToSignedURL(w, r, filePath, filepath.Base(fileName)) {
+		return
+	}
+	ensureLocal(filePath)
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error opening file")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(fileName)))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	// 压缩保存的文件（见 compression.go）
+	if codec := detectOutputCodec(f); codec != nil {
+		serveCompressedOutput(w, r, f, info, codec)
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	// 强 ETag，If-Range 只接受强 ETag；文件被重新生成时大小或修改时间会变化
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	// ServeContent 处理 Range、If-Range、If-None-Match 和 If-Modified-Since，
+	// 范围无效时返回 416，多个范围时返回 multipart/byteranges
+	http.ServeContent(w, r, fileName, info.ModTime(), f)
+}
@@ -0,0 +1,312 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 提交草稿：提交页面选择文件后先预上传（见 uploads.go），再把表单选项和 upload_id 保存为草稿（submission_drafts 表），
+// 用户关闭浏览器后重新打开提交页面时可以恢复，不需要重新上传大文件。提交时以 draft_id 字段引用草稿，
+// 任务创建成功后草稿及其预上传文件一并删除。
+//
+//	DRAFT_TTL  草稿在最后一次保存后的保留时长（默认 7 天），被未过期草稿引用的预上传文件不会按 PENDING_UPLOAD_TTL 清理
+var draftTTL = parseDurationEnv("DRAFT_TTL", 7*24*time.Hour)
+
+const maxDraftsPerUser = 20
+
+var draftIDPattern = uploadIDPattern
+
+// 草稿中不保存的字段：文件另行引用，计划时间在恢复时通常已经过去
+var nonDraftFields = map[string]bool{
+	"file":      true,
+	"file_url":  true,
+	"upload_id": true,
+	"draft_id":  true,
+	"run_at":    true,
+}
+
+// SubmissionDraft 用户未提交的任务草稿
+type SubmissionDraft struct {
+	ID              string            `json:"id"`
+	UploadID        string            `json:"upload_id,omitempty"`
+	Filename        string            `json:"filename,omitempty"`         // 预上传文件的文件名
+	Size            int64             `json:"size,omitempty"`             // 预上传文件的大小
+	UploadAvailable bool              `json:"upload_available,omitempty"` // 预上传文件仍然存在，可以直接提交
+	Form            map[string]string `json:"form"`                       // 表单字段，键为提交表单的字段名
+	CreatedAt       time.Time         `json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+	ExpiresAt       time.Time         `json:"expires_at"`
+}
+
+// draftRequest 保存草稿的请求体
+type draftRequest struct {
+	UploadID string                 `json:"upload_id"`
+	Form     map[string]interface{} `json:"form"`
+}
+
+func createDraftsTable() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS submission_drafts (
+		id ` + t.Key + ` PRIMARY KEY,
+		user_id ` + t.Key + ` NOT NULL,
+		upload_id ` + t.Text + `,
+		form ` + t.Text + ` NOT NULL,
+		created_at ` + t.Time + ` NOT NULL,
+		updated_at ` + t.Time + ` NOT NULL,
+		expires_at ` + t.Time + ` NOT NULL
+	)`)
+	if err == nil {
+		err = dbStore.CreateIndex("idx_submission_drafts_user", "submission_drafts", "user_id, updated_at", "", false)
+	}
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+}
+
+// fillUploadInfo 补充草稿引用的预上传文件的信息
+func (d *SubmissionDraft) fillUploadInfo() {
+	if d.UploadID == "" || !uploadIDPattern.MatchString(d.UploadID) {
+		return
+	}
+	entries, err := os.ReadDir(pendingUploadDir(d.UploadID))
+	if err != nil || len(entries) != 1 {
+		return
+	}
+	d.Filename = entries[0].Name()
+	if info, err := entries[0].Info(); err == nil {
+		d.Size = info.Size()
+	}
+	d.UploadAvailable = true
+}
+
+func scanDraft(row interface{ Scan(...interface{}) error }) (*SubmissionDraft, error) {
+	var draft SubmissionDraft
+	var uploadID sql.NullString
+	var form string
+	if err := row.Scan(&draft.ID, &uploadID, &form, &draft.CreatedAt, &draft.UpdatedAt, &draft.ExpiresAt); err != nil {
+		return nil, err
+	}
+	draft.UploadID = uploadID.String
+	draft.Form = map[string]string{}
+	json.Unmarshal([]byte(form), &draft.Form)
+	draft.fillUploadInfo()
+	return &draft, nil
+}
+
+const draftColumns = `id, upload_id, form, created_at, updated_at, expires_at`
+
+// loadDraft 读取用户的草稿，不存在、属于其他用户或已过期时返回 DRAFT_NOT_FOUND
+func loadDraft(userID, draftID string) (*SubmissionDraft, error) {
+	notFound := newAPIError(http.StatusNotFound, codeDraftNotFound, "draft not found: %s", draftID)
+	if userID == "" || !draftIDPattern.MatchString(draftID) {
+		return nil, notFound
+	}
+	draft, err := scanDraft(db.QueryRow(`SELECT `+draftColumns+` FROM submission_drafts
+		WHERE id = ? AND user_id = ? AND expires_at > ?`, draftID, userID, time.Now()))
+	if err == sql.ErrNoRows {
+		return nil, notFound
+	}
+	return draft, err
+}
+
+// parseDraftRequest 解析并校验保存草稿的请求体
+func parseDraftRequest(w http.ResponseWriter, r *http.Request) (string, map[string]string, error) {
+	var req draftRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return "", nil, invalidJSONError(err)
+	}
+	for key := range req.Form {
+		if nonDraftFields[key] {
+			return "", nil, newAPIError(http.StatusBadRequest, codeBadRequest, "%s cannot be saved in a draft", key)
+		}
+	}
+	form, err := savedFormValues(req.Form)
+	if err != nil {
+		return "", nil, newAPIError(http.StatusBadRequest, codeBadRequest, "%s", err.Error())
+	}
+	if req.UploadID != "" {
+		f, _, err := openPendingUpload(req.UploadID)
+		if err != nil {
+			return "", nil, err
+		}
+		f.Close()
+	}
+	return req.UploadID, form, nil
+}
+
+// 我的草稿：GET 列出未过期的草稿（最近保存的在前），POST 新建
+func draftsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	userID := ensureUserID(w, r)
+
+	if r.Method == http.MethodGet {
+		rows, err := db.Query(`SELECT `+draftColumns+` FROM submission_drafts
+			WHERE user_id = ? AND expires_at > ? ORDER BY updated_at DESC`, userID, time.Now())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		defer rows.Close()
+		drafts := []*SubmissionDraft{}
+		for rows.Next() {
+			if draft, err := scanDraft(rows); err == nil {
+				drafts = append(drafts, draft)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"drafts": drafts})
+		return
+	}
+
+	uploadID, form, err := parseDraftRequest(w, r)
+	if err != nil {
+		writeErrorFrom(w, err, http.StatusBadRequest, codeBadRequest)
+		return
+	}
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM submission_drafts WHERE user_id = ? AND expires_at > ?`, userID, time.Now()).Scan(&count)
+	if count >= maxDraftsPerUser {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "too many drafts, delete some first")
+		return
+	}
+
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	now := time.Now().Truncate(time.Second)
+	draftID := hex.EncodeToString(buf)
+	raw, _ := json.Marshal(form)
+	if _, err := execWithRetry(`INSERT INTO submission_drafts (id, user_id, upload_id, form, created_at, updated_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, draftID, userID, nullIfEmpty(uploadID), string(raw), now, now, now.Add(draftTTL)); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	draft, err := loadDraft(userID, draftID)
+	if err != nil {
+		writeErrorFrom(w, err, http.StatusInternalServerError, codeInternal)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(draft)
+}
+
+// 单个草稿：GET 读取，PUT 覆盖保存（并延长有效期），DELETE 删除（同时删除未被其他草稿引用的预上传文件）
+func draftHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	userID := ensureUserID(w, r)
+
+	draft, err := loadDraft(userID, r.PathValue("id"))
+	if err != nil {
+		writeErrorFrom(w, err, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(draft)
+
+	case http.MethodPut:
+		uploadID, form, err := parseDraftRequest(w, r)
+		if err != nil {
+			writeErrorFrom(w, err, http.StatusBadRequest, codeBadRequest)
+			return
+		}
+		now := time.Now().Truncate(time.Second)
+		raw, _ := json.Marshal(form)
+		if _, err := execWithRetry(`UPDATE submission_drafts SET upload_id = ?, form = ?, updated_at = ?, expires_at = ? WHERE id = ?`,
+			nullIfEmpty(uploadID), string(raw), now, now.Add(draftTTL), draft.ID); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		// 换了文件时旧的预上传文件不再需要
+		if draft.UploadID != "" && draft.UploadID != uploadID {
+			removeUnreferencedUpload(draft.UploadID)
+		}
+		updated, err := loadDraft(userID, draft.ID)
+		if err != nil {
+			writeErrorFrom(w, err, http.StatusInternalServerError, codeInternal)
+			return
+		}
+		json.NewEncoder(w).Encode(updated)
+
+	case http.MethodDelete:
+		deleteDraft(draft)
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// deleteDraft 删除草稿及其不再被引用的预上传文件
+func deleteDraft(draft *SubmissionDraft) {
+	execWithRetry(`DELETE FROM submission_drafts WHERE id = ?`, draft.ID)
+	if draft.UploadID != "" {
+		removeUnreferencedUpload(draft.UploadID)
+	}
+}
+
+// removeUnreferencedUpload 预上传文件没有被其他未过期的草稿引用时删除
+func removeUnreferencedUpload(uploadID string) {
+	if !draftReferencesUpload(uploadID) {
+		removePendingUpload(uploadID)
+	}
+}
+
+// draftReferencesUpload 预上传文件是否被未过期的草稿引用
+func draftReferencesUpload(uploadID string) bool {
+	var exists int
+	err := db.QueryRow(`SELECT 1 FROM submission_drafts WHERE upload_id = ? AND expires_at > ? LIMIT 1`, uploadID, time.Now()).Scan(&exists)
+	return err == nil
+}
+
+// withDraft 以草稿的预上传文件作为提交的文件，请求中未提供（或为空）的字段使用草稿中保存的值
+func withDraft(r *http.Request, input *submissionInput, draftID string) (*submissionInput, error) {
+	draft, err := loadDraft(currentUserID(r), draftID)
+	if err != nil {
+		return nil, err
+	}
+	if draft.UploadID == "" {
+		return nil, newAPIError(http.StatusBadRequest, codeFileRequired, "draft %s has no uploaded file", draftID)
+	}
+	f, name, err := openPendingUpload(draft.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range draft.Form {
+		if strings.TrimSpace(input.form.Get(key)) == "" {
+			input.form.Set(key, value)
+		}
+	}
+	input.file, input.filename = f, filepath.Base(name)
+	input.uploadID, input.draftID = draft.UploadID, draft.ID
+	input.close = func() { f.Close() }
+	return input, nil
+}
+
+// removeSubmittedDraft 任务创建成功后删除引用的草稿
+func removeSubmittedDraft(draftID string) {
+	execWithRetry(`DELETE FROM submission_drafts WHERE id = ?`, draftID)
+}
+
+// cleanExpiredDrafts 删除过期的草稿，其预上传文件之后按 PENDING_UPLOAD_TTL 清理
+func cleanExpiredDrafts() {
+	res, err := execWithRetry(`DELETE FROM submission_drafts WHERE expires_at <= ?`, time.Now())
+	if err != nil {
+		log.Printf("无法清理过期的草稿: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("已清理 %d 个过期的草稿", n)
+	}
+}
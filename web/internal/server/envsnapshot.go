@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 任务的运行环境快照：每次开始执行时记录翻译程序版本、操作系统、区域设置和相关环境变量，
+// 保存在任务上并在任务详情中返回（env_snapshot），排查"在我的部署上正常"一类的问题时无需再登录机器。
+// 名称中包含 KEY、SECRET、PASSWORD、TOKEN 的环境变量只记录是否设置，URL 中的密码会被替换。
+
+// EnvSnapshot 任务执行时的运行环境
+type EnvSnapshot struct {
+	CapturedAt      time.Time         `json:"captured_at"`
+	Attempt         int               `json:"attempt"`
+	Translator      string            `json:"translator"`
+	BabeldocVersion string            `json:"babeldoc_version,omitempty"`
+	ServerVersion   string            `json:"server_version,omitempty"`
+	GoVersion       string            `json:"go_version"`
+	OS              string            `json:"os"`
+	Arch            string            `json:"arch"`
+	Hostname        string            `json:"hostname,omitempty"`
+	WorkerID        string            `json:"worker_id,omitempty"`
+	Locale          string            `json:"locale,omitempty"`
+	Env             map[string]string `json:"env,omitempty"`
+}
+
+// snapshotEnvNames 记录的环境变量：以 * 结尾的为前缀
+var snapshotEnvNames = []string{
+	"OPENAI_*", "BABELDOC_*", "TRANSLATOR", "MOCK_TRANSLATOR_*", "TASK_*", "WORKER_COUNT", "QUEUES*",
+	"OUTPUT_LAYOUT", "LANG", "LC_*", "TZ", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	"PYTHON*", "HF_*", "UV_*",
+}
+
+// snapshotSecretMarkers 名称包含这些字符串的环境变量只记录是否设置
+var snapshotSecretMarkers = []string{"KEY", "SECRET", "PASSWORD", "TOKEN", "CREDENTIAL"}
+
+const maskedValue = "******"
+
+var (
+	babeldocVersionOnce sync.Once
+	babeldocVersion     string
+)
+
+// captureEnvSnapshot 生成任务本次执行的运行环境快照
+func captureEnvSnapshot(task *Task, translator, workerID string) *EnvSnapshot {
+	hostname, _ := os.Hostname()
+	snapshot := &EnvSnapshot{
+		CapturedAt: time.Now(),
+		Attempt:    task.Attempts,
+		Translator: translator,
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Hostname:   hostname,
+		WorkerID:   workerID,
+		Env:        snapshotEnv(os.Environ()),
+	}
+	if translator == translatorMock {
+		snapshot.BabeldocVersion = translatorMock
+	} else {
+		snapshot.BabeldocVersion = detectBabeldocVersion()
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		snapshot.ServerVersion = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				snapshot.ServerVersion = setting.Value
+			}
+		}
+	}
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			snapshot.Locale = value
+			break
+		}
+	}
+	return snapshot
+}
+
+// saveEnvSnapshot 记录任务的运行环境快照，失败时只记录日志，不影响任务执行
+func saveEnvSnapshot(taskID string, snapshot *EnvSnapshot) {
+	data, _ := json.Marshal(snapshot)
+	if _, err := execWithRetry(`UPDATE tasks SET env_snapshot = ? WHERE id = ?`, string(data), taskID); err != nil {
+		log.Printf("无法记录任务 %s 的运行环境: %v", taskID, err)
+	}
+}
+
+// loadEnvSnapshot 读取任务最近一次执行的运行环境快照，没有记录时返回 nil
+func loadEnvSnapshot(taskID string) *EnvSnapshot {
+	var data *string
+	if err := db.QueryRow(`SELECT env_snapshot FROM tasks WHERE id = ?`, taskID).Scan(&data); err != nil || data == nil || *data == "" {
+		return nil
+	}
+	var snapshot EnvSnapshot
+	if err := json.Unmarshal([]byte(*data), &snapshot); err != nil {
+		return nil
+	}
+	return &snapshot
+}
+
+// snapshotEnv 从 environ 中选出相关的环境变量并隐藏敏感值
+func snapshotEnv(environ []string) map[string]string {
+	env := make(map[string]string)
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !snapshotEnvSelected(name) {
+			continue
+		}
+		env[name] = maskEnvValue(name, value)
+	}
+	return env
+}
+
+func snapshotEnvSelected(name string) bool {
+	for _, pattern := range snapshotEnvNames {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func maskEnvValue(name, value string) string {
+	upper := strings.ToUpper(name)
+	for _, marker := range snapshotSecretMarkers {
+		if strings.Contains(upper, marker) {
+			if value == "" {
+				return ""
+			}
+			return maskedValue
+		}
+	}
+	// 代理地址等可能带有用户名和密码
+	if strings.Contains(value, "://") {
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+	}
+	return value
+}
+
+// detectBabeldocVersion 返回 babeldoc --version 的输出，进程内只检测一次
+func detectBabeldocVersion() string {
+	babeldocVersionOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "babeldoc", "--version").CombinedOutput()
+		if err != nil {
+			log.Printf("无法获取 babeldoc 版本: %v", err)
+			babeldocVersion = "unknown"
+			return
+		}
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		babeldocVersion = strings.TrimSpace(lines[len(lines)-1])
+	})
+	return babeldocVersion
+}
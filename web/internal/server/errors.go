@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// 所有 API 错误使用统一的 JSON 格式：
+//
+//	{"success": false, "code": "TASK_NOT_FOUND", "error": "Task not found"}
+//
+// code 为稳定的错误码，客户端应据此判断错误类型；error 为便于阅读的说明，内容可能调整。
+// 个别错误带有额外字段，例如外部标识冲突时的 task_id。
+const (
+	codeBadRequest           = "BAD_REQUEST"            // 参数缺失或无效
+	codeInvalidJSON          = "INVALID_JSON"           // 请求体不是有效的 JSON
+	codeUnauthorized         = "UNAUTHORIZED"           // 缺少或错误的管理令牌
+	codeInvalidSignature     = "INVALID_SIGNATURE"      // 下载链接签名无效、已过期或已撤销
+	codeDownloadLimitReached = "DOWNLOAD_LIMIT_REACHED" // 分享链接的下载次数已用完
+	codeNotFound             = "NOT_FOUND"              // 接口不存在
+	codeMethodNotAllowed     = "METHOD_NOT_ALLOWED"     // 接口不支持该请求方法
+	codeTaskNotFound         = "TASK_NOT_FOUND"         // 任务不存在
+	codeFileNotFound         = "FILE_NOT_FOUND"         // 任务的输出文件不存在
+	codePageNotFound         = "PAGE_NOT_FOUND"         // 页码超出输出文件的页数
+	codeUploadNotFound       = "UPLOAD_NOT_FOUND"       // 预上传文件不存在或已过期
+	codeDraftNotFound        = "DRAFT_NOT_FOUND"        // 草稿不存在或已过期
+	codeBundleNotFound       = "BUNDLE_NOT_FOUND"       // 加密分享包不存在
+	codeFollowNotFound       = "FOLLOW_NOT_FOUND"       // 关注不存在
+	codeImportNotFound       = "IMPORT_NOT_FOUND"       // 导入批次不存在或已过期
+	codeInputFileGone        = "INPUT_FILE_GONE"        // 任务的输入文件已被删除
+	codeFileRequired         = "FILE_REQUIRED"          // 未提供要翻译的文件
+	codeUploadTooLarge       = "UPLOAD_TOO_LARGE"       // 文件超过大小限制
+	codeUnsupportedFile      = "UNSUPPORTED_FILE_TYPE"  // 不是 PDF 文件
+	codeRemoteFetchFailed    = "REMOTE_FETCH_FAILED"    // 无法下载 file_url
+	codeExternalIDConflict   = "EXTERNAL_ID_CONFLICT"   // 外部标识已被其他任务使用
+	codeTaskNotEditable      = "TASK_NOT_EDITABLE"      // 任务已开始执行或已结束
+	codeVersionConflict      = "TASK_VERSION_CONFLICT"  // 任务已被其他请求或 worker 修改
+	codeTooManyTasks         = "TOO_MANY_TASKS"         // 批量操作的任务数超过上限
+	codeTooManyBundles       = "TOO_MANY_BUNDLES"       // 任务的加密分享包数已达上限
+	codeFontNotFound         = "FONT_NOT_FOUND"         // 附加字体不存在
+	codeBabeldocCacheBusy    = "BABELDOC_CACHE_BUSY"    // 另一个清理或移动 babeldoc 缓存目录的操作正在进行
+	codeNotArchived          = "NOT_ARCHIVED"           // 任务的输出文件没有归档，无需取回
+	codeLanguageMismatch     = "LANGUAGE_MISMATCH"      // 文档语言与目标语言相同（LANG_DETECTION=reject）
+	codeTooManyPages         = "TOO_MANY_PAGES"         // 页数超过最后一个规模分级的上限
+	codeHookRejected         = "REJECTED_BY_HOOK"       // 被入队前钩子拒绝
+	codeUploadsBusy          = "UPLOADS_BUSY"           // 同时进行的上传过多，稍后重试
+	codeQueueUnavailable     = "QUEUE_UNAVAILABLE"      // 任务入队失败
+	codeStorageUnavailable   = "STORAGE_UNAVAILABLE"    // 输出文件已归档，但未配置冷存储，无法取回
+	codePreviewUnavailable   = "PREVIEW_UNAVAILABLE"    // 服务器没有安装 pdftoppm，无法渲染页面预览
+	codeTextUnavailable      = "TEXT_UNAVAILABLE"       // 服务器没有安装 pdftotext，无法生成纯文本版本
+	codeBackupInProgress     = "BACKUP_IN_PROGRESS"     // 已有备份正在进行
+	codeInternal             = "INTERNAL_ERROR"         // 服务器内部错误
+)
+
+// apiError 带 HTTP 状态码和错误码的错误，解析请求的辅助函数返回它，由处理函数通过 writeErrorFrom 写出
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func newAPIError(status int, code, format string, args ...interface{}) *apiError {
+	return &apiError{status: status, code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// writeError 写出统一格式的错误响应
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeErrorDetails(w, status, code, message, nil)
+}
+
+// writeErrorDetails 写出统一格式的错误响应，details 中的字段一并写出
+func writeErrorDetails(w http.ResponseWriter, status int, code, message string, details map[string]interface{}) {
+	body := map[string]interface{}{"success": false, "code": code, "error": message}
+	for key, value := range details {
+		body[key] = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeAPIError 写出 apiError
+func writeAPIError(w http.ResponseWriter, err *apiError) {
+	writeError(w, err.status, err.code, err.message)
+}
+
+// writeErrorFrom 写出 err：apiError 使用自身的状态码和错误码，其他错误使用给定的状态码和错误码
+func writeErrorFrom(w http.ResponseWriter, err error, status int, code string) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		writeAPIError(w, apiErr)
+		return
+	}
+	writeError(w, status, code, err.Error())
+}
+
+// isBodyTooLarge 请求体是否超过了 http.MaxBytesReader 的限制
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// invalidJSONError 解析 JSON 请求体失败的错误，请求体超过大小限制时为 UPLOAD_TOO_LARGE
+func invalidJSONError(err error) *apiError {
+	if isBodyTooLarge(err) {
+		return newAPIError(http.StatusRequestEntityTooLarge, codeUploadTooLarge, "Request body too large")
+	}
+	return newAPIError(http.StatusBadRequest, codeInvalidJSON, "Invalid JSON body: %v", err)
+}
+
+// errFileTooLarge 上传或下载的文件超过 MAX_UPLOAD_SIZE
+func errFileTooLarge() *apiError {
+	return newAPIError(http.StatusRequestEntityTooLarge, codeUploadTooLarge, "File too large")
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 剩余时间预测：每个成功任务完成时按模型和语言对记录每页耗时（throughput_stats 表，指数加权平均），
+// 执行中的任务据此和当前进度估算剩余时间（eta_seconds）。
+// 进度较低时主要依据历史每页耗时，随着进度推进逐渐改为按已用时间和进度外推；
+// 没有历史数据时在进度达到 etaMinProgress 后才给出估算。
+const (
+	etaSmoothing     = 0.2 // 新样本在加权平均中的权重
+	etaMinProgress   = 5
+	etaStatsCacheTTL = time.Minute
+)
+
+type throughputKey struct {
+	model, langIn, langOut string
+}
+
+type throughputStat struct {
+	secondsPerPage float64
+	samples        int
+}
+
+var (
+	throughputMu        sync.Mutex
+	throughputCache     map[throughputKey]throughputStat
+	throughputCacheTime time.Time
+)
+
+func createThroughputStatsTable() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS throughput_stats (
+		model ` + t.Key + ` NOT NULL,
+		lang_in ` + t.Key + ` NOT NULL,
+		lang_out ` + t.Key + ` NOT NULL,
+		seconds_per_page ` + t.Real + ` NOT NULL,
+		samples ` + t.Integer + ` NOT NULL,
+		updated_at ` + t.Time + ` NOT NULL,
+		PRIMARY KEY (model, lang_in, lang_out)
+	)`)
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+}
+
+// taskModel 返回任务使用的模型：任务参数 > 队列配置 > OPENAI_MODEL，与 processTask 传给 babeldoc 的一致
+func taskModel(task *Task) string {
+	if taskTranslator(task) == translatorMock {
+		return translatorMock
+	}
+	if task.Params != "" {
+		var paramsMap map[string]string
+		if err := json.Unmarshal([]byte(task.Params), &paramsMap); err == nil {
+			if model := strings.TrimSpace(paramsMap["openai-model"]); model != "" {
+				return model
+			}
+		}
+	}
+	if qc := findQueueConfig(task.Queue); qc != nil && qc.OpenAIAPIKey != "" {
+		if qc.OpenAIModel != "" {
+			return qc.OpenAIModel
+		}
+	} else if model := os.Getenv("OPENAI_MODEL"); model != "" {
+		return model
+	}
+	return "gpt-4o-mini"
+}
+
+// taskTranslatedPages 返回任务实际翻译的页数，页数未知时返回 0
+func taskTranslatedPages(task *Task) int {
+	if task.PageCount <= 0 {
+		return 0
+	}
+	pages, err := selectedPageCount(task.Pages, task.PageCount)
+	if err != nil {
+		return 0
+	}
+	return pages
+}
+
+// recordThroughput 记录成功任务的每页耗时
+func recordThroughput(task *Task) {
+	pages := taskTranslatedPages(task)
+	if pages == 0 || task.StartedAt == nil || task.CompletedAt == nil {
+		return
+	}
+	seconds := task.CompletedAt.Sub(*task.StartedAt).Seconds()
+	if seconds <= 0 {
+		return
+	}
+	_, err := execWithRetry(`INSERT INTO throughput_stats (model, lang_in, lang_out, seconds_per_page, samples, updated_at)
+		VALUES (?, ?, ?, ?, 1, ?)
+		`+dbStore.Upsert("model", "lang_in", "lang_out")+`
+			seconds_per_page = throughput_stats.seconds_per_page * ? + excluded.seconds_per_page * ?,
+			samples = throughput_stats.samples + 1, updated_at = excluded.updated_at`,
+		taskModel(task), task.LangIn, task.LangOut, seconds/float64(pages), time.Now(), 1-etaSmoothing, etaSmoothing)
+	if err != nil {
+		log.Printf("无法记录任务 %s 的翻译速度: %v", task.ID, err)
+		return
+	}
+	throughputMu.Lock()
+	throughputCache = nil
+	throughputMu.Unlock()
+}
+
+// secondsPerPage 返回模型和语言对的历史每页耗时；语言对没有记录时使用该模型所有语言对的平均值
+func secondsPerPage(model, langIn, langOut string) (float64, bool) {
+	throughputMu.Lock()
+	defer throughputMu.Unlock()
+	if throughputCache == nil || time.Since(throughputCacheTime) > etaStatsCacheTTL {
+		throughputCache = loadThroughputStats()
+		throughputCacheTime = time.Now()
+	}
+
+	if stat, ok := throughputCache[throughputKey{model, langIn, langOut}]; ok {
+		return stat.secondsPerPage, true
+	}
+	var total float64
+	samples := 0
+	for key, stat := range throughputCache {
+		if key.model == model {
+			total += stat.secondsPerPage * float64(stat.samples)
+			samples += stat.samples
+		}
+	}
+	if samples == 0 {
+		return 0, false
+	}
+	return total / float64(samples), true
+}
+
+func loadThroughputStats() map[throughputKey]throughputStat {
+	stats := make(map[throughputKey]throughputStat)
+	rows, err := db.Query(`SELECT model, lang_in, lang_out, seconds_per_page, samples FROM throughput_stats`)
+	if err != nil {
+		log.Printf("无法读取翻译速度统计: %v", err)
+		return stats
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key throughputKey
+		var stat throughputStat
+		if err := rows.Scan(&key.model, &key.langIn, &key.langOut, &stat.secondsPerPage, &stat.samples); err == nil {
+			stats[key] = stat
+		}
+	}
+	return stats
+}
+
+// taskETA 返回执行中任务预计的剩余秒数，无法估算时返回 nil
+func taskETA(task *Task) *int {
+	if task.Status != "running" || task.StartedAt == nil {
+		return nil
+	}
+	elapsed := time.Since(*task.StartedAt).Seconds()
+	progress := float64(task.Progress) / 100
+
+	// 按进度外推
+	extrapolated := -1.0
+	if task.Progress >= etaMinProgress {
+		extrapolated = elapsed * (1 - progress) / progress
+	}
+
+	// 按历史每页耗时
+	historical := -1.0
+	if pages := taskTranslatedPages(task); pages > 0 {
+		if perPage, ok := secondsPerPage(taskModel(task), task.LangIn, task.LangOut); ok {
+			historical = math.Max(perPage*float64(pages)-elapsed, 0)
+		}
+	}
+
+	var remaining float64
+	switch {
+	case historical >= 0 && extrapolated >= 0:
+		remaining = (1-progress)*historical + progress*extrapolated
+	case historical >= 0:
+		remaining = historical
+	case extrapolated >= 0:
+		remaining = extrapolated
+	default:
+		return nil
+	}
+	seconds := int(math.Round(remaining))
+	return &seconds
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// 任务列表和详情的条件请求。tasks 表上的触发器在每次插入、修改和删除时递增 settings 中的版本号
+// （多个实例共享数据库时同样有效），ETag 由版本号和请求参数计算，
+// 客户端携带 If-None-Match 且数据未变化时直接返回 304，不再查询任务。
+const settingTasksVersion = "tasks_version"
+
+func createVersionTriggers() {
+	if _, err := db.Exec(`INSERT INTO settings ("key", value) VALUES ('` + settingTasksVersion + `', '0') ` + dbStore.InsertIgnore(`"key"`)); err != nil {
+		log.Printf("无法创建任务版本触发器，任务列表和详情不支持条件请求: %v", err)
+		return
+	}
+	for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+		err := dbStore.CreateTrigger("tasks_version_"+strings.ToLower(event), "tasks", event,
+			`UPDATE settings SET value = CAST(value AS `+dbStore.Types().Cast+`) + 1 WHERE "key" = '`+settingTasksVersion+`'`)
+		if err != nil {
+			log.Printf("无法创建任务版本触发器，任务列表和详情不支持条件请求: %v", err)
+			return
+		}
+	}
+	// 单个任务的版本号：语句本身没有修改 version 时递增
+	if err := dbStore.CreateVersionTrigger("tasks_row_version", "tasks", "version"); err != nil {
+		log.Printf("无法创建任务版本触发器，任务列表和详情不支持条件请求: %v", err)
+	}
+}
+
+// tasksETag 返回当前任务数据对该请求的 ETag，版本号不可用时返回空字符串。
+// 除版本号外还包含队列暂停状态、等待补写的写入数等不在 tasks 表中的状态，以及进程启动时间（配置可能已变化）
+func tasksETag(r *http.Request) string {
+	version := getSetting(settingTasksVersion)
+	if version == "" {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%s\n%s\n%t\n%d", version, processStartTime.UnixNano(), r.URL.Path, r.URL.RawQuery,
+		isQueuePaused(), pendingWriteCount())
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// checkNotModified 设置 ETag 头；请求的 If-None-Match 与之匹配时写出 304 并返回 true
+func checkNotModified(w http.ResponseWriter, r *http.Request) bool {
+	etag := tasksETag(r)
+	if etag == "" {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	// 允许缓存，但每次使用前都需要重新验证
+	w.Header().Set("Cache-Control", "no-cache")
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 任务事件：任务的生命周期（提交、入队、开始、进度、重试、终止、完成）以及之后的处理（例如结果投递、冷存储归档）
+// 的过程记录，保存在 task_events 表中，通过 GET /api/v1/tasks/{id}/events 按时间顺序查看，用于任务详情页的时间线和排查问题。
+// 任务删除时一并删除。
+
+// TaskEvent 任务的一条事件记录
+type TaskEvent struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"` // 例如 task.created、task.started、task.completed、delivery.succeeded、storage.archived
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 生命周期事件的类型
+const (
+	eventTaskCreated   = "task.created"
+	eventTaskScheduled = "task.scheduled" // 等待计划时间或重试的退避时间
+	eventTaskQueued    = "task.queued"
+	eventTaskStarted   = "task.started"
+	eventTaskStage     = "task.stage"
+	eventTaskProgress  = "task.progress"
+	eventTaskRetried   = "task.retried"  // 出现临时错误，退避后重试
+	eventTaskRequeued  = "task.requeued" // 执行被中断（服务重启等），重新排队
+	eventTaskCanceled  = "task.canceled" // 进程被终止（卡住或超时）
+	eventTaskCompleted = "task.completed"
+	eventTaskFailed    = "task.failed"
+
+	// progressEventStep 每跨过多少个百分点记录一次进度事件
+	progressEventStep = 10
+)
+
+func createTaskEventsTable() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS task_events (
+		id ` + t.ID + `,
+		task_id ` + t.Key + ` NOT NULL,
+		type ` + t.Text + ` NOT NULL,
+		message ` + t.Text + ` NOT NULL,
+		created_at ` + t.Time + ` NOT NULL
+	)`)
+	if err == nil {
+		err = dbStore.CreateIndex("idx_task_events_task", "task_events", "task_id, id", "", false)
+	}
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+}
+
+// recordTaskEvent 记录任务事件，失败时只记录日志
+func recordTaskEvent(taskID, eventType, message string) {
+	if _, err := execWithRetry(`INSERT INTO task_events (task_id, type, message, created_at) VALUES (?, ?, ?, ?)`,
+		taskID, eventType, message, time.Now()); err != nil {
+		log.Printf("无法记录任务 %s 的事件 %s: %v", taskID, eventType, err)
+	}
+}
+
+// recordTransitionEvent 记录任务状态转换对应的生命周期事件，from 为空表示新提交的任务
+func recordTransitionEvent(task *Task, from, to string) {
+	switch {
+	case from == "":
+		recordTaskEvent(task.ID, eventTaskCreated, fmt.Sprintf("提交任务 %s（%s → %s）", task.Filename, task.LangIn, task.LangOut))
+		if to == "scheduled" && task.RunAt != nil {
+			recordTaskEvent(task.ID, eventTaskScheduled, "计划于 "+task.RunAt.Format(time.RFC3339)+" 执行")
+		} else {
+			recordTaskEvent(task.ID, eventTaskQueued, queuedEventMessage(task))
+		}
+	case to == "queued" && from == "running":
+		recordTaskEvent(task.ID, eventTaskRequeued, "执行被中断，重新排队")
+	case to == "queued":
+		recordTaskEvent(task.ID, eventTaskQueued, queuedEventMessage(task))
+	case to == "running":
+		recordTaskEvent(task.ID, eventTaskStarted, fmt.Sprintf("开始第 %d 次执行", task.Attempts+1))
+	case to == "scheduled":
+		recordTaskEvent(task.ID, eventTaskRetried, "出现临时错误，等待重试: "+taskErrorMessage(task.ID))
+	case to == "success":
+		recordTaskEvent(task.ID, eventTaskCompleted, "任务完成")
+	case to == "failed":
+		recordTaskEvent(task.ID, eventTaskFailed, "任务失败: "+taskErrorMessage(task.ID))
+	}
+}
+
+func queuedEventMessage(task *Task) string {
+	if task.Queue != "" {
+		return "进入队列 " + task.Queue
+	}
+	return "进入默认队列"
+}
+
+// taskErrorMessage 读取任务记录的错误信息（状态转换时与状态一起写入）
+func taskErrorMessage(taskID string) string {
+	var message sql.NullString
+	db.QueryRow(`SELECT error FROM tasks WHERE id = ?`, taskID).Scan(&message)
+	return message.String
+}
+
+// 列出任务的事件
+func taskEventsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	taskID := r.PathValue("id")
+	var exists int
+	if err := db.QueryRow(`SELECT 1 FROM tasks WHERE id = ?`, taskID).Scan(&exists); err != nil {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+
+	rows, err := db.Query(`SELECT id, type, message, created_at FROM task_events WHERE task_id = ? ORDER BY id`, taskID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	events := []*TaskEvent{}
+	for rows.Next() {
+		var event TaskEvent
+		if err := rows.Scan(&event.ID, &event.Type, &event.Message, &event.CreatedAt); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		events = append(events, &event)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"events": events})
+}
+
+// deleteTaskEvents 删除任务的全部事件
+func deleteTaskEvents(taskID string) {
+	execWithRetry(`DELETE FROM task_events WHERE task_id = ?`, taskID)
+}
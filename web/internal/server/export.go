@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 导出时每写出多少行刷新一次响应，客户端可以边接收边处理
+const exportFlushRows = 200
+
+// defaultExportFields CSV 未指定 fields 时导出的字段（不含 params 等较大或敏感的字段）
+var defaultExportFields = []string{
+	"id", "filename", "status", "lang_in", "lang_out", "pages", "created_at", "started_at", "completed_at",
+	"error", "queue", "attempts", "tags", "external_id",
+}
+
+// 导出任务列表，逐行查询并以分块编码写出，不在内存中缓存全部结果。
+// format 为 csv、json（默认，JSON 数组）或 ndjson（每行一个 JSON 对象）；fields 和筛选参数与任务列表接口相同，不分页
+func exportTasksHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	query, err := parseListQuery(r.URL.Query())
+	if err == nil && format != "csv" && format != "json" && format != "ndjson" {
+		err = fmt.Errorf("format must be csv, json or ndjson")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	query.limit, query.offset, query.cursor = 0, 0, nil
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=babeldoc-tasks-%s.%s", time.Now().Format("20060102-150405"), format))
+	streamTasks(w, query, format, nil)
+}
+
+// streamTasks 逐行查询符合条件的任务并写出，每 exportFlushRows 行刷新一次响应。
+// meta 不为 nil 时（只用于 json）写出 {"meta": ..., "tasks": [...]}
+func streamTasks(w http.ResponseWriter, query *listQuery, format string, meta *ListMeta) {
+	paused := isQueuePaused()
+	sqlQuery, args := query.sql()
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	contentTypes := map[string]string{"csv": "text/csv; charset=utf-8", "json": "application/json", "ndjson": "application/x-ndjson"}
+	w.Header().Set("Content-Type", contentTypes[format])
+
+	rc := http.NewResponseController(w)
+	buf := bufio.NewWriter(w)
+	var csvWriter *csv.Writer
+	fields := query.fields
+	switch format {
+	case "csv":
+		if fields == nil {
+			fields = defaultExportFields
+		}
+		// UTF-8 BOM，便于 Excel 正确识别中文
+		buf.WriteString("\ufeff")
+		csvWriter = csv.NewWriter(buf)
+		csvWriter.Write(fields)
+	case "json":
+		if meta != nil {
+			data, _ := json.Marshal(meta)
+			buf.WriteString(`{"meta":`)
+			buf.Write(data)
+			buf.WriteString(`,"tasks":`)
+		}
+		buf.WriteString("[")
+	}
+
+	n := 0
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		task.QueuePaused = paused && task.Status == "queued"
+
+		switch format {
+		case "csv":
+			csvWriter.Write(csvRecord(task, fields))
+		case "json":
+			if n > 0 {
+				buf.WriteString(",")
+			}
+			data, _ := json.Marshal(projectTask(task, fields))
+			buf.Write(data)
+		case "ndjson":
+			data, _ := json.Marshal(projectTask(task, fields))
+			buf.Write(data)
+			buf.WriteString("\n")
+		}
+
+		n++
+		if n%exportFlushRows == 0 {
+			if csvWriter != nil {
+				csvWriter.Flush()
+			}
+			if err := buf.Flush(); err != nil {
+				// 客户端已断开
+				return
+			}
+			rc.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		// 响应已经开始，无法再返回错误状态码
+		log.Printf("导出任务列表时查询失败: %v", err)
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+	}
+	if format == "json" {
+		buf.WriteString("]")
+		if meta != nil {
+			buf.WriteString("}")
+		}
+		buf.WriteString("\n")
+	}
+	buf.Flush()
+}
+
+// csvRecord 按字段顺序输出任务的 CSV 行：时间为 RFC3339，列表用分号连接，对象为 JSON
+func csvRecord(task *Task, fields []string) []string {
+	data, _ := json.Marshal(task)
+	var all map[string]interface{}
+	json.Unmarshal(data, &all)
+
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		switch value := all[field].(type) {
+		case nil:
+		case string:
+			record[i] = value
+		case []interface{}:
+			items := make([]string, len(value))
+			for j, item := range value {
+				items[j] = fmt.Sprint(item)
+			}
+			record[i] = strings.Join(items, ";")
+		case map[string]interface{}:
+			encoded, _ := json.Marshal(value)
+			record[i] = string(encoded)
+		default:
+			record[i] = fmt.Sprint(value)
+		}
+	}
+	return record
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// 外部标识：提交时可以通过 external_id 指定调用方系统中的标识（唯一），
+// 之后通过 /api/v1/external-tasks/{external_id} 访问任务，与 /api/v1/tasks/{id} 下的接口一一对应。
+const (
+	externalTaskPrefix = "/external-tasks/{external_id}"
+	maxExternalIDLen   = 128
+)
+
+var externalIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:@-]+$`)
+
+// validateExternalID 检查外部标识的格式，空字符串表示未指定
+func validateExternalID(externalID string) error {
+	if externalID == "" {
+		return nil
+	}
+	if len(externalID) > maxExternalIDLen || !externalIDPattern.MatchString(externalID) {
+		return fmt.Errorf("external_id must be 1-%d characters of letters, digits and . _ : @ -", maxExternalIDLen)
+	}
+	return nil
+}
+
+// taskIDByExternalID 返回外部标识对应的任务ID
+func taskIDByExternalID(externalID string) (string, error) {
+	var taskID string
+	err := db.QueryRow(`SELECT id FROM tasks WHERE external_id = ?`, externalID).Scan(&taskID)
+	return taskID, err
+}
+
+// nullIfEmpty 空字符串存为 NULL（external_id 的唯一索引只约束非空值）
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// nullIfZero 0 存为 NULL
+func nullIfZero(value int64) interface{} {
+	if value == 0 {
+		return nil
+	}
+	return value
+}
+
+// externalTaskPath 将 /tasks/{id} 下的路径转换为对应的外部标识路径，其他路径返回空字符串
+func externalTaskPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "/tasks/{id}"); ok {
+		return externalTaskPrefix + rest
+	}
+	return ""
+}
+
+// byExternalID 将外部标识解析为任务ID后交给原有的处理函数
+func byExternalID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskID, err := taskIDByExternalID(r.PathValue("external_id"))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+			} else {
+				writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			}
+			return
+		}
+		r.SetPathValue("id", taskID)
+		next(w, r)
+	}
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 关注：用户可以关注其他人的某个任务或某个标签（例如导师关注学生提交的翻译任务），不需要管理令牌。
+// 关注的任务（或带有关注标签的任务）结束后，向关注时填写的邮箱发送通知（与 notify_email 相同的模板，只带下载链接、不附带文件），
+// 和/或向 webhook 发送与结束回调相同的请求体（只尝试一次）。
+// 关注只在同一组织内生效：组织由前置认证代理注入的 USER_ORG_HEADER 请求头确定，提交任务时记录在任务上；
+// 只能关注同一组织的任务，标签关注也只匹配同一组织提交的任务。未配置组织时所有用户属于同一个（空的）组织。
+const (
+	maxFollowsPerUser = 100
+	maxFollowTagLen   = 64
+)
+
+var followIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// TaskFollow 用户对一个任务或一个标签的关注
+type TaskFollow struct {
+	ID        string    `json:"id"`
+	TaskID    string    `json:"task_id,omitempty"` // 关注的任务，与 tag 二选一
+	Tag       string    `json:"tag,omitempty"`     // 关注的标签
+	Email     string    `json:"email,omitempty"`   // 通知邮箱
+	Webhook   string    `json:"webhook,omitempty"` // 通知地址
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FollowRequest 新建关注的请求体
+type FollowRequest struct {
+	TaskID  string `json:"task_id"`
+	Tag     string `json:"tag"`
+	Email   string `json:"email"`
+	Webhook string `json:"webhook"`
+}
+
+func createFollowsTable() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS task_follows (
+		id ` + t.Key + ` PRIMARY KEY,
+		user_id ` + t.Key + ` NOT NULL,
+		org_id ` + t.Key + ` NOT NULL DEFAULT '',
+		task_id ` + t.Key + `,
+		tag ` + t.Key + `,
+		email ` + t.Text + `,
+		webhook ` + t.Text + `,
+		created_at ` + t.Time + ` NOT NULL
+	)`)
+	if err == nil {
+		err = dbStore.CreateIndex("idx_task_follows_user", "task_follows", "user_id, created_at", "", false)
+	}
+	if err == nil {
+		err = dbStore.CreateIndex("idx_task_follows_task", "task_follows", "task_id", "task_id IS NOT NULL", false)
+	}
+	if err == nil {
+		err = dbStore.CreateIndex("idx_task_follows_tag", "task_follows", "org_id, tag", "tag IS NOT NULL", false)
+	}
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+}
+
+const followColumns = `id, task_id, tag, email, webhook, created_at`
+
+func scanFollow(row interface{ Scan(...interface{}) error }) (*TaskFollow, error) {
+	var follow TaskFollow
+	var taskID, tag, email, webhook sql.NullString
+	if err := row.Scan(&follow.ID, &taskID, &tag, &email, &webhook, &follow.CreatedAt); err != nil {
+		return nil, err
+	}
+	follow.TaskID = taskID.String
+	follow.Tag = tag.String
+	follow.Email = email.String
+	follow.Webhook = webhook.String
+	return &follow, nil
+}
+
+// parseFollowRequest 解析并校验新建关注的请求体，关注任务时检查任务存在、属于同一组织且尚未结束
+func parseFollowRequest(w http.ResponseWriter, r *http.Request, orgID string) (*FollowRequest, error) {
+	var req FollowRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	req.TaskID = strings.TrimSpace(req.TaskID)
+	req.Tag = strings.TrimSpace(req.Tag)
+	req.Email = strings.TrimSpace(req.Email)
+
+	if (req.TaskID == "") == (req.Tag == "") {
+		return nil, newAPIError(http.StatusBadRequest, codeBadRequest, "exactly one of task_id and tag is required")
+	}
+	if len(req.Tag) > maxFollowTagLen {
+		return nil, newAPIError(http.StatusBadRequest, codeBadRequest, "tag is too long")
+	}
+	if req.Email == "" && req.Webhook == "" {
+		return nil, newAPIError(http.StatusBadRequest, codeBadRequest, "email or webhook is required")
+	}
+	if req.Email != "" {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			return nil, newAPIError(http.StatusBadRequest, codeBadRequest, "invalid email address")
+		}
+	}
+	webhook, err := parseCallbackURL(req.Webhook)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, codeBadRequest, "webhook must be an http(s) URL")
+	}
+	req.Webhook = webhook
+
+	if req.TaskID != "" {
+		task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, req.TaskID))
+		// 其他组织的任务按不存在处理
+		if err == sql.ErrNoRows || (err == nil && task.OrgID != orgID) {
+			return nil, newAPIError(http.StatusNotFound, codeTaskNotFound, "Task not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if task.Status == "success" || task.Status == "failed" {
+			return nil, newAPIError(http.StatusBadRequest, codeBadRequest, "task has already finished")
+		}
+	}
+	return &req, nil
+}
+
+// 我的关注：GET 列出（最近关注的在前），POST 关注一个任务或标签
+func followsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	userID := ensureUserID(w, r)
+	orgID := currentUserOrg(r)
+
+	if r.Method == http.MethodGet {
+		rows, err := db.Query(`SELECT `+followColumns+` FROM task_follows
+			WHERE user_id = ? AND org_id = ? ORDER BY created_at DESC`, userID, orgID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		defer rows.Close()
+		follows := []*TaskFollow{}
+		for rows.Next() {
+			if follow, err := scanFollow(rows); err == nil {
+				follows = append(follows, follow)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"follows": follows})
+		return
+	}
+
+	req, err := parseFollowRequest(w, r, orgID)
+	if err != nil {
+		writeErrorFrom(w, err, http.StatusInternalServerError, codeInternal)
+		return
+	}
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM task_follows WHERE user_id = ?`, userID).Scan(&count)
+	if count >= maxFollowsPerUser {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "too many follows, delete some first")
+		return
+	}
+
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	follow := &TaskFollow{
+		ID:        hex.EncodeToString(buf),
+		TaskID:    req.TaskID,
+		Tag:       req.Tag,
+		Email:     req.Email,
+		Webhook:   req.Webhook,
+		CreatedAt: time.Now().Truncate(time.Second),
+	}
+	if _, err := execWithRetry(`INSERT INTO task_follows (id, user_id, org_id, task_id, tag, email, webhook, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, follow.ID, userID, orgID, nullIfEmpty(follow.TaskID), nullIfEmpty(follow.Tag),
+		nullIfEmpty(follow.Email), nullIfEmpty(follow.Webhook), follow.CreatedAt); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(follow)
+}
+
+// 取消关注
+func followHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := ensureUserID(w, r)
+
+	followID := r.PathValue("id")
+	if !followIDPattern.MatchString(followID) {
+		writeError(w, http.StatusNotFound, codeFollowNotFound, "follow not found: "+followID)
+		return
+	}
+	result, err := execWithRetry(`DELETE FROM task_follows WHERE id = ? AND user_id = ?`, followID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, codeFollowNotFound, "follow not found: "+followID)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// taskFollowers 返回关注了任务或其任一标签的同组织关注
+func taskFollowers(task *Task) ([]*TaskFollow, error) {
+	query := `SELECT ` + followColumns + ` FROM task_follows WHERE org_id = ? AND (task_id = ?`
+	args := []interface{}{task.OrgID, task.ID}
+	if len(task.Tags) > 0 {
+		query += ` OR tag IN (?` + strings.Repeat(", ?", len(task.Tags)-1) + `)`
+		for _, tag := range task.Tags {
+			args = append(args, tag)
+		}
+	}
+	rows, err := db.Query(query+`) ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var follows []*TaskFollow
+	for rows.Next() {
+		follow, err := scanFollow(rows)
+		if err != nil {
+			return nil, err
+		}
+		follows = append(follows, follow)
+	}
+	return follows, rows.Err()
+}
+
+// notifyFollowers 在任务结束后通知关注者；同一邮箱或 webhook 只通知一次，提交者的 notify_email 已单独通知
+func notifyFollowers(task *Task) {
+	follows, err := taskFollowers(task)
+	if err != nil {
+		log.Printf("无法查询任务 %s 的关注者: %v", task.ID, err)
+		return
+	}
+	if len(follows) == 0 {
+		return
+	}
+
+	emails := map[string]bool{strings.ToLower(task.NotifyEmail): true}
+	webhooks := map[string]bool{task.CallbackURL: true}
+	var body []byte
+	var event *CallbackEvent
+	notified := 0
+	for _, follow := range follows {
+		if follow.Email != "" && smtpHost != "" && !emails[strings.ToLower(follow.Email)] {
+			emails[strings.ToLower(follow.Email)] = true
+			if err := sendTaskEmail(task, follow.Email, follow); err != nil {
+				log.Printf("任务 %s 发给关注者 %s 的通知邮件发送失败: %v", task.ID, follow.Email, err)
+			} else {
+				notified++
+			}
+		}
+		if follow.Webhook != "" && !webhooks[follow.Webhook] {
+			webhooks[follow.Webhook] = true
+			if event == nil {
+				event = taskCallbackEvent(task)
+				body, _ = json.Marshal(event)
+			}
+			if err := postCallback(follow.Webhook, event.Event, body); err != nil {
+				log.Printf("任务 %s 发给关注者 %s 的通知失败: %v", task.ID, follow.Webhook, err)
+			} else {
+				notified++
+			}
+		}
+	}
+	if notified > 0 {
+		recordTaskEvent(task.ID, "follow.notified", fmt.Sprintf("已通知 %d 个关注者", notified))
+	}
+}
+
+// deleteTaskFollows 删除对任务的关注（标签关注不受影响）
+func deleteTaskFollows(taskID string) {
+	execWithRetry(`DELETE FROM task_follows WHERE task_id = ?`, taskID)
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缺失字形检测与附加字体：
+//
+//	FONTS_DIR  管理员安装的附加字体目录（默认 DATA_DIR/fonts），独立 worker 进程需要能访问同一目录
+//
+// babeldoc 找不到能显示某个字符的字体时输出 "Can't find font for X(code)" 警告，该字符在译文中会缺失。
+// 任务执行时收集这些字符，记录在任务的 font_warning 上（JSON，只在任务详情中返回），并写入任务日志。
+// 管理员通过 POST /api/v1/admin/fonts 上传包含这些字符的 .ttf/.otf 字体后，之后执行的任务通过环境变量
+// BABELDOC_EXTRA_FONTS_DIR 把该目录传给 babeldoc，作为内置备用字体之后的备用字体；已完成的任务需要重新翻译。
+var fontsDir = envOrDefault("FONTS_DIR", filepath.Join(dataDir, "fonts"))
+
+const (
+	// maxFontWarningChars 记录在任务上的缺失字符数上限
+	maxFontWarningChars = 200
+
+	fontWarningHint = "译文中这些字符没有可用的字体，将显示为空白。请管理员通过 POST /api/v1/admin/fonts 安装包含这些字符的字体（.ttf/.otf），然后重新翻译该任务"
+)
+
+// missingGlyphPattern 匹配 babeldoc 的缺失字体警告，捕获字符的码位
+var missingGlyphPattern = regexp.MustCompile(`Can't find font for .*?\((\d+)\)`)
+
+// fontFileMagic 字体文件开头的标识：TrueType、OpenType（CFF）和苹果的 TrueType
+var fontFileMagic = [][]byte{{0x00, 0x01, 0x00, 0x00}, []byte("OTTO"), []byte("true")}
+
+// FontWarning 任务执行中 babeldoc 找不到字体的字符
+type FontWarning struct {
+	Chars     []string `json:"chars"`               // 缺失的字符（去重，按出现顺序）
+	Codes     []string `json:"codes"`               // 对应的码位，形如 U+4E00
+	Count     int      `json:"count"`               // 出现次数
+	Truncated bool     `json:"truncated,omitempty"` // 缺失的字符超过上限，只记录了前面的部分
+	Message   string   `json:"message"`             // 处理建议
+}
+
+// parseMissingGlyphLine 从 babeldoc 的一行输出中解析缺失字体的字符
+func parseMissingGlyphLine(line string) (rune, bool) {
+	m := missingGlyphPattern.FindStringSubmatch(line)
+	if m == nil {
+		return 0, false
+	}
+	code, err := strconv.ParseInt(m[1], 10, 32)
+	if err != nil || code <= 0 {
+		return 0, false
+	}
+	return rune(code), true
+}
+
+// glyphCollector 收集一次执行中缺失字体的字符，可以被多个 goroutine 同时调用
+type glyphCollector struct {
+	mu      sync.Mutex
+	seen    map[rune]bool
+	warning FontWarning
+}
+
+func newGlyphCollector() *glyphCollector {
+	return &glyphCollector{seen: make(map[rune]bool)}
+}
+
+func (c *glyphCollector) add(char rune) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warning.Count++
+	if c.seen[char] {
+		return
+	}
+	c.seen[char] = true
+	if len(c.warning.Chars) >= maxFontWarningChars {
+		c.warning.Truncated = true
+		return
+	}
+	c.warning.Chars = append(c.warning.Chars, string(char))
+	c.warning.Codes = append(c.warning.Codes, fmt.Sprintf("U+%04X", char))
+}
+
+// save 记录本次执行的缺失字符（没有时清除之前执行的记录），返回记录的警告
+func (c *glyphCollector) save(taskID string) *FontWarning {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.warning.Count == 0 {
+		execWithRetry(`UPDATE tasks SET font_warning = NULL WHERE id = ?`, taskID)
+		return nil
+	}
+	warning := c.warning
+	warning.Message = fontWarningHint
+	data, _ := json.Marshal(&warning)
+	if _, err := execWithRetry(`UPDATE tasks SET font_warning = ? WHERE id = ?`, string(data), taskID); err != nil {
+		log.Printf("无法记录任务 %s 的缺失字体: %v", taskID, err)
+	}
+	return &warning
+}
+
+// loadFontWarning 读取任务的缺失字体警告，没有时返回 nil
+func loadFontWarning(taskID string) *FontWarning {
+	var data *string
+	if err := db.QueryRow(`SELECT font_warning FROM tasks WHERE id = ?`, taskID).Scan(&data); err != nil || data == nil || *data == "" {
+		return nil
+	}
+	var warning FontWarning
+	if err := json.Unmarshal([]byte(*data), &warning); err != nil {
+		return nil
+	}
+	return &warning
+}
+
+// extraFontsEnv 有已安装的附加字体时返回传给 babeldoc 的环境变量
+func extraFontsEnv() []string {
+	if fonts, _ := listFonts(); len(fonts) == 0 {
+		return nil
+	}
+	return []string{"BABELDOC_EXTRA_FONTS_DIR=" + fontsDir}
+}
+
+// InstalledFont 已安装的附加字体
+type InstalledFont struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// isFontFilename 是否为 babeldoc 加载的附加字体文件名
+func isFontFilename(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".ttf" || ext == ".otf"
+}
+
+func listFonts() ([]InstalledFont, error) {
+	entries, err := os.ReadDir(fontsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var fonts []InstalledFont
+	for _, entry := range entries {
+		if entry.IsDir() || !isFontFilename(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		fonts = append(fonts, InstalledFont{Name: entry.Name(), Size: info.Size(), ModifiedAt: info.ModTime()})
+	}
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i].Name < fonts[j].Name })
+	return fonts, nil
+}
+
+// 列出已安装的附加字体
+func listFontsHandler(w http.ResponseWriter, r *http.Request) {
+	fonts, err := listFonts()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Failed to list fonts")
+		return
+	}
+	if fonts == nil {
+		fonts = []InstalledFont{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"fonts": fonts})
+}
+
+// 安装附加字体（multipart 的 file 字段，可以有多个），同名字体会被替换
+func installFontHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		if isBodyTooLarge(err) {
+			writeAPIError(w, errFileTooLarge())
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid multipart form: %v", err))
+		return
+	}
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		writeError(w, http.StatusBadRequest, codeFileRequired, "Error retrieving file")
+		return
+	}
+	if err := os.MkdirAll(fontsDir, 0755); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Failed to create fonts directory")
+		return
+	}
+
+	var installed []InstalledFont
+	for _, header := range headers {
+		name := filepath.Base(header.Filename)
+		if !isFontFilename(name) || strings.HasPrefix(name, ".") {
+			writeError(w, http.StatusBadRequest, codeUnsupportedFile, fmt.Sprintf("%s: only .ttf and .otf fonts are supported", header.Filename))
+			return
+		}
+		data, err := readFormFile(header)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeFileRequired, "Error retrieving file")
+			return
+		}
+		if !isFontData(data) {
+			writeError(w, http.StatusBadRequest, codeUnsupportedFile, fmt.Sprintf("%s is not a TrueType or OpenType font", header.Filename))
+			return
+		}
+		// 先写入临时文件再改名，正在启动的任务不会读到不完整的字体
+		tmp := filepath.Join(fontsDir, "."+name+".tmp")
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Failed to save font")
+			return
+		}
+		if err := os.Rename(tmp, filepath.Join(fontsDir, name)); err != nil {
+			os.Remove(tmp)
+			writeError(w, http.StatusInternalServerError, codeInternal, "Failed to save font")
+			return
+		}
+		log.Printf("已安装附加字体 %s（%d 字节）", name, len(data))
+		installed = append(installed, InstalledFont{Name: name, Size: int64(len(data)), ModifiedAt: time.Now()})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"fonts": installed})
+}
+
+// 删除附加字体
+func deleteFontHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name != filepath.Base(name) || !isFontFilename(name) || strings.HasPrefix(name, ".") {
+		writeError(w, http.StatusNotFound, codeFontNotFound, "Font not found")
+		return
+	}
+	if err := os.Remove(filepath.Join(fontsDir, name)); err != nil {
+		if os.IsNotExist(err) {
+			writeError(w, http.StatusNotFound, codeFontNotFound, "Font not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "Failed to delete font")
+		return
+	}
+	log.Printf("已删除附加字体 %s", name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+func readFormFile(header *multipart.FileHeader) ([]byte, error) {
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func isFontData(data []byte) bool {
+	for _, magic := range fontFileMagic {
+		if bytes.HasPrefix(data, magic) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,375 @@
+package server
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Google Cloud Storage 配置：
+//
+//	GCS_CREDENTIALS_FILE  服务账号的 JSON 密钥文件（默认取 GOOGLE_APPLICATION_CREDENTIALS）；
+//	                      未设置时从 GCE/GKE 的元数据服务器获取访问令牌，此时不能生成签名链接
+//	GCS_ENDPOINT          服务地址（默认 https://storage.googleapis.com，可指向模拟器）
+//
+// 使用 JSON API 读写对象，访问令牌由服务账号签发的 JWT 换取（到期前自动刷新）；签名链接使用 V4 签名（GOOG4-RSA-SHA256）。
+const (
+	gcsDefaultEndpoint = "https://storage.googleapis.com"
+	gcsScope           = "https://www.googleapis.com/auth/devstorage.read_write"
+	gcsMetadataToken   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+var gcsHTTPClient = &http.Client{Timeout: 10 * time.Minute}
+
+type gcsClient struct {
+	endpoint string
+	email    string          // 服务账号邮箱，使用元数据服务器时为空
+	key      *rsa.PrivateKey // 服务账号私钥，使用元数据服务器时为 nil
+	tokenURI string
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// gcsServiceAccount 服务账号 JSON 密钥文件中用到的字段
+type gcsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+func newGCSClientFromEnv() (*gcsClient, error) {
+	c := &gcsClient{endpoint: strings.TrimRight(envOrDefault("GCS_ENDPOINT", gcsDefaultEndpoint), "/")}
+	path := envOrDefault("GCS_CREDENTIALS_FILE", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取 GCS 凭据: %w", err)
+	}
+	var account gcsServiceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("无法解析 GCS 凭据: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("GCS 凭据不是服务账号密钥（缺少 client_email 或 private_key）")
+	}
+	key, err := parseRSAPrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析 GCS 服务账号私钥: %w", err)
+	}
+	c.email, c.key = account.ClientEmail, key
+	c.tokenURI = account.TokenURI
+	if c.tokenURI == "" {
+		c.tokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return c, nil
+}
+
+// parseRSAPrivateKey 解析 PEM 格式的 PKCS#8 或 PKCS#1 RSA 私钥
+func parseRSAPrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("不是 PEM 格式")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("不是 RSA 私钥")
+	}
+	return key, nil
+}
+
+// accessToken 返回有效的访问令牌，到期前 1 分钟重新获取
+func (c *gcsClient) accessToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Until(c.tokenExpiry) > time.Minute {
+		return c.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	if c.key != nil {
+		assertion, err := c.signJWT(time.Now())
+		if err != nil {
+			return "", err
+		}
+		form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+		req, err = http.NewRequest(http.MethodPost, c.tokenURI, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req, err = http.NewRequest(http.MethodGet, gcsMetadataToken, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+	}
+	resp, err := gcsHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("无法获取 GCS 访问令牌: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("无法获取 GCS 访问令牌: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("无法解析 GCS 访问令牌响应: %v", err)
+	}
+	c.token = token.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// signJWT 生成换取访问令牌的 JWT（RS256）
+func (c *gcsClient) signJWT(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   c.email,
+		"scope": gcsScope,
+		"aud":   c.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	signature, err := c.signRSA([]byte(unsigned))
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (c *gcsClient) signRSA(data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, sum[:])
+}
+
+// do 发送带访问令牌的请求，非 2xx 响应返回错误（404 时错误包含 os.ErrNotExist）
+func (c *gcsClient) do(method, rawURL string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	token, err := c.accessToken()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := gcsHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		err := fmt.Errorf("GCS %s: HTTP %d: %s", method, resp.StatusCode, strings.TrimSpace(string(msg)))
+		if resp.StatusCode == http.StatusNotFound {
+			err = fmt.Errorf("%w: %v", os.ErrNotExist, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *gcsClient) objectURL(bucket, name string) string {
+	return c.endpoint + "/storage/v1/b/" + url.PathEscape(bucket) + "/o/" + url.PathEscape(name)
+}
+
+// gcsStorage 以 Google Cloud Storage 的 bucket/prefix 作为存储
+type gcsStorage struct {
+	client *gcsClient
+	bucket string
+	prefix string
+}
+
+func (s *gcsStorage) Put(key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	query := url.Values{"uploadType": {"media"}, "name": {joinKeyPrefix(s.prefix, key)}}
+	resp, err := s.client.do(http.MethodPost, s.client.endpoint+"/upload/storage/v1/b/"+url.PathEscape(s.bucket)+"/o?"+query.Encode(),
+		f, info.Size(), "application/pdf")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *gcsStorage) Get(key, path string) error {
+	resp, err := s.client.do(http.MethodGet, s.client.objectURL(s.bucket, joinKeyPrefix(s.prefix, key))+"?alt=media", nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return writeFileAtomic(path, resp.Body)
+}
+
+func (s *gcsStorage) Delete(key string) error {
+	resp, err := s.client.do(http.MethodDelete, s.client.objectURL(s.bucket, joinKeyPrefix(s.prefix, key)), nil, 0, "")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *gcsStorage) List(prefix string) ([]StoredObject, error) {
+	var objects []StoredObject
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {joinKeyPrefix(s.prefix, prefix)}, "fields": {"items(name,size,updated),nextPageToken"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		resp, err := s.client.do(http.MethodGet, s.client.endpoint+"/storage/v1/b/"+url.PathEscape(s.bucket)+"/o?"+query.Encode(), nil, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items []struct {
+				Name    string    `json:"name"`
+				Size    string    `json:"size"` // JSON API 以字符串表示 64 位整数
+				Updated time.Time `json:"updated"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("GCS list %s: %v", prefix, err)
+		}
+		for _, item := range page.Items {
+			size, _ := strconv.ParseInt(item.Size, 10, 64)
+			objects = append(objects, StoredObject{Key: item.Name, Size: size, ModTime: item.Updated})
+		}
+		if page.NextPageToken == "" {
+			return trimObjectPrefix(objects, s.prefix), nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// SignedURL 生成 V4 签名链接，需要服务账号私钥，有效期最长 7 天
+func (s *gcsStorage) SignedURL(key, filename string, expires time.Duration) (string, error) {
+	return s.client.signedURL(s.bucket, joinKeyPrefix(s.prefix, key), filename, expires, time.Now().UTC())
+}
+
+func (c *gcsClient) signedURL(bucket, name, filename string, expires time.Duration, now time.Time) (string, error) {
+	if c.key == nil {
+		return "", fmt.Errorf("%w: GCS 签名链接需要服务账号密钥（GCS_CREDENTIALS_FILE）", errSignedURLUnsupported)
+	}
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", fmt.Errorf("GCS 签名链接的有效期必须在 1s 到 7 天之间")
+	}
+	base, err := url.Parse(c.endpoint)
+	if err != nil {
+		return "", err
+	}
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = gcsEscape(segment)
+	}
+	path := "/" + gcsEscape(bucket) + "/" + strings.Join(segments, "/")
+
+	timestamp := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/auto/storage/goog4_request"
+	query := map[string]string{
+		"X-Goog-Algorithm":     "GOOG4-RSA-SHA256",
+		"X-Goog-Credential":    c.email + "/" + scope,
+		"X-Goog-Date":          timestamp,
+		"X-Goog-Expires":       strconv.Itoa(int(expires.Seconds())),
+		"X-Goog-SignedHeaders": "host",
+	}
+	if filename != "" {
+		query["response-content-disposition"] = attachmentDisposition(filename)
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, gcsEscape(k)+"="+gcsEscape(query[k]))
+	}
+	canonicalQuery := strings.Join(pairs, "&")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		path,
+		canonicalQuery,
+		"host:" + base.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "GOOG4-RSA-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+	signature, err := c.signRSA([]byte(stringToSign))
+	if err != nil {
+		return "", err
+	}
+	return base.Scheme + "://" + base.Host + path + "?" + canonicalQuery + "&X-Goog-Signature=" + hex.EncodeToString(signature), nil
+}
+
+// gcsEscape 按 RFC 3986 百分号编码（只保留字母、数字和 -_.~）
+func gcsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func (s *gcsStorage) String() string { return "gs://" + s.bucket + "/" + s.prefix }
@@ -0,0 +1,719 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GraphQL 查询接口，看板可以在一个请求中只取需要的字段，无需组合列表和多次详情请求：
+//
+//	query($n: Int) { tasks(status: ["running", "queued"], limit: $n) { id filename status progress duration_seconds } }
+//
+// 只支持查询（不支持 mutation、fragment 和指令），模式如下：
+//
+//	type Query {
+//	  tasks(q, status, lang_in, lang_out, external_id, created_after, created_before, limit = 20, offset, cursor): [Task!]!
+//	  taskCount(q, status, lang_in, lang_out, external_id, created_after, created_before): Int!
+//	  task(id, external_id): Task
+//	}
+//
+// Task 的字段与任务详情接口的 JSON 字段相同，另有 duration_seconds（执行耗时，执行中的任务为已执行时长）。
+// 筛选参数的含义与任务列表接口相同。
+
+const (
+	graphQLDefaultLimit = 20
+	maxGraphQLBodySize  = 1 << 20
+)
+
+// graphQLListArgs tasks 和 taskCount 接受的筛选参数，与任务列表接口的查询参数同名
+var graphQLListArgs = map[string]bool{
+	"q": true, "status": true, "lang_in": true, "lang_out": true, "external_id": true,
+	"created_after": true, "created_before": true,
+}
+
+// graphQLComputedFields Task 上不属于 JSON 字段、由服务计算的字段
+var graphQLComputedFields = map[string]bool{"duration_seconds": true, "__typename": true}
+
+// gqlField 查询中的一个字段
+type gqlField struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	selections []*gqlField
+}
+
+func (f *gqlField) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// gqlObject 按查询中的顺序输出字段的 JSON 对象
+type gqlObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newGQLObject() *gqlObject {
+	return &gqlObject{values: make(map[string]interface{})}
+}
+
+func (o *gqlObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// GraphQL 查询，支持 POST（JSON 请求体 {"query", "variables"}）和 GET（query、variables 查询参数）
+func graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				writeAPIError(w, invalidJSONError(err))
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBodySize)).Decode(&req); err != nil {
+		writeAPIError(w, invalidJSONError(err))
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeGraphQLError(w, newAPIError(http.StatusBadRequest, codeBadRequest, "query is required"))
+		return
+	}
+
+	selections, err := parseGraphQL(req.Query, req.Variables)
+	if err != nil {
+		writeGraphQLError(w, newAPIError(http.StatusBadRequest, codeBadRequest, "%v", err))
+		return
+	}
+	data, err := resolveQuery(selections)
+	if err != nil {
+		writeGraphQLError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// writeGraphQLError 写出统一格式的错误响应，同时带有 GraphQL 客户端识别的 errors 字段
+func writeGraphQLError(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*apiError)
+	if !ok {
+		apiErr = newAPIError(http.StatusInternalServerError, codeInternal, "%v", err)
+	}
+	writeErrorDetails(w, apiErr.status, apiErr.code, apiErr.message, map[string]interface{}{
+		"errors": []interface{}{map[string]interface{}{
+			"message":    apiErr.message,
+			"extensions": map[string]string{"code": apiErr.code},
+		}},
+	})
+}
+
+func badQuery(format string, args ...interface{}) *apiError {
+	return newAPIError(http.StatusBadRequest, codeBadRequest, format, args...)
+}
+
+// resolveQuery 执行 Query 类型上的字段
+func resolveQuery(selections []*gqlField) (*gqlObject, error) {
+	data := newGQLObject()
+	for _, field := range selections {
+		var value interface{}
+		var err error
+		switch field.name {
+		case "__typename":
+			value = "Query"
+		case "tasks":
+			value, err = resolveTasks(field)
+		case "taskCount":
+			value, err = resolveTaskCount(field)
+		case "task":
+			value, err = resolveTask(field)
+		default:
+			err = badQuery("Cannot query field %q on type \"Query\"", field.name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		data.set(field.key(), value)
+	}
+	return data, nil
+}
+
+// listQueryFromArgs 将 tasks/taskCount 的参数转换为任务列表接口的查询条件
+func listQueryFromArgs(field *gqlField, allowPaging bool) (*listQuery, error) {
+	values := url.Values{}
+	for name, value := range field.args {
+		paging := name == "limit" || name == "offset" || name == "cursor"
+		if !graphQLListArgs[name] && !(allowPaging && paging) {
+			return nil, badQuery("Unknown argument %q on field %q", name, field.name)
+		}
+		if value != nil {
+			values.Set(name, argString(value))
+		}
+	}
+	if allowPaging && values.Get("limit") == "" {
+		values.Set("limit", strconv.Itoa(graphQLDefaultLimit))
+	}
+	query, err := parseListQuery(values)
+	if err != nil {
+		return nil, badQuery("%v", err)
+	}
+	return query, nil
+}
+
+// argString 将参数值转换为查询参数格式，列表用逗号连接
+func argString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = argString(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+func resolveTasks(field *gqlField) (interface{}, error) {
+	if err := validateSelections("Task", reflect.TypeOf(Task{}), field); err != nil {
+		return nil, err
+	}
+	query, err := listQueryFromArgs(field, true)
+	if err != nil {
+		return nil, err
+	}
+	sqlQuery, args := query.sql()
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paused := isQueuePaused()
+	result := []interface{}{}
+	for rows.Next() && len(result) < query.limit {
+		task, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		task.QueuePaused = paused && task.Status == "queued"
+		result = append(result, taskObject(task, field.selections))
+	}
+	return result, rows.Err()
+}
+
+func resolveTaskCount(field *gqlField) (interface{}, error) {
+	if len(field.selections) > 0 {
+		return nil, badQuery("Field \"taskCount\" of type \"Int\" must not have a selection")
+	}
+	query, err := listQueryFromArgs(field, false)
+	if err != nil {
+		return nil, err
+	}
+	countQuery, countArgs := query.countSQL()
+	var total int
+	err = db.QueryRow(countQuery, countArgs...).Scan(&total)
+	return total, err
+}
+
+func resolveTask(field *gqlField) (interface{}, error) {
+	if err := validateSelections("Task", reflect.TypeOf(Task{}), field); err != nil {
+		return nil, err
+	}
+	for name := range field.args {
+		if name != "id" && name != "external_id" {
+			return nil, badQuery("Unknown argument %q on field \"task\"", name)
+		}
+	}
+	taskID := argString(field.args["id"])
+	if externalID, ok := field.args["external_id"]; ok && externalID != nil {
+		id, err := taskIDByExternalID(argString(externalID))
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		taskID = id
+	} else if field.args["id"] == nil {
+		return nil, badQuery("Field \"task\" requires an id or external_id argument")
+	}
+
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, taskID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	task.QueuePaused = task.Status == "queued" && isQueuePaused()
+	return taskObject(task, field.selections), nil
+}
+
+// validateSelections 检查对象类型字段的子字段：必须有子字段，且子字段存在；嵌套对象递归检查
+func validateSelections(typeName string, t reflect.Type, field *gqlField) error {
+	if len(field.selections) == 0 {
+		return badQuery("Field %q of type %q must have a selection of subfields", field.name, typeName)
+	}
+	fields := structJSONFields(t)
+	for _, sel := range field.selections {
+		if typeName == "Task" && graphQLComputedFields[sel.name] {
+			if len(sel.selections) > 0 {
+				return badQuery("Field %q must not have a selection", sel.name)
+			}
+			continue
+		}
+		ft, ok := fields[sel.name]
+		if !ok {
+			return badQuery("Cannot query field %q on type %q", sel.name, typeName)
+		}
+		if len(sel.args) > 0 {
+			return badQuery("Field %q does not accept arguments", sel.name)
+		}
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}) {
+			if err := validateSelections(ft.Name(), ft, sel); err != nil {
+				return err
+			}
+		} else if len(sel.selections) > 0 {
+			return badQuery("Field %q must not have a selection", sel.name)
+		}
+	}
+	return nil
+}
+
+// structJSONFields 返回结构体的 JSON 字段名及其类型
+func structJSONFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = t.Field(i).Type
+		}
+	}
+	return fields
+}
+
+// taskObject 按查询的字段输出任务，字段已经过 validateSelections 检查
+func taskObject(task *Task, selections []*gqlField) *gqlObject {
+	data, _ := json.Marshal(task)
+	var all map[string]interface{}
+	json.Unmarshal(data, &all)
+
+	obj := newGQLObject()
+	for _, sel := range selections {
+		switch sel.name {
+		case "__typename":
+			obj.set(sel.key(), "Task")
+		case "duration_seconds":
+			obj.set(sel.key(), taskDuration(task))
+		default:
+			obj.set(sel.key(), projectValue(all[sel.name], sel.selections))
+		}
+	}
+	return obj
+}
+
+// projectValue 只保留嵌套对象中查询的字段
+func projectValue(value interface{}, selections []*gqlField) interface{} {
+	nested, ok := value.(map[string]interface{})
+	if !ok || len(selections) == 0 {
+		return value
+	}
+	obj := newGQLObject()
+	for _, sel := range selections {
+		obj.set(sel.key(), nested[sel.name])
+	}
+	return obj
+}
+
+// taskDuration 返回任务的执行耗时（秒），执行中的任务为已执行时长，未开始时为 nil
+func taskDuration(task *Task) interface{} {
+	if task.StartedAt == nil {
+		return nil
+	}
+	end := time.Now()
+	if task.CompletedAt != nil {
+		end = *task.CompletedAt
+	}
+	return int(end.Sub(*task.StartedAt).Seconds())
+}
+
+// GraphQL 查询的词法与语法分析
+
+type gqlToken struct {
+	kind  byte // 'n' 名称，'s' 字符串，'#' 数字，'p' 标点，0 结束
+	value string
+}
+
+type gqlParser struct {
+	tokens    []gqlToken
+	pos       int
+	variables map[string]interface{}
+}
+
+// parseGraphQL 解析只包含一个查询操作的文档，返回其顶层字段；variables 为请求中的变量
+func parseGraphQL(source string, variables map[string]interface{}) ([]*gqlField, error) {
+	tokens, err := lexGraphQL(source)
+	if err != nil {
+		return nil, err
+	}
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	p := &gqlParser{tokens: tokens, variables: variables}
+
+	if tok := p.peek(); tok.kind == 'n' {
+		switch tok.value {
+		case "query":
+			p.next()
+			if p.peek().kind == 'n' {
+				p.next()
+			}
+			if p.peekPunct("(") {
+				if err := p.parseVariableDefinitions(); err != nil {
+					return nil, err
+				}
+			}
+		case "mutation", "subscription":
+			return nil, fmt.Errorf("%s operations are not supported", tok.value)
+		case "fragment":
+			return nil, fmt.Errorf("fragments are not supported")
+		default:
+			return nil, fmt.Errorf("unexpected %q", tok.value)
+		}
+	}
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != 0 {
+		return nil, fmt.Errorf("only a single query operation is supported, unexpected %q", tok.value)
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) peek() gqlToken {
+	if p.pos >= len(p.tokens) {
+		return gqlToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	tok := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *gqlParser) peekPunct(value string) bool {
+	tok := p.peek()
+	return tok.kind == 'p' && tok.value == value
+}
+
+func (p *gqlParser) expectPunct(value string) error {
+	if tok := p.next(); tok.kind != 'p' || tok.value != value {
+		return unexpectedToken(tok, value)
+	}
+	return nil
+}
+
+func (p *gqlParser) expectName() (string, error) {
+	tok := p.next()
+	if tok.kind != 'n' {
+		return "", unexpectedToken(tok, "a name")
+	}
+	return tok.value, nil
+}
+
+func unexpectedToken(tok gqlToken, expected string) error {
+	if tok.kind == 0 {
+		return fmt.Errorf("unexpected end of query, expected %s", expected)
+	}
+	return fmt.Errorf("unexpected %q, expected %s", tok.value, expected)
+}
+
+// parseVariableDefinitions 解析 ($name: Type = default, ...)，类型不做检查，未提供的变量使用默认值
+func (p *gqlParser) parseVariableDefinitions() error {
+	p.next()
+	for !p.peekPunct(")") {
+		if err := p.expectPunct("$"); err != nil {
+			return err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if p.peekPunct("=") {
+			p.next()
+			value, err := p.parseValue()
+			if err != nil {
+				return err
+			}
+			if _, ok := p.variables[name]; !ok {
+				p.variables[name] = value
+			}
+		}
+	}
+	p.next()
+	return nil
+}
+
+func (p *gqlParser) skipType() error {
+	if p.peekPunct("[") {
+		p.next()
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.expectName(); err != nil {
+		return err
+	}
+	if p.peekPunct("!") {
+		p.next()
+	}
+	return nil
+}
+
+func (p *gqlParser) parseSelectionSet() ([]*gqlField, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	var fields []*gqlField
+	for !p.peekPunct("}") {
+		if p.peekPunct("...") {
+			return nil, fmt.Errorf("fragments are not supported")
+		}
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	p.next()
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("selection set must not be empty")
+	}
+	return fields, nil
+}
+
+func (p *gqlParser) parseField() (*gqlField, error) {
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	field := &gqlField{name: name}
+	if p.peekPunct(":") {
+		p.next()
+		field.alias = name
+		if field.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peekPunct("(") {
+		p.next()
+		field.args = make(map[string]interface{})
+		for !p.peekPunct(")") {
+			argName, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(":"); err != nil {
+				return nil, err
+			}
+			if field.args[argName], err = p.parseValue(); err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+	}
+	if p.peekPunct("@") {
+		return nil, fmt.Errorf("directives are not supported")
+	}
+	if p.peekPunct("{") {
+		if field.selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// parseValue 解析参数值：字符串、数字、布尔、null、枚举（按字符串处理）、列表、对象或变量
+func (p *gqlParser) parseValue() (interface{}, error) {
+	tok := p.next()
+	switch tok.kind {
+	case 's':
+		return tok.value, nil
+	case '#':
+		return strconv.ParseFloat(tok.value, 64)
+	case 'n':
+		switch tok.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return tok.value, nil
+	case 'p':
+		switch tok.value {
+		case "$":
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			return p.variables[name], nil
+		case "[":
+			list := []interface{}{}
+			for !p.peekPunct("]") {
+				value, err := p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			obj := make(map[string]interface{})
+			for !p.peekPunct("}") {
+				name, err := p.expectName()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expectPunct(":"); err != nil {
+					return nil, err
+				}
+				if obj[name], err = p.parseValue(); err != nil {
+					return nil, err
+				}
+			}
+			p.next()
+			return obj, nil
+		}
+	}
+	return nil, unexpectedToken(tok, "a value")
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// lexGraphQL 将查询拆分为记号，忽略空白、逗号和 # 注释
+func lexGraphQL(source string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(source[i:], "..."):
+			tokens = append(tokens, gqlToken{'p', "..."})
+			i += 3
+		case strings.ContainsRune("!$():=@[]{}", rune(c)):
+			tokens = append(tokens, gqlToken{'p', string(c)})
+			i++
+		case isNameStart(c):
+			start := i
+			for i < len(source) && (isNameStart(source[i]) || isDigit(source[i])) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{'n', source[start:i]})
+		case c == '-' || isDigit(c):
+			start := i
+			i++
+			for i < len(source) && (isDigit(source[i]) || strings.ContainsRune(".eE+-", rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{'#', source[start:i]})
+		case c == '"':
+			if strings.HasPrefix(source[i:], `"""`) {
+				return nil, fmt.Errorf("block strings are not supported")
+			}
+			start := i
+			for i++; i < len(source) && source[i] != '"'; i++ {
+				if source[i] == '\\' {
+					i++
+				} else if source[i] == '\n' {
+					break
+				}
+			}
+			if i >= len(source) || source[i] != '"' {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			i++
+			// GraphQL 字符串的转义规则与 JSON 相同
+			var value string
+			if err := json.Unmarshal([]byte(source[start:i]), &value); err != nil {
+				return nil, fmt.Errorf("invalid string %s", source[start:i])
+			}
+			tokens = append(tokens, gqlToken{'s', value})
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// worker 心跳：每个 worker 定期将当前任务、阶段和日志写入位置记录到数据库（worker_heartbeats 表），
+// 供 /api/v1/admin/workers 和外部监控查询；/api/v1/workers 只返回存活 worker 的状态摘要。
+//
+//	HEARTBEAT_INTERVAL   心跳间隔（默认 15s）；超过 3 个间隔没有心跳的 worker 视为已停止
+//	WORKER_WEDGED_AFTER  执行中的任务超过该时长没有新的输出时标记为 wedged（默认 10m）
+var (
+	heartbeatInterval = parseDurationEnv("HEARTBEAT_INTERVAL", 15*time.Second)
+	workerWedgedAfter = parseDurationEnv("WORKER_WEDGED_AFTER", 10*time.Minute)
+)
+
+// 停止心跳超过该时长的记录会被删除
+const heartbeatRetention = 24 * time.Hour
+
+// worker 的阶段
+const (
+	stageIdle        = "idle"
+	stagePaused      = "paused"
+	stageDiskLow     = "disk_low"
+	stagePreparing   = "preparing"
+	stageTranslating = "translating"
+	stageFinishing   = "finishing"
+)
+
+// WorkerHeartbeat 一个 worker 最近一次上报的状态
+type WorkerHeartbeat struct {
+	WorkerID      string     `json:"worker_id"`
+	Node          string     `json:"node"`
+	Queue         string     `json:"queue"`
+	TaskID        string     `json:"task_id,omitempty"`
+	Stage         string     `json:"stage"`
+	Progress      int        `json:"progress"`
+	PID           int        `json:"pid,omitempty"` // 正在运行的 babeldoc 进程号，只在执行翻译期间有值
+	LogOffset     int64      `json:"log_offset"`
+	StartedAt     time.Time  `json:"started_at"`
+	TaskStartedAt *time.Time `json:"task_started_at,omitempty"`
+	LastOutputAt  *time.Time `json:"last_output_at,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// 以下字段在查询时计算
+	Alive       bool  `json:"alive"`
+	Wedged      bool  `json:"wedged"`
+	TaskSeconds int64 `json:"task_seconds,omitempty"`
+}
+
+// workerHeartbeat 本实例中一个 worker 的心跳状态
+type workerHeartbeat struct {
+	mu    sync.Mutex
+	state WorkerHeartbeat
+}
+
+func newWorkerHeartbeat(queueName string, index int) *workerHeartbeat {
+	node, _ := os.Hostname()
+	hb := &workerHeartbeat{state: WorkerHeartbeat{
+		WorkerID:  fmt.Sprintf("%s-%d-%s-%d", node, os.Getpid(), queueName, index),
+		Node:      node,
+		Queue:     queueName,
+		Stage:     stageIdle,
+		StartedAt: time.Now(),
+	}}
+	hb.flush()
+	go hb.run()
+	return hb
+}
+
+// run 定期写入心跳
+func (hb *workerHeartbeat) run() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		hb.flush()
+		db.Exec(`DELETE FROM worker_heartbeats WHERE updated_at < ?`, time.Now().Add(-heartbeatRetention))
+	}
+}
+
+// setStage 更新阶段并立即写入
+func (hb *workerHeartbeat) setStage(stage string) {
+	if hb == nil {
+		return
+	}
+	hb.mu.Lock()
+	hb.state.Stage = stage
+	hb.mu.Unlock()
+	hb.flush()
+}
+
+// startTask 记录开始执行的任务，logOffset 为日志文件当前的大小
+func (hb *workerHeartbeat) startTask(task *Task, logOffset int64) {
+	if hb == nil {
+		return
+	}
+	now := time.Now()
+	hb.mu.Lock()
+	hb.state.TaskID = task.ID
+	hb.state.Stage = stagePreparing
+	hb.state.Progress = 0
+	hb.state.LogOffset = logOffset
+	hb.state.TaskStartedAt = &now
+	hb.state.LastOutputAt = &now
+	hb.mu.Unlock()
+	hb.flush()
+}
+
+// endTask 任务执行结束，回到空闲状态
+func (hb *workerHeartbeat) endTask() {
+	if hb == nil {
+		return
+	}
+	hb.mu.Lock()
+	hb.state.TaskID = ""
+	hb.state.Stage = stageIdle
+	hb.state.Progress = 0
+	hb.state.PID = 0
+	hb.state.LogOffset = 0
+	hb.state.TaskStartedAt = nil
+	hb.state.LastOutputAt = nil
+	hb.mu.Unlock()
+	hb.flush()
+}
+
+// wroteLog 记录写入日志的字节数，下一次心跳时写入数据库
+func (hb *workerHeartbeat) wroteLog(n int) {
+	if hb == nil {
+		return
+	}
+	now := time.Now()
+	hb.mu.Lock()
+	hb.state.LogOffset += int64(n)
+	hb.state.LastOutputAt = &now
+	hb.mu.Unlock()
+}
+
+// setPID 记录 babeldoc 进程号（进程结束后为 0）并立即写入
+func (hb *workerHeartbeat) setPID(pid int) {
+	if hb == nil {
+		return
+	}
+	hb.mu.Lock()
+	hb.state.PID = pid
+	hb.mu.Unlock()
+	hb.flush()
+}
+
+func (hb *workerHeartbeat) setProgress(progress int) {
+	if hb == nil {
+		return
+	}
+	hb.mu.Lock()
+	hb.state.Progress = progress
+	hb.mu.Unlock()
+}
+
+func (hb *workerHeartbeat) flush() {
+	hb.mu.Lock()
+	hb.state.UpdatedAt = time.Now()
+	s := hb.state
+	hb.mu.Unlock()
+
+	_, err := execWithRetry(`
+		INSERT INTO worker_heartbeats (worker_id, node, queue, task_id, stage, progress, pid, log_offset, started_at, task_started_at, last_output_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`+dbStore.Upsert("worker_id")+` task_id = excluded.task_id, stage = excluded.stage, progress = excluded.progress,
+			pid = excluded.pid, log_offset = excluded.log_offset, task_started_at = excluded.task_started_at, last_output_at = excluded.last_output_at,
+			updated_at = excluded.updated_at
+	`, s.WorkerID, s.Node, s.Queue, s.TaskID, s.Stage, s.Progress, s.PID, s.LogOffset, s.StartedAt, s.TaskStartedAt, s.LastOutputAt, s.UpdatedAt)
+	if err != nil {
+		log.Printf("无法写入 worker %s 的心跳: %v", s.WorkerID, err)
+	}
+}
+
+// loadWorkerHeartbeats 读取所有 worker 的心跳，并计算存活和卡住状态
+func loadWorkerHeartbeats() ([]*WorkerHeartbeat, error) {
+	rows, err := db.Query(`
+		SELECT worker_id, node, queue, task_id, stage, progress, pid, log_offset, started_at, task_started_at, last_output_at, updated_at
+		FROM worker_heartbeats ORDER BY node, queue, worker_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	workers := []*WorkerHeartbeat{}
+	for rows.Next() {
+		var hb WorkerHeartbeat
+		var taskID sql.NullString
+		var taskStartedAt, lastOutputAt sql.NullTime
+		if err := rows.Scan(&hb.WorkerID, &hb.Node, &hb.Queue, &taskID, &hb.Stage, &hb.Progress, &hb.PID, &hb.LogOffset,
+			&hb.StartedAt, &taskStartedAt, &lastOutputAt, &hb.UpdatedAt); err != nil {
+			return nil, err
+		}
+		hb.TaskID = taskID.String
+		if taskStartedAt.Valid {
+			hb.TaskStartedAt = &taskStartedAt.Time
+			hb.TaskSeconds = int64(now.Sub(taskStartedAt.Time).Seconds())
+		}
+		if lastOutputAt.Valid {
+			hb.LastOutputAt = &lastOutputAt.Time
+		}
+		hb.Alive = now.Sub(hb.UpdatedAt) < 3*heartbeatInterval
+		hb.Wedged = hb.TaskID != "" && (!hb.Alive || (hb.LastOutputAt != nil && now.Sub(*hb.LastOutputAt) > workerWedgedAfter))
+		workers = append(workers, &hb)
+	}
+	return workers, rows.Err()
+}
+
+// worker 列表
+func workersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	workers, err := loadWorkerHeartbeats()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(workers)
+}
+
+// WorkerStatus 一个存活 worker 的状态摘要
+type WorkerStatus struct {
+	WorkerID       string `json:"worker_id"`
+	Node           string `json:"node"`
+	Queue          string `json:"queue"`
+	State          string `json:"state"`                     // idle（空闲）、busy（执行任务）、paused（队列已暂停）、disk_low（磁盘空间不足）、outside_window（等待队列的执行时段）
+	TaskID         string `json:"task_id,omitempty"`         // 正在执行的任务
+	Stage          string `json:"stage,omitempty"`           // 执行阶段：preparing、translating、finishing
+	Progress       int    `json:"progress,omitempty"`        // 任务进度
+	ElapsedSeconds int64  `json:"elapsed_seconds,omitempty"` // 任务已执行的时间
+	PID            int    `json:"pid,omitempty"`             // babeldoc 进程号
+	Wedged         bool   `json:"wedged,omitempty"`          // 长时间没有输出，可能已卡住
+}
+
+// workerStatus 由心跳生成状态摘要
+func workerStatus(hb *WorkerHeartbeat) WorkerStatus {
+	status := WorkerStatus{WorkerID: hb.WorkerID, Node: hb.Node, Queue: hb.Queue, State: hb.Stage}
+	if hb.TaskID != "" {
+		status.State = "busy"
+		status.TaskID = hb.TaskID
+		status.Stage = hb.Stage
+		status.Progress = hb.Progress
+		status.ElapsedSeconds = hb.TaskSeconds
+		status.PID = hb.PID
+		status.Wedged = hb.Wedged
+	}
+	return status
+}
+
+// 各 worker 的状态（不包括已停止的 worker）
+func workerStatusHandler(w http.ResponseWriter, r *http.Request) {
+	heartbeats, err := loadWorkerHeartbeats()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	workers := []WorkerStatus{}
+	for _, hb := range heartbeats {
+		if hb.Alive {
+			workers = append(workers, workerStatus(hb))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workers)
+}
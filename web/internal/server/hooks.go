@@ -0,0 +1,325 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// 钩子阶段
+const (
+	hookStagePreQueue = "pre_queue" // 任务入队前，失败则拒绝提交
+	hookStagePostTask = "post_task" // 任务结束后（成功或失败），失败仅记录日志
+)
+
+const (
+	defaultHookTimeout           = 60 * time.Second
+	defaultSuccessCommandTimeout = 10 * time.Minute
+)
+
+// HookPayload 传递给钩子的任务上下文
+type HookPayload struct {
+	Stage       string   `json:"stage"`
+	Task        *Task    `json:"task"`
+	InputPath   string   `json:"input_path"`
+	OutputPaths []string `json:"output_paths,omitempty"`
+}
+
+// 钩子配置，通过环境变量设置，多个钩子用英文分号分隔：
+//
+//	PRE_QUEUE_HOOKS  入队前执行，例如病毒扫描、DLP 检查
+//	POST_TASK_HOOKS  任务结束后执行，例如归档提交
+//	HOOK_TIMEOUT     单个钩子的超时时间（Go duration 格式，默认 60s）
+//
+// 以 http:// 或 https:// 开头的条目按 HTTP 钩子处理（POST JSON），其余按 shell 命令执行。
+var (
+	preQueueHooks = parseHookList(os.Getenv("PRE_QUEUE_HOOKS"))
+	postTaskHooks = parseHookList(os.Getenv("POST_TASK_HOOKS"))
+	hookTimeout   = parseDurationEnv("HOOK_TIMEOUT", defaultHookTimeout)
+)
+
+// 任务成功后由 worker 执行的命令模板（例如复制到网络共享、触发打印）：
+//
+//	TASK_SUCCESS_COMMAND          text/template 格式的 shell 命令，数据为 HookPayload
+//	TASK_SUCCESS_COMMAND_TIMEOUT  命令超时时间（默认 10m）
+//
+// 模板中每个输出值的动作都会自动做 shell 转义（见 quoteActions），文件名等任务数据不能注入命令，例如：
+//
+//	cp {{range .OutputPaths}}{{.}} {{end}}/mnt/share/
+//
+// 因此模板中不需要（也不应该）再给值加引号；为兼容旧配置，显式以 quote 结尾的动作不会重复转义。
+// 命令输出写入任务日志，失败不影响任务状态。
+var (
+	successCommand        = parseCommandTemplate(os.Getenv("TASK_SUCCESS_COMMAND"))
+	successCommandTimeout = parseDurationEnv("TASK_SUCCESS_COMMAND_TIMEOUT", defaultSuccessCommandTimeout)
+)
+
+func parseHookList(value string) []string {
+	var hooks []string
+	for _, hook := range strings.Split(value, ";") {
+		hook = strings.TrimSpace(hook)
+		if hook != "" {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// parseDurationEnv 读取 Go duration 格式的环境变量，为空或无效时返回默认值
+func parseDurationEnv(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("无效的 %s %q，使用默认值 %s", name, value, def)
+		return def
+	}
+	return d
+}
+
+func parseCommandTemplate(value string) *template.Template {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	tmpl, err := template.New("command").Funcs(template.FuncMap{"quote": shellQuoteValue}).Parse(value)
+	if err != nil {
+		log.Printf("无效的 TASK_SUCCESS_COMMAND 模板，已忽略: %v", err)
+		return nil
+	}
+	for _, t := range tmpl.Templates() {
+		quoteActions(t.Tree, t.Tree.Root)
+	}
+	return tmpl
+}
+
+// quoteActions 在每个输出值的动作的管道末尾追加 quote，与 html/template 的自动转义类似，
+// 渲染出的任何任务数据都是单个 shell 单词。变量声明不输出内容，已经以 quote 结尾的动作保持不变
+func quoteActions(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			quoteActions(tree, child)
+		}
+	case *parse.IfNode:
+		quoteActions(tree, n.List)
+		quoteActions(tree, n.ElseList)
+	case *parse.RangeNode:
+		quoteActions(tree, n.List)
+		quoteActions(tree, n.ElseList)
+	case *parse.WithNode:
+		quoteActions(tree, n.List)
+		quoteActions(tree, n.ElseList)
+	case *parse.ActionNode:
+		pipe := n.Pipe
+		if len(pipe.Decl) > 0 || isQuoteCommand(pipe.Cmds[len(pipe.Cmds)-1]) {
+			return
+		}
+		quote := parse.NewIdentifier("quote").SetTree(tree).SetPos(n.Pos)
+		pipe.Cmds = append(pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{quote}})
+	}
+}
+
+func isQuoteCommand(cmd *parse.CommandNode) bool {
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == "quote"
+}
+
+// shellQuoteValue 是模板中的 quote 函数，按模板的默认格式输出值后做 shell 转义
+func shellQuoteValue(v any) string {
+	return shellQuote(fmt.Sprint(v))
+}
+
+// shellQuote 用单引号包裹字符串，使其可安全拼接到 sh 命令中
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runPreQueueHooks 依次执行入队前钩子，任意一个失败即返回错误
+func runPreQueueHooks(task *Task) error {
+	payload := &HookPayload{
+		Stage:     hookStagePreQueue,
+		Task:      task,
+		InputPath: taskInputPath(task),
+	}
+	for _, hook := range preQueueHooks {
+		if err := runHook(hook, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPostTaskHooks 执行任务结束后钩子，错误只记录不影响任务状态
+func runPostTaskHooks(task *Task) {
+	if len(postTaskHooks) == 0 {
+		return
+	}
+	payload := &HookPayload{
+		Stage:     hookStagePostTask,
+		Task:      task,
+		InputPath: taskInputPath(task),
+	}
+	paths, cleanup := taskOutputPaths(task)
+	defer cleanup()
+	payload.OutputPaths = paths
+	for _, hook := range postTaskHooks {
+		if err := runHook(hook, payload); err != nil {
+			log.Printf("任务 %s 的后置钩子执行失败: %v", task.ID, err)
+		}
+	}
+}
+
+// runSuccessCommand 在 worker 中同步执行任务成功后的命令，输出通过 writeLog 写入任务日志
+func runSuccessCommand(task *Task, writeLog func(string)) {
+	if successCommand == nil {
+		return
+	}
+	paths, cleanup := taskOutputPaths(task)
+	defer cleanup()
+	payload := &HookPayload{
+		Stage:       hookStagePostTask,
+		Task:        task,
+		InputPath:   taskInputPath(task),
+		OutputPaths: paths,
+	}
+
+	var command strings.Builder
+	if err := successCommand.Execute(&command, payload); err != nil {
+		writeLog(fmt.Sprintf("WARNING: 无法渲染成功后命令: %v\n", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), successCommandTimeout)
+	defer cancel()
+
+	writeLog(fmt.Sprintf("==> 执行成功后命令: %s\n", command.String()))
+	cmd := exec.CommandContext(ctx, "sh", "-c", command.String())
+	cmd.Env = append(os.Environ(), hookEnv(payload)...)
+
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		writeLog(string(output))
+		if !bytes.HasSuffix(output, []byte("\n")) {
+			writeLog("\n")
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		writeLog(fmt.Sprintf("WARNING: 成功后命令超时（%s）\n", successCommandTimeout))
+		return
+	}
+	if err != nil {
+		writeLog(fmt.Sprintf("WARNING: 成功后命令执行失败: %v\n", err))
+		return
+	}
+	writeLog("==> 成功后命令执行完成\n")
+}
+
+// taskOutputPaths 返回传给钩子和成功后命令的输出文件路径。压缩保存的文件（见 compression.go）解压到临时目录中的同名文件，
+// 钩子看到的始终是原始的 PDF；返回的清理函数在钩子执行完后删除这些副本
+func taskOutputPaths(task *Task) ([]string, func()) {
+	var paths []string
+	var cleanups []func()
+	for _, file := range task.OutputFiles {
+		path := taskOutputPath(task, file)
+		ensureLocal(path)
+		if copyPath, cleanup, err := decompressedOutputCopy(path); err == nil {
+			path = copyPath
+			cleanups = append(cleanups, cleanup)
+		} else {
+			log.Printf("无法解压任务 %s 的输出文件 %s: %v", task.ID, file, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, func() {
+		for _, cleanup := range cleanups {
+			cleanup()
+		}
+	}
+}
+
+// hookEnv 返回传递给命令钩子的任务元数据环境变量
+func hookEnv(payload *HookPayload) []string {
+	return []string{
+		"BABELDOC_HOOK_STAGE=" + payload.Stage,
+		"BABELDOC_TASK_ID=" + payload.Task.ID,
+		"BABELDOC_TASK_STATUS=" + payload.Task.Status,
+		"BABELDOC_TASK_FILENAME=" + payload.Task.Filename,
+		"BABELDOC_TASK_LANG_IN=" + payload.Task.LangIn,
+		"BABELDOC_TASK_LANG_OUT=" + payload.Task.LangOut,
+		"BABELDOC_TASK_PAGES=" + payload.Task.Pages,
+		"BABELDOC_INPUT_PATH=" + payload.InputPath,
+		"BABELDOC_OUTPUT_DIR=" + outputDir,
+		"BABELDOC_OUTPUT_PATHS=" + strings.Join(payload.OutputPaths, string(os.PathListSeparator)),
+	}
+}
+
+func runHook(hook string, payload *HookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		return runHTTPHook(ctx, hook, body)
+	}
+	return runCommandHook(ctx, hook, payload, body)
+}
+
+// runHTTPHook 以 POST 方式发送任务上下文，非 2xx 响应视为拒绝
+func runHTTPHook(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("hook %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("hook %s: HTTP %d: %s", url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// runCommandHook 通过 sh -c 执行命令，任务上下文通过 stdin（JSON）和环境变量传入，非零退出码视为拒绝
+func runCommandHook(ctx context.Context, command string, payload *HookPayload, body []byte) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), hookEnv(payload)...)
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("hook %q: 超时（%s）", command, hookTimeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("hook %q: %s", command, msg)
+	}
+	return nil
+}
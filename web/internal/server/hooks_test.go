@@ -0,0 +1,48 @@
+package server
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSuccessCommandQuoting(t *testing.T) {
+	payload := &HookPayload{
+		Task: &Task{ID: "t1", Filename: `a'; echo injected; echo "$(id)".pdf`, Attempts: 2},
+		OutputPaths: []string{
+			"/out/with space.pdf",
+			"/out/`uname`.pdf",
+		},
+	}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{`echo {{.Task.Filename}}`, payload.Task.Filename},
+		{`echo {{quote .Task.Filename}}`, payload.Task.Filename},
+		{`echo {{.Task.Filename | quote}}`, payload.Task.Filename},
+		{`echo {{.Task.Attempts}}`, "2"},
+		{`{{range .OutputPaths}}printf '%s\n' {{.}};{{end}}`, "/out/with space.pdf\n/out/`uname`.pdf"},
+		{`{{$name := .Task.Filename}}{{if $name}}echo {{$name}}{{end}}`, payload.Task.Filename},
+		{`{{with .Task}}echo {{.ID}}{{end}}`, "t1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			tmpl := parseCommandTemplate(tt.tmpl)
+			if tmpl == nil {
+				t.Fatalf("parseCommandTemplate(%q) = nil", tt.tmpl)
+			}
+			var command strings.Builder
+			if err := tmpl.Execute(&command, payload); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			output, err := exec.Command("sh", "-c", command.String()).CombinedOutput()
+			if err != nil {
+				t.Fatalf("sh -c %q: %v: %s", command.String(), err, output)
+			}
+			if got := strings.TrimSuffix(string(output), "\n"); got != tt.want {
+				t.Errorf("sh -c %q printed %q, want %q", command.String(), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// 图片提交：上传 PNG/JPG 图片（拍摄或截图的文档页面）时，服务端按上传顺序每张图片一页合成 PDF，
+// 之后与上传 PDF 的流程相同。合成的 PDF 没有文字层，任务自动启用 babeldoc 的 --auto-enable-ocr-workaround。
+//
+//	IMAGE_MAX_PAGES  一次提交最多的图片数（默认 50）
+var imageMaxPages = parseIntEnv("IMAGE_MAX_PAGES", 50)
+
+const (
+	// imageMaxPixels 单张图片的像素上限，避免解码超大图片占用过多内存
+	imageMaxPixels = 50_000_000
+	// imagePageWidth 合成 PDF 的页面宽度（A4 宽度，单位 pt），高度按图片比例计算
+	imagePageWidth = 595
+)
+
+// namedFile 提交中的一个文件
+type namedFile struct {
+	name string
+	file io.Reader
+}
+
+// isImageFilename 文件名是否为支持转换的图片
+func isImageFilename(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// convertImageInput 将提交中的图片合成为 PDF，替换 input 的文件；不是图片提交时不做处理
+func convertImageInput(input *submissionInput) *apiError {
+	images := input.images
+	if len(images) == 0 {
+		if !isImageFilename(input.filename) {
+			return nil
+		}
+		images = []namedFile{{input.filename, input.file}}
+	}
+	if len(images) > imageMaxPages {
+		return newAPIError(http.StatusBadRequest, codeBadRequest, "At most %d images can be submitted at once", imageMaxPages)
+	}
+	for _, img := range images {
+		if !isImageFilename(img.name) {
+			return newAPIError(http.StatusBadRequest, codeUnsupportedFile, "Multiple files must all be PNG or JPG images: %s", img.name)
+		}
+	}
+
+	pdf, err := imagesToPDF(images)
+	if err != nil {
+		return newAPIError(http.StatusBadRequest, codeUnsupportedFile, "%v", err)
+	}
+	input.file = bytes.NewReader(pdf)
+	input.filename = strings.TrimSuffix(filepath.Base(images[0].name), filepath.Ext(images[0].name)) + ".pdf"
+	input.images = nil
+	input.saved = nil
+	// 图片没有文字层，需要 babeldoc 识别扫描件
+	if input.form.Get("auto-enable-ocr-workaround") == "" {
+		input.form.Set("auto-enable-ocr-workaround", "true")
+	}
+	return nil
+}
+
+// imagesToPDF 每张图片一页合成 PDF。JPEG 直接嵌入，PNG 转换为 RGB 后压缩嵌入（透明部分以白色填充）
+func imagesToPDF(images []namedFile) ([]byte, error) {
+	// 对象 1、2 为 Catalog 和 Pages，每页依次为 Page、内容流和图片三个对象
+	objects := [][]byte{nil, nil}
+	var kids []string
+	for i, img := range images {
+		data, err := io.ReadAll(img.file)
+		if err != nil {
+			return nil, err
+		}
+		xobject, width, height, err := imageXObject(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", img.name, err)
+		}
+
+		pageHeight := float64(imagePageWidth) * float64(height) / float64(width)
+		pageObj := len(objects) + 1
+		content := fmt.Sprintf("q %d 0 0 %.2f 0 0 cm /Im%d Do Q", imagePageWidth, pageHeight, i)
+		objects = append(objects,
+			[]byte(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %.2f] /Resources << /XObject << /Im%d %d 0 R >> >> /Contents %d 0 R >>",
+				imagePageWidth, pageHeight, i, pageObj+2, pageObj+1)),
+			streamObject("", []byte(content)),
+			xobject,
+		)
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageObj))
+	}
+	objects[0] = []byte("<< /Type /Catalog /Pages 2 0 R >>")
+	objects[1] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	return assemblePDF(objects), nil
+}
+
+// imageXObject 返回图片的 XObject 对象及像素尺寸
+func imageXObject(data []byte) ([]byte, int, int, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("not a PNG or JPG image")
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > imageMaxPixels {
+		return nil, 0, 0, fmt.Errorf("image size %dx%d is not supported", cfg.Width, cfg.Height)
+	}
+
+	// 灰度和 YCbCr 的 JPEG 可以直接嵌入，CMYK 等其他颜色模型解码后重新压缩
+	if format == "jpeg" && (cfg.ColorModel == color.GrayModel || cfg.ColorModel == color.YCbCrModel) {
+		colorSpace := "/DeviceRGB"
+		if cfg.ColorModel == color.GrayModel {
+			colorSpace = "/DeviceGray"
+		}
+		return streamObject(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode ",
+			cfg.Width, cfg.Height, colorSpace), data), cfg.Width, cfg.Height, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if format == "jpeg" {
+		// 重新编码为 RGB JPEG，比无损压缩小得多
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, 0, 0, err
+		}
+		return imageXObject(buf.Bytes())
+	}
+
+	bounds := img.Bounds()
+	var raw bytes.Buffer
+	zw := zlib.NewWriter(&raw)
+	row := make([]byte, 0, bounds.Dx()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// 预乘 alpha 的颜色叠加到白色背景上
+			white := 0xffff - a
+			row = append(row, byte((r+white)>>8), byte((g+white)>>8), byte((b+white)>>8))
+		}
+		zw.Write(row)
+	}
+	zw.Close()
+	return streamObject(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode ",
+		bounds.Dx(), bounds.Dy()), raw.Bytes()), bounds.Dx(), bounds.Dy(), nil
+}
+
+// streamObject 返回带有给定字典项（为空或以空格结尾）和数据的流对象
+func streamObject(dict string, data []byte) []byte {
+	var obj bytes.Buffer
+	fmt.Fprintf(&obj, "<< %s/Length %d >>\nstream\n", dict, len(data))
+	obj.Write(data)
+	obj.WriteString("\nendstream")
+	return obj.Bytes()
+}
+
+// assemblePDF 按顺序写出对象（编号从 1 开始，对象 1 为 Catalog）以及交叉引用表
+func assemblePDF(objects [][]byte) []byte {
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n", i+1)
+		pdf.Write(obj)
+		pdf.WriteString("\nendobj\n")
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return pdf.Bytes()
+}
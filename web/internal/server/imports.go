@@ -0,0 +1,444 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 批量导入：一次提交多行 URL、DOI 或 arXiv ID（直接粘贴的列表），服务端逐个下载 PDF 并以相同的设置创建翻译任务。
+//
+//	POST /api/v1/imports       创建导入批次，立即返回 202，下载在后台进行
+//	GET  /api/v1/imports/{id}  批次中每一项的下载状态、创建的任务及其状态，下载失败的项带有各自的错误信息
+//
+//	IMPORT_FETCH_CONCURRENCY  同时下载的项数（默认 2）
+//
+// 每行一项，空行和 # 开头的行忽略。arXiv ID（2401.12345、arXiv:2401.12345v2、hep-th/9901001 或 arxiv.org 的链接）
+// 从 arxiv.org 下载；DOI（10.xxxx/…、doi: 前缀或 doi.org 链接）先尝试 Crossref 中出版商提供的 PDF 链接，再尝试 doi.org
+// 跳转到的地址，并作为任务的 doi 字段；其他 HTTPS 链接直接下载。下载的限制与 file_url 相同（见 remotefetch.go）。
+// 批次中的项保存在数据库中，服务重启后继续下载；多个实例可以同时处理同一批次。批次在创建 30 天后删除，已创建的任务不受影响。
+var importFetchConcurrency = parseIntEnv("IMPORT_FETCH_CONCURRENCY", 2)
+
+const (
+	maxImportItems = 200
+
+	importPollInterval = 5 * time.Second
+	importRetention    = 30 * 24 * time.Hour
+	// 下载中的项超过该时长没有结束时视为处理它的实例已退出，重新下载
+	importStaleAfter = 10 * time.Minute
+)
+
+// 导入项的状态
+const (
+	importPending   = "pending"
+	importFetching  = "fetching"
+	importSubmitted = "submitted"
+	importFailed    = "failed"
+)
+
+var (
+	importIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	// 新式（2007 年以后）和旧式的 arXiv ID，可以带版本号
+	arxivIDPattern  = regexp.MustCompile(`(?i)^(?:arxiv:\s*)?(\d{4}\.\d{4,5}(?:v\d+)?|[a-z][a-z.-]*/\d{7}(?:v\d+)?)$`)
+	arxivURLPattern = regexp.MustCompile(`(?i)^https?://(?:www\.|export\.)?arxiv\.org/(?:abs|pdf)/(.+?)(?:\.pdf)?/?$`)
+
+	// importWake 创建批次后唤醒下载的 goroutine，不必等到下一次轮询
+	importWake = make(chan struct{}, 1)
+)
+
+// ImportRequest 创建导入批次的请求体：sources 为换行分隔的列表，其余字段与 JSON 提交相同，作用于批次中的所有任务
+type ImportRequest struct {
+	Sources string `json:"sources"`
+	TaskSubmission
+}
+
+// ImportBatch 导入批次的状态
+type ImportBatch struct {
+	ID        string       `json:"id"`
+	Status    string       `json:"status"` // fetching（还有项等待下载）或 done
+	Total     int          `json:"total"`
+	Pending   int          `json:"pending"` // 等待或正在下载的项
+	Submitted int          `json:"submitted"`
+	Failed    int          `json:"failed"`
+	Items     []ImportItem `json:"items"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// ImportItem 导入批次中的一项
+type ImportItem struct {
+	Index      int       `json:"index"` // 在列表中的序号，从 1 开始（不计空行和注释）
+	Source     string    `json:"source"`
+	Kind       string    `json:"kind,omitempty"`        // url、doi 或 arxiv，无法识别时省略
+	Status     string    `json:"status"`                // pending、fetching、submitted 或 failed
+	TaskID     string    `json:"task_id,omitempty"`     // 创建的任务
+	TaskStatus string    `json:"task_status,omitempty"` // 任务的当前状态，任务已删除时省略
+	Error      string    `json:"error,omitempty"`       // 无法识别、下载或提交失败的原因
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func createImportsTables() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS import_batches (
+		id ` + t.Key + ` PRIMARY KEY,
+		user_id ` + t.Text + ` NOT NULL DEFAULT (''),
+		org_id ` + t.Text + ` NOT NULL DEFAULT (''),
+		form ` + t.Text + ` NOT NULL,
+		created_at ` + t.Time + ` NOT NULL
+	)`)
+	if err == nil {
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS import_items (
+			batch_id ` + t.Key + ` NOT NULL,
+			position ` + t.Integer + ` NOT NULL,
+			source ` + t.Text + ` NOT NULL,
+			kind ` + t.Text + ` NOT NULL DEFAULT (''),
+			target ` + t.Text + ` NOT NULL DEFAULT (''),
+			status ` + t.Key + ` NOT NULL,
+			task_id ` + t.Text + `,
+			error ` + t.Text + `,
+			claimed_at ` + t.Time + `,
+			updated_at ` + t.Time + ` NOT NULL,
+			PRIMARY KEY (batch_id, position)
+		)`)
+	}
+	if err == nil {
+		err = dbStore.CreateIndex("idx_import_items_status", "import_items", "status, updated_at", "", false)
+	}
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+}
+
+// parseImportSource 识别一行的类型，返回类型和规范化后的 arXiv ID、DOI 或 URL
+func parseImportSource(line string) (string, string, error) {
+	if m := arxivIDPattern.FindStringSubmatch(line); m != nil {
+		return "arxiv", m[1], nil
+	}
+	if m := arxivURLPattern.FindStringSubmatch(line); m != nil {
+		return "arxiv", m[1], nil
+	}
+	if doi, err := normalizeDOI(line); err == nil && doi != "" {
+		return "doi", doi, nil
+	}
+	u, err := url.Parse(line)
+	if err == nil && u.Host != "" {
+		if u.Scheme != "https" {
+			return "", "", fmt.Errorf("only https URLs are supported")
+		}
+		return "url", u.String(), nil
+	}
+	return "", "", fmt.Errorf("not a URL, DOI or arXiv ID")
+}
+
+// createImportHandler 创建导入批次
+func createImportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ImportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeErrorFrom(w, invalidJSONError(err), http.StatusBadRequest, codeInvalidJSON)
+		return
+	}
+	sub := req.TaskSubmission
+	if sub.UploadID != "" || sub.DraftID != "" || sub.FileBase64 != "" || sub.FileURL != "" || sub.Filename != "" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "input file fields are not allowed, list the documents in sources")
+		return
+	}
+	if sub.ExternalID != "" || sub.DOI != "" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "external_id and doi are per document and cannot be shared by a batch")
+		return
+	}
+	form, err := submissionForm(&sub)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	var lines []string
+	for _, line := range strings.Split(req.Sources, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "sources is required")
+		return
+	}
+	if len(lines) > maxImportItems {
+		writeError(w, http.StatusBadRequest, codeTooManyTasks, fmt.Sprintf("At most %d documents per import", maxImportItems))
+		return
+	}
+
+	// 设置在创建批次时确定，之后修改默认参数不影响尚未下载的项
+	userID, orgID := currentUserID(r), currentUserOrg(r)
+	if err := applyUserDefaults(form, userID); err != nil {
+		log.Printf("无法读取用户默认参数: %v", err)
+	}
+	formJSON, _ := json.Marshal(form)
+
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	batchID := hex.EncodeToString(buf)
+	now := time.Now()
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO import_batches (id, user_id, org_id, form, created_at) VALUES (?, ?, ?, ?, ?)`,
+		batchID, userID, orgID, string(formJSON), now); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	for i, line := range lines {
+		status, errMessage := importPending, ""
+		kind, target, err := parseImportSource(line)
+		if err != nil {
+			status, errMessage = importFailed, err.Error()
+		}
+		if _, err := tx.Exec(`INSERT INTO import_items (batch_id, position, source, kind, target, status, error, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, batchID, i+1, line, kind, target, status, nullIfEmpty(errMessage), now); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	log.Printf("已创建导入批次 %s（%d 项）", batchID, len(lines))
+
+	select {
+	case importWake <- struct{}{}:
+	default:
+	}
+	batch, err := loadImportBatch(batchID)
+	if err != nil {
+		writeErrorFrom(w, err, http.StatusInternalServerError, codeInternal)
+		return
+	}
+	w.Header().Set("Location", apiVersionPrefix+"/imports/"+batchID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(batch)
+}
+
+// importBatchHandler 返回导入批次的状态
+func importBatchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	batch, err := loadImportBatch(r.PathValue("id"))
+	if err != nil {
+		writeErrorFrom(w, err, http.StatusInternalServerError, codeInternal)
+		return
+	}
+	json.NewEncoder(w).Encode(batch)
+}
+
+// loadImportBatch 读取批次及其各项，任务状态取自任务表
+func loadImportBatch(batchID string) (*ImportBatch, error) {
+	notFound := newAPIError(http.StatusNotFound, codeImportNotFound, "import not found: %s", batchID)
+	if !importIDPattern.MatchString(batchID) {
+		return nil, notFound
+	}
+	batch := &ImportBatch{ID: batchID, Items: []ImportItem{}}
+	err := db.QueryRow(`SELECT created_at FROM import_batches WHERE id = ?`, batchID).Scan(&batch.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, notFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT i.position, i.source, i.kind, i.status, i.task_id, t.status, i.error, i.updated_at
+		FROM import_items i LEFT JOIN tasks t ON t.id = i.task_id
+		WHERE i.batch_id = ? ORDER BY i.position`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item ImportItem
+		var taskID, taskStatus, errMessage sql.NullString
+		if err := rows.Scan(&item.Index, &item.Source, &item.Kind, &item.Status, &taskID, &taskStatus, &errMessage, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+		item.TaskID, item.TaskStatus, item.Error = taskID.String, taskStatus.String, errMessage.String
+		switch item.Status {
+		case importSubmitted:
+			batch.Submitted++
+		case importFailed:
+			batch.Failed++
+		default:
+			batch.Pending++
+		}
+		batch.Items = append(batch.Items, item)
+	}
+	batch.Total = len(batch.Items)
+	batch.Status = "done"
+	if batch.Pending > 0 {
+		batch.Status = "fetching"
+	}
+	return batch, rows.Err()
+}
+
+// importWorker 启动下载导入项的 goroutine，并定期删除过期的批次
+func importWorker() {
+	n := importFetchConcurrency
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		go importFetcher()
+	}
+	for {
+		cutoff := time.Now().Add(-importRetention)
+		execWithRetry(`DELETE FROM import_items WHERE batch_id IN (SELECT id FROM import_batches WHERE created_at < ?)`, cutoff)
+		execWithRetry(`DELETE FROM import_batches WHERE created_at < ?`, cutoff)
+		time.Sleep(time.Hour)
+	}
+}
+
+// importFetcher 逐个领取等待下载的项，没有时等待唤醒或下一次轮询
+func importFetcher() {
+	for {
+		batchID, position, ok := claimImportItem()
+		if !ok {
+			select {
+			case <-importWake:
+			case <-time.After(importPollInterval):
+			}
+			continue
+		}
+		processImportItem(batchID, position)
+	}
+}
+
+// claimImportItem 把一个等待下载（或处理实例已退出）的项标记为下载中，多个实例同时领取时只有一个成功
+func claimImportItem() (string, int, bool) {
+	for attempt := 0; attempt < 3; attempt++ {
+		now := time.Now()
+		stale := now.Add(-importStaleAfter)
+		var batchID string
+		var position int
+		err := db.QueryRow(`SELECT batch_id, position FROM import_items
+			WHERE status = ? OR (status = ? AND claimed_at < ?) ORDER BY updated_at, position LIMIT 1`,
+			importPending, importFetching, stale).Scan(&batchID, &position)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				log.Printf("无法查询待下载的导入项: %v", err)
+			}
+			return "", 0, false
+		}
+		res, err := execWithRetry(`UPDATE import_items SET status = ?, claimed_at = ?, updated_at = ?
+			WHERE batch_id = ? AND position = ? AND (status = ? OR (status = ? AND claimed_at < ?))`,
+			importFetching, now, now, batchID, position, importPending, importFetching, stale)
+		if err != nil {
+			log.Printf("无法领取导入项: %v", err)
+			return "", 0, false
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return batchID, position, true
+		}
+	}
+	return "", 0, false
+}
+
+// processImportItem 下载一项并创建任务，结果写回该项
+func processImportItem(batchID string, position int) {
+	var kind, target, userID, orgID, formJSON string
+	err := db.QueryRow(`SELECT i.kind, i.target, b.user_id, b.org_id, b.form
+		FROM import_items i JOIN import_batches b ON b.id = i.batch_id
+		WHERE i.batch_id = ? AND i.position = ?`, batchID, position).Scan(&kind, &target, &userID, &orgID, &formJSON)
+	if err != nil {
+		log.Printf("无法读取导入项 %s/%d: %v", batchID, position, err)
+		return
+	}
+	form := url.Values{}
+	json.Unmarshal([]byte(formJSON), &form)
+	if kind == "doi" {
+		form.Set("doi", target)
+	}
+
+	taskID, err := fetchAndSubmitImport(kind, target, form, userID, orgID)
+	status, errMessage := importSubmitted, ""
+	if err != nil {
+		status, errMessage = importFailed, err.Error()
+		log.Printf("导入批次 %s 的第 %d 项（%s）失败: %v", batchID, position, target, err)
+	}
+	if _, err := execWithRetry(`UPDATE import_items SET status = ?, task_id = ?, error = ?, updated_at = ? WHERE batch_id = ? AND position = ?`,
+		status, nullIfEmpty(taskID), nullIfEmpty(errMessage), time.Now(), batchID, position); err != nil {
+		log.Printf("无法保存导入项 %s/%d 的结果: %v", batchID, position, err)
+	}
+}
+
+// importURLs 返回一项可能的 PDF 地址，依次尝试
+func importURLs(kind, target string) []string {
+	switch kind {
+	case "arxiv":
+		return []string{"https://arxiv.org/pdf/" + target}
+	case "doi":
+		var urls []string
+		if work, err := fetchCrossrefWork(target); err == nil {
+			for _, link := range work.Message.Link {
+				if link.ContentType == "application/pdf" && strings.HasPrefix(link.URL, "https://") {
+					urls = append(urls, link.URL)
+				}
+			}
+		}
+		return append(urls, "https://doi.org/"+url.PathEscape(target))
+	}
+	return []string{target}
+}
+
+// fetchAndSubmitImport 下载一项的 PDF 并以批次的设置创建任务，返回任务 ID
+func fetchAndSubmitImport(kind, target string, form url.Values, userID, orgID string) (string, error) {
+	var f *os.File
+	var name string
+	var err error
+	for _, candidate := range importURLs(kind, target) {
+		if f, name, err = fetchRemotePDF(context.Background(), candidate); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	// createTask 写出 JSON 响应，从中取得任务 ID 或错误信息
+	rec := &davResponseRecorder{header: make(http.Header)}
+	createTask(rec, &submissionInput{
+		form:       form,
+		file:       f,
+		filename:   name,
+		userID:     userID,
+		orgID:      orgID,
+		receivedAt: time.Now(),
+	})
+	var result struct {
+		TaskID string `json:"task_id"`
+		Error  string `json:"error"`
+	}
+	json.Unmarshal(rec.body.Bytes(), &result)
+	if rec.status >= 300 || result.TaskID == "" {
+		if result.Error == "" {
+			return "", fmt.Errorf("HTTP %d", rec.status)
+		}
+		return "", fmt.Errorf("%s", result.Error)
+	}
+	return result.TaskID, nil
+}
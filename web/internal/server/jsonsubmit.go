@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskSubmission JSON 格式的任务提交请求（Content-Type: application/json）。
+// 文件通过 upload_id 引用预上传的文件，通过 draft_id 引用草稿中的预上传文件（见 drafts.go），
+// 通过 file_base64 + filename 直接内嵌，或通过 file_url 由服务端下载；
+// params 中的键值与表单提交时的 babeldoc 参数相同。
+type TaskSubmission struct {
+	UploadID   string `json:"upload_id,omitempty"`
+	DraftID    string `json:"draft_id,omitempty"`
+	FileBase64 string `json:"file_base64,omitempty"`
+	Filename   string `json:"filename,omitempty"`
+	FileURL    string `json:"file_url,omitempty"`
+
+	ExternalID      string                 `json:"external_id,omitempty"`
+	LangIn          string                 `json:"lang_in,omitempty"`
+	LangOut         string                 `json:"lang_out,omitempty"`
+	Pages           string                 `json:"pages,omitempty"`
+	NotifyEmail     string                 `json:"notify_email,omitempty"`
+	Preset          string                 `json:"preset,omitempty"`
+	RunAt           string                 `json:"run_at,omitempty"`
+	Tags            []string               `json:"tags,omitempty"`
+	ProgressWebhook *ProgressWebhook       `json:"progress_webhook,omitempty"`
+	CallbackURL     string                 `json:"callback_url,omitempty"`
+	DOI             string                 `json:"doi,omitempty"` // 论文的 DOI，启用 DOI_LOOKUP 时查询引用信息（见 citation.go）
+	Params          map[string]interface{} `json:"params,omitempty"`
+}
+
+// submissionInput 提交请求解析后的统一形式：表单字段和输入文件
+type submissionInput struct {
+	form     url.Values
+	file     io.Reader
+	filename string
+	images   []namedFile   // 一次上传多张图片时的全部图片，合成 PDF 后清空（见 imagepdf.go）
+	saved    *streamedFile // file 在接收时已写入上传目录，创建任务时直接改名，不再复制（见 streamupload.go）
+	close    func()
+	uploadID string     // 引用的预上传文件，任务创建成功后删除
+	draftID  string     // 引用的草稿，任务创建成功后删除
+	userID   string     // 提交任务的用户
+	orgID    string     // 提交者所属的组织
+	notes    *TaskNotes // 克隆时沿用原任务（可能已修改过）的备注，为 nil 时从 PDF 元数据读取
+	citation *Citation  // 克隆时沿用原任务的引用信息
+
+	receivedAt  time.Time // 开始接收请求的时间，用于记录上传耗时（见 timings.go）
+	watchSource string    // 从监视目录提交时放入的文件名（见 watchfolder.go）
+}
+
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// parseJSONSubmission 解析 JSON 提交请求，并转换为与表单提交相同的字段
+func parseJSONSubmission(w http.ResponseWriter, r *http.Request) (*submissionInput, error) {
+	// base64 编码后约为原文件的 4/3
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize/3*4+(1<<20))
+	var sub TaskSubmission
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	form, err := submissionForm(&sub)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := 0
+	for _, s := range []string{sub.UploadID, sub.DraftID, sub.FileBase64, sub.FileURL} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, fmt.Errorf("only one of upload_id, draft_id, file_base64 and file_url can be used")
+	}
+
+	input := &submissionInput{form: form}
+	switch {
+	case sub.FileURL != "":
+		return withRemoteFile(r, input, sub.FileURL)
+	case sub.DraftID != "":
+		return withDraft(r, input, sub.DraftID)
+	case sub.UploadID != "":
+		f, name, err := openPendingUpload(sub.UploadID)
+		if err != nil {
+			return nil, err
+		}
+		input.file, input.filename, input.uploadID = f, name, sub.UploadID
+		input.close = func() { f.Close() }
+	case sub.FileBase64 != "":
+		content, err := base64.StdEncoding.DecodeString(sub.FileBase64)
+		if err != nil {
+			return nil, fmt.Errorf("file_base64 is not valid base64")
+		}
+		if sub.Filename == "" {
+			return nil, fmt.Errorf("filename is required with file_base64")
+		}
+		input.file, input.filename = bytes.NewReader(content), filepath.Base(sub.Filename)
+	default:
+		return nil, newAPIError(http.StatusBadRequest, codeFileRequired, "one of upload_id, draft_id, file_base64 or file_url is required")
+	}
+	return input, nil
+}
+
+// submissionForm 将 JSON 提交中的字段转换为与表单提交相同的字段，params 中值为 false 的开关记为 "false"
+func submissionForm(sub *TaskSubmission) (url.Values, error) {
+	form := url.Values{}
+	for key, value := range sub.Params {
+		if reservedFormFields[key] {
+			return nil, fmt.Errorf("params.%s is reserved, use the top-level field instead", key)
+		}
+		switch v := value.(type) {
+		case string:
+			form.Set(key, v)
+		case bool:
+			form.Set(key, strconv.FormatBool(v))
+		case float64:
+			form.Set(key, strconv.FormatFloat(v, 'f', -1, 64))
+		case nil:
+		default:
+			return nil, fmt.Errorf("params.%s must be a string, number or boolean", key)
+		}
+	}
+	if sub.NotifyEmail != "" {
+		email, err := parseNotifyEmail(strings.TrimSpace(sub.NotifyEmail))
+		if err != nil {
+			return nil, err
+		}
+		sub.NotifyEmail = email
+	}
+	for key, value := range map[string]string{
+		"lang_in":      sub.LangIn,
+		"lang_out":     sub.LangOut,
+		"pages":        sub.Pages,
+		"notify_email": sub.NotifyEmail,
+		"preset":       sub.Preset,
+		"run_at":       sub.RunAt,
+		"tags":         strings.Join(sub.Tags, ","),
+		"external_id":  sub.ExternalID,
+		"callback_url": sub.CallbackURL,
+		"doi":          sub.DOI,
+	} {
+		if value != "" {
+			form.Set(key, value)
+		}
+	}
+	if sub.ProgressWebhook != nil {
+		sub.ProgressWebhook.setForm(form)
+	}
+	return form, nil
+}
+
+// parseMultipartSubmission 解析 multipart 表单提交，上传的文件在接收时直接写入上传目录（见 streamupload.go）；
+// 只提交 file_url 时也接受普通表单
+func parseMultipartSubmission(w http.ResponseWriter, r *http.Request) (*submissionInput, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	form, uploaded, err := streamMultipart(r, "file", uploadDir)
+	if errors.Is(err, http.ErrNotMultipart) {
+		if err := r.ParseForm(); err != nil {
+			return nil, fmt.Errorf("invalid form: %v", err)
+		}
+		form = r.Form
+	} else if err != nil {
+		return nil, multipartError(err)
+	} else {
+		// 与 ParseMultipartForm 相同，URL 查询参数排在表单字段之后
+		for key, values := range r.URL.Query() {
+			form[key] = append(form[key], values...)
+		}
+	}
+
+	var files []io.Closer
+	input := &submissionInput{form: form}
+	input.close = func() {
+		for _, f := range files {
+			f.Close()
+		}
+		removeStreamedFiles(uploaded)
+	}
+	fail := func(err error) (*submissionInput, error) {
+		input.close()
+		return nil, err
+	}
+
+	if fileURL := form.Get("file_url"); fileURL != "" {
+		if len(uploaded) > 0 {
+			return fail(fmt.Errorf("file and file_url cannot be used together"))
+		}
+		return withRemoteFile(r, &submissionInput{form: form}, fileURL)
+	}
+	// 没有上传文件时可以引用草稿中的预上传文件
+	if draftID := form.Get("draft_id"); draftID != "" && len(uploaded) == 0 {
+		return withDraft(r, &submissionInput{form: form}, draftID)
+	}
+	if len(uploaded) == 0 {
+		return nil, newAPIError(http.StatusBadRequest, codeFileRequired, "Error retrieving file")
+	}
+	// 多个 file 字段为逐页的图片
+	for _, u := range uploaded {
+		f, err := os.Open(u.path)
+		if err != nil {
+			return fail(newAPIError(http.StatusBadRequest, codeFileRequired, "Error retrieving file"))
+		}
+		files = append(files, f)
+		input.images = append(input.images, namedFile{u.name, f})
+	}
+	input.filename = input.images[0].name
+	if len(uploaded) == 1 {
+		input.file, input.images = input.images[0].file, nil
+		input.saved = uploaded[0]
+	}
+	return input, nil
+}
+
+// withRemoteFile 下载 file_url 作为提交的文件，临时文件在请求结束时删除
+func withRemoteFile(r *http.Request, input *submissionInput, fileURL string) (*submissionInput, error) {
+	f, name, err := fetchRemotePDF(r.Context(), fileURL)
+	if err != nil {
+		return nil, err
+	}
+	input.file, input.filename = f, name
+	input.close = func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	return input, nil
+}
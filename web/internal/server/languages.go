@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Language 支持的语言，Code 为传给 babeldoc 的规范代码，Names 为各界面语言下的显示名称
+type Language struct {
+	Code    string            `json:"code"`
+	Names   map[string]string `json:"names"`
+	Native  string            `json:"native"`
+	Aliases []string          `json:"aliases,omitempty"`
+}
+
+const (
+	defaultLangIn      = "en"
+	defaultLangOut     = "zh"
+	defaultNamesLocale = "en"
+)
+
+// languageRegistry 规范语言列表。中文按 babeldoc 的约定区分简体（zh）与繁体（zh-TW、zh-HK），
+// 繁体代码中的地区部分决定输出使用的字体。
+var languageRegistry = []Language{
+	{Code: "en", Names: map[string]string{"en": "English", "zh": "英语"}, Native: "English", Aliases: []string{"en-US", "en-GB", "eng", "英文"}},
+	{Code: "zh", Names: map[string]string{"en": "Simplified Chinese", "zh": "简体中文"}, Native: "简体中文", Aliases: []string{"zh-CN", "zh-Hans", "zh-Hans-CN", "zh-SG", "chs", "Chinese", "中文", "汉语"}},
+	{Code: "zh-TW", Names: map[string]string{"en": "Traditional Chinese (Taiwan)", "zh": "繁体中文（台湾）"}, Native: "繁體中文（台灣）", Aliases: []string{"zh-Hant", "zh-Hant-TW", "cht", "Traditional Chinese", "繁体中文", "繁體中文"}},
+	{Code: "zh-HK", Names: map[string]string{"en": "Traditional Chinese (Hong Kong)", "zh": "繁体中文（香港）"}, Native: "繁體中文（香港）", Aliases: []string{"zh-Hant-HK", "zh-MO", "Cantonese", "粤语", "粵語"}},
+	{Code: "ja", Names: map[string]string{"en": "Japanese", "zh": "日语"}, Native: "日本語", Aliases: []string{"ja-JP", "jp", "jpn", "日文"}},
+	{Code: "ko", Names: map[string]string{"en": "Korean", "zh": "韩语"}, Native: "한국어", Aliases: []string{"ko-KR", "kr", "kor", "韩文"}},
+	{Code: "fr", Names: map[string]string{"en": "French", "zh": "法语"}, Native: "Français", Aliases: []string{"fr-FR", "fr-CA", "fra"}},
+	{Code: "de", Names: map[string]string{"en": "German", "zh": "德语"}, Native: "Deutsch", Aliases: []string{"de-DE", "de-AT", "de-CH", "deu", "ger"}},
+	{Code: "es", Names: map[string]string{"en": "Spanish", "zh": "西班牙语"}, Native: "Español", Aliases: []string{"es-ES", "es-MX", "spa"}},
+	{Code: "ru", Names: map[string]string{"en": "Russian", "zh": "俄语"}, Native: "Русский", Aliases: []string{"ru-RU", "rus"}},
+	{Code: "it", Names: map[string]string{"en": "Italian", "zh": "意大利语"}, Native: "Italiano", Aliases: []string{"it-IT", "ita"}},
+	{Code: "pt", Names: map[string]string{"en": "Portuguese", "zh": "葡萄牙语"}, Native: "Português", Aliases: []string{"pt-PT", "pt-BR", "por"}},
+	{Code: "nl", Names: map[string]string{"en": "Dutch", "zh": "荷兰语"}, Native: "Nederlands", Aliases: []string{"nl-NL", "nld"}},
+	{Code: "pl", Names: map[string]string{"en": "Polish", "zh": "波兰语"}, Native: "Polski", Aliases: []string{"pl-PL", "pol"}},
+	{Code: "tr", Names: map[string]string{"en": "Turkish", "zh": "土耳其语"}, Native: "Türkçe", Aliases: []string{"tr-TR", "tur"}},
+	{Code: "uk", Names: map[string]string{"en": "Ukrainian", "zh": "乌克兰语"}, Native: "Українська", Aliases: []string{"uk-UA", "ukr"}},
+	{Code: "cs", Names: map[string]string{"en": "Czech", "zh": "捷克语"}, Native: "Čeština", Aliases: []string{"cs-CZ", "ces"}},
+	{Code: "sv", Names: map[string]string{"en": "Swedish", "zh": "瑞典语"}, Native: "Svenska", Aliases: []string{"sv-SE", "swe"}},
+	{Code: "da", Names: map[string]string{"en": "Danish", "zh": "丹麦语"}, Native: "Dansk", Aliases: []string{"da-DK", "dan"}},
+	{Code: "fi", Names: map[string]string{"en": "Finnish", "zh": "芬兰语"}, Native: "Suomi", Aliases: []string{"fi-FI", "fin"}},
+	{Code: "nb", Names: map[string]string{"en": "Norwegian", "zh": "挪威语"}, Native: "Norsk", Aliases: []string{"no", "nb-NO", "nor"}},
+	{Code: "el", Names: map[string]string{"en": "Greek", "zh": "希腊语"}, Native: "Ελληνικά", Aliases: []string{"el-GR", "ell"}},
+	{Code: "hu", Names: map[string]string{"en": "Hungarian", "zh": "匈牙利语"}, Native: "Magyar", Aliases: []string{"hu-HU", "hun"}},
+	{Code: "ro", Names: map[string]string{"en": "Romanian", "zh": "罗马尼亚语"}, Native: "Română", Aliases: []string{"ro-RO", "ron"}},
+	{Code: "bg", Names: map[string]string{"en": "Bulgarian", "zh": "保加利亚语"}, Native: "Български", Aliases: []string{"bg-BG", "bul"}},
+	{Code: "ar", Names: map[string]string{"en": "Arabic", "zh": "阿拉伯语"}, Native: "العربية", Aliases: []string{"ar-SA", "ara"}},
+	{Code: "he", Names: map[string]string{"en": "Hebrew", "zh": "希伯来语"}, Native: "עברית", Aliases: []string{"iw", "he-IL", "heb"}},
+	{Code: "hi", Names: map[string]string{"en": "Hindi", "zh": "印地语"}, Native: "हिन्दी", Aliases: []string{"hi-IN", "hin"}},
+	{Code: "vi", Names: map[string]string{"en": "Vietnamese", "zh": "越南语"}, Native: "Tiếng Việt", Aliases: []string{"vi-VN", "vie"}},
+	{Code: "th", Names: map[string]string{"en": "Thai", "zh": "泰语"}, Native: "ไทย", Aliases: []string{"th-TH", "tha"}},
+	{Code: "id", Names: map[string]string{"en": "Indonesian", "zh": "印尼语"}, Native: "Bahasa Indonesia", Aliases: []string{"in", "id-ID", "ind", "印度尼西亚语"}},
+	{Code: "ms", Names: map[string]string{"en": "Malay", "zh": "马来语"}, Native: "Bahasa Melayu", Aliases: []string{"ms-MY", "msa"}},
+}
+
+// languageIndex 规范化后的代码、别名、名称 -> 规范代码
+var languageIndex = buildLanguageIndex()
+
+func buildLanguageIndex() map[string]string {
+	index := make(map[string]string)
+	for _, lang := range languageRegistry {
+		keys := append([]string{lang.Code, lang.Native}, lang.Aliases...)
+		for _, name := range lang.Names {
+			keys = append(keys, name)
+		}
+		for _, key := range keys {
+			index[languageKey(key)] = lang.Code
+		}
+	}
+	return index
+}
+
+// languageKey 忽略大小写、首尾空白，并将下划线视为连字符（zh_Hans 与 zh-Hans 等价）
+func languageKey(value string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(value)), "_", "-")
+}
+
+// normalizeLanguage 将语言代码、别名或名称转换为规范代码
+func normalizeLanguage(value string) (string, bool) {
+	code, ok := languageIndex[languageKey(value)]
+	return code, ok
+}
+
+// normalizeLanguagePair 校验并规范化源语言和目标语言
+func normalizeLanguagePair(langIn, langOut string) (string, string, error) {
+	in, ok := normalizeLanguage(langIn)
+	if !ok {
+		return "", "", fmt.Errorf("unsupported lang_in: %q (supported: %s)", langIn, supportedLanguageCodes())
+	}
+	out, ok := normalizeLanguage(langOut)
+	if !ok {
+		return "", "", fmt.Errorf("unsupported lang_out: %q (supported: %s)", langOut, supportedLanguageCodes())
+	}
+	if in == out {
+		return "", "", fmt.Errorf("lang_in and lang_out must differ (both are %s)", in)
+	}
+	return in, out, nil
+}
+
+func supportedLanguageCodes() string {
+	codes := make([]string, 0, len(languageRegistry))
+	for _, lang := range languageRegistry {
+		codes = append(codes, lang.Code)
+	}
+	return strings.Join(codes, ", ")
+}
+
+// displayName 返回语言在指定界面语言下的名称，没有对应翻译时使用英文名称
+func (l *Language) displayName(locale string) string {
+	if name, ok := l.Names[locale]; ok {
+		return name
+	}
+	return l.Names[defaultNamesLocale]
+}
+
+// requestLocale 从 locale 参数或 Accept-Language 请求头中取界面语言（只取主语言部分）
+func requestLocale(r *http.Request) string {
+	locale := r.URL.Query().Get("locale")
+	if locale == "" {
+		locale = strings.Split(r.Header.Get("Accept-Language"), ",")[0]
+	}
+	locale = strings.Split(strings.Split(languageKey(locale), ";")[0], "-")[0]
+	if locale == "" {
+		return defaultNamesLocale
+	}
+	return locale
+}
+
+// LanguageEntry 语言列表接口中的一项
+type LanguageEntry struct {
+	Language
+	DisplayName string `json:"display_name"`
+	Source      bool   `json:"source"`
+	Target      bool   `json:"target"`
+}
+
+// 支持的语言列表
+func languagesHandler(w http.ResponseWriter, r *http.Request) {
+	locale := requestLocale(r)
+	entries := make([]LanguageEntry, 0, len(languageRegistry))
+	for _, lang := range languageRegistry {
+		entries = append(entries, LanguageEntry{
+			Language:    lang,
+			DisplayName: lang.displayName(locale),
+			Source:      true,
+			Target:      true,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"locale":           locale,
+		"languages":        entries,
+		"default_lang_in":  defaultLangIn,
+		"default_lang_out": defaultLangOut,
+		"pair_restrictions": []string{
+			"lang_in and lang_out must differ",
+		},
+	})
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxListLimit = 1000
+
+// listQuery 任务列表的查询条件
+type listQuery struct {
+	fields []string
+	limit  int // 0 表示不分页
+	offset int
+	cursor *listCursor
+
+	// 筛选条件，不含游标位置，用于统计总数
+	where []string
+	args  []interface{}
+}
+
+// listCursor 游标分页位置，按 (created_at, id) 倒序遍历，新任务插入不会导致重复或遗漏
+type listCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func (c *listCursor) encode() string {
+	raw := c.CreatedAt.Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeListCursor(value string) (*listCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &listCursor{CreatedAt: createdAt, ID: parts[1]}, nil
+}
+
+// parseListQuery 解析列表接口的查询参数
+func parseListQuery(values url.Values) (*listQuery, error) {
+	q := &listQuery{}
+
+	fields, err := parseFieldsParam(values.Get("fields"))
+	if err != nil {
+		return nil, err
+	}
+	q.fields = fields
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxListLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		q.limit = n
+	}
+
+	if offset := values.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("offset must be a non-negative integer")
+		}
+		q.offset = n
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		if q.offset > 0 {
+			return nil, fmt.Errorf("cursor and offset cannot be used together")
+		}
+		if q.cursor, err = decodeListCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	if search := strings.TrimSpace(values.Get("q")); search != "" {
+		condition, args := searchCondition(search)
+		q.where = append(q.where, condition)
+		q.args = append(q.args, args...)
+	}
+
+	if status := values.Get("status"); status != "" {
+		var placeholders []string
+		for _, s := range strings.Split(status, ",") {
+			s = strings.TrimSpace(s)
+			if !validTaskStatuses[s] {
+				return nil, fmt.Errorf("unknown status: %s", s)
+			}
+			placeholders = append(placeholders, "?")
+			q.args = append(q.args, s)
+		}
+		q.where = append(q.where, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+
+	for _, name := range []string{"lang_in", "lang_out"} {
+		if lang := strings.TrimSpace(values.Get(name)); lang != "" {
+			if code, ok := normalizeLanguage(lang); ok {
+				lang = code
+			}
+			q.where = append(q.where, name+" = ?")
+			q.args = append(q.args, lang)
+		}
+	}
+
+	if externalID := strings.TrimSpace(values.Get("external_id")); externalID != "" {
+		q.where = append(q.where, "external_id = ?")
+		q.args = append(q.args, externalID)
+	}
+
+	if value := values.Get("created_after"); value != "" {
+		t, _, err := parseListTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("created_after must be an RFC3339 timestamp or YYYY-MM-DD date")
+		}
+		q.where = append(q.where, "created_at >= ?")
+		q.args = append(q.args, t)
+	}
+	if value := values.Get("created_before"); value != "" {
+		t, dateOnly, err := parseListTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("created_before must be an RFC3339 timestamp or YYYY-MM-DD date")
+		}
+		// 只给出日期时包含当天
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		q.where = append(q.where, "created_at < ?")
+		q.args = append(q.args, t)
+	}
+	return q, nil
+}
+
+// parseListTime 解析 RFC3339 时间或 YYYY-MM-DD 日期（按服务器本地时区）
+func parseListTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	return t, true, err
+}
+
+// sql 返回查询语句和参数，分页时多取一条用于判断是否还有下一页
+func (q *listQuery) sql() (string, []interface{}) {
+	where := q.where
+	args := append([]interface{}{}, q.args...)
+	if q.cursor != nil {
+		where = append(append([]string{}, where...), "(created_at < ? OR (created_at = ? AND id < ?))")
+		args = append(args, q.cursor.CreatedAt, q.cursor.CreatedAt, q.cursor.ID)
+	}
+
+	query := `SELECT ` + taskColumns + ` FROM tasks`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY created_at DESC, id DESC`
+	if q.limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, q.limit+1, q.offset)
+	} else if q.offset > 0 {
+		// 只设置 offset 时不限制行数（各数据库都支持的写法）
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, math.MaxInt64, q.offset)
+	}
+	return query, args
+}
+
+// countSQL 返回统计符合筛选条件的任务总数的语句（忽略分页位置）
+func (q *listQuery) countSQL() (string, []interface{}) {
+	query := `SELECT COUNT(*) FROM tasks`
+	if len(q.where) > 0 {
+		query += ` WHERE ` + strings.Join(q.where, " AND ")
+	}
+	return query, q.args
+}
+
+// taskJSONFields 返回 Task 所有可输出的 JSON 字段名
+func taskJSONFields() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(Task{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// parseFieldsParam 解析 fields= 参数（逗号分隔），为空时返回 nil 表示输出全部字段
+func parseFieldsParam(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	known := taskJSONFields()
+	// id 总是输出，便于客户端关联
+	fields := []string{"id"}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || field == "id" {
+			continue
+		}
+		if !known[field] {
+			return nil, fmt.Errorf("unknown field: %s", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// projectTask 只保留 fields 中列出的字段，fields 为 nil 时原样返回
+func projectTask(task *Task, fields []string) interface{} {
+	if fields == nil {
+		return task
+	}
+	data, _ := json.Marshal(task)
+	var all map[string]json.RawMessage
+	json.Unmarshal(data, &all)
+
+	projected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected
+}
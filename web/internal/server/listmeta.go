@@ -0,0 +1,106 @@
+package server
+
+import (
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 任务列表的 meta：请求带 meta=true 时，列表响应为 {"tasks": [...], "meta": {...}}，
+// meta 中除分页信息外还包含队列负载（排队数、执行中任务数、最近的平均等待时间），
+// 渲染任务列表的客户端无需再请求管理接口即可显示系统负载。
+// 队列负载每 listMetaCacheTTL 最多统计一次，频繁轮询列表不会增加数据库负担。
+const (
+	listMetaCacheTTL   = 5 * time.Second
+	listMetaWaitWindow = time.Hour // 平均等待时间统计最近这段时间内开始执行的任务
+	listMetaWaitSample = 500       // 平均等待时间最多统计的任务数
+)
+
+// ListMeta 任务列表响应的 meta 部分
+type ListMeta struct {
+	Total      *int      `json:"total,omitempty"`       // 设置 limit 时为符合条件的任务总数
+	NextCursor string    `json:"next_cursor,omitempty"` // 还有下一页时的游标
+	Queue      QueueLoad `json:"queue"`
+}
+
+// QueueLoad 所有队列合计的负载
+type QueueLoad struct {
+	Queued         int       `json:"queued"`
+	Running        int       `json:"running"`
+	Workers        int       `json:"workers"`
+	Paused         bool      `json:"paused"`
+	DiskLow        bool      `json:"disk_low"`         // 磁盘空间不足，已暂停领取新任务
+	AvgWaitSeconds *float64  `json:"avg_wait_seconds"` // 最近一小时开始执行的任务从提交（或计划时间）到开始的平均等待，无样本时为 null
+	WaitSamples    int       `json:"wait_samples"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+var (
+	queueLoadMu    sync.Mutex
+	queueLoadCache *QueueLoad
+)
+
+// wantListMeta 请求是否要求带 meta 的列表响应
+func wantListMeta(value string) bool {
+	enabled, _ := strconv.ParseBool(value)
+	return enabled
+}
+
+// currentQueueLoad 返回队列负载，listMetaCacheTTL 内复用上次的统计结果
+func currentQueueLoad() QueueLoad {
+	queueLoadMu.Lock()
+	defer queueLoadMu.Unlock()
+	if queueLoadCache != nil && time.Since(queueLoadCache.UpdatedAt) < listMetaCacheTTL {
+		return *queueLoadCache
+	}
+
+	status := currentQueueStatus()
+	load := &QueueLoad{
+		Queued:    status.Queued,
+		Running:   status.Running,
+		Paused:    status.Paused,
+		DiskLow:   status.DiskLow != nil,
+		UpdatedAt: time.Now(),
+	}
+	for _, qc := range queueConfigs {
+		load.Workers += qc.Workers
+	}
+	load.AvgWaitSeconds, load.WaitSamples = recentAverageWait(load.UpdatedAt.Add(-listMetaWaitWindow))
+	queueLoadCache = load
+	return *load
+}
+
+// recentAverageWait 统计 since 之后开始执行的任务的平均等待时间（秒）
+func recentAverageWait(since time.Time) (*float64, int) {
+	rows, err := db.Query(`SELECT created_at, run_at, started_at FROM tasks
+		WHERE started_at IS NOT NULL AND started_at >= ? ORDER BY started_at DESC LIMIT ?`, since, listMetaWaitSample)
+	if err != nil {
+		return nil, 0
+	}
+	defer rows.Close()
+
+	var total time.Duration
+	n := 0
+	for rows.Next() {
+		var createdAt, startedAt time.Time
+		var runAt sql.NullTime
+		if err := rows.Scan(&createdAt, &runAt, &startedAt); err != nil {
+			continue
+		}
+		// 计划任务从计划时间开始计算
+		queuedAt := createdAt
+		if runAt.Valid && runAt.Time.After(queuedAt) {
+			queuedAt = runAt.Time
+		}
+		if wait := startedAt.Sub(queuedAt); wait > 0 {
+			total += wait
+		}
+		n++
+	}
+	if n == 0 {
+		return nil, 0
+	}
+	avg := (total / time.Duration(n)).Round(100 * time.Millisecond).Seconds()
+	return &avg, n
+}
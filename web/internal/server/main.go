@@ -0,0 +1,1790 @@
+package server
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const maxUploadSize = 100 << 20 // 100 MB
+
+// Task 任务结构
+type Task struct {
+	ID          string     `json:"id"`
+	Filename    string     `json:"filename"`
+	Status      string     `json:"status"` // scheduled, queued, running, success, failed
+	LangIn      string     `json:"lang_in"`
+	LangOut     string     `json:"lang_out"`
+	Pages       string     `json:"pages"`
+	Params      TaskParams `json:"params,omitempty"` // 数据库中为 JSON 字符串，响应中为对象（见 params.go）
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	OutputFile  string     `json:"output_file,omitempty"`  // 保留兼容性
+	OutputFiles []string   `json:"output_files,omitempty"` // 多个输出文件
+	NotifyEmail string     `json:"notify_email,omitempty"` // 任务结束后的通知邮箱
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`   // 结果过期时间（启用保留策略时）
+	Queue       string     `json:"queue,omitempty"`        // 所属的命名队列
+	Preset      string     `json:"preset,omitempty"`       // 提交时指定的预设
+	PageCount   int        `json:"page_count,omitempty"`   // 文档总页数，无法统计时为 0
+	SizeClass   string     `json:"size_class,omitempty"`   // 规模分级（见 sizeclass.go）
+	Progress    int        `json:"progress"`               // 执行进度 0-100，失败的任务保留失败时的进度
+	Stage       string     `json:"stage,omitempty"`        // 执行中（或失败时）所处的阶段：layout、translation 或 typesetting
+	StorageTier string     `json:"storage_tier,omitempty"` // 输出文件已归档（archived）或正在取回（restoring），见 coldstorage.go
+	ETASeconds  *int       `json:"eta_seconds,omitempty"`  // 执行中任务预计的剩余秒数（见 eta.go）
+	QueuePaused bool       `json:"queue_paused,omitempty"` // 排队中的任务所在队列是否已暂停
+	Attempts    int        `json:"attempts"`               // 已执行次数（含重试）
+	RunAt       *time.Time `json:"run_at,omitempty"`       // 计划执行时间
+	Tags        []string   `json:"tags,omitempty"`         // 标签（例如项目名）
+	ExternalID  string     `json:"external_id,omitempty"`  // 调用方系统中的标识（唯一）
+	Notes       *TaskNotes `json:"notes,omitempty"`        // 标题、作者和主题，提交时取自 PDF 元数据（见 pdfmetadata.go）
+	Citation    *Citation  `json:"citation,omitempty"`     // DOI 及引用信息（见 citation.go）
+	Version     int        `json:"version"`                // 每次修改递增，用于乐观并发控制
+	UserID      string     `json:"-"`                      // 提交任务的用户
+	OrgID       string     `json:"-"`                      // 提交者所属的组织（见 follows.go）
+	OutputDir   string     `json:"-"`                      // 输出文件所在目录（相对 outputDir，见 OUTPUT_LAYOUT）
+
+	PersistenceWarning string `json:"persistence_warning,omitempty"` // 任务状态曾经或正在写入数据库失败
+
+	ProgressWebhook *ProgressWebhook `json:"progress_webhook,omitempty"` // 进度回调订阅
+	CallbackURL     string           `json:"callback_url,omitempty"`     // 任务结束回调地址
+	EnvSnapshot     *EnvSnapshot     `json:"env_snapshot,omitempty"`     // 最近一次执行时的运行环境（只在任务详情中返回）
+	Timings         *TaskTimings     `json:"timings,omitempty"`          // 各阶段耗时（只在任务详情中返回，见 timings.go）
+	FontWarning     *FontWarning     `json:"font_warning,omitempty"`     // 没有可用字体的字符（只在任务详情中返回，见 fonts.go）
+	ResourceRetry   *ResourceRetry   `json:"resource_retry,omitempty"`   // 内存不足后调整参数的重试（只在任务详情中返回，见 resourceretry.go）
+
+	Policy           *TaskPolicy `json:"policy,omitempty"`            // 提交者的个人策略（见 usersettings.go）
+	RetentionSeconds int64       `json:"retention_seconds,omitempty"` // 提交者设置的保留时长，覆盖 RESULT_RETENTION
+
+	InputSHA256    string     `json:"input_sha256,omitempty"`     // 输入文件内容的 SHA-256，相同内容的文件只保存一份（见 blobs.go）
+	InputRemovedAt *time.Time `json:"input_removed_at,omitempty"` // 源文件被删除（INPUT_RETENTION 或个人策略）的时间
+	NextWindowAt   *time.Time `json:"next_window_at,omitempty"`   // 排队中的任务所在队列在执行时段之外时，下一个时段的开始时间（见 windows.go）
+	WatchSource    string     `json:"watch_source,omitempty"`     // 从监视目录提交时放入的文件名，结果复制到 WATCH_OUTPUT_DIR（见 watchfolder.go）
+}
+
+// reservedFormFields 由服务自身处理的表单字段，不会作为参数传给 babeldoc
+var reservedFormFields = map[string]bool{
+	"file":                   true,
+	"file_url":               true,
+	"draft_id":               true,
+	"external_id":            true,
+	"lang_in":                true,
+	"lang_out":               true,
+	"pages":                  true,
+	"notify_email":           true,
+	"preset":                 true,
+	"progress_webhook":       true,
+	"callback_url":           true,
+	"progress_every_percent": true,
+	"progress_every_seconds": true,
+	"progress_milestones":    true,
+	"progress_on_stage":      true,
+	"run_at":                 true,
+	"tags":                   true,
+	"doi":                    true,
+}
+
+// Global variables
+var (
+	db          *sql.DB
+	tasksMutex  sync.RWMutex
+	workerCount = 1 // 单线程执行
+)
+
+// Main 启动服务，实例角色由 NODE_ROLE 决定（web/main.go）
+func Main() {
+	run(nodeRole())
+}
+
+// RunWorker 以独立 worker 进程运行：只从共享队列领取并执行任务，不提供 HTTP 接口（web/cmd/worker）。
+// 队列必须是持久的（QUEUE_BACKEND=db 或 redis），任务状态、进度和日志通过共享的数据目录和数据库交给 Web 服务
+func RunWorker() {
+	run(nodeRoleWorker)
+}
+
+func run(role string) {
+	// worker 以子进程方式运行模拟翻译器（见 mocktranslator.go）
+	if len(os.Args) > 1 && os.Args[1] == mockTranslatorArg {
+		os.Exit(runMockTranslator(os.Args[2:]))
+	}
+	// 备份与恢复命令（见 backup.go）
+	if len(os.Args) > 1 && (os.Args[1] == backupArg || os.Args[1] == restoreArg) {
+		os.Exit(runBackupCommand(os.Args[1], os.Args[2:]))
+	}
+
+	// 接管平滑升级时旧进程交接的监听套接字（见 upgrade.go）
+	initUpgrade()
+
+	// 确保目录存在（见 datadirs.go）
+	if err := prepareDataDirs(); err != nil {
+		log.Fatal("数据目录配置无效: ", err)
+	}
+
+	// 初始化数据库
+	var err error
+	db, err = openDatabase()
+	if err != nil {
+		log.Fatal("无法打开数据库:", err)
+	}
+	defer db.Close()
+
+	// 创建表
+	createTable()
+
+	// 演示模式下写入示例任务（见 demo.go）
+	if demoMode {
+		seedDemoTasks()
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("WORKER_COUNT")); err == nil && n > 0 {
+		workerCount = n
+	}
+
+	// 初始化任务队列
+	queueConfigs, err = loadQueueConfigs(workerCount)
+	if err != nil {
+		log.Fatal("无法加载队列配置:", err)
+	}
+	if err := initTaskQueues(); err != nil {
+		log.Fatal("无法初始化任务队列:", err)
+	}
+
+	// 加载规模分级（见 sizeclass.go）
+	sizeClasses, err = loadSizeClasses()
+	if err != nil {
+		log.Fatal("无法加载规模分级:", err)
+	}
+
+	// 加载冷存储配置（见 coldstorage.go）
+	coldStorage, err = loadColdStore()
+	if err != nil {
+		log.Fatal("无法加载冷存储配置:", err)
+	}
+
+	// 加载对象存储配置（见 storage.go）
+	objectStorage, err = loadObjectStore()
+	if err != nil {
+		log.Fatal("无法加载对象存储配置:", err)
+	}
+
+	// 加载输出文件压缩配置（见 compression.go）
+	outputCompression, err = loadOutputCompression()
+	if err != nil {
+		log.Fatal("无法加载输出压缩配置:", err)
+	}
+
+	// 加载结果投递目标（见 delivery.go）
+	deliveryTargets, err = loadDeliveryTargets()
+	if err != nil {
+		log.Fatal("无法加载投递目标:", err)
+	}
+
+	// 恢复重启前未完成的任务（共享队列只恢复已停止的 worker 留下的任务）
+	if role == nodeRoleWorker && !taskQueues[queueConfigs[0].Name].Durable() {
+		log.Fatal("独立运行的 worker 需要共享队列，请设置 QUEUE_BACKEND=db 或 redis")
+	}
+	if taskQueues[queueConfigs[0].Name].Durable() {
+		recoverDurableTasks()
+	} else if isUpgradeChild() {
+		recoverTasksAfterUpgrade()
+	} else {
+		recoverTasks()
+	}
+
+	// 启动任务处理器
+	if role != nodeRoleAPI {
+		// 提前检测 babeldoc 版本，避免第一个任务等待（见 envsnapshot.go）
+		if defaultTranslator != translatorMock {
+			go detectBabeldocVersion()
+		}
+		for _, qc := range queueConfigs {
+			for i := 0; i < qc.Workers; i++ {
+				go taskWorker(qc.Name, i)
+			}
+			log.Printf("Queue %s started with %d worker(s)", qc.Name, qc.Workers)
+		}
+	}
+
+	// 启动服务商健康探测
+	go providerProber()
+
+	// 启动计划任务调度
+	go scheduledDispatcher()
+
+	// 启动卡住任务清理
+	go stuckTaskReaper()
+
+	// 启动磁盘空间监控（见 diskmonitor.go）
+	go diskSpaceMonitor()
+
+	if role == nodeRoleWorker {
+		notifyUpgradeReady()
+		waitForSignals()
+		return
+	}
+
+	// 启动过期结果清理
+	go retentionWorker()
+
+	// 启动旧结果归档
+	go coldStorageWorker()
+
+	// 启动对象存储的本地缓存清理
+	go storageCacheCleaner()
+
+	// 为已完成的任务补建译文内容索引
+	go contentIndexBackfill()
+
+	// 任务由其他节点（或平滑升级前的旧进程）执行时，WebSocket 推送需要轮询数据库发现变化（见 ws.go）
+	if role == nodeRoleAPI || taskQueues[queueConfigs[0].Name].Durable() || isUpgradeChild() {
+		go wsPoller()
+	}
+
+	// 启动按标签的每周汇总
+	go tagDigestWorker()
+
+	// 启动过期预上传文件清理
+	go pendingUploadCleaner()
+
+	// 启动写入失败的任务状态补写
+	go pendingWriteFlusher()
+
+	// 启动批量导入的下载（见 imports.go）
+	go importWorker()
+
+	// 启动监视目录的自动提交（见 watchfolder.go）
+	if watchDir != "" {
+		go folderWatcher()
+	}
+
+	// 静态文件与 API 路由（见 routes.go）
+	router := newRouter()
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	// 管理接口及 pprof 的独立监听地址（见 adminlisten.go）
+	if adminListen != "" {
+		go serveAdmin()
+	}
+	if adminToken == "" {
+		if adminListen != "" {
+			log.Printf("未设置 ADMIN_TOKEN，管理端点只能通过 %s 访问", adminListen)
+		} else {
+			log.Printf("未设置 ADMIN_TOKEN，管理端点已禁用")
+		}
+	}
+
+	srv := newHTTPServer(":"+port, router)
+	ln, err := listen(listenerPublic, srv.Addr)
+	if err != nil {
+		log.Fatal("无法监听端口:", err)
+	}
+	trackServer(listenerPublic, srv, ln)
+
+	log.Printf("Server starting on port %s...", port)
+	go func() {
+		if err := serve(srv, ln); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// 停止或平滑升级（见 upgrade.go）
+	notifyUpgradeReady()
+	waitForSignals()
+}
+
+func createTable() {
+	t := dbStore.Types()
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS tasks (
+		id ` + t.Key + ` PRIMARY KEY,
+		filename ` + t.Text + ` NOT NULL,
+		status ` + t.Text + ` NOT NULL,
+		lang_in ` + t.Text + `,
+		lang_out ` + t.Text + `,
+		pages ` + t.Text + `,
+		params ` + t.Text + `,
+		created_at ` + t.Time + ` NOT NULL,
+		started_at ` + t.Time + `,
+		completed_at ` + t.Time + `,
+		error ` + t.Text + `,
+		output_file ` + t.Text + `
+	)`)
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+
+	// 迁移：添加params列（如果不存在）
+	db.Exec(`ALTER TABLE tasks ADD COLUMN params ` + t.Text)
+	// 迁移：添加output_files列用于存储多个输出文件（JSON数组）
+	db.Exec(`ALTER TABLE tasks ADD COLUMN output_files ` + t.Text)
+	// 迁移：添加notify_email列用于邮件通知
+	db.Exec(`ALTER TABLE tasks ADD COLUMN notify_email ` + t.Text)
+	// 迁移：添加queue列记录任务所属的命名队列
+	db.Exec(`ALTER TABLE tasks ADD COLUMN queue ` + t.Text)
+	// 迁移：添加attempts列记录执行次数
+	db.Exec(`ALTER TABLE tasks ADD COLUMN attempts ` + t.Integer + ` NOT NULL DEFAULT 0`)
+	// 迁移：添加progress_webhook列存储进度回调订阅（JSON）
+	db.Exec(`ALTER TABLE tasks ADD COLUMN progress_webhook ` + t.Text)
+	// 迁移：添加run_at列用于计划执行
+	db.Exec(`ALTER TABLE tasks ADD COLUMN run_at ` + t.Time)
+	// 迁移：添加tags列存储标签（JSON数组）
+	db.Exec(`ALTER TABLE tasks ADD COLUMN tags ` + t.Text)
+	// 迁移：添加external_id列存储调用方的外部标识
+	db.Exec(`ALTER TABLE tasks ADD COLUMN external_id ` + t.Key)
+	// 迁移：添加persistence_warning列记录状态写入失败后的补写
+	db.Exec(`ALTER TABLE tasks ADD COLUMN persistence_warning ` + t.Text)
+	// 迁移：添加version列用于乐观并发控制，由触发器在每次修改时递增
+	db.Exec(`ALTER TABLE tasks ADD COLUMN version ` + t.Integer + ` NOT NULL DEFAULT 1`)
+	// 迁移：添加user_id列记录提交任务的用户
+	db.Exec(`ALTER TABLE tasks ADD COLUMN user_id ` + t.Text)
+	// 迁移：添加output_dir列记录输出文件所在目录
+	db.Exec(`ALTER TABLE tasks ADD COLUMN output_dir ` + t.Text)
+	// 迁移：添加callback_url列存储任务结束回调地址
+	db.Exec(`ALTER TABLE tasks ADD COLUMN callback_url ` + t.Text)
+	// 迁移：添加env_snapshot列记录执行时的运行环境（JSON）
+	db.Exec(`ALTER TABLE tasks ADD COLUMN env_snapshot ` + t.Text)
+	// 迁移：添加preset列记录提交时的预设（用于按预设投递结果）
+	db.Exec(`ALTER TABLE tasks ADD COLUMN preset ` + t.Text)
+	// 迁移：添加page_count和size_class列记录页数和规模分级
+	db.Exec(`ALTER TABLE tasks ADD COLUMN page_count ` + t.Integer + ` NOT NULL DEFAULT 0`)
+	db.Exec(`ALTER TABLE tasks ADD COLUMN size_class ` + t.Text)
+	// 迁移：添加progress和stage列记录执行进度和阶段
+	db.Exec(`ALTER TABLE tasks ADD COLUMN progress ` + t.Integer + ` NOT NULL DEFAULT 0`)
+	db.Exec(`ALTER TABLE tasks ADD COLUMN stage ` + t.Text)
+	// 迁移：添加storage_tier和restored_at列记录输出文件的冷存储状态
+	db.Exec(`ALTER TABLE tasks ADD COLUMN storage_tier ` + t.Text)
+	db.Exec(`ALTER TABLE tasks ADD COLUMN restored_at ` + t.Time)
+	// 迁移：添加timings列记录各阶段耗时（JSON）
+	db.Exec(`ALTER TABLE tasks ADD COLUMN timings ` + t.Text)
+	// 迁移：添加font_warning列记录没有可用字体的字符（JSON）
+	db.Exec(`ALTER TABLE tasks ADD COLUMN font_warning ` + t.Text)
+	// 迁移：添加resource_retry列记录内存不足后调整的参数（JSON）
+	db.Exec(`ALTER TABLE tasks ADD COLUMN resource_retry ` + t.Text)
+	// 迁移：添加policy、retention_seconds列记录提交者的个人策略
+	db.Exec(`ALTER TABLE tasks ADD COLUMN policy ` + t.Text)
+	db.Exec(`ALTER TABLE tasks ADD COLUMN retention_seconds ` + t.Integer)
+	// 迁移：添加input_sha256列，按内容寻址保存输入文件
+	db.Exec(`ALTER TABLE tasks ADD COLUMN input_sha256 ` + t.Text)
+	// 迁移：添加org_id列记录提交者所属的组织
+	db.Exec(`ALTER TABLE tasks ADD COLUMN org_id ` + t.Text)
+	// 迁移：添加notes列保存从PDF元数据读取的标题、作者和主题
+	db.Exec(`ALTER TABLE tasks ADD COLUMN notes ` + t.Text)
+	// 迁移：添加citation列保存DOI及从Crossref查询到的引用信息
+	db.Exec(`ALTER TABLE tasks ADD COLUMN citation ` + t.Text)
+	// 迁移：添加input_removed_at列记录源文件被删除的时间
+	db.Exec(`ALTER TABLE tasks ADD COLUMN input_removed_at ` + t.Time)
+	// 迁移：添加watch_source列记录从监视目录提交的文件名
+	db.Exec(`ALTER TABLE tasks ADD COLUMN watch_source ` + t.Text)
+	if err := dbStore.CreateIndex("idx_tasks_external_id", "tasks", "external_id", "external_id IS NOT NULL", true); err != nil {
+		log.Fatal("无法创建索引:", err)
+	}
+
+	// 服务级别的持久化设置（例如队列暂停状态）
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS settings ("key" ` + t.Key + ` PRIMARY KEY, value ` + t.Text + ` NOT NULL)`)
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+
+	// 用户保存的默认提交参数（JSON 对象）
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS user_defaults (user_id ` + t.Key + ` PRIMARY KEY, defaults ` + t.Text + ` NOT NULL, updated_at ` + t.Time + ` NOT NULL)`)
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+
+	// worker 心跳
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS worker_heartbeats (
+		worker_id ` + t.Key + ` PRIMARY KEY,
+		node ` + t.Text + ` NOT NULL,
+		queue ` + t.Text + ` NOT NULL,
+		task_id ` + t.Text + `,
+		stage ` + t.Text + ` NOT NULL,
+		progress ` + t.Integer + ` NOT NULL DEFAULT 0,
+		log_offset ` + t.Integer + ` NOT NULL DEFAULT 0,
+		started_at ` + t.Time + ` NOT NULL,
+		task_started_at ` + t.Time + `,
+		last_output_at ` + t.Time + `,
+		updated_at ` + t.Time + ` NOT NULL
+	)`)
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+	// 迁移：添加pid列记录 babeldoc 进程号
+	db.Exec(`ALTER TABLE worker_heartbeats ADD COLUMN pid ` + t.Integer + ` NOT NULL DEFAULT 0`)
+
+	// 分享链接
+	createDownloadLinksTable()
+
+	// 加密分享包
+	createBundlesTable()
+
+	// 用户个人策略
+	createUserSettingsTable()
+
+	// 任务事件（结果投递等）
+	createTaskEventsTable()
+	createDraftsTable()
+	createBlobsTable()
+	createFollowsTable()
+	createImportsTables()
+	createTokenSpendTable()
+	createThroughputStatsTable()
+
+	// 文件名与标签的全文索引
+	createSearchIndex()
+
+	// 译文内容索引（见 contentindex.go）
+	createContentIndex()
+
+	// 任务版本号，用于列表和详情的 ETag 及单个任务的乐观并发控制
+	createVersionTriggers()
+}
+
+// getSetting 读取持久化设置，不存在时返回空字符串
+func getSetting(key string) string {
+	var value string
+	db.QueryRow(`SELECT value FROM settings WHERE "key" = ?`, key).Scan(&value)
+	return value
+}
+
+// setSetting 写入持久化设置
+func setSetting(key, value string) error {
+	_, err := execWithRetry(`INSERT INTO settings ("key", value) VALUES (?, ?) `+dbStore.Upsert(`"key"`)+` value = excluded.value`, key, value)
+	return err
+}
+
+// taskColumns 与 scanTask 的扫描顺序保持一致
+const taskColumns = `id, filename, status, lang_in, lang_out, pages, params, created_at, started_at, completed_at, error, output_file, output_files, notify_email, queue, attempts, progress_webhook, run_at, tags, external_id, persistence_warning, version, user_id, output_dir, callback_url, preset, page_count, size_class, progress, stage, storage_tier, policy, retention_seconds, input_sha256, org_id, notes, citation, input_removed_at, watch_source`
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask 按 taskColumns 的列顺序读取一条任务记录
+func scanTask(row rowScanner) (*Task, error) {
+	var task Task
+	var startedAt, completedAt, runAt, inputRemovedAt sql.NullTime
+	var errorMsg, outputFile, params, outputFilesJSON, notifyEmail, queue, progressWebhookJSON, tagsJSON, externalID, persistenceWarning, userID, outputDirCol, callbackURL, preset, sizeClass, stage, storageTier, policyJSON, inputSHA256, orgID, notesJSON, citationJSON, watchSource sql.NullString
+	var retentionSeconds sql.NullInt64
+
+	err := row.Scan(&task.ID, &task.Filename, &task.Status, &task.LangIn, &task.LangOut,
+		&task.Pages, &params, &task.CreatedAt, &startedAt, &completedAt, &errorMsg, &outputFile, &outputFilesJSON, &notifyEmail, &queue, &task.Attempts, &progressWebhookJSON, &runAt, &tagsJSON, &externalID, &persistenceWarning, &task.Version, &userID, &outputDirCol, &callbackURL, &preset, &task.PageCount, &sizeClass, &task.Progress, &stage, &storageTier, &policyJSON, &retentionSeconds, &inputSHA256, &orgID, &notesJSON, &citationJSON, &inputRemovedAt, &watchSource)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Valid {
+		task.Params = TaskParams(params.String)
+	}
+	if startedAt.Valid {
+		task.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		task.CompletedAt = &completedAt.Time
+	}
+	if errorMsg.Valid {
+		task.Error = errorMsg.String
+	}
+	if outputFile.Valid {
+		task.OutputFile = outputFile.String
+	}
+	if outputFilesJSON.Valid && outputFilesJSON.String != "" {
+		json.Unmarshal([]byte(outputFilesJSON.String), &task.OutputFiles)
+	}
+	task.UserID = userID.String
+	task.OrgID = orgID.String
+	task.OutputDir = outputDirCol.String
+	task.CallbackURL = callbackURL.String
+	task.Preset = preset.String
+	task.SizeClass = sizeClass.String
+	task.Stage = stage.String
+	task.StorageTier = storageTier.String
+	if policyJSON.Valid && policyJSON.String != "" {
+		json.Unmarshal([]byte(policyJSON.String), &task.Policy)
+	}
+	task.RetentionSeconds = retentionSeconds.Int64
+	task.InputSHA256 = inputSHA256.String
+	task.WatchSource = watchSource.String
+	if notesJSON.Valid && notesJSON.String != "" {
+		json.Unmarshal([]byte(notesJSON.String), &task.Notes)
+	}
+	if inputRemovedAt.Valid {
+		task.InputRemovedAt = &inputRemovedAt.Time
+	}
+	if citationJSON.Valid && citationJSON.String != "" {
+		json.Unmarshal([]byte(citationJSON.String), &task.Citation)
+	}
+	if notifyEmail.Valid {
+		task.NotifyEmail = notifyEmail.String
+	}
+	if queue.Valid {
+		task.Queue = queue.String
+	}
+	if runAt.Valid {
+		task.RunAt = &runAt.Time
+	}
+	if tagsJSON.Valid && tagsJSON.String != "" {
+		json.Unmarshal([]byte(tagsJSON.String), &task.Tags)
+	}
+	if progressWebhookJSON.Valid && progressWebhookJSON.String != "" {
+		json.Unmarshal([]byte(progressWebhookJSON.String), &task.ProgressWebhook)
+	}
+	if externalID.Valid {
+		task.ExternalID = externalID.String
+	}
+	task.PersistenceWarning = persistenceWarning.String
+	if warning := pendingWriteWarning(task.ID); warning != "" {
+		task.PersistenceWarning = warning
+	}
+	task.ExpiresAt = taskExpiresAt(&task)
+	task.ETASeconds = taskETA(&task)
+	if task.Status == "queued" {
+		task.NextWindowAt = queueNextWindow(task.Queue)
+	}
+	return &task, nil
+}
+
+// recoverTasks 恢复上次进程退出时尚未完成的任务。
+// 队列只存在于内存中，重启后 queued 任务需要重新入队；
+// running 任务的 babeldoc 进程已随服务一起退出，重置为 queued 后重新执行。
+func recoverTasks() {
+	resetInterruptedTasks(nil)
+	enqueueQueuedTasks()
+}
+
+// recoverDurableTasks 使用共享队列时恢复已停止的 worker 留下的任务：
+// 没有存活 worker 在执行的 running 任务重置为 queued 并重新入队，Redis 处理中列表中的任务放回队列。
+// 本节点上的其他 worker 都属于重启前的进程，视为已停止（平滑升级时旧进程仍在运行，除外）
+func recoverDurableTasks() {
+	workers, err := loadWorkerHeartbeats()
+	if err != nil {
+		log.Printf("无法读取 worker 心跳，跳过任务恢复: %v", err)
+		return
+	}
+	node, _ := os.Hostname()
+	alive := make(map[string]bool)
+	executing := make(map[string]bool)
+	for _, hb := range workers {
+		if hb.Alive && (hb.Node != node || isUpgradeChild()) {
+			alive[hb.WorkerID] = true
+			if hb.TaskID != "" {
+				executing[hb.TaskID] = true
+			}
+		}
+	}
+
+	var interrupted []string
+	rows, err := db.Query(`SELECT id FROM tasks WHERE status = 'running'`)
+	if err != nil {
+		log.Printf("无法查询执行中的任务: %v", err)
+		return
+	}
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil && !executing[id] {
+			interrupted = append(interrupted, id)
+		}
+	}
+	rows.Close()
+	if len(interrupted) > 0 {
+		resetInterruptedTasks(interrupted)
+	}
+	for _, id := range interrupted {
+		// 清理中断任务残留的临时输出，避免被误认为本次的翻译结果
+		os.RemoveAll(filepath.Join(outputDir, id))
+	}
+
+	requeued := make(map[string]bool)
+	for _, qc := range queueConfigs {
+		rq, ok := taskQueues[qc.Name].(*redisQueue)
+		if !ok {
+			continue
+		}
+		ids, err := rq.requeueProcessing(alive)
+		if err != nil {
+			log.Printf("无法恢复队列 %s 中处理中的任务: %v", qc.Name, err)
+		}
+		for id := range ids {
+			requeued[id] = true
+		}
+	}
+	if len(requeued) > 0 {
+		log.Printf("已将 %d 个处理中的任务放回队列", len(requeued))
+	}
+
+	// 不在处理中列表中的中断任务（db 队列，或由旧版本取出的任务）直接重新入队
+	for _, id := range interrupted {
+		if requeued[id] {
+			continue
+		}
+		task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id))
+		if err != nil || task.Status != "queued" {
+			continue
+		}
+		if err := enqueueTask(task); err != nil {
+			log.Printf("任务 %s 重新入队失败: %v", task.ID, err)
+		}
+	}
+}
+
+// resetInterruptedTasks 将 running 任务重置为 queued（批量执行状态机中的 running → queued 转换），
+// ids 为 nil 时重置全部 running 任务
+func resetInterruptedTasks(ids []string) {
+	query := `UPDATE tasks SET status = 'queued', started_at = NULL, progress = 0, stage = NULL WHERE status = 'running'`
+	args := make([]interface{}, len(ids))
+	if ids != nil {
+		if len(ids) == 0 {
+			return
+		}
+		for i, id := range ids {
+			args[i] = id
+		}
+		query += ` AND id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)`
+	}
+	if ids == nil {
+		// 先读取将被重置的任务，用于记录事件
+		rows, err := db.Query(`SELECT id FROM tasks WHERE status = 'running'`)
+		if err == nil {
+			for rows.Next() {
+				var id string
+				if rows.Scan(&id) == nil {
+					ids = append(ids, id)
+				}
+			}
+			rows.Close()
+		}
+	}
+	res, err := execWithRetry(query, args...)
+	if err != nil {
+		log.Printf("无法重置中断的任务: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("已将 %d 个中断的任务重置为排队状态", n)
+		for _, id := range ids {
+			recordTaskEvent(id, eventTaskRequeued, "执行被中断，重新排队")
+		}
+	}
+}
+
+// enqueueQueuedTasks 将数据库中排队中的任务放入内存队列
+func enqueueQueuedTasks() {
+	rows, err := db.Query(`SELECT ` + taskColumns + ` FROM tasks WHERE status = 'queued' ORDER BY created_at ASC`)
+	if err != nil {
+		log.Printf("无法加载排队中的任务: %v", err)
+		return
+	}
+	var tasks []*Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			log.Printf("无法读取任务记录: %v", err)
+			continue
+		}
+		// 清理中断任务残留的临时输出，避免被误认为本次的翻译结果
+		os.RemoveAll(filepath.Join(outputDir, task.ID))
+		tasks = append(tasks, task)
+	}
+	rows.Close()
+
+	if len(tasks) == 0 {
+		return
+	}
+	log.Printf("恢复 %d 个排队中的任务", len(tasks))
+
+	// 队列容量有限，在后台逐个入队，避免阻塞启动
+	go func() {
+		for _, task := range tasks {
+			enqueueTask(task)
+		}
+	}()
+}
+
+// 提交任务
+func submitTaskHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+
+	// 支持 multipart 表单和 JSON 两种提交方式，解析为相同的字段（限制上传大小）
+	parse := parseMultipartSubmission
+	if isJSONRequest(r) {
+		parse = parseJSONSubmission
+	}
+	input, err := parse(w, r)
+	if err != nil {
+		writeErrorFrom(w, err, http.StatusBadRequest, codeBadRequest)
+		return
+	}
+	if input.close != nil {
+		defer input.close()
+	}
+
+	// 未提供的字段使用用户保存的默认参数
+	input.userID = currentUserID(r)
+	input.orgID = currentUserOrg(r)
+	input.receivedAt = receivedAt
+	if err := applyUserDefaults(input.form, input.userID); err != nil {
+		log.Printf("无法读取用户默认参数: %v", err)
+	}
+	createTask(w, input)
+}
+
+// createTask 根据解析后的提交内容保存输入文件、创建任务并入队，写出提交接口的响应
+func createTask(w http.ResponseWriter, input *submissionInput) {
+	form := input.form
+	if input.receivedAt.IsZero() {
+		input.receivedAt = time.Now()
+	}
+
+	// 图片合成为 PDF（见 imagepdf.go），之后检查文件类型
+	if err := convertImageInput(input); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if !strings.HasSuffix(strings.ToLower(input.filename), ".pdf") {
+		writeError(w, http.StatusBadRequest, codeUnsupportedFile, "Only PDF files are allowed")
+		return
+	}
+
+	// 外部标识必须唯一
+	externalID := strings.TrimSpace(form.Get("external_id"))
+	if err := validateExternalID(externalID); err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	if externalID != "" {
+		if existing, err := taskIDByExternalID(externalID); err == nil {
+			writeErrorDetails(w, http.StatusConflict, codeExternalIDConflict, "external_id already exists", map[string]interface{}{"task_id": existing})
+			return
+		}
+	}
+
+	// 生成任务ID
+	timestamp := time.Now().Format("20060102-150405")
+	taskID := fmt.Sprintf("%s_%d", timestamp, time.Now().UnixNano()%10000)
+	filename := fmt.Sprintf("%s_%s", timestamp, input.filename)
+	inputPath := filepath.Join(uploadDir, filename)
+
+	// 保存文件，同时计算内容的 SHA-256，用于去重（见 blobs.go）；接收时已写入上传目录的文件直接改名
+	inputSHA256, err := saveSubmissionFile(input, inputPath)
+	if err != nil {
+		os.Remove(inputPath)
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error saving file")
+		return
+	}
+	// 接收并保存上传文件的耗时（见 timings.go）
+	timingsJSON, _ := json.Marshal(&TaskTimings{Upload: roundedSeconds(time.Since(input.receivedAt).Seconds())})
+
+	// 获取参数
+	langIn := form.Get("lang_in")
+	langOut := form.Get("lang_out")
+	pages := form.Get("pages")
+	notifyEmail := strings.TrimSpace(form.Get("notify_email"))
+	preset := strings.TrimSpace(form.Get("preset"))
+
+	if notifyEmail != "" {
+		if notifyEmail, err = parseNotifyEmail(notifyEmail); err != nil {
+			os.Remove(inputPath)
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+	}
+
+	runAt, err := parseRunAt(form.Get("run_at"))
+	if err != nil {
+		os.Remove(inputPath)
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	progressWebhook, err := parseProgressWebhook(form)
+	if err != nil {
+		os.Remove(inputPath)
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	callbackURL, err := parseCallbackURL(form.Get("callback_url"))
+	if err != nil {
+		os.Remove(inputPath)
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	doi, err := normalizeDOI(form.Get("doi"))
+	if err != nil {
+		os.Remove(inputPath)
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	// 统计页数并确定规模分级（见 sizeclass.go）
+	pageCount, sizeClass, apiErr := classifyTaskSize(inputPath, pages)
+	if apiErr != nil {
+		os.Remove(inputPath)
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	langInExplicit := langIn != ""
+	if langIn == "" {
+		langIn = defaultLangIn
+	}
+	if langOut == "" {
+		langOut = defaultLangOut
+	}
+
+	// 校验语言代码并将别名（zh-CN、zh_Hans、Chinese 等）转换为 babeldoc 使用的规范代码
+	langIn, langOut, err = normalizeLanguagePair(langIn, langOut)
+	if err != nil {
+		os.Remove(inputPath)
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	// 根据 PDF 元数据中的文档语言检查语言设置，避免把英文“翻译”成英文
+	langIn, warnings, err := checkDocumentLanguage(inputPath, langIn, langOut, langInExplicit)
+	if err != nil {
+		os.Remove(inputPath)
+		writeError(w, http.StatusUnprocessableEntity, codeLanguageMismatch, err.Error())
+		return
+	}
+	for _, warning := range warnings {
+		log.Printf("任务 %s: %s", taskID, warning)
+	}
+
+	// 收集所有其他参数（过滤空值）
+	paramsMap := make(map[string]string)
+	for key, values := range form {
+		if len(values) > 0 && !reservedFormFields[key] {
+			value := strings.TrimSpace(values[0])
+			if value != "" && value != "false" && value != "off" {
+				paramsMap[key] = value
+			}
+		}
+	}
+	paramsJSON, _ := json.Marshal(paramsMap)
+
+	// 创建任务
+	task := &Task{
+		ID:          taskID,
+		Filename:    input.filename,
+		Status:      "queued",
+		LangIn:      langIn,
+		LangOut:     langOut,
+		Pages:       pages,
+		Params:      TaskParams(paramsJSON),
+		CreatedAt:   time.Now(),
+		NotifyEmail: notifyEmail,
+		Queue:       queueForPreset(preset),
+		Preset:      preset,
+		PageCount:   pageCount,
+		SizeClass:   sizeClass.Name,
+
+		ProgressWebhook: progressWebhook,
+		CallbackURL:     callbackURL,
+		Tags:            parseTags(form.Get("tags")),
+		ExternalID:      externalID,
+		UserID:          input.userID,
+		OrgID:           input.orgID,
+		Notes:           input.notes,
+		WatchSource:     input.watchSource,
+	}
+	if task.Notes == nil {
+		task.Notes = readPDFNotes(inputPath)
+	}
+	// DOI 和引用信息（见 citation.go）：克隆时沿用原任务的，否则使用提交的 DOI，启用查询时在 PDF 中查找
+	task.Citation = input.citation
+	if doi != "" && (task.Citation == nil || task.Citation.DOI != doi) {
+		task.Citation = &Citation{DOI: doi}
+	}
+	if task.Citation == nil && doiLookupEnabled {
+		if found := findPDFDOI(inputPath); found != "" {
+			task.Citation = &Citation{DOI: found}
+		}
+	}
+
+	// 提交者的个人策略（见 usersettings.go）
+	if settings, err := loadUserSettings(input.userID); err == nil {
+		task.Policy = settings.policy()
+		task.RetentionSeconds = settings.retentionSeconds()
+	} else {
+		log.Printf("无法读取用户 %s 的个人策略: %v", input.userID, err)
+	}
+
+	// 分级限制了服务商时改用允许的队列
+	if apiErr := applySizeClassProviders(task, sizeClass); apiErr != nil {
+		os.Remove(inputPath)
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	// 计划时间未到的任务暂不入队
+	if runAt != nil && runAt.After(task.CreatedAt) {
+		task.Status = "scheduled"
+		task.RunAt = runAt
+	}
+
+	// 执行入队前钩子（病毒扫描、DLP 检查等）
+	if err := runPreQueueHooks(task); err != nil {
+		os.Remove(inputPath)
+		log.Printf("任务 %s 被入队前钩子拒绝: %v", task.ID, err)
+		writeError(w, http.StatusUnprocessableEntity, codeHookRejected, "Rejected by pre-queue hook: "+err.Error())
+		return
+	}
+
+	// 按内容保存输入文件，已有相同内容的文件时直接引用；启用对象存储时同时上传，执行任务的 worker 从对象存储取回
+	task.InputSHA256 = hex.EncodeToString(inputSHA256)
+	if _, err := storeInputBlob(inputPath, task.InputSHA256); err != nil {
+		os.Remove(inputPath)
+		log.Printf("无法保存任务 %s 的输入文件: %v", task.ID, err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error saving file")
+		return
+	}
+
+	// 保存到数据库
+	var progressWebhookJSON, tagsJSON, policyJSON, citationJSON []byte
+	if task.Citation != nil {
+		citationJSON, _ = json.Marshal(task.Citation)
+	}
+	if task.Policy != nil {
+		policyJSON, _ = json.Marshal(task.Policy)
+	}
+	if task.ProgressWebhook != nil {
+		progressWebhookJSON, _ = json.Marshal(task.ProgressWebhook)
+	}
+	if len(task.Tags) > 0 {
+		tagsJSON, _ = json.Marshal(task.Tags)
+	}
+	_, err = execWithRetry(`
+		INSERT INTO tasks (id, filename, status, lang_in, lang_out, pages, params, created_at, notify_email, queue, progress_webhook, run_at, tags, external_id, user_id, callback_url, preset, page_count, size_class, timings, policy, retention_seconds, input_sha256, org_id, notes, citation, watch_source)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, task.ID, task.Filename, task.Status, task.LangIn, task.LangOut, task.Pages, task.Params, task.CreatedAt, task.NotifyEmail, task.Queue, string(progressWebhookJSON), task.RunAt, string(tagsJSON), nullIfEmpty(task.ExternalID), nullIfEmpty(task.UserID), nullIfEmpty(task.CallbackURL), nullIfEmpty(task.Preset), task.PageCount, task.SizeClass, string(timingsJSON), nullIfEmpty(string(policyJSON)), nullIfZero(task.RetentionSeconds), task.InputSHA256, nullIfEmpty(task.OrgID), notesColumn(task.Notes), nullIfEmpty(string(citationJSON)), nullIfEmpty(task.WatchSource))
+
+	if err != nil {
+		releaseInputBlob(task.InputSHA256)
+		w.Header().Set("Content-Type", "application/json")
+		// 并发提交相同的外部标识
+		if externalID != "" && strings.Contains(err.Error(), "UNIQUE") {
+			writeError(w, http.StatusConflict, codeExternalIDConflict, "external_id already exists")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error saving task: "+err.Error())
+		return
+	}
+
+	// 预上传文件已复制为任务输入文件
+	if input.uploadID != "" {
+		removePendingUpload(input.uploadID)
+	}
+	if input.draftID != "" {
+		removeSubmittedDraft(input.draftID)
+	}
+	publishTaskStatus(task.ID, "", task.Status)
+	recordTransitionEvent(task, "", task.Status)
+	if doiLookupEnabled && task.Citation != nil && task.Citation.ResolvedAt == nil {
+		go resolveTaskCitation(task.ID, task.Citation.DOI)
+	}
+
+	// 添加到队列
+	if task.Status == "scheduled" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"task_id":  taskID,
+			"run_at":   task.RunAt,
+			"warnings": nonNilStrings(warnings),
+		})
+		return
+	}
+	if err := enqueueTask(task); err != nil {
+		log.Printf("任务 %s 入队失败: %v", task.ID, err)
+		failTask(task, "任务入队失败: "+err.Error())
+		writeError(w, http.StatusServiceUnavailable, codeQueueUnavailable, "Error queueing task: "+err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"task_id":  taskID,
+		"warnings": nonNilStrings(warnings),
+	})
+}
+
+// 任务列表
+func listTasksHandler(w http.ResponseWriter, r *http.Request) {
+	// fields= 参数只输出指定字段，减少大列表的响应体积；limit/offset/cursor 参数用于分页，
+	// q、status、lang_in、lang_out、created_after、created_before 参数用于搜索和筛选，
+	// meta=true 时响应为带队列负载的 {"tasks": [...], "meta": {...}}（见 listmeta.go）
+	query, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	if checkNotModified(w, r) {
+		return
+	}
+
+	// 不分页时逐行写出，避免任务很多时在内存中缓存全部结果
+	withMeta := wantListMeta(r.URL.Query().Get("meta"))
+	if query.limit == 0 {
+		var meta *ListMeta
+		if withMeta {
+			meta = &ListMeta{Queue: currentQueueLoad()}
+		}
+		streamTasks(w, query, "json", meta)
+		return
+	}
+
+	sqlQuery, args := query.sql()
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+
+	meta := &ListMeta{}
+
+	// 分页时通过响应头返回符合条件的总数
+	if query.limit > 0 {
+		countQuery, countArgs := query.countSQL()
+		var total int
+		if err := db.QueryRow(countQuery, countArgs...).Scan(&total); err == nil {
+			w.Header().Set("X-Total-Count", strconv.Itoa(total))
+			meta.Total = &total
+		}
+	}
+
+	// 还有下一页时通过响应头返回下一页的游标
+	if query.limit > 0 && len(tasks) > query.limit {
+		tasks = tasks[:query.limit]
+		last := tasks[len(tasks)-1]
+		cursor := &listCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		meta.NextCursor = cursor.encode()
+		w.Header().Set("X-Next-Cursor", meta.NextCursor)
+	}
+
+	paused := isQueuePaused()
+	result := make([]interface{}, 0, len(tasks))
+	for i := range tasks {
+		tasks[i].QueuePaused = paused && tasks[i].Status == "queued"
+		result = append(result, projectTask(&tasks[i], query.fields))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if withMeta {
+		meta.Queue = currentQueueLoad()
+		json.NewEncoder(w).Encode(map[string]interface{}{"tasks": result, "meta": meta})
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// 任务详情
+func taskDetailHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := r.PathValue("id")
+	if taskID == "" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "Invalid task ID")
+		return
+	}
+	if checkNotModified(w, r) {
+		return
+	}
+
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, taskID))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	task.QueuePaused = task.Status == "queued" && isQueuePaused()
+	task.EnvSnapshot = loadEnvSnapshot(task.ID)
+	task.Timings = loadTaskTimings(task.ID)
+	task.FontWarning = loadFontWarning(task.ID)
+	task.ResourceRetry = loadResourceRetry(task.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// 下载任务结果
+func downloadTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := r.PathValue("id")
+	if taskID == "" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "Invalid task ID")
+		return
+	}
+
+	// 检查是否指定了具体文件名
+	fileName := r.URL.Query().Get("file")
+
+	// 带签名的链接（例如通知邮件中的链接）需校验签名和有效期
+	if sig := r.URL.Query().Get("sig"); sig != "" {
+		link := r.URL.Query().Get("link")
+		if !verifyDownloadSignature(taskID, fileName, link, r.URL.Query().Get("expires"), sig) {
+			writeError(w, http.StatusForbidden, codeInvalidSignature, "Invalid or expired download link")
+			return
+		}
+		// 文件已归档时先取回，分享链接的下载次数在真正下载时才计入
+		if task := archivedTask(taskID); task != nil {
+			writeRestoring(w, task)
+			return
+		}
+		// 分享链接可能已被撤销或用完下载次数
+		if link != "" {
+			if apiErr := consumeDownloadLink(link, taskID, fileName, r); apiErr != nil {
+				writeAPIError(w, apiErr)
+				return
+			}
+		}
+	}
+
+	// 文件已归档时在后台取回，客户端按 Retry-After 重新请求
+	if task := archivedTask(taskID); task != nil {
+		writeRestoring(w, task)
+		return
+	}
+
+	if fileName != "" {
+		// 验证文件名是否属于该任务
+		var outputFilesJSON, taskOutputDir sql.NullString
+		err := db.QueryRow("SELECT output_files, output_dir FROM tasks WHERE id = ?", taskID).Scan(&outputFilesJSON, &taskOutputDir)
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+			return
+		}
+
+		if outputFilesJSON.Valid && outputFilesJSON.String != "" {
+			var outputFiles []string
+			if err := json.Unmarshal([]byte(outputFilesJSON.String), &outputFiles); err == nil {
+				// 检查文件是否在输出列表中
+				found := false
+				for _, f := range outputFiles {
+					if f == fileName {
+						found = true
+						break
+					}
+				}
+				if !found {
+					writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+					return
+				}
+			}
+		}
+
+		serveOutputFile(w, r, outputPath(taskOutputDir.String, fileName), fileName)
+		return
+	}
+
+	// 如果没有指定文件名，使用默认的output_file
+	var outputFile, taskOutputDir sql.NullString
+	err := db.QueryRow("SELECT output_file, output_dir FROM tasks WHERE id = ?", taskID).Scan(&outputFile, &taskOutputDir)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+	if err != nil || !outputFile.Valid || outputFile.String == "" {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+		return
+	}
+
+	serveOutputFile(w, r, outputPath(taskOutputDir.String, outputFile.String), outputFile.String)
+}
+
+// 删除任务
+func deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := r.PathValue("id")
+	if taskID == "" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "Invalid task ID")
+		return
+	}
+
+	version, err := parseExpectedVersion(r.URL.Query().Get("version"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	err = deleteTask(taskID, version)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+	var conflict *versionConflictError
+	if errors.As(err, &conflict) {
+		writeVersionConflict(w, conflict.current)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error deleting task")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// deleteTask 删除任务的数据库记录及输入、输出、日志文件，任务不存在时返回 sql.ErrNoRows。
+// version 大于 0 时只在任务的版本号仍为 version 时删除，否则返回 *versionConflictError
+func deleteTask(taskID string, version int) error {
+	// 获取任务信息
+	var filename, outputFile, outputFilesJSON, taskOutputDir, storageTier, inputSHA256 sql.NullString
+	var current int
+	err := db.QueryRow("SELECT filename, output_file, output_files, output_dir, storage_tier, input_sha256, version FROM tasks WHERE id = ?", taskID).Scan(&filename, &outputFile, &outputFilesJSON, &taskOutputDir, &storageTier, &inputSHA256, &current)
+	if err != nil {
+		return err
+	}
+	if version > 0 && version != current {
+		return &versionConflictError{current: current}
+	}
+
+	// 先删除数据库记录，读取之后任务被修改时不删除
+	res, err := execWithRetry("DELETE FROM tasks WHERE id = ? AND version = ?", taskID, current)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var latest int
+		if err := db.QueryRow("SELECT version FROM tasks WHERE id = ?", taskID).Scan(&latest); err != nil {
+			return err
+		}
+		return &versionConflictError{current: latest}
+	}
+
+	// 删除输入文件（按内容保存的文件减少一次引用）
+	if filename.Valid {
+		removeTaskInput(&Task{ID: taskID, Filename: filename.String, InputSHA256: inputSHA256.String})
+	}
+
+	// 删除输出文件
+	if outputFile.Valid && outputFile.String != "" {
+		os.Remove(outputPath(taskOutputDir.String, outputFile.String))
+		removeStoredFile(outputPath(taskOutputDir.String, outputFile.String))
+	}
+
+	// 删除所有输出文件（如果有多个），包括冷存储中的文件
+	if outputFilesJSON.Valid && outputFilesJSON.String != "" {
+		var outputFiles []string
+		if err := json.Unmarshal([]byte(outputFilesJSON.String), &outputFiles); err == nil {
+			for _, file := range outputFiles {
+				os.Remove(outputPath(taskOutputDir.String, file))
+				if file != outputFile.String {
+					removeStoredFile(outputPath(taskOutputDir.String, file))
+				}
+			}
+			if storageTier.Valid {
+				removeColdCopies(taskID, outputFiles)
+			}
+		}
+	}
+	removeOutputDir(taskOutputDir.String)
+
+	// 删除临时输出目录（如果存在）
+	outputSubDir := filepath.Join(outputDir, taskID)
+	os.RemoveAll(outputSubDir)
+
+	// 删除日志文件
+	removeTaskLog(taskID)
+
+	deleteDownloadLinks(taskID)
+	deleteTaskBundles(taskID)
+	deleteTaskPreviews(taskID)
+	deleteTaskTextVariants(taskID)
+	deleteTaskFollows(taskID)
+	deleteTaskEvents(taskID)
+	publishTaskDeleted(taskID)
+	return nil
+}
+
+// 任务处理器
+func taskWorker(queueName string, index int) {
+	hb := newWorkerHeartbeat(queueName, index)
+	for {
+		waitWhileQueuePaused(hb)
+		waitWhileDiskLow(hb)
+		waitForQueueWindow(queueName, hb)
+		task, err := scheduler.next(queueName, hb.state.WorkerID)
+		if err != nil {
+			log.Printf("无法从队列 %s 获取任务: %v", queueName, err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		// 等待期间队列可能被暂停或执行时段已结束，任务保留在 worker 中直到恢复
+		waitWhileQueuePaused(hb)
+		waitWhileDiskLow(hb)
+		waitForQueueWindow(queueName, hb)
+		if !beginTask() {
+			// 已停止领取任务（见 upgrade.go）：共享队列中的任务放回队列，内存队列中的任务由下一个进程从数据库恢复
+			scheduler.release(task)
+			if taskQueues[queueName].Durable() && taskQueues[queueName].Enqueue(task) == nil {
+				ackTask(task)
+			}
+			return
+		}
+		processTask(task, hb)
+		runningTasks.Done()
+		hb.endTask()
+		scheduler.release(task)
+		ackTask(task)
+	}
+}
+
+func processTask(task *Task, hb *workerHeartbeat) {
+	// 领取任务并更新状态为运行中：排队期间任务可能被修改或删除，以数据库中的记录为准
+	if err := transitionTask(task, "running", "started_at = ?, attempts = attempts + 1, progress = 0, stage = NULL", time.Now()); err != nil {
+		log.Printf("无法领取任务，跳过: %v", err)
+		return
+	}
+	claimed, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, task.ID))
+	if err != nil {
+		log.Printf("无法读取任务 %s: %v", task.ID, err)
+		failTask(task, "无法读取任务记录")
+		return
+	}
+	task = claimed
+
+	// 记录各阶段耗时（见 timings.go）
+	timer := startTaskTimer(task)
+	defer timer.finish()
+
+	// 创建日志文件（见 tasklog.go），重试时追加到已有日志之后
+	logger, logOffset, err := openTaskLog(task, hb.wroteLog)
+	if err != nil {
+		log.Printf("无法创建日志文件: %v", err)
+		failTask(task, "无法创建日志文件")
+		return
+	}
+	defer logger.Close()
+	hb.startTask(task, logOffset)
+
+	writeLog := func(msg string) {
+		logger.write(logSourceService, msg)
+	}
+
+	if task.Attempts > 1 {
+		writeLog(fmt.Sprintf("\n==> 第 %d 次尝试\n", task.Attempts))
+	}
+	writeLog(fmt.Sprintf("==> 开始翻译任务 %s\n", task.ID))
+	writeLog(fmt.Sprintf("==> 文件名: %s\n", task.Filename))
+	writeLog(fmt.Sprintf("==> 语言: %s -> %s\n", task.LangIn, task.LangOut))
+
+	// 记录运行环境快照（见 envsnapshot.go）
+	snapshot := captureEnvSnapshot(task, taskTranslator(task), hb.state.WorkerID)
+	saveEnvSnapshot(task.ID, snapshot)
+	writeLog(fmt.Sprintf("==> 运行环境: %s %s, %s/%s, %s\n", snapshot.Translator, snapshot.BabeldocVersion, snapshot.OS, snapshot.Arch, snapshot.Hostname))
+	if task.Queue != "" {
+		writeLog(fmt.Sprintf("==> 队列: %s\n", task.Queue))
+	}
+	if task.SizeClass != "" {
+		writeLog(fmt.Sprintf("==> 规模分级: %s（%d 页）\n", task.SizeClass, task.PageCount))
+	}
+
+	// 构建命令（输入文件由其他节点接收时从对象存储取回）
+	if err := ensureLocal(taskInputPath(task)); err != nil {
+		writeLog(fmt.Sprintf("ERROR: 无法从对象存储取回输入文件: %v\n", err))
+		failTask(task, "无法从对象存储取回输入文件")
+		return
+	}
+	outputSubDir := filepath.Join(outputDir, task.ID)
+	os.MkdirAll(outputSubDir, 0755)
+	inputPath, err := stageTaskInput(task, outputSubDir)
+	if err != nil {
+		writeLog(fmt.Sprintf("ERROR: 无法准备输入文件: %v\n", err))
+		os.RemoveAll(outputSubDir)
+		failTask(task, "无法准备输入文件")
+		return
+	}
+
+	args := []string{
+		"--files", inputPath,
+		"--lang-in", task.LangIn,
+		"--lang-out", task.LangOut,
+		"--output", outputSubDir,
+	}
+
+	if task.Pages != "" {
+		args = append(args, "--pages", task.Pages)
+	}
+
+	// 检查前端是否传递了完整的 OpenAI 配置
+	hasAPIKey := false
+	hasModel := false
+	hasBaseURL := false
+	// token 用量按服务商和模型统计（见 tokens.go）
+	provider, model := customProviderName, "gpt-4o-mini"
+
+	// 解析所有参数
+	if task.Params != "" {
+		var paramsMap map[string]string
+		if err := json.Unmarshal([]byte(task.Params), &paramsMap); err == nil {
+			for key, value := range paramsMap {
+				value = strings.TrimSpace(value)
+				if key == "openai-api-key" && value != "" {
+					hasAPIKey = true
+				}
+				if key == "openai-model" && value != "" {
+					hasModel = true
+					model = value
+				}
+				if key == "openai-base-url" && value != "" {
+					hasBaseURL = true
+				}
+
+				if value != "" {
+					// 处理布尔值参数
+					if value == "true" || value == "on" {
+						args = append(args, "--"+key)
+					} else if value != "false" && value != "off" {
+						// 处理带值的参数
+						args = append(args, "--"+key, value)
+					}
+				}
+			}
+		}
+	}
+
+	// 如果前端没有传 API Key 和 Base URL，使用队列配置或环境变量填充（只传了模型时使用该模型）
+	translator := taskTranslator(task)
+	if translator == translatorMock {
+		writeLog("==> 使用模拟翻译器，不调用翻译服务\n")
+		provider, model = translatorMock, translatorMock
+	} else if !hasAPIKey && !hasBaseURL {
+		envAPIKey := os.Getenv("OPENAI_API_KEY")
+		envModel := os.Getenv("OPENAI_MODEL")
+		envBaseURL := os.Getenv("OPENAI_BASE_URL")
+		source := "环境变量"
+		provider = envProviderName
+		if qc := findQueueConfig(task.Queue); qc != nil && qc.OpenAIAPIKey != "" {
+			envAPIKey, envModel, envBaseURL = qc.OpenAIAPIKey, qc.OpenAIModel, qc.OpenAIBaseURL
+			source = "队列 " + qc.Name + " 的"
+			provider = qc.Name
+		}
+
+		if envAPIKey != "" {
+			writeLog(fmt.Sprintf("==> 使用%s配置 OpenAI\n", source))
+			args = append(args, "--openai-api-key", envAPIKey)
+
+			if hasModel {
+				// 模型已作为参数传递
+			} else if envModel != "" {
+				args = append(args, "--openai-model", envModel)
+				model = envModel
+			} else {
+				args = append(args, "--openai-model", "gpt-4o-mini")
+			}
+
+			if envBaseURL != "" {
+				args = append(args, "--openai-base-url", envBaseURL)
+			}
+		} else {
+			writeLog("ERROR: 未配置 OpenAI，请在表单中填写 API Key、模型和 Base URL，或设置环境变量 OPENAI_API_KEY\n")
+			failTask(task, "未配置 OpenAI API Key")
+			return
+		}
+	} else {
+		writeLog("==> 使用前端传递的 OpenAI 配置\n")
+	}
+
+	// 总是添加 --openai 参数
+	if translator != translatorMock {
+		args = append(args, "--openai")
+	}
+
+	writeLog(fmt.Sprintf("==> 执行命令: %s %s\n", translator, strings.Join(args, " ")))
+
+	cmd := translatorCommand(translator, args)
+
+	// 继承系统环境变量，允许使用容器的环境变量配置
+	cmd.Env = append(os.Environ(), extraFontsEnv()...)
+
+	// 如果params中包含API密钥，也可以通过环境变量传递
+	if task.Params != "" {
+		var paramsMap map[string]string
+		if err := json.Unmarshal([]byte(task.Params), &paramsMap); err == nil {
+			if apiKey, ok := paramsMap["openai-api-key"]; ok && apiKey != "" {
+				cmd.Env = append(cmd.Env, "OPENAI_API_KEY="+apiKey)
+			}
+			if baseURL, ok := paramsMap["openai-base-url"]; ok && baseURL != "" {
+				cmd.Env = append(cmd.Env, "OPENAI_BASE_URL="+baseURL)
+			}
+		}
+	}
+
+	// 重定向输出到日志文件
+	stdout, _ := cmd.StdoutPipe()
+	stderr, _ := cmd.StderrPipe()
+
+	if err := cmd.Start(); err != nil {
+		writeLog(fmt.Sprintf("ERROR: 无法启动命令: %v\n", err))
+		failTask(task, err.Error())
+		return
+	}
+	registerProcess(task.ID, cmd)
+	hb.setPID(cmd.Process.Pid)
+	hb.setStage(stageTranslating)
+	timer.enter(timingStartup)
+
+	// 按规模分级限制执行时间
+	if timeout := taskTimeout(task); timeout > 0 {
+		timer := time.AfterFunc(timeout, func() { killProcess(task.ID, killReasonTimeout) })
+		defer timer.Stop()
+	}
+
+	// 跟踪进度并按订阅发送进度回调
+	tracker := newProgressTracker(task, task.ProgressWebhook)
+	defer tracker.stop()
+
+	// 读取输出，同时记录是否出现临时错误或内存不足（用于判断是否重试）
+	var outputWG sync.WaitGroup
+	var transientMutex sync.Mutex
+	transient := false
+	exhausted := ""
+	glyphs := newGlyphCollector()
+	tokens := &tokenCollector{}
+	readOutput := func(r io.Reader, source string) {
+		defer outputWG.Done()
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if stage, ok := parseStageLine(line); ok {
+				tracker.updateStage(stage)
+				logger.setStage(stage)
+				timer.enter(stage)
+			}
+			logger.write(source, line)
+			if progress, ok := parseProgressLine(line); ok {
+				tracker.update(progress)
+				hb.setProgress(progress)
+			}
+			if char, ok := parseMissingGlyphLine(line); ok {
+				glyphs.add(char)
+			}
+			if kind, n, ok := parseTokenUsageLine(line); ok {
+				tokens.add(kind, n)
+			}
+			if isTransientOutput(line) {
+				transientMutex.Lock()
+				transient = true
+				transientMutex.Unlock()
+			}
+			if isResourceExhaustionOutput(line) {
+				transientMutex.Lock()
+				if exhausted == "" {
+					exhausted = strings.TrimSpace(ansiEscapePattern.ReplaceAllString(line, ""))
+				}
+				transientMutex.Unlock()
+			}
+		}
+	}
+	outputWG.Add(2)
+	go readOutput(stdout, logSourceStdout)
+	go readOutput(stderr, logSourceStderr)
+
+	// 必须先读完输出再调用 Wait，否则 Wait 关闭管道后可能丢失最后的输出
+	outputWG.Wait()
+	err = cmd.Wait()
+	hb.setPID(0)
+	hb.setStage(stageFinishing)
+	timer.finish()
+	// 失败的执行同样消耗了 token
+	tokens.save(task.ID, provider, model)
+	if warning := glyphs.save(task.ID); warning != nil {
+		writeLog(fmt.Sprintf("\nWARNING: %d 个字符没有可用的字体（共出现 %d 次）: %s\n%s\n", len(warning.Chars), warning.Count, strings.Join(warning.Chars, " "), warning.Message))
+	}
+	switch unregisterProcess(task.ID) {
+	case killReasonStuck:
+		writeLog(fmt.Sprintf("\nERROR: 任务超过 %s 没有活动，已被终止\n", stuckTaskTimeout))
+		recordTaskEvent(task.ID, eventTaskCanceled, "超过 "+stuckTaskTimeout.String()+" 没有活动，进程已被终止")
+		os.RemoveAll(outputSubDir)
+		failTask(task, "任务卡住（超过 "+stuckTaskTimeout.String()+" 无活动），已被终止")
+		return
+	case killReasonTimeout:
+		writeLog(fmt.Sprintf("\nERROR: 任务执行超过 %s（规模分级 %s 的超时），已被终止\n", taskTimeout(task), task.SizeClass))
+		recordTaskEvent(task.ID, eventTaskCanceled, "执行超过 "+taskTimeout(task).String()+"，进程已被终止")
+		os.RemoveAll(outputSubDir)
+		failTask(task, "任务执行超时（超过 "+taskTimeout(task).String()+"），已被终止")
+		return
+	}
+	if err != nil {
+		writeLog(fmt.Sprintf("\nERROR: 命令执行失败: %v\n", err))
+		if exhausted == "" && killedBySignal(err) {
+			exhausted = err.Error()
+		}
+		if exhausted != "" && retryWithReducedResources(task, exhausted, err.Error(), writeLog) {
+			return
+		}
+		if transient && canRetry(task) {
+			delay := retryDelay(task.Attempts)
+			writeLog(fmt.Sprintf("==> 检测到临时错误，%s 后重试（第 %d/%d 次）\n", delay, task.Attempts+1, taskMaxAttemptsFor(task)))
+			retryTask(task, err.Error(), delay)
+			return
+		}
+		failTask(task, err.Error())
+		return
+	}
+
+	// 查找输出文件
+	timer.enter(timingOutputMove)
+	files, err := filepath.Glob(filepath.Join(outputSubDir, "*.pdf"))
+	if err != nil || len(files) == 0 {
+		writeLog("ERROR: 未找到输出文件\n")
+		failTask(task, "未找到输出文件")
+		return
+	}
+
+	// 将所有文件移动到按 OUTPUT_LAYOUT 确定的输出目录
+	task.OutputDir = outputLayoutDir(task)
+	if err := os.MkdirAll(outputPath(task.OutputDir, ""), 0755); err != nil {
+		writeLog(fmt.Sprintf("ERROR: 无法创建输出目录: %v\n", err))
+		failTask(task, "无法保存输出文件")
+		return
+	}
+	var outputFilenames []string
+	for _, file := range files {
+		outputFilename := task.ID + "_" + filepath.Base(file)
+		finalPath := taskOutputPath(task, outputFilename)
+		if err := os.Rename(file, finalPath); err != nil {
+			writeLog(fmt.Sprintf("WARNING: 无法移动文件 %s: %v\n", file, err))
+			continue
+		}
+		outputFilenames = append(outputFilenames, outputFilename)
+		writeLog(fmt.Sprintf("==> 生成文件: %s\n", outputFilename))
+		// 启用 OUTPUT_COMPRESSION 时压缩保存，失败时保留未压缩的文件
+		if err := compressOutputFile(finalPath); err != nil {
+			writeLog(fmt.Sprintf("WARNING: 无法压缩文件 %s: %v\n", outputFilename, err))
+		}
+	}
+
+	if len(outputFilenames) == 0 {
+		writeLog("ERROR: 无法保存输出文件\n")
+		failTask(task, "无法保存输出文件")
+		return
+	}
+
+	// 启用对象存储时上传输出文件
+	for _, outputFilename := range outputFilenames {
+		if err := persistFile(taskOutputPath(task, outputFilename)); err != nil {
+			writeLog(fmt.Sprintf("ERROR: 无法上传输出文件到对象存储: %v\n", err))
+			for _, name := range outputFilenames {
+				os.Remove(taskOutputPath(task, name))
+				removeStoredFile(taskOutputPath(task, name))
+			}
+			failTask(task, "无法保存输出文件到对象存储")
+			return
+		}
+	}
+
+	// 输出已保存，补发 100% 里程碑（babeldoc 的进度条不一定刷新到 100）
+	tracker.update(100)
+	timer.finish()
+	writeLog("\n==> 任务完成！\n")
+
+	// 更新状态为成功
+	completedAt := time.Now()
+	outputFilesJSON, _ := json.Marshal(outputFilenames)
+	// 保留 output_file 兼容性，保存第一个文件
+	if !applyTransition(task, "success", "completed_at = ?, output_file = ?, output_files = ?, output_dir = ?, progress = 100, stage = NULL",
+		completedAt, outputFilenames[0], string(outputFilesJSON), nullIfEmpty(task.OutputDir)) {
+		os.RemoveAll(outputSubDir)
+		return
+	}
+	task.CompletedAt = &completedAt
+	task.Progress, task.Stage = 100, ""
+	task.OutputFile = outputFilenames[0]
+	task.OutputFiles = outputFilenames
+
+	// 执行管理员配置的成功后命令
+	runSuccessCommand(task, writeLog)
+
+	// 清理临时目录
+	os.RemoveAll(outputSubDir)
+
+	go func() {
+		runPostTaskHooks(task)
+		// 钩子可能读取源文件，执行完后再按提交者的策略和 INPUT_RETENTION 处理（见 usersettings.go、retention.go）
+		applyTaskPolicy(task)
+		applyInputRetention(task)
+	}()
+	go sendTaskNotification(task)
+	go sendTaskCallback(task)
+	go notifyFollowers(task)
+	go deliverTaskOutputs(task)
+	go deliverWatchOutputs(task)
+	go recordThroughput(task)
+	go indexTaskContent(task)
+}
+
+func failTask(task *Task, errorMsg string) {
+	completedAt := time.Now()
+	// 清理器已将任务标记为失败等情况下不再重复通知
+	if !applyTransition(task, "failed", "completed_at = ?, error = ?", completedAt, errorMsg) {
+		return
+	}
+	task.CompletedAt = &completedAt
+	task.Error = errorMsg
+
+	go runPostTaskHooks(task)
+	go sendTaskNotification(task)
+	go sendTaskCallback(task)
+	go notifyFollowers(task)
+	go writeWatchFailure(task)
+}
+
+// parseTags 解析逗号分隔的标签，去除空白和重复项
+func parseTags(value string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(strings.ReplaceAll(value, "，", ","), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// taskInputPath 返回任务上传文件的保存路径：按内容保存的文件见 blobPath，旧任务的文件以任务ID中的时间戳作为前缀
+func taskInputPath(task *Task) string {
+	if sha256Pattern.MatchString(task.InputSHA256) {
+		return blobPath(task.InputSHA256)
+	}
+	return filepath.Join(uploadDir, inputFileName(task))
+}
+
+// inputFileName 返回以任务ID中的时间戳作为前缀的上传文件名
+func inputFileName(task *Task) string {
+	timestamp := strings.Split(task.ID, "_")[0]
+	return timestamp + "_" + task.Filename
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 翻译后端：
+//
+//	TRANSLATOR                  babeldoc（默认）或 mock
+//	MOCK_TRANSLATOR_STEP_DELAY  模拟翻译器每 10% 进度的耗时（默认 100ms）
+//
+// 命名队列可以通过 translator 字段单独设置。mock 不调用任何翻译服务，也不需要 API Key：
+// worker 以子进程方式运行本程序的模拟翻译器（参数与 babeldoc 相同），输出与 babeldoc 相同格式的进度，
+// 并将输入 PDF 复制为 <文件名>.<目标语言>.mono.pdf 和 .dual.pdf（末尾附加一行注释说明是模拟结果），
+// 开发和 CI 可以快速、确定地走完排队、执行、进度、输出和回调的完整流程。
+//
+// 任务参数 mock-fail 用于模拟失败：true 为普通失败，transient 为临时错误（输出 429，可触发重试），
+// oom 为内存不足（输出 MemoryError，可触发降低并发的重试，带有 --max-pages-per-part 时不再失败）。
+const (
+	translatorBabeldoc = "babeldoc"
+	translatorMock     = "mock"
+
+	// mockTranslatorArg 以模拟翻译器方式运行本程序的第一个命令行参数
+	mockTranslatorArg = "mock-translate"
+)
+
+var (
+	defaultTranslator       = parseTranslator(envOrDefault("TRANSLATOR", translatorBabeldoc))
+	mockTranslatorStepDelay = parseDurationEnv("MOCK_TRANSLATOR_STEP_DELAY", 100*time.Millisecond)
+)
+
+func parseTranslator(value string) string {
+	if value != translatorBabeldoc && value != translatorMock {
+		log.Printf("无效的 TRANSLATOR %q，使用 %s", value, translatorBabeldoc)
+		return translatorBabeldoc
+	}
+	return value
+}
+
+// taskTranslator 返回执行任务的翻译后端：队列配置 > TRANSLATOR
+func taskTranslator(task *Task) string {
+	if qc := findQueueConfig(task.Queue); qc != nil && qc.Translator != "" {
+		return qc.Translator
+	}
+	return defaultTranslator
+}
+
+// translatorCommand 返回执行翻译的命令
+func translatorCommand(translator string, args []string) *exec.Cmd {
+	if translator == translatorMock {
+		exe, err := os.Executable()
+		if err != nil {
+			exe = os.Args[0]
+		}
+		return exec.Command(exe, append([]string{mockTranslatorArg}, args...)...)
+	}
+	return exec.Command("babeldoc", args...)
+}
+
+// runMockTranslator 模拟翻译器的入口，返回进程退出码
+func runMockTranslator(args []string) int {
+	// babeldoc 参数形如 --key value 或 --key（布尔参数）
+	options := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			continue
+		}
+		key := strings.TrimPrefix(args[i], "--")
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			options[key] = args[i+1]
+			i++
+		} else {
+			options[key] = "true"
+		}
+	}
+
+	input, outputDir, langOut := options["files"], options["output"], options["lang-out"]
+	if input == "" || outputDir == "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --files and --output are required")
+		return 2
+	}
+	content, err := os.ReadFile(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("mock translator: %s (%s -> %s)\n", filepath.Base(input), options["lang-in"], langOut)
+	for progress := 0; progress <= 100; progress += 10 {
+		if progress == 50 {
+			switch options["mock-fail"] {
+			case "true":
+				fmt.Fprintln(os.Stderr, "ERROR: mock translator failed as requested by mock-fail")
+				return 1
+			case "transient":
+				fmt.Fprintln(os.Stderr, "ERROR: 429 Too Many Requests (simulated by mock-fail=transient)")
+				return 1
+			case "oom":
+				if options["max-pages-per-part"] == "" {
+					fmt.Fprintln(os.Stderr, "MemoryError: Unable to allocate array (simulated by mock-fail=oom)")
+					return 1
+				}
+			}
+		}
+		// 与 rich 进度条的输出格式相同，由 parseStageLine 和 parseProgressLine 解析
+		stage := "Parse Page Layout"
+		if progress >= 80 {
+			stage = "Typesetting"
+		} else if progress >= 30 {
+			stage = "Translate Paragraphs"
+		}
+		fmt.Printf("%s (1/1) ━━━━━━━━━━ %d/100\n", stage, progress)
+		fmt.Printf("translate ━━━━━━━━━━ %d/100\n", progress)
+		time.Sleep(mockTranslatorStepDelay)
+	}
+
+	stem := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	note := fmt.Sprintf("\n%% BabelDOC mock translation: %s -> %s, not actually translated\n", options["lang-in"], langOut)
+	for _, variant := range []string{"mono", "dual"} {
+		path := filepath.Join(outputDir, fmt.Sprintf("%s.%s.%s.pdf", stem, langOut, variant))
+		if err := os.WriteFile(path, append(append([]byte{}, content...), note...), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		fmt.Printf("saved %s\n", path)
+	}
+	// 与 babeldoc 结束时输出的 token 用量格式相同，按输入大小给出确定的数值（见 tokens.go）
+	prompt, completion := int64(len(content)/4+100), int64(len(content)/5+50)
+	fmt.Printf("Prompt tokens: %d\nCompletion tokens: %d\nTotal tokens: %d\n", prompt, completion, prompt+completion)
+	return 0
+}
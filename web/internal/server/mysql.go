@@ -0,0 +1,172 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlStore MySQL 数据库（8.0.29 及以上，使用 InnoDB 和 utf8mb4）。DATABASE_URL 的查询部分作为 go-sql-driver/mysql 的连接参数；
+// 连接启用 ANSI_QUOTES、PIPES_AS_CONCAT 和 NO_BACKSLASH_ESCAPES，使标识符引号、字符串拼接和转义与 SQLite 一致。
+// 全文索引使用 ngram 分词器的 FULLTEXT 索引，触发器直接以 MySQL 语法创建；备份方式与 PostgreSQL 相同。
+type mysqlStore struct {
+	dsn string
+}
+
+const (
+	mysqlSQLMode = `'ANSI_QUOTES,PIPES_AS_CONCAT,NO_BACKSLASH_ESCAPES,STRICT_TRANS_TABLES'`
+
+	// 需要建立索引的文本列使用的长度，utf8mb4 下不超过 InnoDB 单列索引的 767 字节
+	mysqlKeyColumnType = "VARCHAR(191)"
+)
+
+// mysqlDSN 把 mysql://用户:密码@主机:端口/数据库?参数 转换为驱动的 DSN
+func mysqlDSN(u *url.URL) (string, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = u.User.Username()
+	cfg.Passwd, _ = u.User.Password()
+	cfg.Net = "tcp"
+	cfg.Addr = u.Host
+	if u.Port() == "" {
+		cfg.Addr = net.JoinHostPort(u.Hostname(), "3306")
+	}
+	cfg.DBName = strings.Trim(u.Path, "/")
+	if u.Hostname() == "" || cfg.DBName == "" {
+		return "", errors.New("需要指定 MySQL 的主机和数据库名")
+	}
+
+	dsn := cfg.FormatDSN()
+	if u.RawQuery != "" {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		parsed, err := mysql.ParseDSN(dsn + separator + u.RawQuery)
+		if err != nil {
+			return "", err
+		}
+		cfg = parsed
+	}
+	if !u.Query().Has("parseTime") {
+		cfg.ParseTime = true
+	}
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	if _, ok := cfg.Params["sql_mode"]; !ok {
+		cfg.Params["sql_mode"] = mysqlSQLMode
+	}
+	return cfg.FormatDSN(), nil
+}
+
+func (s *mysqlStore) Name() string { return "mysql" }
+
+func (s *mysqlStore) Open() (*sql.DB, error) {
+	return sql.Open("mysql", s.dsn)
+}
+
+func (s *mysqlStore) Types() columnTypes {
+	return columnTypes{
+		ID:      "BIGINT PRIMARY KEY AUTO_INCREMENT",
+		Key:     mysqlKeyColumnType,
+		Text:    "LONGTEXT",
+		Integer: "BIGINT",
+		Real:    "DOUBLE",
+		Time:    "DATETIME(6)",
+		Cast:    "SIGNED",
+	}
+}
+
+func (s *mysqlStore) CreateIndex(name, table, columns, where string, unique bool) error {
+	if exists, err := mysqlIndexExists(name, table); err != nil || exists {
+		return err
+	}
+	// 唯一索引本身允许多个 NULL，与 WHERE 列 IS NOT NULL 的部分唯一索引效果相同
+	stmt := `CREATE INDEX `
+	if unique {
+		stmt = `CREATE UNIQUE INDEX `
+	}
+	_, err := db.Exec(stmt + name + ` ON ` + table + `(` + columns + `)`)
+	return err
+}
+
+// mysqlIndexExists table 上是否已有名为 name 的索引（MySQL 的 CREATE INDEX 不支持 IF NOT EXISTS）
+func mysqlIndexExists(name, table string) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`, table, name).Scan(&count)
+	return count > 0, err
+}
+
+func (s *mysqlStore) Upsert(conflict ...string) string {
+	// 冲突的唯一约束由 MySQL 自行判断；AS excluded 给要插入的行起别名，与 SQLite 的 excluded 用法相同
+	return `AS excluded ON DUPLICATE KEY UPDATE`
+}
+
+func (s *mysqlStore) InsertIgnore(conflict ...string) string {
+	// 不用 INSERT IGNORE，它会把类型转换等其他错误也降级为警告
+	return `ON DUPLICATE KEY UPDATE ` + conflict[0] + ` = ` + conflict[0]
+}
+
+func (s *mysqlStore) CreateTrigger(name, table, event, body string) error {
+	// MySQL 的触发器不能限定列（UPDATE OF）
+	event, _, _ = strings.Cut(event, " OF ")
+	_, err := db.Exec(`CREATE TRIGGER IF NOT EXISTS ` + name + ` AFTER ` + event + ` ON ` + table + ` FOR EACH ROW ` + body)
+	return err
+}
+
+func (s *mysqlStore) CreateVersionTrigger(name, table, column string) error {
+	_, err := db.Exec(`CREATE TRIGGER IF NOT EXISTS ` + name + ` BEFORE UPDATE ON ` + table + ` FOR EACH ROW
+		SET new.` + column + ` = IF(new.` + column + ` = old.` + column + `, old.` + column + ` + 1, new.` + column + `)`)
+	return err
+}
+
+func (s *mysqlStore) CreateSearchIndex(name, table string, columns []string) error {
+	if exists, err := mysqlIndexExists(name, table); err != nil || exists {
+		return err
+	}
+	_, err := db.Exec(`ALTER TABLE ` + table + ` ADD FULLTEXT INDEX ` + name + ` (` + strings.Join(columns, ", ") + `) WITH PARSER ngram`)
+	return err
+}
+
+func (s *mysqlStore) SearchCondition(name, alias string, columns []string, q string) (string, []interface{}) {
+	qualified := make([]string, len(columns))
+	for i, column := range columns {
+		qualified[i] = qualifyColumn(alias, column)
+	}
+	// 整体作为短语匹配，避免查询中的布尔模式运算符被解释
+	phrase := `"` + strings.ReplaceAll(q, `"`, ` `) + `"`
+	return `MATCH(` + strings.Join(qualified, ", ") + `) AGAINST (? IN BOOLEAN MODE)`, []interface{}{phrase}
+}
+
+func (s *mysqlStore) Snapshot(database *sql.DB, path string) error {
+	rows, err := database.Query(`SELECT table_name FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name`)
+	if err != nil {
+		return err
+	}
+	tables, err := scanStrings(rows)
+	if err != nil {
+		return err
+	}
+	return snapshotTables(database, path, tables, func(tx *sql.Tx, table string) ([]string, error) {
+		rows, err := tx.Query(`SELECT column_name FROM information_schema.key_column_usage
+			WHERE table_schema = DATABASE() AND table_name = ? AND constraint_name = 'PRIMARY'
+			ORDER BY ordinal_position`, table)
+		if err != nil {
+			return nil, err
+		}
+		return scanStrings(rows)
+	})
+}
+
+func (s *mysqlStore) Restore(snapshot string, force bool) error {
+	if err := openStoreForRestore(s); err != nil {
+		return err
+	}
+	return restoreTables(db, snapshot, force)
+}
@@ -0,0 +1,289 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// 邮件通知配置：
+//
+//	SMTP_HOST / SMTP_PORT               SMTP 服务器（未设置 SMTP_HOST 时不发送邮件，端口默认 587）
+//	SMTP_USERNAME / SMTP_PASSWORD       SMTP 认证信息（可选）
+//	SMTP_FROM                           发件人地址（默认使用 SMTP_USERNAME）
+//	EMAIL_ATTACHMENT_MAX_SIZE           附件大小上限（字节），所有结果文件总大小不超过时直接附带，否则发送签名链接；0 表示从不附带（默认 10MB）
+//	EMAIL_LINK_TTL                      邮件中签名下载链接的有效期（默认 168h）
+//	EMAIL_TEMPLATE_TEXT / EMAIL_TEMPLATE_HTML  自定义纯文本 / HTML 正文模板文件路径
+//	EMAIL_SUBJECT_TEMPLATE              自定义邮件主题模板
+//
+// 收件人由提交任务时的 notify_email 字段指定；关注了任务或其标签的用户也会收到同样的邮件（不带附件，见 follows.go）。
+const (
+	defaultEmailAttachmentMaxSize = 10 << 20 // 10 MB
+	defaultEmailLinkTTL           = 7 * 24 * time.Hour
+)
+
+const defaultEmailSubjectTemplate = `[BabelDOC] {{.Task.Filename}} {{if eq .Task.Status "success"}}翻译完成{{else}}翻译失败{{end}}`
+
+const defaultEmailTextTemplate = `您好，
+
+{{if .Follow}}{{if .Follow.Tag}}您关注的标签 {{.Follow.Tag}} 下的{{else}}您关注的{{end}}{{end}}任务 {{.Task.ID}}（{{.Task.Filename}}，{{.Task.LangIn}} -> {{.Task.LangOut}}）{{if eq .Task.Status "success"}}已翻译完成。{{else}}执行失败。{{end}}
+{{if .Task.Error}}
+错误信息: {{.Task.Error}}
+{{end}}{{if .Attached}}
+翻译结果已作为附件发送。
+{{else if .Links}}
+下载链接（{{.LinkExpiresAt.Format "2006-01-02 15:04"}} 前有效）:
+{{range .Links}}- {{.Name}}: {{.URL}}
+{{end}}{{end}}
+任务详情: {{.DetailURL}}
+`
+
+const defaultEmailHTMLTemplate = `<p>您好，</p>
+<p>{{if .Follow}}{{if .Follow.Tag}}您关注的标签 {{.Follow.Tag}} 下的{{else}}您关注的{{end}}{{end}}任务 <strong>{{.Task.ID}}</strong>（{{.Task.Filename}}，{{.Task.LangIn}} -&gt; {{.Task.LangOut}}）{{if eq .Task.Status "success"}}已翻译完成。{{else}}执行失败。{{end}}</p>
+{{if .Task.Error}}<p>错误信息: <code>{{.Task.Error}}</code></p>{{end}}
+{{if .Attached}}<p>翻译结果已作为附件发送。</p>
+{{else if .Links}}<p>下载链接（{{.LinkExpiresAt.Format "2006-01-02 15:04"}} 前有效）:</p>
+<ul>{{range .Links}}<li><a href="{{.URL}}">{{.Name}}</a></li>{{end}}</ul>{{end}}
+<p><a href="{{.DetailURL}}">查看任务详情</a></p>
+`
+
+// EmailLink 邮件中的下载链接
+type EmailLink struct {
+	Name string
+	URL  string
+}
+
+// EmailData 邮件模板可用的数据
+type EmailData struct {
+	Task          *Task
+	Attached      bool
+	Links         []EmailLink
+	LinkExpiresAt time.Time
+	DetailURL     string
+	Follow        *TaskFollow // 发给关注者时为对应的关注，发给提交者时为 nil
+}
+
+type emailAttachment struct {
+	name        string
+	data        []byte
+	contentType string // 为空时按 application/pdf 处理
+}
+
+var (
+	smtpHost               = os.Getenv("SMTP_HOST")
+	emailAttachmentMaxSize = parseSizeEnv("EMAIL_ATTACHMENT_MAX_SIZE", defaultEmailAttachmentMaxSize)
+	emailLinkTTL           = parseDurationEnv("EMAIL_LINK_TTL", defaultEmailLinkTTL)
+
+	emailSubjectTemplate = texttemplate.Must(texttemplate.New("subject").Parse(envOrDefault("EMAIL_SUBJECT_TEMPLATE", defaultEmailSubjectTemplate)))
+	emailTextTemplate    = texttemplate.Must(texttemplate.New("text").Parse(loadTemplateFile("EMAIL_TEMPLATE_TEXT", defaultEmailTextTemplate)))
+	emailHTMLTemplate    = htmltemplate.Must(htmltemplate.New("html").Parse(loadTemplateFile("EMAIL_TEMPLATE_HTML", defaultEmailHTMLTemplate)))
+)
+
+func envOrDefault(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// parseSizeEnv 读取以字节为单位的环境变量，为空或无效时返回默认值
+func parseSizeEnv(name string, def int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		log.Printf("无效的 %s %q，使用默认值 %d", name, value, def)
+		return def
+	}
+	return n
+}
+
+func loadTemplateFile(name, def string) string {
+	path := os.Getenv(name)
+	if path == "" {
+		return def
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("无法读取 %s 模板 %s，使用默认模板: %v", name, path, err)
+		return def
+	}
+	return string(content)
+}
+
+// sendTaskNotification 在任务结束后向提交时指定的邮箱发送通知
+func sendTaskNotification(task *Task) {
+	if smtpHost == "" || task.NotifyEmail == "" {
+		return
+	}
+	if err := sendTaskEmail(task, task.NotifyEmail, nil); err != nil {
+		log.Printf("任务 %s 的通知邮件发送失败: %v", task.ID, err)
+		return
+	}
+	log.Printf("任务 %s 的通知邮件已发送至 %s", task.ID, task.NotifyEmail)
+}
+
+// sendTaskEmail 向 to 发送任务结束通知；follow 不为 nil 时发给关注者，只提供下载链接、不附带文件
+func sendTaskEmail(task *Task, to string, follow *TaskFollow) error {
+	data := &EmailData{
+		Task:      task,
+		DetailURL: publicBaseURL() + "/detail.html?id=" + task.ID,
+		Follow:    follow,
+	}
+
+	var attachments []emailAttachment
+	if task.Status == "success" {
+		if follow == nil {
+			attachments = loadAttachments(task)
+		}
+		if attachments != nil {
+			data.Attached = true
+		} else {
+			data.LinkExpiresAt = time.Now().Add(emailLinkTTL)
+			for _, file := range task.OutputFiles {
+				data.Links = append(data.Links, EmailLink{
+					Name: file,
+					URL:  signedDownloadURL(task.ID, file, emailLinkTTL),
+				})
+			}
+		}
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := emailSubjectTemplate.Execute(&subject, data); err != nil {
+		return fmt.Errorf("邮件主题渲染失败: %w", err)
+	}
+	if err := emailTextTemplate.Execute(&text, data); err != nil {
+		return fmt.Errorf("纯文本邮件渲染失败: %w", err)
+	}
+	if err := emailHTMLTemplate.Execute(&html, data); err != nil {
+		return fmt.Errorf("HTML 邮件渲染失败: %w", err)
+	}
+
+	// 校验之前保存的地址可能不合法，不能原样写入邮件头
+	to, err := parseNotifyEmail(to)
+	if err != nil {
+		return fmt.Errorf("无效的收件人地址: %w", err)
+	}
+	from := envOrDefault("SMTP_FROM", os.Getenv("SMTP_USERNAME"))
+	msg := buildEmail(from, to, strings.TrimSpace(subject.String()), text.String(), html.String(), attachments)
+	return sendEmail(from, []string{to}, msg)
+}
+
+// parseNotifyEmail 校验通知邮箱并返回其中的地址部分（去掉显示名）。地址会写入 To: 邮件头，包含 CR/LF 的输入一律拒绝
+func parseNotifyEmail(value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return "", errors.New("invalid notify_email")
+	}
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", errors.New("invalid notify_email")
+	}
+	return addr.Address, nil
+}
+
+// loadAttachments 在输出文件总大小不超过上限时读取全部文件，否则返回 nil
+func loadAttachments(task *Task) []emailAttachment {
+	if emailAttachmentMaxSize <= 0 || len(task.OutputFiles) == 0 {
+		return nil
+	}
+	var total int64
+	for _, file := range task.OutputFiles {
+		ensureLocal(taskOutputPath(task, file))
+		info, err := statOutputFile(taskOutputPath(task, file))
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+	}
+	if total > emailAttachmentMaxSize {
+		return nil
+	}
+
+	var attachments []emailAttachment
+	for _, file := range task.OutputFiles {
+		content, err := readOutputFile(taskOutputPath(task, file))
+		if err != nil {
+			return nil
+		}
+		attachments = append(attachments, emailAttachment{name: file, data: content})
+	}
+	return attachments
+}
+
+func sendEmail(from string, to []string, msg []byte) error {
+	port := envOrDefault("SMTP_PORT", "587")
+	var auth smtp.Auth
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), smtpHost)
+	}
+	return smtp.SendMail(smtpHost+":"+port, auth, from, to, msg)
+}
+
+// buildEmail 构造 multipart/mixed 邮件，正文为 text/plain 与 text/html 的 multipart/alternative
+func buildEmail(from, to, subject, text, html string, attachments []emailAttachment) []byte {
+	mixed := randomBoundary()
+	alternative := randomBoundary()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mixed)
+
+	fmt.Fprintf(&b, "--%s\r\n", mixed)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", alternative)
+	writeBase64Part(&b, alternative, "text/plain; charset=UTF-8", "", []byte(text))
+	writeBase64Part(&b, alternative, "text/html; charset=UTF-8", "", []byte(html))
+	fmt.Fprintf(&b, "--%s--\r\n", alternative)
+
+	for _, attachment := range attachments {
+		contentType := attachment.contentType
+		if contentType == "" {
+			contentType = "application/pdf"
+		}
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.name})
+		writeBase64Part(&b, mixed, contentType, disposition, attachment.data)
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", mixed)
+	return b.Bytes()
+}
+
+func writeBase64Part(b *bytes.Buffer, boundary, contentType, disposition string, data []byte) {
+	fmt.Fprintf(b, "--%s\r\n", boundary)
+	fmt.Fprintf(b, "Content-Type: %s\r\n", contentType)
+	if disposition != "" {
+		fmt.Fprintf(b, "Content-Disposition: %s\r\n", disposition)
+	}
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+}
+
+func randomBoundary() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
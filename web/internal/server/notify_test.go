@@ -0,0 +1,36 @@
+package server
+
+import "testing"
+
+func TestParseNotifyEmail(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "alice@example.com", want: "alice@example.com"},
+		{value: "Alice <alice@example.com>", want: "alice@example.com"},
+		{value: "alice", wantErr: true},
+		{value: "alice@example.com\r\nBcc: eve@example.com", wantErr: true},
+		{value: "alice@example.com\nBcc: eve@example.com", wantErr: true},
+		{value: "\"Alice\r\n\" <alice@example.com>", wantErr: true},
+		{value: "alice@example.com, eve@example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseNotifyEmail(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseNotifyEmail(%q) = %q, want error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseNotifyEmail(%q): %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseNotifyEmail(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,1302 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenAPI 3 文档。路径和参数在此手工描述，响应中的数据结构由 Go 类型通过反射生成，
+// 字段变更后无需同步修改文档。
+type object = map[string]interface{}
+
+// openAPISchemas 需要出现在 components.schemas 中的类型
+var openAPISchemas = []interface{}{
+	Task{},
+	ProgressWebhook{},
+	CallbackEvent{},
+	CallbackFile{},
+	ShareLinkRequest{},
+	DownloadLink{},
+	BundleRequest{},
+	BundlePart{},
+	TaskBundle{},
+	TaskEvent{},
+	LogRecord{},
+	RestoreStatus{},
+	TaskChangeEvent{},
+	ListMeta{},
+	QueueLoad{},
+	EnvSnapshot{},
+	TaskTimings{},
+	FontWarning{},
+	ResourceRetry{},
+	InstalledFont{},
+	QueueStatus{},
+	QueueDetail{},
+	UploadStats{},
+	DiskSpaceWarning{},
+	WorkerHeartbeat{},
+	WorkerStatus{},
+	ContentSearchResult{},
+	StorageUsage{},
+	StorageTotals{},
+	StorageVolume{},
+	TaskStorageUsage{},
+	BabeldocCacheUsage{},
+	BabeldocCacheEntry{},
+	BabeldocCacheClearRequest{},
+	BabeldocCacheRelocateRequest{},
+	SubmissionDraft{},
+	ImportRequest{},
+	ImportBatch{},
+	ImportItem{},
+	TaskFollow{},
+	FollowRequest{},
+	UserSettings{},
+	TaskPolicy{},
+	ConnectionStats{},
+	ProviderStatus{},
+	Language{},
+	LanguageEntry{},
+	TaskSubmission{},
+	TaskUpdate{},
+	TaskNotes{},
+	Citation{},
+	PagePreviews{},
+	TaskStatus{},
+	BatchDeleteRequest{},
+	BatchDeleteResult{},
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildOpenAPISpec())
+}
+
+func buildOpenAPISpec() object {
+	schemas := object{
+		"Error": object{
+			"type":     "object",
+			"required": []string{"success", "code", "error"},
+			"properties": object{
+				"success": object{"type": "boolean", "example": false},
+				"code": object{
+					"type":        "string",
+					"description": "稳定的错误码，客户端应据此判断错误类型",
+					"enum": []string{
+						codeBadRequest, codeInvalidJSON, codeUnauthorized, codeInvalidSignature, codeDownloadLimitReached, codeNotFound, codeMethodNotAllowed,
+						codeTaskNotFound, codeFileNotFound, codeUploadNotFound, codeDraftNotFound, codeBundleNotFound, codeFollowNotFound, codeInputFileGone, codeFileRequired, codeUploadTooLarge,
+						codeUnsupportedFile, codeRemoteFetchFailed, codeExternalIDConflict, codeTaskNotEditable, codeVersionConflict, codeTooManyTasks,
+						codeTooManyBundles, codeFontNotFound, codeBabeldocCacheBusy, codeNotArchived, codeLanguageMismatch, codeTooManyPages, codeHookRejected, codeUploadsBusy, codeQueueUnavailable,
+						codeStorageUnavailable, codeInternal,
+					},
+				},
+				"error":   object{"type": "string", "description": "便于阅读的错误说明，内容可能调整"},
+				"task_id": object{"type": "string", "description": "EXTERNAL_ID_CONFLICT 时为已有任务的ID"},
+				"version": object{"type": "integer", "description": "TASK_VERSION_CONFLICT 时为任务的当前版本号"},
+			},
+		},
+		"SubmitResponse": object{
+			"type": "object",
+			"properties": object{
+				"success": object{"type": "boolean"},
+				"task_id": object{"type": "string"},
+				"run_at":  object{"type": "string", "format": "date-time", "description": "仅计划任务返回"},
+				"warnings": object{
+					"type":        "array",
+					"items":       object{"type": "string"},
+					"description": "提交时发现的问题，例如文档元数据中的语言与设置不符",
+				},
+			},
+		},
+		"SuccessResponse": object{
+			"type":       "object",
+			"properties": object{"success": object{"type": "boolean"}},
+		},
+		"QueueActionResponse": object{
+			"type": "object",
+			"properties": object{
+				"success": object{"type": "boolean"},
+				"queue":   ref("QueueStatus"),
+			},
+		},
+		"UserDefaults": object{
+			"type": "object",
+			"properties": object{
+				"user_id":  object{"type": "string"},
+				"defaults": object{"type": "object", "additionalProperties": object{"type": "string"}},
+			},
+		},
+		"DraftRequest": object{
+			"type": "object",
+			"properties": object{
+				"upload_id": object{"type": "string", "description": "预上传文件（见 /api/v1/uploads），被草稿引用时保留到草稿过期"},
+				"form": object{
+					"type":                 "object",
+					"description":          "表单字段，键为提交表单的字段名（file、file_url、upload_id、draft_id、run_at 除外）",
+					"additionalProperties": object{"type": "string"},
+				},
+			},
+		},
+		"UserSettingsResponse": object{
+			"type": "object",
+			"properties": object{
+				"user_id":  object{"type": "string"},
+				"settings": ref("UserSettings"),
+				"retention_bounds": object{
+					"type":        "object",
+					"description": "管理员允许的保留时长范围（没有上限时省略 max）",
+					"properties":  object{"min": object{"type": "string"}, "max": object{"type": "string"}},
+				},
+			},
+		},
+	}
+	for _, v := range openAPISchemas {
+		t := reflect.TypeOf(v)
+		schemas[t.Name()] = structSchema(t)
+	}
+	schemas["Task"].(object)["properties"].(object)["status"] = object{"type": "string", "enum": sortedKeys(validTaskStatuses)}
+	schemas["Task"].(object)["properties"].(object)["params"] = paramsSchema()
+	for _, name := range []string{"Task", "TaskStatus"} {
+		schemas[name].(object)["properties"].(object)["stage"] = object{"type": "string", "enum": []string{taskStageLayout, taskStageTranslation, taskStageTypesetting}}
+	}
+
+	spec := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "BabelDOC Web API",
+			"version":     "1.0.0",
+			"description": "PDF 文档翻译任务的提交、查询、下载与管理接口。未加版本前缀的旧路径（如 /api/tasks/list）作为废弃别名继续提供，响应带有 Deprecation 头。",
+		},
+		"servers": []object{{"url": publicBaseURL()}},
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"adminToken": object{"type": "http", "scheme": "bearer", "description": "ADMIN_TOKEN，仅管理端点需要"},
+			},
+			"responses": object{
+				"BadRequest":    errorResponse("请求参数无效"),
+				"NotFound":      errorResponse("任务或文件不存在"),
+				"InternalError": errorResponse("服务器内部错误"),
+				"Unauthorized":  errorResponse("缺少或错误的管理令牌"),
+				"NotModified":   object{"description": "If-None-Match 与当前 ETag 相同，内容未变化"},
+			},
+		},
+		"paths": object{
+			"/api/v1/tasks": object{
+				"get": object{
+					"summary":     "任务列表",
+					"operationId": "listTasks",
+					"parameters": []object{
+						queryParam("fields", "string", "逗号分隔的字段名，只返回这些字段（id 总是返回）"),
+						queryParam("limit", "integer", "每页数量（1-1000），未设置时返回全部任务"),
+						queryParam("offset", "integer", "跳过的任务数，不能与 cursor 同时使用"),
+						queryParam("cursor", "string", "游标分页位置，取自上一页的 X-Next-Cursor 响应头"),
+						queryParam("q", "string", "按文件名和标签搜索（不区分大小写的子串匹配）"),
+						queryParam("status", "string", "按状态筛选，多个用逗号分隔"),
+						queryParam("lang_in", "string", "按源语言筛选"),
+						queryParam("lang_out", "string", "按目标语言筛选"),
+						queryParam("external_id", "string", "按外部标识筛选"),
+						queryParam("created_after", "string", "创建时间下限（RFC3339 或 YYYY-MM-DD）"),
+						queryParam("created_before", "string", "创建时间上限（RFC3339 或 YYYY-MM-DD，只给日期时包含当天）"),
+						queryParam("meta", "boolean", "为 true 时响应为 {tasks, meta}，meta 中包含分页信息和队列负载"),
+						ifNoneMatchParam(),
+					},
+					"responses": object{
+						"200": object{
+							"description": "按创建时间倒序排列的任务",
+							"headers": object{
+								"X-Next-Cursor": object{"schema": object{"type": "string"}, "description": "还有下一页时返回"},
+								"X-Total-Count": object{"schema": object{"type": "integer"}, "description": "设置 limit 时返回符合条件的任务总数"},
+								"ETag":          etagHeader(),
+							},
+							"content": object{"application/json": object{"schema": object{"oneOf": []object{
+								{"type": "array", "items": ref("Task")},
+								{
+									"type":        "object",
+									"description": "meta=true 时",
+									"properties": object{
+										"tasks": object{"type": "array", "items": ref("Task")},
+										"meta":  ref("ListMeta"),
+									},
+								},
+							}}}},
+						},
+						"304": ref("NotModified", "responses"),
+						"400": ref("BadRequest", "responses"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+				"post": object{
+					"summary":     "提交翻译任务",
+					"operationId": "submitTask",
+					"description": "除下列字段外，其余表单字段作为 babeldoc 命令行参数传递（字段名即参数名，值为 true 时作为开关）。" +
+						"未提供的字段使用调用者保存的默认参数（见 /api/v1/me/defaults）。" +
+						"也可以提交 JSON 请求体，文件通过 upload_id（见 /api/v1/uploads）、draft_id（见 /api/v1/drafts）或 file_base64 提供，babeldoc 参数放在 params 中。",
+					"requestBody": object{
+						"required": true,
+						"content": object{
+							"multipart/form-data": object{
+								"schema": object{
+									"type": "object",
+									"properties": object{
+										"file":                   object{"type": "string", "format": "binary", "description": "PDF 文件，或 PNG/JPG 图片（可重复多次，每张图片一页，由服务端合成 PDF），与 file_url 二选一"},
+										"file_url":               object{"type": "string", "format": "uri", "description": "由服务端下载的 PDF 的 HTTPS 地址，与 file 二选一"},
+										"draft_id":               object{"type": "string", "description": "没有上传文件时使用草稿中的预上传文件，未提供的字段使用草稿中保存的值；任务创建后草稿被删除"},
+										"lang_in":                object{"type": "string", "default": "en", "description": "源语言代码或别名"},
+										"lang_out":               object{"type": "string", "default": "zh", "description": "目标语言代码或别名"},
+										"pages":                  object{"type": "string", "description": "页码范围，如 1,2,1-,-3,3-5"},
+										"notify_email":           object{"type": "string", "format": "email", "description": "任务结束后的通知邮箱"},
+										"preset":                 object{"type": "string", "description": "用于选择命名队列的预设名"},
+										"run_at":                 object{"type": "string", "format": "date-time", "description": "计划执行时间"},
+										"tags":                   object{"type": "string", "description": "逗号分隔的标签"},
+										"external_id":            object{"type": "string", "maxLength": maxExternalIDLen, "description": "调用方系统中的唯一标识，可用于 /api/v1/external-tasks/{external_id}"},
+										"progress_webhook":       object{"type": "string", "format": "uri", "description": "进度回调地址"},
+										"progress_every_percent": object{"type": "integer", "minimum": 1, "maximum": 100},
+										"progress_every_seconds": object{"type": "integer", "minimum": 1},
+										"progress_milestones":    object{"type": "string", "description": "逗号分隔的进度百分比（如 25,50,75,100），首次达到时各回调一次"},
+										"progress_on_stage":      object{"type": "boolean", "description": "进入版面分析、翻译、排版阶段时回调"},
+										"callback_url":           object{"type": "string", "format": "uri", "description": "任务结束后回调的地址（请求体为 CallbackEvent）"},
+										"doi":                    object{"type": "string", "description": "论文的 DOI，启用 DOI_LOOKUP 时查询引用信息"},
+									},
+									"additionalProperties": object{"type": "string"},
+								},
+							},
+							"application/json": object{"schema": ref("TaskSubmission")},
+						},
+					},
+					"responses": object{
+						"200": jsonResponse("任务已创建", ref("SubmitResponse")),
+						"400": ref("BadRequest", "responses"),
+						"409": errorResponse("external_id 已被其他任务使用（响应中的 task_id 为该任务）"),
+						"413": errorResponse("文件超过大小限制"),
+						"422": errorResponse("被入队前钩子拒绝、文档语言与目标语言相同（LANG_DETECTION=reject），或页数超过规模分级的上限（TOO_MANY_PAGES）"),
+						"500": ref("InternalError", "responses"),
+						"503": errorResponse("任务入队失败，或同时进行的上传过多（带 Retry-After 头）"),
+					},
+				},
+			},
+			"/api/v1/uploads": object{
+				"post": object{
+					"summary":     "预上传 PDF 文件或 PNG/JPG 图片，供 JSON 提交通过 upload_id 引用",
+					"operationId": "uploadFile",
+					"description": "请求体为包含 file 字段的 multipart 表单，或原始文件内容（文件名取自 filename 参数或 Content-Disposition 头）。" +
+						"未被引用的文件在 PENDING_UPLOAD_TTL 后删除。",
+					"parameters": []object{queryParam("filename", "string", "原始文件内容上传时的文件名")},
+					"requestBody": object{
+						"required": true,
+						"content": object{
+							"multipart/form-data": object{"schema": object{
+								"type":       "object",
+								"required":   []string{"file"},
+								"properties": object{"file": object{"type": "string", "format": "binary"}},
+							}},
+							"application/pdf": object{"schema": object{"type": "string", "format": "binary"}},
+						},
+					},
+					"responses": object{
+						"201": jsonResponse("文件已保存", object{
+							"type": "object",
+							"properties": object{
+								"success":    object{"type": "boolean"},
+								"upload_id":  object{"type": "string"},
+								"filename":   object{"type": "string"},
+								"size":       object{"type": "integer"},
+								"expires_at": object{"type": "string", "format": "date-time"},
+							},
+						}),
+						"400": ref("BadRequest", "responses"),
+						"413": errorResponse("文件超过大小限制"),
+						"500": ref("InternalError", "responses"),
+						"503": errorResponse("同时进行的上传过多（带 Retry-After 头）"),
+					},
+				},
+			},
+			"/api/v1/imports": object{
+				"post": object{
+					"summary":     "批量导入",
+					"description": "sources 为换行分隔的 URL、DOI 或 arXiv ID（最多 200 项），其余字段作用于所有任务。下载在后台进行，通过 GET /api/v1/imports/{id} 查看每一项的结果。",
+					"operationId": "createImport",
+					"requestBody": object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": ref("ImportRequest")}},
+					},
+					"responses": object{
+						"202": jsonResponse("批次已创建，无法识别的行已标记为 failed", ref("ImportBatch")),
+						"400": ref("BadRequest", "responses"),
+					},
+				},
+			},
+			"/api/v1/imports/{id}": object{
+				"get": object{
+					"summary":     "导入批次状态",
+					"operationId": "getImport",
+					"parameters": []object{
+						object{"name": "id", "in": "path", "required": true, "schema": object{"type": "string"}},
+					},
+					"responses": object{
+						"200": jsonResponse("每一项的下载状态、创建的任务及其状态和失败原因", ref("ImportBatch")),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+			},
+			"/api/v1/drafts": object{
+				"get": object{
+					"summary":     "列出我的提交草稿",
+					"operationId": "listDrafts",
+					"responses": object{"200": jsonResponse("未过期的草稿，最近保存的在前", object{
+						"type":       "object",
+						"properties": object{"drafts": object{"type": "array", "items": ref("SubmissionDraft")}},
+					})},
+				},
+				"post": object{
+					"summary":     "保存提交草稿",
+					"description": "草稿在最后一次保存后 DRAFT_TTL 过期。提交任务时以 draft_id 引用，任务创建后草稿被删除。",
+					"operationId": "createDraft",
+					"requestBody": object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": ref("DraftRequest")}},
+					},
+					"responses": object{
+						"201": jsonResponse("草稿已保存", ref("SubmissionDraft")),
+						"400": ref("BadRequest", "responses"),
+					},
+				},
+			},
+			"/api/v1/drafts/{id}": object{
+				"get": object{
+					"summary":     "读取提交草稿",
+					"operationId": "getDraft",
+					"parameters":  []object{draftIDParam()},
+					"responses": object{
+						"200": jsonResponse("草稿", ref("SubmissionDraft")),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+				"put": object{
+					"summary":     "覆盖保存提交草稿并延长有效期",
+					"operationId": "updateDraft",
+					"parameters":  []object{draftIDParam()},
+					"requestBody": object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": ref("DraftRequest")}},
+					},
+					"responses": object{
+						"200": jsonResponse("草稿已保存", ref("SubmissionDraft")),
+						"400": ref("BadRequest", "responses"),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+				"delete": object{
+					"summary":     "删除提交草稿及其预上传文件",
+					"operationId": "deleteDraft",
+					"parameters":  []object{draftIDParam()},
+					"responses": object{
+						"200": jsonResponse("已删除", ref("SuccessResponse")),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/download-batch": object{
+				"post": object{
+					"summary":     "批量下载多个任务的结果",
+					"operationId": "downloadTasksBatch",
+					"requestBody": object{
+						"required": true,
+						"content": object{"application/json": object{"schema": object{
+							"type":       "object",
+							"required":   []string{"task_ids"},
+							"properties": object{"task_ids": object{"type": "array", "items": object{"type": "string"}, "maxItems": maxBatchDownloadTasks}},
+						}}},
+					},
+					"responses": object{
+						"200": object{"description": "zip 压缩包，每个任务一个目录", "content": object{"application/zip": object{"schema": object{"type": "string", "format": "binary"}}}},
+						"202": jsonResponse("有任务的文件已归档，正在取回（task_ids），按 Retry-After 重新请求", ref("RestoreStatus")),
+						"400": ref("BadRequest", "responses"),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/export": object{
+				"get": object{
+					"summary":     "导出任务列表",
+					"operationId": "exportTasks",
+					"description": "支持任务列表的 fields 和筛选参数，不分页，结果逐行流式写出。",
+					"parameters": []object{
+						queryParam("format", "string", "csv、json（默认）或 ndjson"),
+						queryParam("fields", "string", "逗号分隔的字段名；CSV 未设置时导出常用字段"),
+						queryParam("q", "string", "按文件名和标签搜索"),
+						queryParam("status", "string", "按状态筛选，多个用逗号分隔"),
+						queryParam("lang_in", "string", "按源语言筛选"),
+						queryParam("lang_out", "string", "按目标语言筛选"),
+						queryParam("external_id", "string", "按外部标识筛选"),
+						queryParam("created_after", "string", "创建时间下限（RFC3339 或 YYYY-MM-DD）"),
+						queryParam("created_before", "string", "创建时间上限（RFC3339 或 YYYY-MM-DD，只给日期时包含当天）"),
+					},
+					"responses": object{
+						"200": object{
+							"description": "按创建时间倒序排列的任务",
+							"content": object{
+								"text/csv":             object{"schema": object{"type": "string"}},
+								"application/json":     object{"schema": object{"type": "array", "items": ref("Task")}},
+								"application/x-ndjson": object{"schema": object{"type": "string"}},
+							},
+						},
+						"400": ref("BadRequest", "responses"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/export.bib": object{
+				"get": object{
+					"summary":     "导出 BibTeX",
+					"operationId": "exportBibTeX",
+					"description": "为成功的任务生成 BibTeX 条目，信息取自引用信息或任务备注，file 字段链接到译文 PDF 的本地路径。",
+					"parameters": []object{
+						queryParam("ids", "string", "逗号分隔的任务 ID；未设置时按筛选参数导出"),
+						queryParam("q", "string", "按文件名和标签搜索"),
+						queryParam("lang_in", "string", "按源语言筛选"),
+						queryParam("lang_out", "string", "按目标语言筛选"),
+						queryParam("external_id", "string", "按外部标识筛选"),
+						queryParam("created_after", "string", "创建时间下限（RFC3339 或 YYYY-MM-DD）"),
+						queryParam("created_before", "string", "创建时间上限（RFC3339 或 YYYY-MM-DD，只给日期时包含当天）"),
+					},
+					"responses": object{
+						"200": object{
+							"description": "BibTeX 文件",
+							"content":     object{"application/x-bibtex": object{"schema": object{"type": "string"}}},
+						},
+						"400": ref("BadRequest", "responses"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/delete": object{
+				"post": object{
+					"summary":     "批量删除任务及其文件",
+					"operationId": "deleteTasksBatch",
+					"description": "task_ids 与 filter 二选一，每次最多删除 1000 个任务；执行中的任务会被跳过。",
+					"requestBody": object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": ref("BatchDeleteRequest")}},
+					},
+					"responses": object{
+						"200": jsonResponse("每个任务的删除结果", object{
+							"type": "object",
+							"properties": object{
+								"success":   object{"type": "boolean"},
+								"deleted":   object{"type": "integer"},
+								"results":   object{"type": "array", "items": ref("BatchDeleteResult")},
+								"truncated": object{"type": "boolean", "description": "符合筛选条件的任务超过上限，需要再次调用"},
+							},
+						}),
+						"400": ref("BadRequest", "responses"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}": object{
+				"get": object{
+					"summary":     "任务详情",
+					"operationId": "getTask",
+					"parameters":  []object{taskIDParam(), ifNoneMatchParam()},
+					"responses": object{
+						"200": object{
+							"description": "任务",
+							"headers":     object{"ETag": etagHeader()},
+							"content":     object{"application/json": object{"schema": ref("Task")}},
+						},
+						"304": ref("NotModified", "responses"),
+						"404": ref("NotFound", "responses"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+				"patch": object{
+					"summary":     "修改排队中或计划执行的任务，或任意任务的备注",
+					"operationId": "updateTask",
+					"parameters":  []object{taskIDParam()},
+					"requestBody": object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": ref("TaskUpdate")}},
+					},
+					"responses": object{
+						"200": jsonResponse("修改后的任务", ref("Task")),
+						"400": ref("BadRequest", "responses"),
+						"404": ref("NotFound", "responses"),
+						"409": errorResponse("任务已开始执行或已结束（TASK_NOT_EDITABLE），或已被修改（TASK_VERSION_CONFLICT）"),
+						"422": errorResponse("新的页码范围超过规模分级的上限（TOO_MANY_PAGES）"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+				"delete": object{
+					"summary":     "删除任务及其文件",
+					"operationId": "deleteTask",
+					"parameters": []object{
+						taskIDParam(),
+						queryParam("version", "integer", "读取任务时的 version，任务已被修改时返回 409"),
+					},
+					"responses": object{
+						"200": jsonResponse("已删除", ref("SuccessResponse")),
+						"404": ref("NotFound", "responses"),
+						"409": errorResponse("任务已被修改（TASK_VERSION_CONFLICT，响应中的 version 为当前版本号）"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/clone": object{
+				"post": object{
+					"summary":     "以已有任务的输入文件和参数创建新任务",
+					"operationId": "cloneTask",
+					"description": "请求体可选，字段与 JSON 提交相同（不能包含文件字段），用于覆盖原任务的设置；params 中值为 null 的参数会被移除。外部标识和计划时间不会复制。",
+					"parameters":  []object{taskIDParam()},
+					"requestBody": object{
+						"content": object{"application/json": object{"schema": ref("TaskSubmission")}},
+					},
+					"responses": object{
+						"200": jsonResponse("新任务已创建", ref("SubmitResponse")),
+						"400": ref("BadRequest", "responses"),
+						"404": ref("NotFound", "responses"),
+						"409": errorResponse("external_id 已被其他任务使用"),
+						"410": errorResponse("原任务的输入文件已不存在"),
+						"422": errorResponse("被入队前钩子拒绝、文档语言与目标语言相同（LANG_DETECTION=reject），或页数超过规模分级的上限（TOO_MANY_PAGES）"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/status": object{
+				"get": object{
+					"summary":     "任务状态和进度",
+					"description": "只返回状态、进度（0-100）和执行阶段，适合高频轮询",
+					"operationId": "getTaskStatus",
+					"parameters":  []object{taskIDParam()},
+					"responses": object{
+						"200": jsonResponse("任务状态", ref("TaskStatus")),
+						"404": ref("NotFound", "responses"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/logs": object{
+				"get": object{
+					"summary":     "任务日志",
+					"description": "日志按行记录为 LogRecord。默认返回纯文本（每条记录一行），format=json 或 jsonl 返回结构化记录。轮询时传入上次返回的 offset 只获取新写入的记录，纯文本和 jsonl 格式的 offset 在 X-Log-Offset 响应头中。",
+					"operationId": "getTaskLogs",
+					"parameters": []object{
+						taskIDParam(),
+						queryParam("level", "string", "只返回不低于该级别的记录：debug（默认，包括进度条刷新）、info、warning、error"),
+						queryParam("format", "string", "text（默认）、json 或 jsonl"),
+						queryParam("offset", "integer", "从日志文件的该字节位置开始读取，取自上次响应的 offset；超出日志大小时从头读取并标记 reset"),
+						queryParam("lines", "integer", "最多返回的记录数：与 offset 一起使用时返回之后的前 lines 条，单独使用时返回最后 lines 条"),
+					},
+					"responses": object{
+						"200": object{"description": "日志", "headers": object{
+							"X-Log-Offset": object{"description": "下次查询传入的 offset", "schema": object{"type": "integer"}},
+							"X-Log-More":   object{"description": "受 lines 限制，之后还有未返回的内容", "schema": object{"type": "boolean"}},
+							"X-Log-Reset":  object{"description": "offset 超出日志大小（日志已被重新创建），已从头读取", "schema": object{"type": "boolean"}},
+						}, "content": object{
+							"text/plain": object{"schema": object{"type": "string"}},
+							"application/json": object{"schema": object{"type": "object", "properties": object{
+								"records": object{"type": "array", "items": ref("LogRecord")},
+								"offset":  object{"type": "integer"},
+								"more":    object{"type": "boolean"},
+								"reset":   object{"type": "boolean"},
+							}}},
+							"application/x-ndjson": object{"schema": ref("LogRecord")},
+						}},
+						"400": ref("BadRequest", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/download": object{
+				"get": object{
+					"summary":     "下载翻译结果",
+					"operationId": "downloadTask",
+					"parameters": []object{
+						taskIDParam(),
+						queryParam("file", "string", "输出文件名（取自 output_files），未设置时下载主输出文件"),
+						queryParam("expires", "integer", "签名链接的过期时间（Unix 秒）"),
+						queryParam("sig", "string", "签名链接的签名"),
+						queryParam("link", "string", "分享链接的 ID（由 /links 接口生成的链接带有该参数）"),
+						headerParam("Range", "断点续传的字节范围，例如 bytes=1048576-"),
+						headerParam("If-Range", "之前响应的 ETag，文件已变化时忽略 Range 返回完整文件"),
+					},
+					"responses": object{
+						"200": object{"description": "PDF 文件", "content": object{"application/pdf": object{"schema": object{"type": "string", "format": "binary"}}}},
+						"206": object{"description": "请求范围内的部分内容", "content": object{"application/pdf": object{"schema": object{"type": "string", "format": "binary"}}}},
+						"202": jsonResponse("文件已归档，正在取回，按 Retry-After 重新请求", ref("RestoreStatus")),
+						"304": object{"description": "文件未变化（If-None-Match 匹配）"},
+						"403": errorResponse("签名无效、已过期或分享链接已撤销"),
+						"404": ref("NotFound", "responses"),
+						"410": errorResponse("分享链接的下载次数已用完（DOWNLOAD_LIMIT_REACHED）"),
+						"416": object{"description": "请求的范围超出文件大小"},
+						"503": errorResponse("文件已归档，但未配置冷存储（STORAGE_UNAVAILABLE）"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/pages": object{
+				"get": object{
+					"summary":     "页面预览列表",
+					"operationId": "listPagePreviews",
+					"parameters": []object{
+						taskIDParam(),
+						queryParam("file", "string", "输出文件名（取自 output_files），未设置时使用单语版本"),
+					},
+					"responses": object{
+						"200": jsonResponse("输出文件的页数和各页 PNG 的地址", ref("PagePreviews")),
+						"202": jsonResponse("文件已归档，正在取回，按 Retry-After 重新请求", ref("RestoreStatus")),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/pages/{n}.png": object{
+				"get": object{
+					"summary":     "页面预览",
+					"description": "第一次请求时用 pdftoppm 渲染并缓存，之后直接返回缓存的图片。",
+					"operationId": "getPagePreview",
+					"parameters": []object{
+						taskIDParam(),
+						object{"name": "n", "in": "path", "required": true, "description": "页码，从 1 开始", "schema": object{"type": "integer", "minimum": 1}},
+						queryParam("file", "string", "输出文件名（取自 output_files），未设置时使用单语版本"),
+					},
+					"responses": object{
+						"200": object{"description": "PNG 图片", "content": object{"image/png": object{"schema": object{"type": "string", "format": "binary"}}}},
+						"202": jsonResponse("文件已归档且该页没有缓存，正在取回，按 Retry-After 重新请求", ref("RestoreStatus")),
+						"400": ref("BadRequest", "responses"),
+						"404": errorResponse("任务、输出文件或页面（PAGE_NOT_FOUND）不存在"),
+						"503": errorResponse("服务器没有安装 pdftoppm（PREVIEW_UNAVAILABLE）"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/text": object{
+				"get": object{
+					"summary":     "纯文本版本",
+					"description": "第一次请求时用 pdftotext 提取并缓存。请求带 Accept-Encoding: gzip 时压缩传输。",
+					"operationId": "getTaskText",
+					"parameters": []object{
+						taskIDParam(),
+						object{"name": "format", "in": "query", "description": "txt（默认）或 md", "schema": object{"type": "string", "enum": []string{"txt", "md"}}},
+						queryParam("file", "string", "输出文件名（取自 output_files），未设置时使用单语版本"),
+					},
+					"responses": object{
+						"200": object{"description": "译文的文本，段落之间空一行；Markdown 版本每页一个二级标题", "content": object{
+							"text/plain":    object{"schema": object{"type": "string"}},
+							"text/markdown": object{"schema": object{"type": "string"}},
+						}},
+						"202": jsonResponse("文件已归档且没有提取过文本，正在取回，按 Retry-After 重新请求", ref("RestoreStatus")),
+						"400": ref("BadRequest", "responses"),
+						"404": ref("NotFound", "responses"),
+						"503": errorResponse("服务器没有安装 pdftotext（TEXT_UNAVAILABLE）"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/links": object{
+				"post": object{
+					"summary":     "生成分享链接",
+					"description": "为输出文件生成带签名、有有效期的下载链接，可限制下载次数。未指定 file 时为每个输出文件各生成一个链接。",
+					"operationId": "createDownloadLinks",
+					"parameters":  []object{taskIDParam()},
+					"requestBody": object{
+						"content": object{"application/json": object{"schema": ref("ShareLinkRequest")}},
+					},
+					"responses": object{
+						"201": jsonResponse("已生成", object{
+							"type": "object",
+							"properties": object{
+								"success": object{"type": "boolean"},
+								"links":   object{"type": "array", "items": ref("DownloadLink")},
+							},
+						}),
+						"400": ref("BadRequest", "responses"),
+						"404": ref("NotFound", "responses"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+				"get": object{
+					"summary":     "列出未过期的分享链接",
+					"operationId": "listDownloadLinks",
+					"parameters":  []object{taskIDParam()},
+					"responses": object{
+						"200": jsonResponse("分享链接", object{
+							"type":       "object",
+							"properties": object{"links": object{"type": "array", "items": ref("DownloadLink")}},
+						}),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/links/{link}": object{
+				"delete": object{
+					"summary":     "撤销分享链接",
+					"operationId": "deleteDownloadLink",
+					"parameters": []object{
+						taskIDParam(),
+						object{"name": "link", "in": "path", "required": true, "description": "分享链接 ID", "schema": object{"type": "string"}},
+					},
+					"responses": object{
+						"200": jsonResponse("已撤销", ref("SuccessResponse")),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/bundles": object{
+				"post": object{
+					"summary": "生成加密分享包",
+					"description": "把输出文件（可选包括上传的原文件）打包为 AES-256 加密的 zip（WinZip AES）。未指定密码时随机生成，只在本次响应中返回。" +
+						"设置 max_part_size 时按文件拆分为多个可以单独解压的分卷。",
+					"operationId": "createBundle",
+					"parameters":  []object{taskIDParam()},
+					"requestBody": object{
+						"content": object{"application/json": object{"schema": ref("BundleRequest")}},
+					},
+					"responses": object{
+						"201": jsonResponse("已生成", ref("TaskBundle")),
+						"202": jsonResponse("输出文件已归档，正在取回，稍后重试", ref("RestoreStatus")),
+						"400": ref("BadRequest", "responses"),
+						"404": ref("NotFound", "responses"),
+						"409": errorResponse("分享包数已达上限（TOO_MANY_BUNDLES）"),
+						"410": errorResponse("原文件已被删除（INPUT_FILE_GONE）"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+				"get": object{
+					"summary":     "列出加密分享包",
+					"operationId": "listBundles",
+					"parameters":  []object{taskIDParam()},
+					"responses": object{
+						"200": jsonResponse("分享包", object{
+							"type":       "object",
+							"properties": object{"bundles": object{"type": "array", "items": ref("TaskBundle")}},
+						}),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/bundles/{bundle}": object{
+				"delete": object{
+					"summary":     "删除加密分享包",
+					"operationId": "deleteBundle",
+					"parameters":  []object{taskIDParam(), bundleIDParam()},
+					"responses": object{
+						"200": jsonResponse("已删除", ref("SuccessResponse")),
+						"404": errorResponse("分享包不存在（BUNDLE_NOT_FOUND）"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/bundles/{bundle}/download": object{
+				"get": object{
+					"summary":     "下载加密分享包的分卷",
+					"operationId": "downloadBundle",
+					"parameters": []object{
+						taskIDParam(),
+						bundleIDParam(),
+						queryParam("part", "integer", "分卷序号，从 1 开始，默认 1"),
+					},
+					"responses": object{
+						"200": object{
+							"description": "加密的 zip",
+							"content":     object{"application/zip": object{"schema": object{"type": "string", "format": "binary"}}},
+						},
+						"400": ref("BadRequest", "responses"),
+						"404": errorResponse("分享包或文件不存在（BUNDLE_NOT_FOUND、FILE_NOT_FOUND）"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/events": object{
+				"get": object{
+					"summary": "列出任务事件",
+					"description": "按时间顺序列出任务的事件：生命周期（task.created、task.scheduled、task.queued、task.started、task.stage、" +
+						"task.progress、task.retried、task.requeued、task.canceled、task.completed、task.failed），" +
+						"以及之后的处理，例如结果投递（delivery.succeeded、delivery.retrying、delivery.failed）、" +
+						"冷存储（storage.archived、storage.restored、storage.archive_failed、storage.restore_failed）" +
+						"和加密分享包（bundle.created、bundle.deleted）。",
+					"operationId": "listTaskEvents",
+					"parameters":  []object{taskIDParam()},
+					"responses": object{
+						"200": jsonResponse("任务事件", object{
+							"type":       "object",
+							"properties": object{"events": object{"type": "array", "items": ref("TaskEvent")}},
+						}),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+			},
+			"/api/v1/tasks/{id}/restore": object{
+				"post": object{
+					"summary":     "取回已归档的输出文件",
+					"description": "在后台从冷存储取回文件，完成后任务的 storage_tier 清空。下载已归档的文件时会自动取回，无需先调用本接口。",
+					"operationId": "restoreTask",
+					"parameters":  []object{taskIDParam()},
+					"responses": object{
+						"202": jsonResponse("正在取回", ref("RestoreStatus")),
+						"404": ref("NotFound", "responses"),
+						"409": errorResponse("输出文件没有归档（NOT_ARCHIVED）"),
+						"503": errorResponse("未配置冷存储（STORAGE_UNAVAILABLE）"),
+					},
+				},
+			},
+			"/api/v1/ws": object{
+				"get": object{
+					"summary": "任务状态推送（WebSocket）",
+					"description": "升级为 WebSocket 后推送任务的状态变化、进度和删除，每条消息为一个 TaskChangeEvent JSON 文本帧。" +
+						"也可以连接 /api/ws。只推送连接建立后的变化，客户端应在连接后加载一次任务列表。",
+					"operationId": "taskUpdatesWebSocket",
+					"parameters": []object{
+						queryParam("task_id", "string", "逗号分隔的任务 ID，只推送这些任务的变化；未设置时推送全部任务"),
+					},
+					"responses": object{
+						"101": object{
+							"description": "已升级为 WebSocket",
+							"content":     object{"application/json": object{"schema": ref("TaskChangeEvent")}},
+						},
+						"400": ref("BadRequest", "responses"),
+						"426": errorResponse("请求未携带 WebSocket 升级头"),
+					},
+				},
+			},
+			"/api/v1/me/defaults": object{
+				"get": object{
+					"summary":     "读取我的默认提交参数",
+					"operationId": "getUserDefaults",
+					"responses":   object{"200": jsonResponse("默认参数", ref("UserDefaults"))},
+				},
+				"put": object{
+					"summary":     "保存我的默认提交参数",
+					"operationId": "putUserDefaults",
+					"requestBody": object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": object{"type": "object", "additionalProperties": true}}},
+					},
+					"responses": object{
+						"200": jsonResponse("已保存", ref("UserDefaults")),
+						"400": ref("BadRequest", "responses"),
+					},
+				},
+				"delete": object{
+					"summary":     "清除我的默认提交参数",
+					"operationId": "deleteUserDefaults",
+					"responses":   object{"200": jsonResponse("已清除", ref("SuccessResponse"))},
+				},
+			},
+			"/api/v1/me/settings": object{
+				"get": object{
+					"summary":     "读取我的个人策略",
+					"operationId": "getUserSettings",
+					"responses":   object{"200": jsonResponse("个人策略及允许的保留时长范围", ref("UserSettingsResponse"))},
+				},
+				"put": object{
+					"summary":     "保存我的个人策略",
+					"operationId": "putUserSettings",
+					"requestBody": object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": ref("UserSettings")}},
+					},
+					"responses": object{
+						"200": jsonResponse("已保存，之后提交的任务使用新的策略", ref("UserSettingsResponse")),
+						"400": ref("BadRequest", "responses"),
+					},
+				},
+				"delete": object{
+					"summary":     "清除我的个人策略",
+					"operationId": "deleteUserSettings",
+					"responses":   object{"200": jsonResponse("已清除", ref("SuccessResponse"))},
+				},
+			},
+			"/api/v1/me/follows": object{
+				"get": object{
+					"summary":     "列出我的关注",
+					"operationId": "listFollows",
+					"responses": object{"200": jsonResponse("当前组织内的关注，最近关注的在前", object{
+						"type":       "object",
+						"properties": object{"follows": object{"type": "array", "items": ref("TaskFollow")}},
+					})},
+				},
+				"post": object{
+					"summary":     "关注一个任务或标签",
+					"description": "task_id 与 tag 二选一，email 与 webhook 至少填写一个。只能关注同一组织（USER_ORG_HEADER）的任务；关注的任务或带有关注标签的任务结束后发送通知。",
+					"operationId": "createFollow",
+					"requestBody": object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": ref("FollowRequest")}},
+					},
+					"responses": object{
+						"201": jsonResponse("已关注", ref("TaskFollow")),
+						"400": ref("BadRequest", "responses"),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+			},
+			"/api/v1/me/follows/{id}": object{
+				"delete": object{
+					"summary":     "取消关注",
+					"operationId": "deleteFollow",
+					"parameters":  []object{followIDParam()},
+					"responses": object{
+						"200": jsonResponse("已取消", ref("SuccessResponse")),
+						"404": ref("NotFound", "responses"),
+					},
+				},
+			},
+			"/api/v1/admin/queue/status": object{
+				"get": adminOperation("队列状态", "getQueueStatus", jsonResponse("队列状态", ref("QueueStatus"))),
+			},
+			"/api/v1/admin/queue/pause": object{
+				"post": adminOperation("暂停队列", "pauseQueue", jsonResponse("已暂停", ref("QueueActionResponse"))),
+			},
+			"/api/v1/admin/queue/resume": object{
+				"post": adminOperation("恢复队列", "resumeQueue", jsonResponse("已恢复", ref("QueueActionResponse"))),
+			},
+			"/api/v1/admin/providers": object{
+				"get": adminOperation("翻译服务商健康状态", "getProviders",
+					jsonResponse("各服务商的最近一次探测结果", object{"type": "array", "items": ref("ProviderStatus")})),
+			},
+			"/api/v1/admin/workers": object{
+				"get": adminOperation("worker 心跳", "getWorkers",
+					jsonResponse("各 worker 最近一次上报的任务、阶段和日志位置", object{"type": "array", "items": ref("WorkerHeartbeat")})),
+			},
+			"/api/v1/admin/connections": object{
+				"get": adminOperation("HTTP 连接统计", "getConnections",
+					jsonResponse("当前连接数及按协议统计的请求数", ref("ConnectionStats"))),
+			},
+			"/api/v1/admin/fonts": object{
+				"get": adminOperation("已安装的附加字体", "listFonts",
+					jsonResponse("babeldoc 找不到字体时使用的附加字体", fontListSchema())),
+				"post": withRequestBody(createdOperation(adminOperation("安装附加字体", "installFonts",
+					jsonResponse("已安装，同名字体被替换", fontListSchema()))),
+					object{
+						"required": true,
+						"content": object{
+							"multipart/form-data": object{"schema": object{
+								"type":       "object",
+								"required":   []string{"file"},
+								"properties": object{"file": object{"type": "string", "format": "binary", "description": ".ttf 或 .otf 字体文件，可重复多次"}},
+							}},
+						},
+					}),
+			},
+			"/api/v1/admin/fonts/{name}": object{
+				"delete": withParameters(adminOperation("删除附加字体", "deleteFont",
+					jsonResponse("已删除", ref("SuccessResponse"))),
+					object{"name": "name", "in": "path", "required": true, "description": "字体文件名", "schema": object{"type": "string"}}),
+			},
+			"/api/v1/admin/babeldoc-cache/clear": object{
+				"post": withRequestBody(adminOperation("清理 babeldoc 缓存", "clearBabeldocCache",
+					jsonResponse("已删除的项、释放的字节数和清理后的缓存目录用量；另一个清理或移动正在进行时返回 409", babeldocCacheActionSchema(true))),
+					object{"content": object{"application/json": object{"schema": ref("BabeldocCacheClearRequest")}}}),
+			},
+			"/api/v1/admin/babeldoc-cache/relocate": object{
+				"post": withRequestBody(adminOperation("移动 babeldoc 缓存目录", "relocateBabeldocCache",
+					jsonResponse("已移动，原位置替换为指向新位置的符号链接；另一个清理或移动正在进行时返回 409", babeldocCacheActionSchema(false))),
+					object{"required": true, "content": object{"application/json": object{"schema": ref("BabeldocCacheRelocateRequest")}}}),
+			},
+			"/api/v1/admin/backup": object{
+				"get": adminOperation("下载备份", "downloadBackup", object{
+					"description": "数据库、上传文件、输出文件和任务日志的 tar.gz，以流式响应写出；已有备份正在进行时返回 409",
+					"content":     object{"application/gzip": object{"schema": object{"type": "string", "format": "binary"}}},
+				}),
+			},
+			"/api/v1/storage": object{
+				"get": withParameters(adminOperation("磁盘用量", "getStorageUsage",
+					jsonResponse("各目录的合计用量、所在卷的剩余空间和占用空间最多的任务（也可以通过 /api/storage 访问）", ref("StorageUsage"))),
+					queryParam("limit", "integer", "返回的任务数（默认 50，最大 1000，0 表示只返回合计）")),
+			},
+			"/api/v1/search/content": object{
+				"get": object{
+					"summary":     "按译文内容搜索",
+					"operationId": "searchContent",
+					"parameters": []object{
+						object{"name": "q", "in": "query", "required": true, "description": "搜索词（不区分大小写的子串匹配）", "schema": object{"type": "string"}},
+						queryParam("limit", "integer", "每页结果数（默认 20，最大 100）"),
+						queryParam("offset", "integer", "跳过的结果数"),
+					},
+					"responses": object{
+						"200": jsonResponse("译文中包含搜索词的成功任务，按完成时间倒序", object{
+							"type": "object",
+							"properties": object{
+								"results": object{"type": "array", "items": ref("ContentSearchResult")},
+								"offset":  object{"type": "integer"},
+								"more":    object{"type": "boolean", "description": "是否还有更多结果"},
+							},
+						}),
+						"400": ref("BadRequest", "responses"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+			},
+			"/api/v1/workers": object{
+				"get": adminOperation("worker 状态", "listWorkers",
+					jsonResponse("存活的 worker 是否空闲、正在执行的任务、已执行时间和 babeldoc 进程号", object{"type": "array", "items": ref("WorkerStatus")})),
+			},
+			"/api/v1/languages": object{
+				"get": object{
+					"summary":     "支持的语言",
+					"operationId": "listLanguages",
+					"parameters": []object{
+						queryParam("locale", "string", "显示名称使用的界面语言（如 en、zh），未设置时取 Accept-Language"),
+					},
+					"responses": object{
+						"200": jsonResponse("语言列表、默认语言及语言对限制", object{
+							"type": "object",
+							"properties": object{
+								"locale":            object{"type": "string"},
+								"languages":         object{"type": "array", "items": ref("LanguageEntry")},
+								"default_lang_in":   object{"type": "string"},
+								"default_lang_out":  object{"type": "string"},
+								"pair_restrictions": object{"type": "array", "items": object{"type": "string"}},
+							},
+						}),
+					},
+				},
+			},
+			"/api/v1/openapi.json": object{
+				"get": object{
+					"summary":     "本文档",
+					"operationId": "getOpenAPISpec",
+					"responses":   object{"200": jsonResponse("OpenAPI 3 文档", object{"type": "object"})},
+				},
+			},
+			"/api/v1/graphql": object{
+				"post": object{
+					"summary": "GraphQL 查询",
+					"description": "在一个请求中按需获取任务字段。支持 tasks（筛选参数同任务列表，limit 默认 20）、taskCount 和 task(id / external_id) 查询，" +
+						"Task 另有 duration_seconds 字段；不支持 mutation 和 fragment。也可以 GET 并通过 query、variables 查询参数传递",
+					"operationId": "graphqlQuery",
+					"requestBody": object{
+						"required": true,
+						"content": object{"application/json": object{"schema": object{
+							"type":     "object",
+							"required": []string{"query"},
+							"properties": object{
+								"query":     object{"type": "string"},
+								"variables": object{"type": "object"},
+							},
+						}}},
+					},
+					"responses": object{
+						"200": jsonResponse("查询结果", object{
+							"type":       "object",
+							"properties": object{"data": object{"type": "object"}},
+						}),
+						"400": errorResponse("查询无效，响应同时带有 GraphQL 格式的 errors 字段"),
+						"500": ref("InternalError", "responses"),
+					},
+				},
+			},
+		},
+	}
+	addExternalTaskPaths(spec["paths"].(object))
+	return spec
+}
+
+// addExternalTaskPaths 为 /api/v1/tasks/{id} 下的每个路径生成按外部标识访问的对应路径
+func addExternalTaskPaths(paths object) {
+	for path, item := range paths {
+		external := externalTaskPath(strings.TrimPrefix(path, apiVersionPrefix))
+		if external == "" {
+			continue
+		}
+		externalItem := object{}
+		for method, op := range item.(object) {
+			operation := object{}
+			for key, value := range op.(object) {
+				operation[key] = value
+			}
+			operation["operationId"] = op.(object)["operationId"].(string) + "ByExternalID"
+			var params []object
+			for _, param := range op.(object)["parameters"].([]object) {
+				if param["name"] == "id" {
+					param = externalIDParam()
+				}
+				params = append(params, param)
+			}
+			operation["parameters"] = params
+			externalItem[method] = operation
+		}
+		paths[apiVersionPrefix+external] = externalItem
+	}
+}
+
+// structSchema 根据结构体的 json 标签生成 schema，嵌套结构体引用 components.schemas 中的同名类型
+func structSchema(t reflect.Type) object {
+	properties := object{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// 匿名嵌入的结构体字段展开到外层
+		if field.Anonymous && field.Tag.Get("json") == "" && field.Type.Kind() == reflect.Struct {
+			embedded := structSchema(field.Type)
+			for name, schema := range embedded["properties"].(object) {
+				properties[name] = schema
+			}
+			if names, ok := embedded["required"].([]string); ok {
+				required = append(required, names...)
+			}
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		properties[name] = typeSchema(field.Type)
+		omitempty := len(tag) > 1 && tag[1] == "omitempty"
+		if !omitempty && field.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+	schema := object{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func typeSchema(t reflect.Type) object {
+	if t == reflect.TypeOf(time.Time{}) {
+		return object{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := typeSchema(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return schema
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.Slice:
+		return object{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return ref(t.Name())
+	}
+	return object{}
+}
+
+func ref(name string, kind ...string) object {
+	section := "schemas"
+	if len(kind) > 0 {
+		section = kind[0]
+	}
+	return object{"$ref": "#/components/" + section + "/" + name}
+}
+
+func jsonResponse(description string, schema object) object {
+	return object{
+		"description": description,
+		"content":     object{"application/json": object{"schema": schema}},
+	}
+}
+
+func errorResponse(description string) object {
+	return jsonResponse(description, ref("Error"))
+}
+
+func queryParam(name, typ, description string) object {
+	return object{"name": name, "in": "query", "description": description, "schema": object{"type": typ}}
+}
+
+func headerParam(name, description string) object {
+	return object{"name": name, "in": "header", "description": description, "schema": object{"type": "string"}}
+}
+
+func taskIDParam() object {
+	return object{"name": "id", "in": "path", "required": true, "description": "任务 ID", "schema": object{"type": "string"}}
+}
+
+func bundleIDParam() object {
+	return object{"name": "bundle", "in": "path", "required": true, "description": "分享包 ID", "schema": object{"type": "string"}}
+}
+
+func draftIDParam() object {
+	return object{"name": "id", "in": "path", "required": true, "description": "草稿 ID", "schema": object{"type": "string"}}
+}
+
+func followIDParam() object {
+	return object{"name": "id", "in": "path", "required": true, "description": "关注 ID", "schema": object{"type": "string"}}
+}
+
+func ifNoneMatchParam() object {
+	return object{"name": "If-None-Match", "in": "header", "description": "上次响应的 ETag，内容未变化时返回 304", "schema": object{"type": "string"}}
+}
+
+func etagHeader() object {
+	return object{"schema": object{"type": "string"}, "description": "内容版本，用于 If-None-Match 条件请求"}
+}
+
+func externalIDParam() object {
+	return object{"name": "external_id", "in": "path", "required": true, "description": "提交时指定的外部标识", "schema": object{"type": "string"}}
+}
+
+func adminOperation(summary, operationID string, ok object) object {
+	return object{
+		"summary":     summary,
+		"operationId": operationID,
+		"security":    []object{{"adminToken": []string{}}},
+		"responses": object{
+			"200": ok,
+			"401": ref("Unauthorized", "responses"),
+		},
+	}
+}
+
+// fontListSchema 附加字体接口的响应
+func fontListSchema() object {
+	return object{
+		"type":       "object",
+		"properties": object{"fonts": object{"type": "array", "items": ref("InstalledFont")}},
+	}
+}
+
+// babeldocCacheActionSchema 清理或移动 babeldoc 缓存的响应
+func babeldocCacheActionSchema(clear bool) object {
+	properties := object{
+		"success": object{"type": "boolean"},
+		"cache":   ref("BabeldocCacheUsage"),
+	}
+	if clear {
+		properties["removed"] = object{"type": "array", "items": object{"type": "string"}}
+		properties["freed"] = object{"type": "integer", "format": "int64"}
+	}
+	return object{"type": "object", "properties": properties}
+}
+
+// createdOperation 把操作的成功响应改为 201
+func createdOperation(op object) object {
+	responses := op["responses"].(object)
+	responses["201"] = responses["200"]
+	delete(responses, "200")
+	return op
+}
+
+// withRequestBody 为操作加上请求体
+func withRequestBody(op, body object) object {
+	op["requestBody"] = body
+	return op
+}
+
+// withParameters 为操作加上参数
+func withParameters(op object, params ...object) object {
+	op["parameters"] = params
+	return op
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
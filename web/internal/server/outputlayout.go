@@ -0,0 +1,68 @@
+package server
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 输出文件在 outputDir 下的组织方式：
+//
+//	OUTPUT_LAYOUT  flat（默认，全部位于根目录）；user（users/<用户标识>/）；date（<年>/<月>/<日>/，按提交日期）；
+//	               task（tasks/<任务 ID>/）
+//
+// 任务完成时按当前设置确定目录并记录在任务上（output_dir），之后修改设置不影响已有任务。
+// API 返回的 output_files 始终只是文件名，与目录布局无关。
+var outputLayout = parseOutputLayout(envOrDefault("OUTPUT_LAYOUT", "flat"))
+
+// 用户标识中不能用作目录名的字符
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._@-]`)
+
+func parseOutputLayout(value string) string {
+	switch value {
+	case "flat", "user", "date", "task":
+		return value
+	}
+	log.Printf("无效的 OUTPUT_LAYOUT %q，使用 flat", value)
+	return "flat"
+}
+
+// outputLayoutDir 返回按当前布局存放任务输出的目录（相对 outputDir）
+func outputLayoutDir(task *Task) string {
+	switch outputLayout {
+	case "user":
+		user := strings.TrimLeft(unsafePathChars.ReplaceAllString(task.UserID, "_"), ".")
+		if user == "" {
+			user = "_anonymous"
+		}
+		return filepath.Join("users", user)
+	case "date":
+		return task.CreatedAt.Format("2006/01/02")
+	case "task":
+		// 不能直接使用任务 ID：outputDir/<任务 ID> 是执行期间的临时目录
+		return filepath.Join("tasks", task.ID)
+	}
+	return ""
+}
+
+// outputPath 返回存放在 dir（相对 outputDir）下的输出文件的路径
+func outputPath(dir, file string) string {
+	return filepath.Join(outputDir, dir, file)
+}
+
+// taskOutputPath 返回任务输出文件的路径
+func taskOutputPath(task *Task, file string) string {
+	return outputPath(task.OutputDir, file)
+}
+
+// removeOutputDir 删除任务的输出文件后清理已经为空的目录，直到 outputDir
+func removeOutputDir(dir string) {
+	for dir != "" && dir != "." {
+		if err := os.Remove(filepath.Join(outputDir, dir)); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 页面预览：把译文的每一页渲染为 PNG，浏览器中无需下载整个 PDF 即可阅读。
+//
+//	GET /api/v1/tasks/{id}/pages          页数和各页图片的地址
+//	GET /api/v1/tasks/{id}/pages/{n}.png  第 n 页（从 1 开始）
+//
+//	PAGE_PREVIEW_DPI  渲染分辨率（默认 100，范围 36-300）
+//
+// 默认预览单语版本，file 参数指定其他输出文件。页面在第一次请求时用 pdftoppm（poppler-utils）渲染，
+// 缓存在 DATA_DIR/previews/<任务 ID>/ 下，输出文件更新后重新渲染；删除任务时一并删除。
+// 输出文件归档后已渲染的页面仍可访问，其他页面需要先取回。找不到 pdftoppm 时返回 503。
+const (
+	pdftoppmTimeout = 2 * time.Minute
+
+	// previewCacheControl 预览图片的缓存时间，输出文件不会原地修改，浏览器可以放心缓存
+	previewCacheControl = "private, max-age=86400"
+)
+
+var (
+	previewsDir = filepath.Join(dataDir, "previews")
+	previewDPI  = parsePreviewDPI()
+
+	// 同时渲染的页面数
+	previewSlots = make(chan struct{}, runtime.NumCPU())
+	// 每个缓存文件一个锁，同一页的并发请求只渲染一次
+	previewLocks sync.Map
+
+	pdftoppmOnce  sync.Once
+	pdftoppmFound bool
+)
+
+func parsePreviewDPI() int {
+	dpi := parseIntEnv("PAGE_PREVIEW_DPI", 100)
+	if dpi < 36 || dpi > 300 {
+		log.Printf("无效的 PAGE_PREVIEW_DPI %d，使用默认值 100", dpi)
+		return 100
+	}
+	return dpi
+}
+
+// PagePreviews 任务的页面预览
+type PagePreviews struct {
+	File      string   `json:"file"`       // 预览的输出文件
+	PageCount int      `json:"page_count"` // 页数
+	Pages     []string `json:"pages"`      // 各页图片的地址
+}
+
+// canRenderPreviews 是否能渲染页面，第一次调用时检查 pdftoppm
+func canRenderPreviews() bool {
+	pdftoppmOnce.Do(func() {
+		if _, err := exec.LookPath("pdftoppm"); err != nil {
+			log.Printf("找不到 pdftoppm，页面预览不可用")
+			return
+		}
+		pdftoppmFound = true
+	})
+	return pdftoppmFound
+}
+
+// previewTask 读取任务并确定预览的输出文件，失败时写出错误响应并返回 nil
+func previewTask(w http.ResponseWriter, r *http.Request) (*Task, string) {
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, r.PathValue("id")))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return nil, ""
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error loading task")
+		return nil, ""
+	}
+	file := r.URL.Query().Get("file")
+	if file == "" {
+		file = contentSourceFile(task)
+	}
+	for _, output := range taskOutputFiles(task) {
+		if output == file && task.Status == "success" {
+			return task, file
+		}
+	}
+	writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+	return nil, ""
+}
+
+// pagePreviewsHandler 返回页数和各页图片的地址
+func pagePreviewsHandler(w http.ResponseWriter, r *http.Request) {
+	task, file := previewTask(w, r)
+	if task == nil {
+		return
+	}
+	if task.StorageTier != "" {
+		writeRestoring(w, task)
+		return
+	}
+	path := taskOutputPath(task, file)
+	ensureLocal(path)
+	source, cleanup, err := decompressedOutputCopy(path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+		return
+	}
+	defer cleanup()
+
+	previews := PagePreviews{File: file, PageCount: countPDFPages(source), Pages: []string{}}
+	for n := 1; n <= previews.PageCount; n++ {
+		previews.Pages = append(previews.Pages, previewURL(task.ID, file, n))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(previews)
+}
+
+// previewURL 返回第 n 页图片的地址
+func previewURL(taskID, file string, n int) string {
+	return fmt.Sprintf("%s/tasks/%s/pages/%d.png?file=%s", apiVersionPrefix, taskID, n, url.QueryEscape(file))
+}
+
+// pagePreviewHandler 返回第 n 页的 PNG，没有缓存时先渲染
+func pagePreviewHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(strings.TrimSuffix(r.PathValue("page"), ".png"))
+	if err != nil || n < 1 {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "page must be a positive integer")
+		return
+	}
+	task, file := previewTask(w, r)
+	if task == nil {
+		return
+	}
+
+	cachePath := filepath.Join(previewsDir, task.ID, file, fmt.Sprintf("%d.png", n))
+	path := taskOutputPath(task, file)
+	if task.StorageTier != "" {
+		// 已归档：只能返回之前渲染的页面
+		if _, err := os.Stat(cachePath); err == nil {
+			servePreview(w, r, cachePath)
+			return
+		}
+		writeRestoring(w, task)
+		return
+	}
+
+	ensureLocal(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+		return
+	}
+	if cached, err := os.Stat(cachePath); err == nil && !cached.ModTime().Before(info.ModTime()) {
+		servePreview(w, r, cachePath)
+		return
+	}
+	if !canRenderPreviews() {
+		writeError(w, http.StatusServiceUnavailable, codePreviewUnavailable, "pdftoppm is not installed on the server")
+		return
+	}
+
+	lock, _ := previewLocks.LoadOrStore(cachePath, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	// 等待期间其他请求可能已经渲染完成
+	if cached, err := os.Stat(cachePath); err != nil || cached.ModTime().Before(info.ModTime()) {
+		if apiErr := renderPreview(path, cachePath, n); apiErr != nil {
+			writeAPIError(w, apiErr)
+			return
+		}
+	}
+	servePreview(w, r, cachePath)
+}
+
+// renderPreview 用 pdftoppm 把输出文件的第 n 页渲染到 cachePath
+func renderPreview(path, cachePath string, n int) *apiError {
+	source, cleanup, err := decompressedOutputCopy(path)
+	if err != nil {
+		return newAPIError(http.StatusNotFound, codeFileNotFound, "File not found")
+	}
+	defer cleanup()
+	if pages := countPDFPages(source); pages > 0 && n > pages {
+		return newAPIError(http.StatusNotFound, codePageNotFound, "page %d out of range (1-%d)", n, pages)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return newAPIError(http.StatusInternalServerError, codeInternal, "Error creating preview directory")
+	}
+	previewSlots <- struct{}{}
+	defer func() { <-previewSlots }()
+
+	// pdftoppm 在输出前缀后加上 .png
+	prefix := filepath.Join(filepath.Dir(cachePath), fmt.Sprintf(".tmp-%d-%d", n, time.Now().UnixNano()))
+	ctx, cancel := context.WithTimeout(context.Background(), pdftoppmTimeout)
+	defer cancel()
+	page := strconv.Itoa(n)
+	out, err := exec.CommandContext(ctx, "pdftoppm", "-png", "-r", strconv.Itoa(previewDPI), "-f", page, "-l", page, "-singlefile", source, prefix).CombinedOutput()
+	if err != nil {
+		os.Remove(prefix + ".png")
+		log.Printf("无法渲染 %s 的第 %d 页: %v: %s", path, n, err, strings.TrimSpace(string(out)))
+		return newAPIError(http.StatusInternalServerError, codeInternal, "Error rendering page %d", n)
+	}
+	if err := os.Rename(prefix+".png", cachePath); err != nil {
+		os.Remove(prefix + ".png")
+		return newAPIError(http.StatusInternalServerError, codeInternal, "Error saving preview")
+	}
+	return nil
+}
+
+func servePreview(w http.ResponseWriter, r *http.Request, cachePath string) {
+	f, err := os.Open(cachePath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error opening preview")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", previewCacheControl)
+	http.ServeContent(w, r, filepath.Base(cachePath), info.ModTime(), f)
+}
+
+// deleteTaskPreviews 删除任务的页面预览缓存
+func deleteTaskPreviews(taskID string) {
+	os.RemoveAll(filepath.Join(previewsDir, taskID))
+}
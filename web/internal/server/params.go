@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// TaskParams 任务的 babeldoc 参数。数据库和程序内部为 JSON 字符串（键为 babeldoc 参数名，值均为字符串），
+// 接口响应中输出为 JSON 对象，客户端无需再次解析：knownParamTypes 中的参数按类型输出（数字、布尔值），
+// 其他参数原样输出为字符串；API Key 等敏感参数只显示为 ******，与 JSON 提交的 params 格式一致。
+type TaskParams string
+
+// knownParamTypes 已知参数的类型，值无法按类型解析时仍输出为字符串
+var knownParamTypes = map[string]string{
+	"openai-model":          "string",
+	"openai-base-url":       "string",
+	"custom-system-prompt":  "string",
+	"watermark-output-mode": "string",
+	"qps":                   "integer",
+	"rpm":                   "integer",
+	"pool-max-workers":      "integer",
+	"min-text-length":       "integer",
+	"max-pages-per-part":    "integer",
+	"no-dual":               "boolean",
+	"no-mono":               "boolean",
+	"skip-clean":            "boolean",
+	"enhance-compatibility": "boolean",
+	"ignore-cache":          "boolean",
+}
+
+// Map 返回解析后的参数，格式无效时返回空 map
+func (p TaskParams) Map() map[string]string {
+	params := make(map[string]string)
+	if p != "" {
+		json.Unmarshal([]byte(p), &params)
+	}
+	return params
+}
+
+// MarshalJSON 输出为带类型的 JSON 对象，敏感参数被隐藏
+func (p TaskParams) MarshalJSON() ([]byte, error) {
+	params := p.Map()
+	out := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		out[key] = typedParamValue(key, maskEnvValue(key, value))
+	}
+	return json.Marshal(out)
+}
+
+func typedParamValue(key, value string) interface{} {
+	switch knownParamTypes[key] {
+	case "integer":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// paramsSchema 返回 params 的 OpenAPI schema：已知参数带类型，其他参数为字符串
+func paramsSchema() object {
+	properties := object{}
+	for name, typ := range knownParamTypes {
+		properties[name] = object{"type": typ}
+	}
+	return object{
+		"type":                 "object",
+		"description":          "babeldoc 参数（键为参数名）；已知参数按类型输出，API Key 等敏感参数显示为 ******",
+		"properties":           properties,
+		"additionalProperties": object{"type": "string"},
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// 提交时根据 PDF 元数据检查语言设置：
+//
+//	LANG_DETECTION  off 不检查；warn（默认）只在响应中给出警告；reject 拒绝目标语言与文档语言相同的任务
+//
+// 文档语言取自文档目录的 /Lang 条目或 XMP 元数据中的 dc:language。未显式指定 lang_in 且检测结果与默认值不同时，
+// 自动改用检测到的语言。
+var langDetectionMode = envOrDefault("LANG_DETECTION", "warn")
+
+const (
+	// 只扫描文件头尾，文档目录和 XMP 元数据通常位于这两处
+	langScanChunkSize = 4 << 20
+	// 单个对象流解压后的大小上限
+	maxObjectStreamSize = 1 << 20
+)
+
+var (
+	pdfLangLiteralPattern = regexp.MustCompile(`/Lang\s*\(((?:[^()\\]|\\.){1,64})\)`)
+	pdfLangHexPattern     = regexp.MustCompile(`/Lang\s*<([0-9A-Fa-f\s]{2,130})>`)
+	xmpLanguagePattern    = regexp.MustCompile(`(?s)<dc:language>.*?<rdf:li[^>]*>\s*([^<\s]+)\s*</rdf:li>`)
+	objectStreamPattern   = regexp.MustCompile(`/Type\s*/ObjStm[^>]*?>>\s*stream\r?\n`)
+)
+
+// detectPDFLanguage 从 PDF 元数据中读取文档语言，返回规范语言代码，无法确定时返回空字符串
+func detectPDFLanguage(path string) string {
+	for _, chunk := range readPDFChunks(path) {
+		for _, value := range pdfLanguageValues(chunk) {
+			if code := languageFromTag(value); code != "" {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// readPDFChunks 读取文件开头和结尾各一段（小文件只读一次）
+func readPDFChunks(path string) [][]byte {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+
+	head := make([]byte, min(info.Size(), langScanChunkSize))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return nil
+	}
+	chunks := [][]byte{head}
+	if info.Size() > langScanChunkSize {
+		tail := make([]byte, min(info.Size()-langScanChunkSize, langScanChunkSize))
+		if _, err := f.ReadAt(tail, info.Size()-int64(len(tail))); err == nil {
+			// 文档目录通常在文件末尾的增量更新中，优先检查
+			chunks = [][]byte{tail, head}
+		}
+	}
+	return chunks
+}
+
+// pdfLanguageValues 返回数据中出现的语言标记，包括压缩对象流中的 /Lang
+func pdfLanguageValues(data []byte) []string {
+	values := languageValuesIn(data)
+	for _, loc := range objectStreamPattern.FindAllIndex(data, -1) {
+		r, err := zlib.NewReader(bytes.NewReader(data[loc[1]:]))
+		if err != nil {
+			continue
+		}
+		inflated, _ := io.ReadAll(io.LimitReader(r, maxObjectStreamSize))
+		r.Close()
+		values = append(values, languageValuesIn(inflated)...)
+	}
+	return values
+}
+
+func languageValuesIn(data []byte) []string {
+	var values []string
+	for _, m := range pdfLangLiteralPattern.FindAllSubmatch(data, -1) {
+		values = append(values, decodePDFText(m[1]))
+	}
+	for _, m := range pdfLangHexPattern.FindAllSubmatch(data, -1) {
+		raw, err := hex.DecodeString(strings.Join(strings.Fields(string(m[1])), ""))
+		if err == nil {
+			values = append(values, decodePDFText(raw))
+		}
+	}
+	for _, m := range xmpLanguagePattern.FindAllSubmatch(data, -1) {
+		values = append(values, string(m[1]))
+	}
+	return values
+}
+
+// decodePDFText 解码 PDF 文本字符串，支持带 BOM 的 UTF-16BE
+func decodePDFText(raw []byte) string {
+	raw = bytes.ReplaceAll(raw, []byte(`\`), nil)
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	return string(raw)
+}
+
+// languageFromTag 将 BCP 47 语言标记转换为规范代码，完整标记无法识别时退回主语言部分
+func languageFromTag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if tag == "" || strings.EqualFold(tag, "x-unknown") {
+		return ""
+	}
+	if code, ok := normalizeLanguage(tag); ok {
+		return code
+	}
+	primary := strings.SplitN(languageKey(tag), "-", 2)[0]
+	if code, ok := normalizeLanguage(primary); ok {
+		return code
+	}
+	return ""
+}
+
+// checkDocumentLanguage 对比文档语言与提交的语言设置。langInExplicit 为 false 时可自动调整源语言；
+// 返回调整后的源语言和给调用方的警告，mode 为 reject 且目标语言与文档语言相同时返回错误
+func checkDocumentLanguage(path, langIn, langOut string, langInExplicit bool) (string, []string, error) {
+	if langDetectionMode == "off" {
+		return langIn, nil, nil
+	}
+	detected := detectPDFLanguage(path)
+	if detected == "" {
+		return langIn, nil, nil
+	}
+
+	var warnings []string
+	if detected == langOut {
+		if langDetectionMode == "reject" {
+			return langIn, nil, fmt.Errorf("document metadata indicates it is already in the target language %s", langOut)
+		}
+		warnings = append(warnings, fmt.Sprintf("document metadata indicates it is already in the target language %s", langOut))
+		return langIn, warnings, nil
+	}
+	if detected != langIn {
+		if !langInExplicit {
+			warnings = append(warnings, fmt.Sprintf("lang_in adjusted from %s to %s based on document metadata", langIn, detected))
+			return detected, warnings, nil
+		}
+		warnings = append(warnings, fmt.Sprintf("document metadata indicates source language %s, but lang_in is %s", detected, langIn))
+	}
+	return langIn, warnings, nil
+}
+
+// nonNilStrings 保证空列表编码为 [] 而不是 null
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
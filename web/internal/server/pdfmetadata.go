@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// 任务备注：提交时从 PDF 的文档信息字典（trailer 的 /Info）读取标题、作者和主题，找不到时使用 XMP 元数据中的
+// dc:title、dc:creator 和 dc:description，保存在任务上（notes），任务列表据此显示论文标题而不是文件名。
+// 备注可以随时通过 PATCH /api/v1/tasks/{id} 修改，包括已开始执行或已结束的任务。
+// 加密的文档不读取文档信息字典（其中的字符串已加密）。
+
+// maxNoteLength 备注每一项的最大字符数，超出部分截断
+const maxNoteLength = 500
+
+// TaskNotes 任务备注
+type TaskNotes struct {
+	Title   string `json:"title,omitempty"`
+	Author  string `json:"author,omitempty"`
+	Subject string `json:"subject,omitempty"`
+}
+
+var (
+	pdfInfoRefPattern = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfEncryptPattern = regexp.MustCompile(`/Encrypt\s+\d+\s+\d+\s+R`)
+	xmpTitlePattern   = regexp.MustCompile(`(?s)<dc:title>.*?<rdf:li[^>]*>([^<]*)</rdf:li>`)
+	xmpCreatorPattern = regexp.MustCompile(`(?s)<dc:creator>.*?<rdf:li[^>]*>([^<]*)</rdf:li>`)
+	xmpSubjectPattern = regexp.MustCompile(`(?s)<dc:description>.*?<rdf:li[^>]*>([^<]*)</rdf:li>`)
+	// 常见的无意义标题，例如由 Word 导出时自动生成的
+	placeholderTitlePattern = regexp.MustCompile(`(?i)^(untitled|title|microsoft (word|powerpoint) - .*|.*\.(docx?|pptx?|tex|dvi|pdf))$`)
+)
+
+// IsEmpty 判断备注是否为空
+func (n *TaskNotes) IsEmpty() bool {
+	return n == nil || (n.Title == "" && n.Author == "" && n.Subject == "")
+}
+
+// normalize 去除各项首尾和多余的空白并截断过长的内容
+func (n *TaskNotes) normalize() {
+	for _, field := range []*string{&n.Title, &n.Author, &n.Subject} {
+		value := strings.Join(strings.Fields(*field), " ")
+		if r := []rune(value); len(r) > maxNoteLength {
+			value = string(r[:maxNoteLength]) + "…"
+		}
+		*field = value
+	}
+}
+
+// readPDFNotes 从 PDF 元数据中读取备注，没有可用的元数据时返回 nil
+func readPDFNotes(path string) *TaskNotes {
+	chunks := readPDFChunks(path)
+	notes := &TaskNotes{}
+	encrypted := false
+	for _, chunk := range chunks {
+		if pdfEncryptPattern.Match(chunk) {
+			encrypted = true
+		}
+	}
+	if !encrypted {
+		if info := findPDFInfoDict(chunks); info != nil {
+			notes.Title = pdfDictString(info, "Title")
+			notes.Author = pdfDictString(info, "Author")
+			notes.Subject = pdfDictString(info, "Subject")
+		}
+	}
+	notes.normalize()
+	if placeholderTitlePattern.MatchString(notes.Title) {
+		notes.Title = ""
+	}
+	for _, chunk := range chunks {
+		fillFromXMP(&notes.Title, chunk, xmpTitlePattern)
+		fillFromXMP(&notes.Author, chunk, xmpCreatorPattern)
+		fillFromXMP(&notes.Subject, chunk, xmpSubjectPattern)
+	}
+	notes.normalize()
+	if notes.IsEmpty() {
+		return nil
+	}
+	return notes
+}
+
+// fillFromXMP 在 field 为空时使用 XMP 元数据中的值
+func fillFromXMP(field *string, data []byte, pattern *regexp.Regexp) {
+	if *field != "" {
+		return
+	}
+	if m := pattern.FindSubmatch(data); m != nil {
+		*field = html.UnescapeString(string(m[1]))
+	}
+}
+
+// findPDFInfoDict 找到 trailer 中 /Info 引用的对象，返回其字典内容。
+// 增量更新的文件中取最后一个引用；对象位于压缩对象流中时返回 nil
+func findPDFInfoDict(chunks [][]byte) []byte {
+	for _, chunk := range chunks {
+		refs := pdfInfoRefPattern.FindAllSubmatch(chunk, -1)
+		if len(refs) == 0 {
+			continue
+		}
+		ref := refs[len(refs)-1]
+		header := regexp.MustCompile(`(?:^|[^0-9])` + string(ref[1]) + `\s+` + string(ref[2]) + `\s+obj\b`)
+		for _, data := range chunks {
+			locs := header.FindAllIndex(data, -1)
+			if len(locs) == 0 {
+				continue
+			}
+			body := data[locs[len(locs)-1][1]:]
+			if end := bytes.Index(body, []byte("endobj")); end >= 0 {
+				body = body[:end]
+			}
+			return body
+		}
+		return nil
+	}
+	return nil
+}
+
+// pdfDictString 读取字典中 key 对应的字符串值（字面量或十六进制字符串），不存在时返回空字符串
+func pdfDictString(dict []byte, key string) string {
+	pattern := regexp.MustCompile(`/` + key + `\s*([(<])`)
+	loc := pattern.FindSubmatchIndex(dict)
+	if loc == nil {
+		return ""
+	}
+	start := loc[2]
+	if dict[start] == '<' {
+		end := bytes.IndexByte(dict[start:], '>')
+		if end < 0 {
+			return ""
+		}
+		hexDigits := strings.Join(strings.Fields(string(dict[start+1:start+end])), "")
+		if len(hexDigits)%2 == 1 {
+			hexDigits += "0"
+		}
+		raw, err := hex.DecodeString(hexDigits)
+		if err != nil {
+			return ""
+		}
+		return decodePDFTextString(raw)
+	}
+	return decodePDFTextString(parsePDFLiteral(dict[start:]))
+}
+
+// parsePDFLiteral 解析以 ( 开头的字面量字符串，处理转义和嵌套的括号
+func parsePDFLiteral(data []byte) []byte {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case c == '\\' && i+1 < len(data):
+			i++
+			switch e := data[i]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// 续行
+				if i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7' {
+						j++
+					}
+					value, _ := strconv.ParseUint(string(data[i:j]), 8, 8)
+					c = byte(value)
+					i = j - 1
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// pdfDocEncodingHigh PDFDocEncoding 中 0x80-0xA0 与 Latin-1 不同的字符
+var pdfDocEncodingHigh = []rune("•†‡…—–ƒ⁄‹›−‰„“”‘’‚™ﬁﬂŁŒŠŸŽıłœšž�€")
+
+// decodePDFTextString 解码 PDF 文本字符串：带 BOM 的 UTF-16BE 或 UTF-8，否则按 PDFDocEncoding
+// （有些生成器直接写入不带 BOM 的 UTF-8，能按 UTF-8 解码时照此处理）
+func decodePDFTextString(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if bytes.HasPrefix(raw, []byte{0xEF, 0xBB, 0xBF}) {
+		return string(raw[3:])
+	}
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	var sb strings.Builder
+	for _, b := range raw {
+		if b >= 0x80 && b <= 0xA0 {
+			sb.WriteRune(pdfDocEncodingHigh[b-0x80])
+		} else {
+			sb.WriteRune(rune(b))
+		}
+	}
+	return sb.String()
+}
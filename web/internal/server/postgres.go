@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// postgresStore PostgreSQL 数据库（14 及以上）。DATABASE_URL 直接交给 lib/pq，连接参数（sslmode 等）写在地址的查询部分；
+// 连接把语句中的 ? 占位符换成 $n，其余部分原样执行。
+// 全文索引使用 pg_trgm 扩展的 GIN 索引加速不区分大小写的子串匹配（ILIKE），需要有创建扩展的权限，否则退化为 LIKE 查询；
+// 触发器通过 PL/pgSQL 函数实现。备份时在只读的可重复读事务中把各表复制到 SQLite 文件，格式与 SQLite 的备份相同，可以相互恢复。
+type postgresStore struct {
+	dsn string
+}
+
+const postgresDriverName = "babeldoc-postgres"
+
+func init() {
+	sql.Register(postgresDriverName, &postgresDriver{})
+}
+
+func (s *postgresStore) Name() string { return "postgres" }
+
+func (s *postgresStore) Open() (*sql.DB, error) {
+	return sql.Open(postgresDriverName, s.dsn)
+}
+
+func (s *postgresStore) Types() columnTypes {
+	return columnTypes{
+		ID:      "BIGSERIAL PRIMARY KEY",
+		Key:     "TEXT",
+		Text:    "TEXT",
+		Integer: "BIGINT",
+		Real:    "DOUBLE PRECISION",
+		Time:    "TIMESTAMPTZ",
+		Cast:    "BIGINT",
+	}
+}
+
+func (s *postgresStore) CreateIndex(name, table, columns, where string, unique bool) error {
+	return createIndexIfNotExists(name, table, columns, where, unique)
+}
+
+func (s *postgresStore) Upsert(conflict ...string) string {
+	return conflictTarget(conflict) + ` DO UPDATE SET`
+}
+
+func (s *postgresStore) InsertIgnore(conflict ...string) string {
+	return conflictTarget(conflict) + ` DO NOTHING`
+}
+
+func (s *postgresStore) CreateTrigger(name, table, event, body string) error {
+	return s.createTrigger(name, table, "AFTER "+event, body+`;
+		RETURN NULL;`)
+}
+
+func (s *postgresStore) CreateVersionTrigger(name, table, column string) error {
+	return s.createTrigger(name, table, "BEFORE UPDATE", `IF new.`+column+` = old.`+column+` THEN
+			new.`+column+` := old.`+column+` + 1;
+		END IF;
+		RETURN new;`)
+}
+
+// createTrigger 创建执行 body 的触发器函数和触发器，已存在时替换
+func (s *postgresStore) createTrigger(name, table, timing, body string) error {
+	statements := []string{
+		`CREATE OR REPLACE FUNCTION ` + name + `() RETURNS trigger LANGUAGE plpgsql AS $$
+	BEGIN
+		` + body + `
+	END $$`,
+		`CREATE OR REPLACE TRIGGER ` + name + ` ` + timing + ` ON ` + table + ` FOR EACH ROW EXECUTE FUNCTION ` + name + `()`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *postgresStore) CreateSearchIndex(name, table string, columns []string) error {
+	if _, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`); err != nil {
+		return err
+	}
+	for _, column := range columns {
+		if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS ` + name + `_` + column + ` ON ` + table + ` USING gin (` + column + ` gin_trgm_ops)`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *postgresStore) SearchCondition(name, alias string, columns []string, q string) (string, []interface{}) {
+	pattern := "%" + escapeLike(q) + "%"
+	conditions := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		conditions[i] = qualifyColumn(alias, column) + ` ILIKE ? ESCAPE '\'`
+		args[i] = pattern
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+func (s *postgresStore) Snapshot(database *sql.DB, path string) error {
+	rows, err := database.Query(`SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name`)
+	if err != nil {
+		return err
+	}
+	tables, err := scanStrings(rows)
+	if err != nil {
+		return err
+	}
+	return snapshotTables(database, path, tables, func(tx *sql.Tx, table string) ([]string, error) {
+		rows, err := tx.Query(`SELECT kcu.column_name FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage kcu ON kcu.constraint_name = tc.constraint_name
+				AND kcu.table_schema = tc.table_schema AND kcu.table_name = tc.table_name
+			WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = current_schema() AND tc.table_name = ?
+			ORDER BY kcu.ordinal_position`, table)
+		if err != nil {
+			return nil, err
+		}
+		return scanStrings(rows)
+	})
+}
+
+func (s *postgresStore) Restore(snapshot string, force bool) error {
+	if err := openStoreForRestore(s); err != nil {
+		return err
+	}
+	if err := restoreTables(db, snapshot, force); err != nil {
+		return err
+	}
+	// 恢复的事件保留了原来的 id，序列需要从其后继续
+	_, err := db.Exec(`SELECT setval(pg_get_serial_sequence('task_events', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM task_events`)
+	return err
+}
+
+// postgresDriver 包装 lib/pq 的驱动：执行前把 ? 占位符换成 $n，布尔参数转换为整数
+type postgresDriver struct {
+	pq.Driver
+}
+
+func (d *postgresDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresConn{Conn: conn}, nil
+}
+
+// rebindPlaceholders 把字符串和带引号的标识符以外的 ? 依次替换为 $1、$2……
+func rebindPlaceholders(query string) string {
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// postgresConn 替换占位符后交给 lib/pq 的连接执行
+type postgresConn struct {
+	driver.Conn
+}
+
+func (c *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebindPlaceholders(query))
+}
+
+func (c *postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	query = rebindPlaceholders(query)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return e.ExecContext(ctx, rebindPlaceholders(query), args)
+}
+
+func (c *postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return q.QueryContext(ctx, rebindPlaceholders(query), args)
+}
+
+func (c *postgresConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *postgresConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *postgresConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *postgresConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue 布尔值与 SQLite 一样以 0/1 保存在整数列中
+func (c *postgresConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if b, ok := nv.Value.(bool); ok {
+		nv.Value = int64(0)
+		if b {
+			nv.Value = int64(1)
+		}
+	}
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
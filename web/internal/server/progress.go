@@ -0,0 +1,344 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressWebhook 任务的进度回调订阅，提交任务时通过 progress_webhook、progress_every_percent、
+// progress_every_seconds、progress_milestones、progress_on_stage 字段设置
+type ProgressWebhook struct {
+	URL          string `json:"url"`
+	EveryPercent int    `json:"every_percent,omitempty"` // 进度每增加 N 个百分点回调一次
+	EverySeconds int    `json:"every_seconds,omitempty"` // 每隔 M 秒回调一次
+	Milestones   []int  `json:"milestones,omitempty"`    // 进度首次达到这些百分比时各回调一次
+	OnStage      bool   `json:"on_stage,omitempty"`      // 进入版面分析、翻译、排版阶段时回调
+}
+
+// 进度回调的事件类型
+const (
+	progressEventProgress  = "task.progress"
+	progressEventMilestone = "task.milestone"
+	progressEventStage     = "task.stage"
+)
+
+// ProgressEvent 进度回调的请求体
+type ProgressEvent struct {
+	Event     string    `json:"event"` // task.progress（按间隔）、task.milestone（达到里程碑）或 task.stage（进入新阶段）
+	TaskID    string    `json:"task_id"`
+	Status    string    `json:"status"`
+	Progress  int       `json:"progress"`
+	Stage     string    `json:"stage,omitempty"`     // 当前阶段：layout、translation、typesetting
+	Milestone int       `json:"milestone,omitempty"` // 达到的里程碑（task.milestone）
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	defaultProgressEveryPercent = 10
+	progressWebhookTimeout      = 10 * time.Second
+)
+
+var (
+	ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+	// rich 进度条: "translate ━━━━━━━━ 45/100 0:01:23 0:02:00"
+	richProgressPattern = regexp.MustCompile(`\btranslate\b.*?\b(\d{1,3})/100\b`)
+	// tqdm 进度条: "translate:  45%|████      | 45/100"
+	tqdmProgressPattern = regexp.MustCompile(`(\d{1,3})%\|`)
+	// 阶段进度条: "Translate Paragraphs (1/1) ━━━━ 12/40"，tqdm 为 "Translate Paragraphs (12/40):  45%|"
+	stageLinePattern = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z ]*?) \((?:\d+/\d+|Complete)\)`)
+)
+
+// 任务阶段，按执行顺序排列
+const (
+	taskStageLayout      = "layout"
+	taskStageTranslation = "translation"
+	taskStageTypesetting = "typesetting"
+)
+
+var taskStageOrder = map[string]int{taskStageLayout: 1, taskStageTranslation: 2, taskStageTypesetting: 3}
+
+// babeldocStages babeldoc 各处理阶段（TRANSLATE_STAGES）所属的任务阶段
+var babeldocStages = map[string]string{
+	"Parse PDF and Create Intermediate Representation": taskStageLayout,
+	"DetectScannedFile":             taskStageLayout,
+	"Parse Page Layout":             taskStageLayout,
+	"Parse Table":                   taskStageLayout,
+	"Parse Paragraphs":              taskStageLayout,
+	"Parse Formulas and Styles":     taskStageLayout,
+	"Remove Char Descent":           taskStageLayout,
+	"Extract Terms":                 taskStageTranslation,
+	"Translate Paragraphs":          taskStageTranslation,
+	"Typesetting":                   taskStageTypesetting,
+	"Add Fonts":                     taskStageTypesetting,
+	"Generate drawing instructions": taskStageTypesetting,
+	"Subset font":                   taskStageTypesetting,
+	"Save PDF":                      taskStageTypesetting,
+}
+
+// parseProgressWebhook 从表单字段构造进度回调订阅，未设置 URL 时返回 nil
+func parseProgressWebhook(form url.Values) (*ProgressWebhook, error) {
+	webhookURL := strings.TrimSpace(form.Get("progress_webhook"))
+	if webhookURL == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(webhookURL, "http://") && !strings.HasPrefix(webhookURL, "https://") {
+		return nil, fmt.Errorf("progress_webhook must be an http(s) URL")
+	}
+	everyPercent := strings.TrimSpace(form.Get("progress_every_percent"))
+	everySeconds := strings.TrimSpace(form.Get("progress_every_seconds"))
+	webhook := &ProgressWebhook{URL: webhookURL}
+	if everyPercent != "" {
+		n, err := strconv.Atoi(everyPercent)
+		if err != nil || n < 1 || n > 100 {
+			return nil, fmt.Errorf("progress_every_percent must be between 1 and 100")
+		}
+		webhook.EveryPercent = n
+	}
+	if everySeconds != "" {
+		n, err := strconv.Atoi(everySeconds)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("progress_every_seconds must be a positive integer")
+		}
+		webhook.EverySeconds = n
+	}
+	seen := make(map[int]bool)
+	for _, value := range strings.Split(form.Get("progress_milestones"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			return nil, fmt.Errorf("progress_milestones must be comma-separated percentages between 1 and 100")
+		}
+		if !seen[n] {
+			seen[n] = true
+			webhook.Milestones = append(webhook.Milestones, n)
+		}
+	}
+	sort.Ints(webhook.Milestones)
+	if value := strings.TrimSpace(form.Get("progress_on_stage")); value != "" {
+		onStage, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("progress_on_stage must be true or false")
+		}
+		webhook.OnStage = onStage
+	}
+	// 只订阅里程碑或阶段时不按间隔回调
+	if webhook.EveryPercent == 0 && webhook.EverySeconds == 0 && len(webhook.Milestones) == 0 && !webhook.OnStage {
+		webhook.EveryPercent = defaultProgressEveryPercent
+	}
+	return webhook, nil
+}
+
+// setForm 把订阅写回表单字段（重新提交、JSON 提交时使用）
+func (w *ProgressWebhook) setForm(form url.Values) {
+	form.Set("progress_webhook", w.URL)
+	if w.EveryPercent > 0 {
+		form.Set("progress_every_percent", strconv.Itoa(w.EveryPercent))
+	}
+	if w.EverySeconds > 0 {
+		form.Set("progress_every_seconds", strconv.Itoa(w.EverySeconds))
+	}
+	if len(w.Milestones) > 0 {
+		milestones := make([]string, len(w.Milestones))
+		for i, n := range w.Milestones {
+			milestones[i] = strconv.Itoa(n)
+		}
+		form.Set("progress_milestones", strings.Join(milestones, ","))
+	}
+	if w.OnStage {
+		form.Set("progress_on_stage", "true")
+	}
+}
+
+// parseProgressLine 从 babeldoc 的一行输出中解析总体进度百分比
+func parseProgressLine(line string) (int, bool) {
+	line = ansiEscapePattern.ReplaceAllString(line, "")
+	// 进度条刷新使用 \r，取最后一段
+	if i := strings.LastIndex(strings.TrimRight(line, "\r"), "\r"); i >= 0 {
+		line = line[i+1:]
+	}
+	for _, pattern := range []*regexp.Regexp{richProgressPattern, tqdmProgressPattern} {
+		if m := pattern.FindStringSubmatch(line); m != nil {
+			if n, err := strconv.Atoi(m[1]); err == nil && n <= 100 {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// parseStageLine 从 babeldoc 的一行输出中解析当前处理阶段所属的任务阶段
+func parseStageLine(line string) (string, bool) {
+	line = ansiEscapePattern.ReplaceAllString(line, "")
+	if i := strings.LastIndex(strings.TrimRight(line, "\r"), "\r"); i >= 0 {
+		line = line[i+1:]
+	}
+	if m := stageLinePattern.FindStringSubmatch(line); m != nil {
+		stage, ok := babeldocStages[m[1]]
+		return stage, ok
+	}
+	return "", false
+}
+
+// progressTracker 记录运行中任务的进度和阶段，写入数据库并按订阅设置发送回调
+type progressTracker struct {
+	task    *Task
+	webhook *ProgressWebhook
+
+	mu            sync.Mutex
+	progress      int
+	stage         string
+	lastNotified  int
+	nextMilestone int // 下一个未回调的里程碑在 webhook.Milestones 中的下标
+	lastRecorded  int // 最近一次记录为任务事件的进度
+	done          chan struct{}
+}
+
+func newProgressTracker(task *Task, webhook *ProgressWebhook) *progressTracker {
+	t := &progressTracker{
+		task:         task,
+		webhook:      webhook,
+		lastNotified: -1,
+		done:         make(chan struct{}),
+	}
+	if webhook != nil && webhook.EverySeconds > 0 {
+		go t.tick(time.Duration(webhook.EverySeconds) * time.Second)
+	}
+	return t
+}
+
+// update 记录新的进度，跨过百分比步长或里程碑时发送回调
+func (t *progressTracker) update(progress int) {
+	t.mu.Lock()
+	if progress <= t.progress {
+		t.mu.Unlock()
+		return
+	}
+	t.progress = progress
+	t.save()
+	publishTaskProgress(t.task.ID, progress)
+	record := progress/progressEventStep > t.lastRecorded/progressEventStep
+	if record {
+		t.lastRecorded = progress
+	}
+	var events []*ProgressEvent
+	if t.webhook != nil {
+		// 进度一次跨过多个里程碑时依次回调每一个
+		for ; t.nextMilestone < len(t.webhook.Milestones) && t.webhook.Milestones[t.nextMilestone] <= progress; t.nextMilestone++ {
+			event := t.event(progressEventMilestone)
+			event.Milestone = t.webhook.Milestones[t.nextMilestone]
+			events = append(events, event)
+		}
+		if t.webhook.EveryPercent > 0 && progress/t.webhook.EveryPercent > t.lastNotified/t.webhook.EveryPercent {
+			t.lastNotified = progress
+			events = append(events, t.event(progressEventProgress))
+		}
+	}
+	t.mu.Unlock()
+
+	if record {
+		recordTaskEvent(t.task.ID, eventTaskProgress, fmt.Sprintf("进度 %d%%", progress))
+	}
+	for _, event := range events {
+		t.send(event)
+	}
+}
+
+// updateStage 记录新的阶段，阶段只会前进（babeldoc 会重绘之前阶段的进度条）
+func (t *progressTracker) updateStage(stage string) {
+	t.mu.Lock()
+	if taskStageOrder[stage] <= taskStageOrder[t.stage] {
+		t.mu.Unlock()
+		return
+	}
+	t.stage = stage
+	t.save()
+	recordTaskEvent(t.task.ID, eventTaskStage, "进入阶段: "+stage)
+	var event *ProgressEvent
+	if t.webhook != nil && t.webhook.OnStage {
+		event = t.event(progressEventStage)
+	}
+	t.mu.Unlock()
+
+	if event != nil {
+		t.send(event)
+	}
+}
+
+// event 生成当前进度的回调内容，调用时需持有 t.mu
+func (t *progressTracker) event(kind string) *ProgressEvent {
+	return &ProgressEvent{
+		Event:     kind,
+		TaskID:    t.task.ID,
+		Status:    "running",
+		Progress:  t.progress,
+		Stage:     t.stage,
+		UpdatedAt: time.Now(),
+	}
+}
+
+// save 把进度和阶段写入数据库，调用时需持有 t.mu
+func (t *progressTracker) save() {
+	if _, err := execWithRetry(`UPDATE tasks SET progress = ?, stage = ? WHERE id = ? AND status = 'running'`,
+		t.progress, nullIfEmpty(t.stage), t.task.ID); err != nil {
+		log.Printf("无法保存任务 %s 的进度: %v", t.task.ID, err)
+	}
+}
+
+func (t *progressTracker) tick(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			t.lastNotified = t.progress
+			event := t.event(progressEventProgress)
+			t.mu.Unlock()
+			t.send(event)
+		}
+	}
+}
+
+// stop 停止定时回调
+func (t *progressTracker) stop() {
+	close(t.done)
+}
+
+func (t *progressTracker) send(event *ProgressEvent) {
+	body, _ := json.Marshal(event)
+
+	ctx, cancel := context.WithTimeout(context.Background(), progressWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("任务 %s 的进度回调失败: %v", t.task.ID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("任务 %s 的进度回调失败: %v", t.task.ID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("任务 %s 的进度回调返回 HTTP %d", t.task.ID, resp.StatusCode)
+	}
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 服务商探测配置：
+//
+//	PROVIDER_PROBE_INTERVAL  探测间隔（如 5m），未设置时不探测
+//
+// 探测请求为 GET {base_url}/models，不消耗 token。探测失败的服务商上的任务会被暂存，
+// 恢复可用后重新入队。
+var providerProbeInterval = parseDurationEnv("PROVIDER_PROBE_INTERVAL", 0)
+
+const (
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+	providerProbeTimeout = 15 * time.Second
+	envProviderName      = "env"
+)
+
+// ProviderStatus 服务商的探测结果
+type ProviderStatus struct {
+	Name       string     `json:"name"`
+	BaseURL    string     `json:"base_url"`
+	Model      string     `json:"model,omitempty"`
+	Available  bool       `json:"available"`
+	LatencyMs  int64      `json:"latency_ms,omitempty"`
+	StatusCode int        `json:"status_code,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CheckedAt  *time.Time `json:"checked_at,omitempty"`
+}
+
+type providerConfig struct {
+	name    string
+	baseURL string
+	apiKey  string
+	model   string
+}
+
+var (
+	providerMutex  sync.RWMutex
+	providerStatus = make(map[string]*ProviderStatus)
+)
+
+// configuredProviders 返回环境变量和各命名队列中配置的服务商
+func configuredProviders() []providerConfig {
+	var providers []providerConfig
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		providers = append(providers, providerConfig{
+			name:    envProviderName,
+			baseURL: envOrDefault("OPENAI_BASE_URL", defaultOpenAIBaseURL),
+			apiKey:  key,
+			model:   os.Getenv("OPENAI_MODEL"),
+		})
+	}
+	for _, qc := range queueConfigs {
+		if qc.OpenAIAPIKey == "" {
+			continue
+		}
+		baseURL := qc.OpenAIBaseURL
+		if baseURL == "" {
+			baseURL = defaultOpenAIBaseURL
+		}
+		providers = append(providers, providerConfig{
+			name:    qc.Name,
+			baseURL: baseURL,
+			apiKey:  qc.OpenAIAPIKey,
+			model:   qc.OpenAIModel,
+		})
+	}
+	return providers
+}
+
+// taskProviderName 返回任务使用的服务商名称，任务自带凭据时返回空字符串（不参与探测）
+func taskProviderName(task *Task) string {
+	if task.Params != "" {
+		var paramsMap map[string]string
+		if err := json.Unmarshal([]byte(task.Params), &paramsMap); err == nil && paramsMap["openai-api-key"] != "" {
+			return ""
+		}
+	}
+	if qc := findQueueConfig(task.Queue); qc != nil {
+		return queueProviderName(qc)
+	}
+	return envProviderName
+}
+
+// queueProviderName 返回队列使用的服务商名称：配置了凭据的队列以队列名为服务商，否则使用环境变量中的凭据
+func queueProviderName(qc *QueueConfig) string {
+	if qc.OpenAIAPIKey != "" {
+		return qc.Name
+	}
+	return envProviderName
+}
+
+// providerAvailable 返回服务商是否可用，未探测过的服务商视为可用
+func providerAvailable(name string) bool {
+	if name == "" {
+		return true
+	}
+	providerMutex.RLock()
+	defer providerMutex.RUnlock()
+	status, ok := providerStatus[name]
+	return !ok || status.Available
+}
+
+// providerProber 定期探测所有服务商
+func providerProber() {
+	if providerProbeInterval <= 0 {
+		return
+	}
+	for {
+		probeProviders()
+		time.Sleep(providerProbeInterval)
+	}
+}
+
+func probeProviders() {
+	recovered := false
+	for _, provider := range configuredProviders() {
+		status := probeProvider(provider)
+
+		providerMutex.Lock()
+		previous := providerStatus[provider.name]
+		providerStatus[provider.name] = status
+		providerMutex.Unlock()
+
+		if previous != nil && previous.Available != status.Available {
+			if status.Available {
+				log.Printf("服务商 %s 已恢复可用", provider.name)
+				recovered = true
+			} else {
+				log.Printf("服务商 %s 不可用: %s", provider.name, status.Error)
+			}
+		}
+	}
+	// 有服务商恢复时，将暂存的任务重新入队
+	if recovered {
+		scheduler.requeueHeld()
+	}
+}
+
+// probeProvider 请求 {base_url}/models，可连通且不是认证失败或 5xx 即视为可用
+func probeProvider(provider providerConfig) *ProviderStatus {
+	now := time.Now()
+	status := &ProviderStatus{
+		Name:      provider.name,
+		BaseURL:   provider.baseURL,
+		Model:     provider.model,
+		CheckedAt: &now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(provider.baseURL, "/")+"/models", nil)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	req.Header.Set("Authorization", "Bearer "+provider.apiKey)
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	status.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	resp.Body.Close()
+
+	status.StatusCode = resp.StatusCode
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		status.Error = "认证失败"
+	case resp.StatusCode >= 500:
+		status.Error = resp.Status
+	default:
+		status.Available = true
+	}
+	return status
+}
+
+// 服务商状态
+func providersHandler(w http.ResponseWriter, r *http.Request) {
+	providers := []*ProviderStatus{}
+	providerMutex.RLock()
+	for _, provider := range configuredProviders() {
+		if status, ok := providerStatus[provider.name]; ok {
+			providers = append(providers, status)
+			continue
+		}
+		// 尚未探测
+		providers = append(providers, &ProviderStatus{
+			Name:      provider.name,
+			BaseURL:   provider.baseURL,
+			Model:     provider.model,
+			Available: true,
+		})
+	}
+	providerMutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"probe_enabled": providerProbeInterval > 0,
+		"providers":     providers,
+	})
+}
@@ -0,0 +1,711 @@
+package server
+
+import (
+	"bufio"
+	"container/heap"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 队列配置：
+//
+//	QUEUE_BACKEND  memory（默认，进程内队列）、db（轮询共享的任务数据库）或 redis（多实例共享队列）
+//	DB_QUEUE_POLL_INTERVAL  db 队列查询排队中任务的间隔（默认 2s）
+//	REDIS_URL      Redis 地址，例如 redis://:password@redis:6379/0
+//	REDIS_QUEUE    Redis 列表键名（默认 babeldoc:tasks）
+//	NODE_ROLE      all（默认，同时提供 HTTP API 和执行任务）、api（只提供 HTTP API）、worker（只执行任务）
+//	QUEUES_CONFIG  命名队列配置文件（JSON），未设置时只有一个 default 队列
+//
+// 使用 db 或 redis 队列时，所有实例需共享同一个数据目录（上传文件、输出文件、日志和数据库）。
+const (
+	nodeRoleAll    = "all"
+	nodeRoleAPI    = "api"
+	nodeRoleWorker = "worker"
+)
+
+const defaultQueueName = "default"
+
+// QueueConfig 命名队列配置，每个队列有独立的 worker 数量和 OpenAI 凭据，
+// 任务根据提交时的 preset 路由到对应队列，未匹配时进入第一个队列
+type QueueConfig struct {
+	Name          string   `json:"name"`
+	Workers       int      `json:"workers"`
+	OpenAIAPIKey  string   `json:"openai_api_key,omitempty"`
+	OpenAIModel   string   `json:"openai_model,omitempty"`
+	OpenAIBaseURL string   `json:"openai_base_url,omitempty"`
+	Presets       []string `json:"presets,omitempty"`
+	Translator    string   `json:"translator,omitempty"` // babeldoc 或 mock，未设置时使用 TRANSLATOR
+
+	Windows        []string `json:"windows,omitempty"`         // 执行时段，例如 ["22:00-06:00"]，未设置时全天执行（见 windows.go）
+	WindowTimezone string   `json:"window_timezone,omitempty"` // 执行时段使用的时区，未设置时为本地时区
+
+	windows  []execWindow
+	location *time.Location
+}
+
+var (
+	queueConfigs []*QueueConfig
+	taskQueues   = make(map[string]TaskQueue)
+)
+
+// loadQueueConfigs 读取 QUEUES_CONFIG，未配置时返回只包含 default 队列的配置
+func loadQueueConfigs(defaultWorkers int) ([]*QueueConfig, error) {
+	path := os.Getenv("QUEUES_CONFIG")
+	if path == "" {
+		qc := &QueueConfig{Name: defaultQueueName, Workers: defaultWorkers}
+		return []*QueueConfig{qc}, qc.loadWindows()
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []*QueueConfig
+	if err := json.Unmarshal(content, &configs); err != nil {
+		return nil, fmt.Errorf("无法解析 %s: %v", path, err)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%s 中没有定义队列", path)
+	}
+
+	seen := make(map[string]bool)
+	for _, qc := range configs {
+		if qc.Name == "" {
+			return nil, fmt.Errorf("%s 中存在未命名的队列", path)
+		}
+		if seen[qc.Name] {
+			return nil, fmt.Errorf("%s 中队列名 %s 重复", path, qc.Name)
+		}
+		seen[qc.Name] = true
+		if qc.Workers <= 0 {
+			qc.Workers = 1
+		}
+		if qc.Translator != "" && qc.Translator != translatorBabeldoc && qc.Translator != translatorMock {
+			return nil, fmt.Errorf("%s 中队列 %s 的 translator 无效: %s", path, qc.Name, qc.Translator)
+		}
+		if err := qc.loadWindows(); err != nil {
+			return nil, fmt.Errorf("%s 中队列 %s: %v", path, qc.Name, err)
+		}
+	}
+	return configs, nil
+}
+
+// initTaskQueues 为每个命名队列创建任务队列
+func initTaskQueues() error {
+	for _, qc := range queueConfigs {
+		q, err := newTaskQueue(qc.Name)
+		if err != nil {
+			return fmt.Errorf("队列 %s: %v", qc.Name, err)
+		}
+		taskQueues[qc.Name] = q
+	}
+	return nil
+}
+
+// queueForPreset 返回 preset 对应的队列名，未匹配时返回第一个队列
+func queueForPreset(preset string) string {
+	if preset != "" {
+		for _, qc := range queueConfigs {
+			for _, p := range qc.Presets {
+				if p == preset {
+					return qc.Name
+				}
+			}
+		}
+	}
+	return queueConfigs[0].Name
+}
+
+// findQueueConfig 按名称查找队列配置
+func findQueueConfig(name string) *QueueConfig {
+	for _, qc := range queueConfigs {
+		if qc.Name == name {
+			return qc
+		}
+	}
+	return nil
+}
+
+// enqueueTask 将任务加入其所属的队列，队列不存在（例如配置已变更）时进入第一个队列
+func enqueueTask(task *Task) error {
+	return taskQueueFor(task).Enqueue(task)
+}
+
+// ackTask 确认任务已从其所属的队列中取出并处理完毕
+func ackTask(task *Task) {
+	if err := taskQueueFor(task).Ack(task); err != nil {
+		log.Printf("无法确认任务 %s 已出队: %v", task.ID, err)
+	}
+}
+
+// taskQueueFor 返回任务所属的队列，队列不存在时返回第一个队列
+func taskQueueFor(task *Task) TaskQueue {
+	q, ok := taskQueues[task.Queue]
+	if !ok {
+		q = taskQueues[queueConfigs[0].Name]
+	}
+	return q
+}
+
+// TaskQueue 任务队列
+type TaskQueue interface {
+	// Enqueue 将任务加入队列
+	Enqueue(task *Task) error
+	// Dequeue 阻塞直到取出一个任务，worker 为调用者的标识（见 heartbeat.go 的 WorkerID）
+	Dequeue(worker string) (*Task, error)
+	// Ack 确认取出的任务已执行结束或已放回队列，之后队列不再为其保留
+	Ack(task *Task) error
+	// Durable 表示队列内容在服务重启后是否仍然存在
+	Durable() bool
+}
+
+// newTaskQueue 根据 QUEUE_BACKEND 创建名为 name 的任务队列
+func newTaskQueue(name string) (TaskQueue, error) {
+	switch backend := os.Getenv("QUEUE_BACKEND"); backend {
+	case "", "memory":
+		return newMemoryQueue(), nil
+	case "db":
+		return newDBQueue(name), nil
+	case "redis":
+		redisURL := os.Getenv("REDIS_URL")
+		if redisURL == "" {
+			redisURL = "redis://localhost:6379/0"
+		}
+		key := os.Getenv("REDIS_QUEUE")
+		if key == "" {
+			key = "babeldoc:tasks"
+		}
+		if name != defaultQueueName {
+			key += ":" + name
+		}
+		return newRedisQueue(redisURL, key)
+	default:
+		return nil, fmt.Errorf("未知的 QUEUE_BACKEND: %s", backend)
+	}
+}
+
+// nodeRole 返回当前实例的角色
+func nodeRole() string {
+	switch role := os.Getenv("NODE_ROLE"); role {
+	case nodeRoleAPI, nodeRoleWorker:
+		return role
+	default:
+		return nodeRoleAll
+	}
+}
+
+// memoryQueue 进程内队列，重启后内容丢失。优先级高的任务先出队（见 sizeclass.go），同优先级先进先出
+type memoryQueue struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	items memoryQueueItems
+	seq   int64
+}
+
+type memoryQueueItem struct {
+	task     *Task
+	priority int
+	seq      int64
+}
+
+// memoryQueueItems 实现 heap.Interface
+type memoryQueueItems []memoryQueueItem
+
+func (h memoryQueueItems) Len() int { return len(h) }
+func (h memoryQueueItems) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h memoryQueueItems) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *memoryQueueItems) Push(x interface{}) { *h = append(*h, x.(memoryQueueItem)) }
+func (h *memoryQueueItems) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+func newMemoryQueue() *memoryQueue {
+	q := &memoryQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *memoryQueue) Enqueue(task *Task) error {
+	q.mu.Lock()
+	q.seq++
+	heap.Push(&q.items, memoryQueueItem{task: task, priority: taskPriority(task), seq: q.seq})
+	q.mu.Unlock()
+	q.cond.Signal()
+	return nil
+}
+
+func (q *memoryQueue) Dequeue(worker string) (*Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.items.Len() == 0 {
+		q.cond.Wait()
+	}
+	return heap.Pop(&q.items).(memoryQueueItem).task, nil
+}
+
+func (q *memoryQueue) Ack(task *Task) error {
+	return nil
+}
+
+func (q *memoryQueue) Durable() bool {
+	return false
+}
+
+// dbQueue 直接以数据库中排队中（queued）的任务作为队列，按间隔轮询，本实例入队时立即唤醒。
+// 多个进程可能取到同一个任务，由 processTask 领取时的状态转换保证只执行一次
+type dbQueue struct {
+	name string
+	wake chan struct{}
+
+	mu    sync.Mutex
+	taken map[string]int // 已交给本实例 worker、仍在排队中的任务（例如被调度器暂存）-> 当时的执行次数
+}
+
+var dbQueuePollInterval = parseDurationEnv("DB_QUEUE_POLL_INTERVAL", 2*time.Second)
+
+func newDBQueue(name string) *dbQueue {
+	return &dbQueue{name: name, wake: make(chan struct{}, 1), taken: make(map[string]int)}
+}
+
+func (q *dbQueue) Enqueue(task *Task) error {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *dbQueue) Dequeue(worker string) (*Task, error) {
+	for {
+		task, err := q.pick()
+		if err != nil {
+			return nil, err
+		}
+		if task != nil {
+			return task, nil
+		}
+		select {
+		case <-q.wake:
+		case <-time.After(dbQueuePollInterval):
+		}
+	}
+}
+
+// pick 返回属于本队列、优先级最高且最早提交的排队中任务，没有时返回 nil。
+// 所属队列已不存在（例如配置已变更）的任务归第一个队列
+func (q *dbQueue) pick() (*Task, error) {
+	rows, err := db.Query(`SELECT ` + taskColumns + ` FROM tasks WHERE status = 'queued' ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("无法查询排队中的任务: %v", err)
+	}
+	var candidates []*Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		queue := task.Queue
+		if findQueueConfig(queue) == nil {
+			queue = queueConfigs[0].Name
+		}
+		if queue == q.name {
+			candidates = append(candidates, task)
+		}
+	}
+	rows.Close()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var best *Task
+	queued := make(map[string]bool, len(candidates))
+	for _, task := range candidates {
+		queued[task.ID] = true
+		// 执行次数变化说明任务执行过后重新排队（重试、重新提交），需要再次交给 worker
+		if attempts, ok := q.taken[task.ID]; ok && attempts == task.Attempts {
+			continue
+		}
+		if best == nil || taskPriority(task) > taskPriority(best) {
+			best = task
+		}
+	}
+	// 已离开排队状态的任务不再需要记录
+	for id := range q.taken {
+		if !queued[id] {
+			delete(q.taken, id)
+		}
+	}
+	if best != nil {
+		q.taken[best.ID] = best.Attempts
+	}
+	return best, nil
+}
+
+// Ack 任务的状态保存在数据库中，无需确认
+func (q *dbQueue) Ack(task *Task) error {
+	return nil
+}
+
+func (q *dbQueue) Durable() bool {
+	return true
+}
+
+// redisQueue 基于 Redis 列表的共享队列，列表中只保存任务ID，
+// 出队时从数据库读取最新的任务记录。每个优先级使用一个列表（优先级 0 为 key 本身），出队时按优先级从高到低检查。
+//
+// 出队的任务ID原子地移入该 worker 的处理中列表（key:processing:<worker>），任务执行结束后才删除（Ack），
+// worker 在执行期间崩溃时任务ID仍留在 Redis 中，由下次启动的实例放回队列（见 recoverDurableTasks）
+type redisQueue struct {
+	addr     string
+	password string
+	dbIndex  int
+	key      string
+
+	mu         sync.Mutex            // 保护以下字段
+	push       *redisConn            // 入队和确认使用的连接
+	conns      map[string]*redisConn // worker -> 该 worker 出队专用的连接，阻塞等待时不影响其他 worker
+	processing map[string]string     // 已出队、尚未确认的任务ID -> 所在的处理中列表
+}
+
+// redisBlockTimeout 只有一个优先级时阻塞等待的时长；有多个优先级时只能阻塞在其中一个列表上，
+// 缩短为 redisPriorityBlockTimeout，让其他列表中新到的任务不必等待太久
+const (
+	redisBlockTimeout         = "30"
+	redisPriorityBlockTimeout = "1"
+)
+
+func newRedisQueue(rawURL, key string) (*redisQueue, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" {
+		return nil, fmt.Errorf("无效的 REDIS_URL: %s", rawURL)
+	}
+	q := &redisQueue{
+		addr:       u.Host,
+		key:        key,
+		conns:      make(map[string]*redisConn),
+		processing: make(map[string]string),
+	}
+	if !strings.Contains(q.addr, ":") {
+		q.addr += ":6379"
+	}
+	if u.User != nil {
+		q.password, _ = u.User.Password()
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if q.dbIndex, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("无效的 Redis 数据库编号: %s", path)
+		}
+	}
+
+	// 启动时检查连通性
+	conn, err := q.dial()
+	if err != nil {
+		return nil, err
+	}
+	q.push = conn
+	return q, nil
+}
+
+func (q *redisQueue) dial() (*redisConn, error) {
+	nc, err := net.DialTimeout("tcp", q.addr, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("无法连接 Redis %s: %v", q.addr, err)
+	}
+	conn := &redisConn{conn: nc, r: bufio.NewReader(nc)}
+	if q.password != "" {
+		if _, err := conn.do("AUTH", q.password); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	if q.dbIndex != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(q.dbIndex)); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// pushDo 在共享连接上执行一条命令，连接出错时关闭，下次调用重新建立
+func (q *redisQueue) pushDo(args ...string) (interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.push == nil {
+		conn, err := q.dial()
+		if err != nil {
+			return nil, err
+		}
+		q.push = conn
+	}
+	reply, err := q.push.do(args...)
+	if err != nil {
+		q.push.conn.Close()
+		q.push = nil
+	}
+	return reply, err
+}
+
+func (q *redisQueue) Enqueue(task *Task) error {
+	_, err := q.pushDo("LPUSH", q.priorityKey(taskPriority(task)), task.ID)
+	return err
+}
+
+// workerConn 返回 worker 出队专用的连接，没有时新建
+func (q *redisQueue) workerConn(worker string) (*redisConn, error) {
+	q.mu.Lock()
+	conn := q.conns[worker]
+	q.mu.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+	conn, err := q.dial()
+	if err != nil {
+		return nil, err
+	}
+	q.mu.Lock()
+	q.conns[worker] = conn
+	q.mu.Unlock()
+	return conn, nil
+}
+
+// closeWorkerConn 关闭出错的连接，下次出队时重新建立
+func (q *redisQueue) closeWorkerConn(worker string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if conn := q.conns[worker]; conn != nil {
+		conn.conn.Close()
+		delete(q.conns, worker)
+	}
+}
+
+// Dequeue 将任务ID从队列移入 worker 的处理中列表并返回任务，任务执行结束后需要调用 Ack
+func (q *redisQueue) Dequeue(worker string) (*Task, error) {
+	conn, err := q.workerConn(worker)
+	if err != nil {
+		return nil, err
+	}
+	processing := q.processingKey(worker)
+	for {
+		taskID, err := q.move(conn, processing)
+		if err != nil {
+			q.closeWorkerConn(worker)
+			return nil, err
+		}
+		if taskID == "" {
+			// 超时，继续等待
+			continue
+		}
+		task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, taskID))
+		if err == sql.ErrNoRows {
+			// 任务在排队期间已被删除
+			conn.do("LREM", processing, "1", taskID)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("无法加载任务 %s: %v", taskID, err)
+		}
+		q.mu.Lock()
+		q.processing[taskID] = processing
+		q.mu.Unlock()
+		return task, nil
+	}
+}
+
+// move 按优先级从高到低取出一个任务ID放入 processing 列表，队列为空时阻塞等待，超时返回空字符串
+func (q *redisQueue) move(conn *redisConn, processing string) (string, error) {
+	priorities := sizeClassPriorities()
+	timeout := redisBlockTimeout
+	if len(priorities) > 1 {
+		for _, priority := range priorities {
+			reply, err := conn.do("RPOPLPUSH", q.priorityKey(priority), processing)
+			if err != nil {
+				return "", err
+			}
+			if taskID, ok := reply.(string); ok {
+				return taskID, nil
+			}
+		}
+		timeout = redisPriorityBlockTimeout
+	}
+	// 阻塞在最后（优先级最低）的列表上，只有一个优先级时即 key 本身
+	reply, err := conn.do("BRPOPLPUSH", q.priorityKey(priorities[len(priorities)-1]), processing, timeout)
+	if err != nil {
+		return "", err
+	}
+	taskID, _ := reply.(string)
+	return taskID, nil
+}
+
+// Ack 将任务ID从出队时的处理中列表删除
+func (q *redisQueue) Ack(task *Task) error {
+	q.mu.Lock()
+	processing, ok := q.processing[task.ID]
+	delete(q.processing, task.ID)
+	q.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	_, err := q.pushDo("LREM", processing, "1", task.ID)
+	return err
+}
+
+// requeueProcessing 将已停止的 worker 留在处理中列表的任务放回队列头部，alive 为仍在运行的 worker。
+// 只放回仍在排队中的任务（中断的 running 任务需先重置为 queued），返回放回的任务ID
+func (q *redisQueue) requeueProcessing(alive map[string]bool) (map[string]bool, error) {
+	prefix := q.processingKey("")
+	var lists []string
+	cursor := "0"
+	for {
+		reply, err := q.pushDo("SCAN", cursor, "MATCH", prefix+"*", "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 2 {
+			return nil, errors.New("redis: 无法解析 SCAN 的响应")
+		}
+		cursor, _ = items[0].(string)
+		keys, _ := items[1].([]interface{})
+		for _, key := range keys {
+			if list, ok := key.(string); ok && !alive[strings.TrimPrefix(list, prefix)] {
+				lists = append(lists, list)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+
+	requeued := make(map[string]bool)
+	for _, list := range lists {
+		reply, err := q.pushDo("LRANGE", list, "0", "-1")
+		if err != nil {
+			return requeued, err
+		}
+		ids, _ := reply.([]interface{})
+		for _, item := range ids {
+			taskID, _ := item.(string)
+			if taskID == "" || requeued[taskID] {
+				continue
+			}
+			task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, taskID))
+			if err != nil || task.Status != "queued" {
+				continue
+			}
+			// 放在列表的出队端，先于之后提交的任务执行
+			if _, err := q.pushDo("RPUSH", q.priorityKey(taskPriority(task)), taskID); err != nil {
+				return requeued, err
+			}
+			requeued[taskID] = true
+		}
+		if _, err := q.pushDo("DEL", list); err != nil {
+			return requeued, err
+		}
+	}
+	return requeued, nil
+}
+
+// priorityKey 返回优先级对应的列表键名
+func (q *redisQueue) priorityKey(priority int) string {
+	if priority == 0 {
+		return q.key
+	}
+	return q.key + ":p" + strconv.Itoa(priority)
+}
+
+// processingKey 返回 worker 的处理中列表键名
+func (q *redisQueue) processingKey(worker string) string {
+	return q.key + ":processing:" + worker
+}
+
+func (q *redisQueue) Durable() bool {
+	return true
+}
+
+// redisConn 最小化的 RESP 协议客户端，只支持本服务用到的命令
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: 空响应")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New("redis: " + line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: 无法解析的响应 %q", line)
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// 卡住任务清理配置：
+//
+//	STUCK_TASK_TIMEOUT  running 状态的任务超过该时长没有任何日志输出时视为卡住（如 2h），未设置时不检查
+//
+// 本实例正在执行的任务会被终止；找不到执行进程的任务（例如 worker 崩溃）直接标记为失败。
+var stuckTaskTimeout = parseDurationEnv("STUCK_TASK_TIMEOUT", 0)
+
+const reaperInterval = time.Minute
+
+// 进程被终止的原因
+const (
+	killReasonStuck   = "stuck"   // 被清理器终止
+	killReasonTimeout = "timeout" // 超过规模分级的执行超时（见 sizeclass.go）
+)
+
+// runningProcess 本实例正在执行的 babeldoc 进程
+type runningProcess struct {
+	cmd    *exec.Cmd
+	killed string // 被终止的原因，未被终止时为空
+}
+
+// runningProcesses 任务ID -> 执行进程，由 tasksMutex 保护
+var runningProcesses = make(map[string]*runningProcess)
+
+func registerProcess(taskID string, cmd *exec.Cmd) {
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+	runningProcesses[taskID] = &runningProcess{cmd: cmd}
+}
+
+// unregisterProcess 移除进程记录，返回该进程被终止的原因，未被终止时返回空字符串
+func unregisterProcess(taskID string) string {
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+	proc, ok := runningProcesses[taskID]
+	delete(runningProcesses, taskID)
+	if !ok {
+		return ""
+	}
+	return proc.killed
+}
+
+// killProcess 以 reason 终止本实例中任务的执行进程，进程不在本实例时返回 false
+func killProcess(taskID, reason string) bool {
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+	proc, ok := runningProcesses[taskID]
+	if !ok || proc.killed != "" {
+		return ok
+	}
+	proc.killed = reason
+	if proc.cmd.Process != nil {
+		proc.cmd.Process.Kill()
+	}
+	return true
+}
+
+// stuckTaskReaper 定期检查卡住的任务
+func stuckTaskReaper() {
+	if stuckTaskTimeout <= 0 {
+		return
+	}
+	for {
+		time.Sleep(reaperInterval)
+		reapStuckTasks()
+	}
+}
+
+func reapStuckTasks() {
+	rows, err := db.Query(`SELECT ` + taskColumns + ` FROM tasks WHERE status = 'running'`)
+	if err != nil {
+		log.Printf("无法查询运行中的任务: %v", err)
+		return
+	}
+	var tasks []*Task
+	for rows.Next() {
+		if task, err := scanTask(rows); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	rows.Close()
+
+	for _, task := range tasks {
+		lastActivity := task.CreatedAt
+		if task.StartedAt != nil {
+			lastActivity = *task.StartedAt
+		}
+		if modTime, ok := taskLogModTime(task.ID); ok && modTime.After(lastActivity) {
+			lastActivity = modTime
+		}
+		if time.Since(lastActivity) < stuckTaskTimeout {
+			continue
+		}
+
+		log.Printf("任务 %s 已超过 %s 没有活动，判定为卡住", task.ID, stuckTaskTimeout)
+		// 进程在本实例中：终止进程，由 processTask 负责标记失败
+		if killProcess(task.ID, killReasonStuck) {
+			continue
+		}
+		reapOrphanTask(task)
+	}
+}
+
+// reapOrphanTask 将找不到执行进程的任务标记为失败并清理临时输出
+func reapOrphanTask(task *Task) {
+	completedAt := time.Now()
+	errorMsg := "任务卡住或执行进程已退出（超过 " + stuckTaskTimeout.String() + " 无活动）"
+	// 其他实例可能已经处理
+	if err := transitionTask(task, "failed", "completed_at = ?, error = ?", completedAt, errorMsg); err != nil {
+		return
+	}
+	task.CompletedAt = &completedAt
+	task.Error = errorMsg
+	os.RemoveAll(filepath.Join(outputDir, task.ID))
+
+	go runPostTaskHooks(task)
+	go sendTaskNotification(task)
+	go sendTaskCallback(task)
+	go notifyFollowers(task)
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 通过 URL 提交：提交时用 file_url 代替上传文件，由服务端下载 PDF。
+//
+//	REMOTE_FETCH_TIMEOUT        下载的总超时时间（默认 60s）
+//	REMOTE_FETCH_ALLOW_PRIVATE  为 true 时允许下载内网和本机地址（默认拒绝）
+//
+// 只支持 HTTPS，文件大小上限与上传相同，内容必须是 PDF。
+var (
+	remoteFetchTimeout      = parseDurationEnv("REMOTE_FETCH_TIMEOUT", 60*time.Second)
+	remoteFetchAllowPrivate = os.Getenv("REMOTE_FETCH_ALLOW_PRIVATE") == "true"
+)
+
+const remoteFetchMaxRedirects = 5
+
+var errPrivateAddress = errors.New("refusing to fetch from a private or loopback address")
+
+var remoteFetchClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: checkRemoteAddress,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= remoteFetchMaxRedirects {
+			return fmt.Errorf("too many redirects")
+		}
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to non-HTTPS URL is not allowed")
+		}
+		return nil
+	},
+}
+
+// checkRemoteAddress 在建立连接前检查目标地址，防止通过 file_url 访问内网服务（包括 DNS 重绑定）
+func checkRemoteAddress(network, address string, _ syscall.RawConn) error {
+	if remoteFetchAllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// fetchRemotePDF 下载远程 PDF 到临时文件，返回文件及文件名；调用方负责关闭并删除临时文件
+func fetchRemotePDF(ctx context.Context, rawURL string) (*os.File, string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, "", fmt.Errorf("file_url must be an https URL")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, remoteFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid file_url: %v", err)
+	}
+	req.Header.Set("Accept", "application/pdf")
+	resp, err := remoteFetchClient.Do(req)
+	if err != nil {
+		return nil, "", newAPIError(http.StatusBadRequest, codeRemoteFetchFailed, "failed to fetch file_url: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", newAPIError(http.StatusBadRequest, codeRemoteFetchFailed, "failed to fetch file_url: remote server returned %s", resp.Status)
+	}
+	if resp.ContentLength > maxUploadSize {
+		return nil, "", errFileTooLarge()
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != "application/pdf" && mediaType != "application/octet-stream" {
+		return nil, "", newAPIError(http.StatusBadRequest, codeUnsupportedFile, "file_url does not point to a PDF (Content-Type: %s)", mediaType)
+	}
+
+	tmp, err := os.CreateTemp("", "babeldoc-fetch-*.pdf")
+	if err != nil {
+		return nil, "", newAPIError(http.StatusInternalServerError, codeInternal, "Error creating file")
+	}
+	fail := func(err error) (*os.File, string, error) {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, "", err
+	}
+
+	n, err := io.Copy(tmp, io.LimitReader(resp.Body, maxUploadSize+1))
+	if err != nil {
+		return fail(newAPIError(http.StatusBadRequest, codeRemoteFetchFailed, "failed to fetch file_url: %v", err))
+	}
+	if n > maxUploadSize {
+		return fail(errFileTooLarge())
+	}
+
+	// 检查 PDF 文件头
+	magic := make([]byte, 5)
+	if _, err := tmp.ReadAt(magic, 0); err != nil || !bytes.Equal(magic, []byte("%PDF-")) {
+		return fail(newAPIError(http.StatusBadRequest, codeUnsupportedFile, "file_url does not point to a PDF"))
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fail(newAPIError(http.StatusInternalServerError, codeInternal, "Error reading file"))
+	}
+	return tmp, remoteFileName(resp), nil
+}
+
+// remoteFileName 从 Content-Disposition 或最终 URL 的路径中取文件名
+func remoteFileName(resp *http.Response) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = path.Base(resp.Request.URL.Path)
+	}
+	name = safeFileName(strings.TrimSpace(name))
+	if name == "" || name == "." {
+		name = "document"
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".pdf") {
+		name += ".pdf"
+	}
+	return name
+}
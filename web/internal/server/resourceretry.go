@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 资源不足时的重试：babeldoc 因内存不足失败（输出 MemoryError 等，或进程被 OOM killer 终止）时，
+// 降低任务内的并发（pool-max-workers 减半，未设置时为 1）并把文档拆分为较小的部分（max-pages-per-part）自动重试一次，
+// 调整后的参数写回任务的 params，调整记录保存在任务的 resource_retry 上（只在任务详情中返回）。
+// 这次重试不受 TASK_MAX_ATTEMPTS 限制，已经调整过一次的任务再次失败时按普通失败处理。
+//
+//	RESOURCE_RETRY                 是否启用（默认 true）
+//	RESOURCE_RETRY_PAGES_PER_PART  重试时每部分的页数（默认 20，已设置 max-pages-per-part 时取其一半）
+var (
+	resourceRetryEnabled      = os.Getenv("RESOURCE_RETRY") != "false"
+	resourceRetryPagesPerPart = max(parseIntEnv("RESOURCE_RETRY_PAGES_PER_PART", 20), 1)
+)
+
+// resourceExhaustionPatterns 表明内存不足的输出关键字（小写）
+var resourceExhaustionPatterns = []string{
+	"memoryerror",
+	"out of memory",
+	"cannot allocate memory",
+	"std::bad_alloc",
+	"oom-kill",
+}
+
+// ResourceRetry 资源不足时调整参数后的重试
+type ResourceRetry struct {
+	Reason   string            `json:"reason"`             // 判定为资源不足的原因
+	Params   map[string]string `json:"params"`             // 调整后的参数
+	Previous map[string]string `json:"previous,omitempty"` // 调整前的值，原来未设置的参数不出现
+	At       time.Time         `json:"at"`
+}
+
+// isResourceExhaustionOutput 判断 babeldoc 的一行输出是否表明内存不足
+func isResourceExhaustionOutput(line string) bool {
+	line = strings.ToLower(line)
+	for _, p := range resourceExhaustionPatterns {
+		if strings.Contains(line, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// killedBySignal 进程是否被 SIGKILL 终止（服务自身终止卡住或超时的进程时另行处理，其余情况通常是 OOM killer）
+func killedBySignal(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "signal: killed")
+}
+
+// reducedParams 返回降低并发、拆分页数后的参数，以及被修改参数的原值
+func reducedParams(params map[string]string) (map[string]string, map[string]string) {
+	adjusted := make(map[string]string, len(params)+2)
+	for key, value := range params {
+		adjusted[key] = value
+	}
+	previous := make(map[string]string)
+
+	workers := 1
+	if n, err := strconv.Atoi(params["pool-max-workers"]); err == nil && n > 1 {
+		workers = n / 2
+	}
+	pages := resourceRetryPagesPerPart
+	if n, err := strconv.Atoi(params["max-pages-per-part"]); err == nil && n > 0 {
+		pages = max(n/2, 1)
+	}
+	for key, value := range map[string]string{"pool-max-workers": strconv.Itoa(workers), "max-pages-per-part": strconv.Itoa(pages)} {
+		if old, ok := params[key]; ok {
+			previous[key] = old
+		}
+		adjusted[key] = value
+	}
+	return adjusted, previous
+}
+
+// retryWithReducedResources 资源不足时调整参数并安排重试，返回 false 表示不重试（未启用或已经调整过）
+func retryWithReducedResources(task *Task, reason, errorMsg string, writeLog func(string)) bool {
+	if !resourceRetryEnabled || loadResourceRetry(task.ID) != nil {
+		return false
+	}
+	if r := []rune(reason); len(r) > 200 {
+		reason = string(r[:200]) + "…"
+	}
+	params, previous := reducedParams(task.Params.Map())
+	retry := &ResourceRetry{
+		Reason:   reason,
+		Params:   map[string]string{"pool-max-workers": params["pool-max-workers"], "max-pages-per-part": params["max-pages-per-part"]},
+		Previous: previous,
+		At:       time.Now(),
+	}
+	paramsJSON, _ := json.Marshal(params)
+	retryJSON, _ := json.Marshal(retry)
+	if _, err := execWithRetry(`UPDATE tasks SET params = ?, resource_retry = ? WHERE id = ?`, string(paramsJSON), string(retryJSON), task.ID); err != nil {
+		log.Printf("无法记录任务 %s 的资源重试参数: %v", task.ID, err)
+		return false
+	}
+	task.Params = TaskParams(paramsJSON)
+
+	writeLog(fmt.Sprintf("==> 疑似内存不足（%s），降低并发后重试：pool-max-workers=%s，max-pages-per-part=%s\n",
+		reason, retry.Params["pool-max-workers"], retry.Params["max-pages-per-part"]))
+	recordTaskEvent(task.ID, "task.resource_retry", fmt.Sprintf("疑似内存不足（%s），以 pool-max-workers=%s、max-pages-per-part=%s 重试",
+		reason, retry.Params["pool-max-workers"], retry.Params["max-pages-per-part"]))
+	retryTask(task, errorMsg, taskRetryBackoff)
+	return true
+}
+
+// loadResourceRetry 读取任务的资源重试记录，没有时返回 nil
+func loadResourceRetry(taskID string) *ResourceRetry {
+	var data *string
+	if err := db.QueryRow(`SELECT resource_retry FROM tasks WHERE id = ?`, taskID).Scan(&data); err != nil || data == nil || *data == "" {
+		return nil
+	}
+	var retry ResourceRetry
+	if err := json.Unmarshal([]byte(*data), &retry); err != nil {
+		return nil
+	}
+	return &retry
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// 结果保留配置：
+//
+//	RESULT_RETENTION  已结束任务（成功或失败）保留的时长，超过后删除任务及其文件；未设置时永久保留
+//	INPUT_RETENTION   成功任务的源文件保留的时长，超过后只删除源文件，输出文件按 RESULT_RETENTION 保留；
+//	                  0 表示成功后（任务钩子执行完）立即删除，未设置时与任务一起删除
+//	RETENTION_CHECK_INTERVAL  检查过期任务和源文件的间隔（默认 10m）
+//
+// 启用后列表和详情接口会返回 expires_at，客户端可据此提醒用户及时下载。
+// 提交者在个人策略中设置了保留时长的任务（retention_seconds）按该时长清理（见 usersettings.go）。
+// 失败的任务保留源文件，以便重试或克隆。源文件删除后任务带有 input_removed_at，克隆返回 INPUT_FILE_GONE。
+var (
+	resultRetention        = parseDurationEnv("RESULT_RETENTION", 0)
+	inputRetention         = parseInputRetention()
+	retentionCheckInterval = parseDurationEnv("RETENTION_CHECK_INTERVAL", 10*time.Minute)
+)
+
+// parseInputRetention 解析 INPUT_RETENTION，未设置或无效时返回 -1（不单独删除源文件）
+func parseInputRetention() time.Duration {
+	value := os.Getenv("INPUT_RETENTION")
+	if value == "" {
+		return -1
+	}
+	if value == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("无效的 INPUT_RETENTION %q，源文件与任务一起删除", value)
+		return -1
+	}
+	return d
+}
+
+// taskRetention 返回任务结束后的保留时长，0 表示永久保留
+func taskRetention(task *Task) time.Duration {
+	if task.RetentionSeconds > 0 {
+		return time.Duration(task.RetentionSeconds) * time.Second
+	}
+	return resultRetention
+}
+
+// taskExpiresAt 返回任务结果的过期时间，未启用保留策略或任务未结束时返回 nil
+func taskExpiresAt(task *Task) *time.Time {
+	retention := taskRetention(task)
+	if retention <= 0 || task.CompletedAt == nil {
+		return nil
+	}
+	expiresAt := task.CompletedAt.Add(retention)
+	return &expiresAt
+}
+
+// retentionWorker 定期清理已过期的任务
+func retentionWorker() {
+	if resultRetention > 0 {
+		log.Printf("已启用结果保留策略，已结束的任务将在 %s 后清理", resultRetention)
+	}
+	if inputRetention >= 0 {
+		log.Printf("已启用源文件保留策略，成功任务的源文件将在 %s 后删除", inputRetention)
+	}
+
+	for {
+		cleanupExpiredTasks()
+		cleanupExpiredInputs()
+		time.Sleep(retentionCheckInterval)
+	}
+}
+
+// applyInputRetention INPUT_RETENTION 为 0 时在任务成功后立即删除源文件
+func applyInputRetention(task *Task) {
+	if inputRetention != 0 || task.Status != "success" || task.InputRemovedAt != nil {
+		return
+	}
+	removeExpiredInput(task.ID, "任务成功，已删除源文件")
+}
+
+// cleanupExpiredInputs 删除成功超过 INPUT_RETENTION 的任务的源文件（INPUT_RETENTION 为 0 时兜底处理立即删除失败的任务）
+func cleanupExpiredInputs() {
+	if inputRetention < 0 {
+		return
+	}
+	ids := expiredTaskIDs(`SELECT id FROM tasks WHERE status = 'success' AND input_removed_at IS NULL AND completed_at < ?`,
+		time.Now().Add(-inputRetention))
+	for _, id := range ids {
+		removeExpiredInput(id, fmt.Sprintf("任务成功已超过 %s，已删除源文件", inputRetention))
+	}
+}
+
+func removeExpiredInput(taskID, message string) {
+	// 重新读取，源文件可能已按个人策略删除
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, taskID))
+	if err != nil || task.InputRemovedAt != nil {
+		return
+	}
+	if err := removeTaskInput(task); err != nil {
+		log.Printf("无法删除任务 %s 的源文件: %v", task.ID, err)
+		return
+	}
+	log.Printf("已删除任务 %s 的源文件", task.ID)
+	recordTaskEvent(task.ID, "retention.input_deleted", message)
+}
+
+func cleanupExpiredTasks() {
+	var ids []string
+	if resultRetention > 0 {
+		ids = expiredTaskIDs(`SELECT id FROM tasks WHERE status IN ('success', 'failed') AND retention_seconds IS NULL AND completed_at < ?`,
+			time.Now().Add(-resultRetention))
+	}
+	// 个人策略的保留时长不少于 USER_RETENTION_MIN，先按该时长筛选，再逐个比较
+	now := time.Now()
+	rows, err := db.Query(`SELECT id, completed_at, retention_seconds FROM tasks
+		WHERE status IN ('success', 'failed') AND retention_seconds IS NOT NULL AND completed_at < ?`, now.Add(-userRetentionMin))
+	if err != nil {
+		log.Printf("无法查询过期任务: %v", err)
+	} else {
+		for rows.Next() {
+			var id string
+			var completedAt time.Time
+			var seconds int64
+			if err := rows.Scan(&id, &completedAt, &seconds); err == nil && completedAt.Add(time.Duration(seconds)*time.Second).Before(now) {
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+	}
+
+	for _, id := range ids {
+		if err := deleteTask(id, 0); err != nil {
+			log.Printf("无法清理过期任务 %s: %v", id, err)
+			continue
+		}
+		log.Printf("已清理过期任务 %s", id)
+	}
+}
+
+// expiredTaskIDs 查询过期任务的 ID
+func expiredTaskIDs(query string, args ...interface{}) []string {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("无法查询过期任务: %v", err)
+		return nil
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInputRetention(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", -1},
+		{"0", 0},
+		{"0s", 0},
+		{"24h", 24 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"-1h", -1},
+		{"7d", -1},
+		{"abc", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("INPUT_RETENTION", tt.value)
+			if got := parseInputRetention(); got != tt.want {
+				t.Errorf("parseInputRetention() with %q = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDurationEnv(t *testing.T) {
+	const def = 10 * time.Minute
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", def},
+		{"1s", time.Second},
+		{"90m", 90 * time.Minute},
+		{"720h", 720 * time.Hour},
+		{"0", def},
+		{"-5m", def},
+		{"30", def},
+		{"bad", def},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("RETENTION_CHECK_INTERVAL", tt.value)
+			if got := parseDurationEnv("RETENTION_CHECK_INTERVAL", def); got != tt.want {
+				t.Errorf("parseDurationEnv() with %q = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskExpiresAt(t *testing.T) {
+	saved := resultRetention
+	defer func() { resultRetention = saved }()
+
+	completedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name             string
+		resultRetention  time.Duration
+		retentionSeconds int64
+		completedAt      *time.Time
+		want             time.Duration // 相对 completedAt，0 表示不过期
+	}{
+		{"disabled", 0, 0, &completedAt, 0},
+		{"not completed", 24 * time.Hour, 0, nil, 0},
+		{"result retention", 24 * time.Hour, 0, &completedAt, 24 * time.Hour},
+		{"task retention", 24 * time.Hour, 3600, &completedAt, time.Hour},
+		{"task retention without global", 0, 3600, &completedAt, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resultRetention = tt.resultRetention
+			task := &Task{RetentionSeconds: tt.retentionSeconds, CompletedAt: tt.completedAt}
+			got := taskExpiresAt(task)
+			if tt.want == 0 {
+				if got != nil {
+					t.Errorf("taskExpiresAt() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || !got.Equal(completedAt.Add(tt.want)) {
+				t.Errorf("taskExpiresAt() = %v, want %v", got, completedAt.Add(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// 重试配置：
+//
+//	TASK_MAX_ATTEMPTS     任务最多执行次数（含首次），默认 1 即不重试
+//	TASK_RETRY_BACKOFF    首次重试前的等待时间，之后每次翻倍（默认 30s）
+//	TASK_RETRY_MAX_DELAY  单次等待时间上限（默认 30m）
+//	TASK_RETRY_PATTERNS   判定为临时错误的输出关键字，多个用英文分号分隔（不区分大小写），覆盖默认列表
+//
+// 只有 babeldoc 执行失败且输出中包含临时错误关键字（网络错误、429 等）时才会重试。
+var (
+	taskMaxAttempts   = parseIntEnv("TASK_MAX_ATTEMPTS", 1)
+	taskRetryBackoff  = parseDurationEnv("TASK_RETRY_BACKOFF", 30*time.Second)
+	taskRetryMaxDelay = parseDurationEnv("TASK_RETRY_MAX_DELAY", 30*time.Minute)
+	transientPatterns = loadTransientPatterns()
+)
+
+var defaultTransientPatterns = []string{
+	"429",
+	"rate limit",
+	"ratelimit",
+	"too many requests",
+	"timed out",
+	"timeout",
+	"connection reset",
+	"connection refused",
+	"connection error",
+	"connectionerror",
+	"temporarily unavailable",
+	"service unavailable",
+	"bad gateway",
+	"502",
+	"503",
+	"504",
+}
+
+func loadTransientPatterns() []string {
+	value := os.Getenv("TASK_RETRY_PATTERNS")
+	if value == "" {
+		return defaultTransientPatterns
+	}
+	var patterns []string
+	for _, p := range strings.Split(value, ";") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// isTransientOutput 判断 babeldoc 的一行输出是否表明发生了临时错误
+func isTransientOutput(line string) bool {
+	line = strings.ToLower(line)
+	for _, p := range transientPatterns {
+		if strings.Contains(line, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay 返回第 attempt 次执行失败后的等待时间（指数退避）
+func retryDelay(attempt int) time.Duration {
+	delay := taskRetryBackoff
+	for i := 1; i < attempt && delay < taskRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > taskRetryMaxDelay {
+		delay = taskRetryMaxDelay
+	}
+	return delay
+}
+
+// canRetry 返回任务是否还有剩余的重试次数
+func canRetry(task *Task) bool {
+	return task.Attempts < taskMaxAttemptsFor(task)
+}
+
+// retryTask 将任务改为计划执行，在退避时间后由 scheduledDispatcher 重新入队
+func retryTask(task *Task, errorMsg string, delay time.Duration) {
+	runAt := time.Now().Add(delay)
+	if !applyTransition(task, "scheduled", "started_at = NULL, run_at = ?, error = ?, progress = 0, stage = NULL", runAt, errorMsg) {
+		return
+	}
+	task.StartedAt = nil
+	task.Progress, task.Stage = 0, ""
+	task.RunAt = &runAt
+	task.Error = errorMsg
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// apiVersionPrefix 当前 API 版本的路径前缀
+const apiVersionPrefix = "/api/v1"
+
+// route 一条 API 路由，注册为 net/http.ServeMux 的「方法 路径」模式，路径参数形如 {id}；
+// legacy 为旧版（未加版本前缀）的路径，作为废弃别名继续提供
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	legacy  string
+}
+
+func apiRoutes() []route {
+	return []route{
+		{http.MethodPost, "/tasks", limitUploads(submitTaskHandler), "/api/tasks/submit"},
+		{http.MethodGet, "/tasks", listTasksHandler, "/api/tasks/list"},
+		{http.MethodGet, "/tasks/export", exportTasksHandler, ""},
+		{http.MethodGet, "/tasks/export.bib", exportBibTeXHandler, ""},
+		{http.MethodPost, "/tasks/download-batch", batchDownloadHandler, "/api/tasks/download-batch"},
+		{http.MethodPost, "/tasks/delete", batchDeleteHandler, ""},
+		{http.MethodGet, "/tasks/{id}", taskDetailHandler, "/api/tasks/detail/{id}"},
+		{http.MethodPatch, "/tasks/{id}", updateTaskHandler, ""},
+		{http.MethodDelete, "/tasks/{id}", deleteTaskHandler, "/api/tasks/delete/{id}"},
+		{http.MethodPost, "/tasks/{id}/clone", cloneTaskHandler, ""},
+		{http.MethodGet, "/tasks/{id}/status", taskStatusHandler, "/api/tasks/status/{id}"},
+		{http.MethodGet, "/tasks/{id}/logs", taskLogsHandler, "/api/tasks/logs/{id}"},
+		{http.MethodGet, "/tasks/{id}/download", downloadTaskHandler, "/api/tasks/download/{id}"},
+		{http.MethodGet, "/tasks/{id}/pages", pagePreviewsHandler, ""},
+		{http.MethodGet, "/tasks/{id}/pages/{page}", pagePreviewHandler, ""},
+		{http.MethodGet, "/tasks/{id}/text", taskTextHandler, ""},
+		{http.MethodPost, "/tasks/{id}/links", createDownloadLinksHandler, ""},
+		{http.MethodGet, "/tasks/{id}/links", listDownloadLinksHandler, ""},
+		{http.MethodDelete, "/tasks/{id}/links/{link}", deleteDownloadLinkHandler, ""},
+		{http.MethodPost, "/tasks/{id}/bundles", createBundleHandler, ""},
+		{http.MethodGet, "/tasks/{id}/bundles", listBundlesHandler, ""},
+		{http.MethodGet, "/tasks/{id}/bundles/{bundle}/download", downloadBundleHandler, ""},
+		{http.MethodDelete, "/tasks/{id}/bundles/{bundle}", deleteBundleHandler, ""},
+		{http.MethodGet, "/tasks/{id}/events", taskEventsHandler, "/api/tasks/events/{id}"},
+		{http.MethodPost, "/tasks/{id}/restore", restoreTaskHandler, ""},
+		{http.MethodPost, "/uploads", limitUploads(uploadHandler), ""},
+		{http.MethodPost, "/imports", createImportHandler, ""},
+		{http.MethodGet, "/imports/{id}", importBatchHandler, ""},
+		{http.MethodGet, "/drafts", draftsHandler, ""},
+		{http.MethodPost, "/drafts", draftsHandler, ""},
+		{http.MethodGet, "/drafts/{id}", draftHandler, ""},
+		{http.MethodPut, "/drafts/{id}", draftHandler, ""},
+		{http.MethodDelete, "/drafts/{id}", draftHandler, ""},
+
+		{http.MethodGet, "/me/defaults", userDefaultsHandler, "/api/me/defaults"},
+		{http.MethodPut, "/me/defaults", userDefaultsHandler, "/api/me/defaults"},
+		{http.MethodPost, "/me/defaults", userDefaultsHandler, "/api/me/defaults"},
+		{http.MethodDelete, "/me/defaults", userDefaultsHandler, "/api/me/defaults"},
+		{http.MethodGet, "/me/settings", userSettingsHandler, ""},
+		{http.MethodPut, "/me/settings", userSettingsHandler, ""},
+		{http.MethodDelete, "/me/settings", userSettingsHandler, ""},
+		{http.MethodGet, "/me/follows", followsHandler, ""},
+		{http.MethodPost, "/me/follows", followsHandler, ""},
+		{http.MethodDelete, "/me/follows/{id}", followHandler, ""},
+
+		{http.MethodGet, "/search/content", contentSearchHandler, ""},
+		{http.MethodGet, "/storage", requireAdmin(storageUsageHandler), "/api/storage"},
+		{http.MethodGet, "/workers", requireAdmin(workerStatusHandler), ""},
+		{http.MethodGet, "/languages", languagesHandler, "/api/languages"},
+		{http.MethodGet, "/openapi.json", openAPIHandler, "/api/openapi.json"},
+		{http.MethodGet, "/ws", taskWebSocketHandler, ""},
+		{http.MethodGet, "/graphql", graphqlHandler, ""},
+		{http.MethodPost, "/graphql", graphqlHandler, ""},
+
+		{http.MethodGet, "/admin/queue/status", requireAdmin(queueStatusHandler), "/api/admin/queue/status"},
+		{http.MethodPost, "/admin/queue/pause", requireAdmin(pauseQueueHandler), "/api/admin/queue/pause"},
+		{http.MethodPost, "/admin/queue/resume", requireAdmin(resumeQueueHandler), "/api/admin/queue/resume"},
+		{http.MethodGet, "/admin/providers", requireAdmin(providersHandler), "/api/admin/providers"},
+		{http.MethodGet, "/admin/workers", requireAdmin(workersHandler), "/api/admin/workers"},
+		{http.MethodGet, "/admin/connections", requireAdmin(connectionsHandler), ""},
+		{http.MethodGet, "/admin/fonts", requireAdmin(listFontsHandler), ""},
+		{http.MethodPost, "/admin/fonts", requireAdmin(installFontHandler), ""},
+		{http.MethodDelete, "/admin/fonts/{name}", requireAdmin(deleteFontHandler), ""},
+		{http.MethodPost, "/admin/babeldoc-cache/clear", requireAdmin(clearBabeldocCacheHandler), ""},
+		{http.MethodPost, "/admin/babeldoc-cache/relocate", requireAdmin(relocateBabeldocCacheHandler), ""},
+		{http.MethodGet, "/admin/backup", requireAdmin(backupHandler), ""},
+	}
+}
+
+// newRouter 注册静态文件、/api/v1 路由及旧路径的废弃别名；设置了 ADMIN_LISTEN 时管理接口改由 newAdminRouter 提供
+func newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir("./web/static")))
+	mux.HandleFunc("/api/", apiNotFoundHandler)
+	// WebSocket 推送也以不带版本号的 /api/ws 提供（不是废弃别名）
+	mux.HandleFunc("GET /api/ws", taskWebSocketHandler)
+	if adminListen == "" {
+		mux.HandleFunc("GET /metrics", requireAdmin(metricsHandler))
+	}
+	if webdavMode != "" {
+		mux.HandleFunc(webdavPrefix, webdavHandler)
+		mux.HandleFunc(webdavPrefix+"/", webdavHandler)
+	}
+
+	for _, rt := range apiRoutes() {
+		if adminListen != "" && isAdminRoute(rt) {
+			continue
+		}
+		registerRoute(mux, rt)
+	}
+	return mux
+}
+
+// registerRoute 注册一条路由（/tasks/{id} 下的路由同时以外部标识提供）及其旧路径的废弃别名
+func registerRoute(mux *http.ServeMux, rt route) {
+	path := apiVersionPrefix + rt.path
+	mux.HandleFunc(rt.method+" "+path, rt.handler)
+	if external := externalTaskPath(rt.path); external != "" {
+		mux.HandleFunc(rt.method+" "+apiVersionPrefix+external, byExternalID(rt.handler))
+	}
+	if rt.legacy != "" {
+		mux.HandleFunc(rt.method+" "+rt.legacy, deprecatedRoute(path, rt.handler))
+	}
+}
+
+// isAdminRoute 是否为管理接口
+func isAdminRoute(rt route) bool {
+	return strings.HasPrefix(rt.path, "/admin/")
+}
+
+// deprecatedRoute 为旧路径的响应加上 Deprecation 头和指向新路径的 Link 头
+func deprecatedRoute(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link := successor
+		if id := r.PathValue("id"); id != "" {
+			link = strings.ReplaceAll(link, "{id}", id)
+		}
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+link+">; rel=\"successor-version\"")
+		next(w, r)
+	}
+}
+
+// apiNotFoundHandler 未匹配任何路由（或方法不符）的 API 请求返回 JSON 格式的 404
+func apiNotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, codeNotFound, "Not found")
+}
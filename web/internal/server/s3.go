@@ -0,0 +1,256 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 兼容存储配置（AWS S3、MinIO 等）：
+//
+//	S3_ENDPOINT           服务地址（默认 https://s3.<region>.amazonaws.com）
+//	S3_REGION             区域（默认 us-east-1）
+//	S3_ACCESS_KEY_ID      访问密钥 ID
+//	S3_SECRET_ACCESS_KEY  访问密钥
+//
+// 使用路径风格的 URL（<endpoint>/<bucket>/<key>），请求使用 AWS Signature V4 签名。
+type s3Client struct {
+	endpoint  string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+func newS3ClientFromEnv() (*s3Client, error) {
+	c := &s3Client{
+		region:    envOrDefault("S3_REGION", "us-east-1"),
+		accessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+	}
+	c.endpoint = strings.TrimRight(envOrDefault("S3_ENDPOINT", "https://s3."+c.region+".amazonaws.com"), "/")
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, fmt.Errorf("未配置 S3_ACCESS_KEY_ID / S3_SECRET_ACCESS_KEY")
+	}
+	return c, nil
+}
+
+// parseS3Location 解析 "bucket/prefix" 或 "s3://bucket/prefix"
+func parseS3Location(location string) (bucket, prefix string) {
+	location = strings.TrimPrefix(location, "s3://")
+	parts := strings.SplitN(location, "/", 2)
+	bucket = parts[0]
+	if len(parts) == 2 {
+		prefix = strings.Trim(parts[1], "/")
+	}
+	return bucket, prefix
+}
+
+func (c *s3Client) objectURL(bucket, key string) string {
+	escaped := make([]string, 0)
+	for _, segment := range strings.Split(key, "/") {
+		escaped = append(escaped, url.PathEscape(segment))
+	}
+	return c.endpoint + "/" + bucket + "/" + strings.Join(escaped, "/")
+}
+
+// do 发送签名后的请求，非 2xx 响应返回错误
+func (c *s3Client) do(method, bucket, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.objectURL(bucket, key), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.send(req, key)
+}
+
+func (c *s3Client) send(req *http.Request, key string) (*http.Response, error) {
+	c.sign(req, time.Now().UTC())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 %s %s: HTTP %d: %s", req.Method, key, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// putObject 上传对象
+func (c *s3Client) putObject(bucket, key string, body io.Reader, size int64, contentType string) error {
+	resp, err := c.do(http.MethodPut, bucket, key, body, size, contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// getObject 读取对象，调用方负责关闭返回的 Body
+func (c *s3Client) getObject(bucket, key string) (io.ReadCloser, error) {
+	resp, err := c.do(http.MethodGet, bucket, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// deleteObject 删除对象
+func (c *s3Client) deleteObject(bucket, key string) error {
+	resp, err := c.do(http.MethodDelete, bucket, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3ListResult ListObjectsV2 的响应
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// listObjects 列出 key 以 prefix 开头的对象（ListObjectsV2，自动翻页）
+func (c *s3Client) listObjects(bucket, prefix string) ([]StoredObject, error) {
+	var objects []StoredObject
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := http.NewRequest(http.MethodGet, c.endpoint+"/"+bucket+"?"+canonicalQuery(query), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.send(req, prefix)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("S3 list %s: %v", prefix, err)
+		}
+		for _, item := range result.Contents {
+			objects = append(objects, StoredObject{Key: item.Key, Size: item.Size, ModTime: item.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// presignGet 返回下载对象的预签名链接（查询参数中的 Signature V4），有效期最长 7 天
+func (c *s3Client) presignGet(bucket, key, filename string, expires time.Duration, now time.Time) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", fmt.Errorf("S3 预签名链接的有效期必须在 1s 到 7 天之间")
+	}
+	u, err := url.Parse(c.objectURL(bucket, key))
+	if err != nil {
+		return "", err
+	}
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", c.accessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if filename != "" {
+		query.Set("response-content-disposition", attachmentDisposition(filename))
+	}
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	signature := hex.EncodeToString(hmacSHA256(c.signingKey(date), stringToSign))
+
+	u.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// signingKey 派生 Signature V4 的签名密钥
+func (c *s3Client) signingKey(date string) []byte {
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	return hmacSHA256(key, "aws4_request")
+}
+
+// sign 按 AWS Signature V4 为请求签名，负载不参与签名（UNSIGNED-PAYLOAD）
+func (c *s3Client) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:UNSIGNED-PAYLOAD\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signature := hex.EncodeToString(hmacSHA256(c.signingKey(date), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(values url.Values) string {
+	// url.Values.Encode 按键排序，但空格编码为 +，SigV4 要求 %20
+	return strings.ReplaceAll(values.Encode(), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 计划执行的任务状态为 scheduled，到达 run_at 后由 scheduledDispatcher 转为 queued 并入队。
+// 状态保存在数据库中，服务重启后仍会按时执行。
+const scheduledDispatchInterval = 15 * time.Second
+
+// parseRunAt 解析提交时的 run_at 字段，支持 RFC3339 和浏览器 datetime-local 格式（按服务器本地时区）
+func parseRunAt(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		var t time.Time
+		var err error
+		if layout == time.RFC3339 {
+			t, err = time.Parse(layout, value)
+		} else {
+			t, err = time.ParseInLocation(layout, value, time.Local)
+		}
+		if err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("run_at must be an RFC3339 timestamp")
+}
+
+// scheduledDispatcher 定期将到期的计划任务放入队列
+func scheduledDispatcher() {
+	for {
+		dispatchDueTasks()
+		time.Sleep(scheduledDispatchInterval)
+	}
+}
+
+func dispatchDueTasks() {
+	rows, err := db.Query(`SELECT `+taskColumns+` FROM tasks WHERE status = 'scheduled' AND run_at <= ? ORDER BY run_at ASC`, time.Now())
+	if err != nil {
+		log.Printf("无法查询计划任务: %v", err)
+		return
+	}
+	var tasks []*Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	rows.Close()
+
+	for _, task := range tasks {
+		// 多个实例同时调度时只有一个能完成状态切换
+		if err := transitionTask(task, "queued", ""); err != nil {
+			continue
+		}
+		if err := enqueueTask(task); err != nil {
+			log.Printf("任务 %s 入队失败: %v", task.ID, err)
+			failTask(task, "任务入队失败: "+err.Error())
+		}
+	}
+}
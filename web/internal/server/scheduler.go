@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// 调度配置：
+//
+//	MAX_CONCURRENT_PER_KEY  同一个 OpenAI API Key 同时执行的最大任务数（本实例内），0 表示不限制（默认）
+//
+// 某个 Key 达到上限（或其服务商探测不可用）时，worker 会暂存该任务并继续领取其他任务，
+// Key 释放后优先执行暂存的任务。
+var maxConcurrentPerKey = parseIntEnv("MAX_CONCURRENT_PER_KEY", 0)
+
+var scheduler = &keyScheduler{
+	running: make(map[string]int),
+	held:    make(map[string][]*Task),
+}
+
+// keyScheduler 按 API Key 限制并发的调度器
+type keyScheduler struct {
+	mu      sync.Mutex
+	running map[string]int     // API Key -> 正在执行的任务数
+	held    map[string][]*Task // 队列名 -> 因 Key 饱和或服务商不可用而暂存的任务
+}
+
+// parseIntEnv 读取整数环境变量，为空或无效时返回默认值
+func parseIntEnv(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("无效的 %s %q，使用默认值 %d", name, value, def)
+		return def
+	}
+	return n
+}
+
+// taskAPIKey 返回任务实际使用的 OpenAI API Key：表单参数 > 队列配置 > 环境变量
+func taskAPIKey(task *Task) string {
+	if task.Params != "" {
+		var paramsMap map[string]string
+		if err := json.Unmarshal([]byte(task.Params), &paramsMap); err == nil {
+			if key := paramsMap["openai-api-key"]; key != "" {
+				return key
+			}
+		}
+	}
+	if qc := findQueueConfig(task.Queue); qc != nil && qc.OpenAIAPIKey != "" {
+		return qc.OpenAIAPIKey
+	}
+	return os.Getenv("OPENAI_API_KEY")
+}
+
+// next 返回下一个可以执行的任务，worker 为调用者的标识。返回的任务执行完毕后必须调用 release 和 ackTask
+func (s *keyScheduler) next(queueName, worker string) (*Task, error) {
+	for {
+		if task := s.takeHeld(queueName); task != nil {
+			return task, nil
+		}
+
+		task, err := taskQueues[queueName].Dequeue(worker)
+		if err != nil {
+			return nil, err
+		}
+		if s.tryAcquire(task) {
+			return task, nil
+		}
+
+		s.mu.Lock()
+		s.held[queueName] = append(s.held[queueName], task)
+		s.mu.Unlock()
+		log.Printf("任务 %s 暂时无法执行（API Key 并发已满或服务商不可用），暂存等待", task.ID)
+	}
+}
+
+// takeHeld 取出第一个 Key 已有空闲额度的暂存任务
+func (s *keyScheduler) takeHeld(queueName string) *Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	held := s.held[queueName]
+	for i, task := range held {
+		if s.acquireLocked(task) {
+			s.held[queueName] = append(held[:i:i], held[i+1:]...)
+			return task
+		}
+	}
+	return nil
+}
+
+func (s *keyScheduler) tryAcquire(task *Task) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acquireLocked(task)
+}
+
+func (s *keyScheduler) acquireLocked(task *Task) bool {
+	if !providerAvailable(taskProviderName(task)) {
+		return false
+	}
+	key := taskAPIKey(task)
+	if maxConcurrentPerKey > 0 && s.running[key] >= maxConcurrentPerKey {
+		return false
+	}
+	s.running[key]++
+	return true
+}
+
+// release 释放任务占用的 Key 额度
+func (s *keyScheduler) release(task *Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := taskAPIKey(task)
+	if s.running[key] <= 1 {
+		delete(s.running, key)
+	} else {
+		s.running[key]--
+	}
+}
+
+// requeueHeld 将所有暂存任务放回各自的队列，用于服务商恢复可用等 worker 无法感知的情况
+func (s *keyScheduler) requeueHeld() {
+	s.mu.Lock()
+	held := s.held
+	s.held = make(map[string][]*Task)
+	s.mu.Unlock()
+
+	for _, tasks := range held {
+		for _, task := range tasks {
+			if err := enqueueTask(task); err != nil {
+				log.Printf("任务 %s 重新入队失败: %v", task.ID, err)
+				continue
+			}
+			ackTask(task)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"log"
+	"strings"
+)
+
+// 文件名与标签的全文索引，由数据库后端实现（见 store.go）：SQLite 使用 FTS5 的 trigram 分词器，支持不区分大小写的子串匹配，
+// 外部内容表通过触发器与 tasks 表保持同步；PostgreSQL 使用 pg_trgm 索引，MySQL 使用 ngram 全文索引。无法创建索引时退化为 LIKE 查询。
+var searchIndexAvailable bool
+
+// trigram 分词器无法匹配少于 3 个字符的查询，此时同样使用 LIKE
+const minIndexedQueryLength = 3
+
+var searchColumns = []string{"filename", "tags"}
+
+func createSearchIndex() {
+	if err := dbStore.CreateSearchIndex("tasks_fts", "tasks", searchColumns); err != nil {
+		log.Printf("无法创建全文索引，搜索将使用 LIKE 查询: %v", err)
+		return
+	}
+	searchIndexAvailable = true
+}
+
+// searchCondition 返回按文件名和标签搜索的 WHERE 条件
+func searchCondition(q string) (string, []interface{}) {
+	if searchIndexAvailable && len([]rune(q)) >= minIndexedQueryLength {
+		return dbStore.SearchCondition("tasks_fts", "", searchColumns, q)
+	}
+	return likeSearchCondition("", searchColumns, q)
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// HTTP 服务配置，面向大量同时轮询或保持长连接的看板客户端：
+//
+//	HTTP_IDLE_TIMEOUT             keep-alive 空闲连接的保持时间（默认 120s）
+//	HTTP_READ_HEADER_TIMEOUT      读取请求头的超时时间（默认 10s）
+//	HTTP_KEEP_ALIVE               为 false 时关闭 keep-alive（默认开启）
+//	HTTP2_MAX_CONCURRENT_STREAMS  每个 HTTP/2 连接的最大并发流数（默认 250）
+//	HTTP2_PING_INTERVAL           HTTP/2 连接空闲多久后发送 PING 检测对端是否存活（默认 30s，0 表示不检测）
+//	HTTP2_CLEARTEXT               是否接受明文 HTTP/2（h2c，默认 true，用于反向代理到本服务的 HTTP/2 连接）
+//	TLS_CERT_FILE / TLS_KEY_FILE  设置后直接提供 HTTPS，浏览器通过 ALPN 协商 HTTP/2
+//
+// 不设置写超时，以免中断流式导出等长时间响应。
+var (
+	httpIdleTimeout           = parseDurationEnv("HTTP_IDLE_TIMEOUT", 120*time.Second)
+	httpReadHeaderTimeout     = parseDurationEnv("HTTP_READ_HEADER_TIMEOUT", 10*time.Second)
+	http2MaxConcurrentStreams = parseIntEnv("HTTP2_MAX_CONCURRENT_STREAMS", 250)
+	http2PingInterval         = parseDurationEnv("HTTP2_PING_INTERVAL", 30*time.Second)
+)
+
+// newHTTPServer 创建监听 addr 的 HTTP 服务，同时支持 HTTP/1.1 和 HTTP/2
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(envOrDefault("HTTP2_CLEARTEXT", "true") == "true")
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           connMetrics.countRequests(handler),
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		IdleTimeout:       httpIdleTimeout,
+		Protocols:         protocols,
+		HTTP2: &http.HTTP2Config{
+			MaxConcurrentStreams: http2MaxConcurrentStreams,
+			SendPingTimeout:      http2PingInterval,
+		},
+		ConnState: connMetrics.trackConn,
+	}
+	srv.SetKeepAlivesEnabled(os.Getenv("HTTP_KEEP_ALIVE") != "false")
+	return srv
+}
+
+// serve 在 ln 上提供服务，设置了证书时提供 HTTPS，否则提供 HTTP（及 h2c）
+func serve(srv *http.Server, ln net.Listener) error {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile != "" && keyFile != "" {
+		return srv.ServeTLS(ln, certFile, keyFile)
+	}
+	return srv.Serve(ln)
+}
+
+// ConnectionStats 连接与请求统计
+type ConnectionStats struct {
+	Open             int64            `json:"open"`               // 当前打开的连接数
+	Active           int64            `json:"active"`             // 正在处理请求的连接数
+	Idle             int64            `json:"idle"`               // keep-alive 空闲连接数
+	Accepted         int64            `json:"accepted"`           // 启动以来接受的连接总数
+	InFlightRequests map[string]int64 `json:"in_flight_requests"` // 按协议统计的正在处理的请求数
+	Requests         map[string]int64 `json:"requests"`           // 按协议统计的启动以来的请求总数
+}
+
+type connectionMetrics struct {
+	mu       sync.Mutex
+	accepted int64
+	states   map[net.Conn]http.ConnState
+	inFlight map[string]int64
+	requests map[string]int64
+}
+
+var connMetrics = &connectionMetrics{
+	states:   make(map[net.Conn]http.ConnState),
+	inFlight: make(map[string]int64),
+	requests: make(map[string]int64),
+}
+
+func (m *connectionMetrics) trackConn(conn net.Conn, state http.ConnState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch state {
+	case http.StateNew:
+		m.accepted++
+		m.states[conn] = state
+	case http.StateHijacked, http.StateClosed:
+		delete(m.states, conn)
+	default:
+		m.states[conn] = state
+	}
+}
+
+// countRequests 按协议（HTTP/1.1、HTTP/2.0）统计请求
+func (m *connectionMetrics) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.inFlight[r.Proto]++
+		m.requests[r.Proto]++
+		m.mu.Unlock()
+		defer func() {
+			m.mu.Lock()
+			m.inFlight[r.Proto]--
+			m.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *connectionMetrics) stats() *ConnectionStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := &ConnectionStats{
+		Open:             int64(len(m.states)),
+		Accepted:         m.accepted,
+		InFlightRequests: make(map[string]int64, len(m.inFlight)),
+		Requests:         make(map[string]int64, len(m.requests)),
+	}
+	for _, state := range m.states {
+		switch state {
+		case http.StateActive:
+			stats.Active++
+		case http.StateIdle:
+			stats.Idle++
+		}
+	}
+	for proto, n := range m.inFlight {
+		stats.InFlightRequests[proto] = n
+	}
+	for proto, n := range m.requests {
+		stats.Requests[proto] = n
+	}
+	return stats
+}
+
+// 连接统计
+func connectionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(connMetrics.stats())
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 分享链接：为任务的输出文件生成带签名、有有效期的下载链接，持有链接即可下载，无需访问其他接口。
+//
+//	DOWNLOAD_LINK_TTL      未指定 expires_in 时的有效期（默认 24h）
+//	DOWNLOAD_LINK_MAX_TTL  expires_in 的上限（默认 720h）
+//
+// 每个链接记录在 download_links 表中，可以限制下载次数（max_downloads）和提前撤销。
+// 续传请求（Range 起始位置大于 0）不计入下载次数，但只有链接已被下载过至少一次时才允许。
+var (
+	downloadLinkTTL    = parseDurationEnv("DOWNLOAD_LINK_TTL", 24*time.Hour)
+	downloadLinkMaxTTL = parseDurationEnv("DOWNLOAD_LINK_MAX_TTL", 30*24*time.Hour)
+)
+
+// ShareLinkRequest 生成分享链接的请求体，所有字段可选
+type ShareLinkRequest struct {
+	File         string `json:"file,omitempty"`          // 输出文件名，未设置时为每个输出文件各生成一个链接
+	ExpiresIn    int    `json:"expires_in,omitempty"`    // 有效期（秒）
+	MaxDownloads int    `json:"max_downloads,omitempty"` // 最多下载次数，0 表示不限
+}
+
+// DownloadLink 一个分享链接
+type DownloadLink struct {
+	ID           string    `json:"id"`
+	File         string    `json:"file"`
+	URL          string    `json:"url"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	MaxDownloads int       `json:"max_downloads"`
+	Downloads    int       `json:"downloads"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func createDownloadLinksTable() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS download_links (
+		id ` + t.Key + ` PRIMARY KEY,
+		task_id ` + t.Key + ` NOT NULL,
+		file ` + t.Text + ` NOT NULL,
+		expires_at ` + t.Time + ` NOT NULL,
+		max_downloads ` + t.Integer + ` NOT NULL DEFAULT 0,
+		downloads ` + t.Integer + ` NOT NULL DEFAULT 0,
+		created_at ` + t.Time + ` NOT NULL
+	)`)
+	if err == nil {
+		err = dbStore.CreateIndex("idx_download_links_task", "download_links", "task_id", "", false)
+	}
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+}
+
+// 生成分享链接
+func createDownloadLinksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ShareLinkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil && err != io.EOF {
+		writeAPIError(w, invalidJSONError(err))
+		return
+	}
+	ttl := downloadLinkTTL
+	if req.ExpiresIn < 0 || req.MaxDownloads < 0 {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "expires_in and max_downloads must not be negative")
+		return
+	}
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl > downloadLinkMaxTTL {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "expires_in exceeds the maximum of "+strconv.Itoa(int(downloadLinkMaxTTL.Seconds()))+" seconds")
+		return
+	}
+
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, r.PathValue("id")))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	if task.Status != "success" || len(task.OutputFiles) == 0 {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "Task has no output files")
+		return
+	}
+	files := task.OutputFiles
+	if req.File != "" {
+		found := false
+		for _, f := range task.OutputFiles {
+			found = found || f == req.File
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+			return
+		}
+		files = []string{req.File}
+	}
+
+	// 顺便清理已过期的链接
+	execWithRetry(`DELETE FROM download_links WHERE expires_at < ?`, time.Now())
+
+	now := time.Now().Truncate(time.Second)
+	links := make([]*DownloadLink, 0, len(files))
+	for _, file := range files {
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		link := &DownloadLink{
+			ID:           hex.EncodeToString(buf),
+			File:         file,
+			ExpiresAt:    now.Add(ttl),
+			MaxDownloads: req.MaxDownloads,
+			CreatedAt:    now,
+		}
+		_, err := execWithRetry(`INSERT INTO download_links (id, task_id, file, expires_at, max_downloads, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			link.ID, task.ID, link.File, link.ExpiresAt, link.MaxDownloads, link.CreatedAt)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Error saving download link: "+err.Error())
+			return
+		}
+		link.URL = downloadLinkURL(task.ID, link)
+		links = append(links, link)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "links": links})
+}
+
+// 列出任务未过期的分享链接
+func listDownloadLinksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	taskID := r.PathValue("id")
+	var exists int
+	if err := db.QueryRow(`SELECT 1 FROM tasks WHERE id = ?`, taskID).Scan(&exists); err != nil {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+
+	rows, err := db.Query(`SELECT id, file, expires_at, max_downloads, downloads, created_at FROM download_links
+		WHERE task_id = ? AND expires_at >= ? ORDER BY created_at, file`, taskID, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	links := []*DownloadLink{}
+	for rows.Next() {
+		var link DownloadLink
+		if err := rows.Scan(&link.ID, &link.File, &link.ExpiresAt, &link.MaxDownloads, &link.Downloads, &link.CreatedAt); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		link.URL = downloadLinkURL(taskID, &link)
+		links = append(links, &link)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"links": links})
+}
+
+// 撤销分享链接，之后使用该链接下载返回 403
+func deleteDownloadLinkHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	res, err := execWithRetry(`DELETE FROM download_links WHERE id = ? AND task_id = ?`, r.PathValue("link"), r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, codeNotFound, "Download link not found")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// downloadLinkURL 返回分享链接的下载地址，签名包含链接 ID，去掉 link 参数后签名不再有效
+func downloadLinkURL(taskID string, link *DownloadLink) string {
+	expires := link.ExpiresAt.Unix()
+	query := url.Values{}
+	query.Set("file", link.File)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("link", link.ID)
+	query.Set("sig", downloadSignature(taskID, link.File, link.ID, expires))
+	return publicBaseURL() + apiVersionPrefix + "/tasks/" + url.PathEscape(taskID) + "/download?" + query.Encode()
+}
+
+// consumeDownloadLink 在通过分享链接下载前检查链接是否仍然有效，并计入一次下载
+func consumeDownloadLink(linkID, taskID, file string, r *http.Request) *apiError {
+	var linkTaskID, linkFile string
+	var downloads int
+	err := db.QueryRow(`SELECT task_id, file, downloads FROM download_links WHERE id = ?`, linkID).Scan(&linkTaskID, &linkFile, &downloads)
+	if err != nil || linkTaskID != taskID || linkFile != file {
+		return newAPIError(http.StatusForbidden, codeInvalidSignature, "Download link has been revoked")
+	}
+	// HEAD 请求和已开始的下载的续传不计数
+	if r.Method == http.MethodHead || (isRangeContinuation(r) && downloads > 0) {
+		return nil
+	}
+	res, err := execWithRetry(`UPDATE download_links SET downloads = downloads + 1
+		WHERE id = ? AND (max_downloads = 0 OR downloads < max_downloads)`, linkID)
+	if err != nil {
+		return newAPIError(http.StatusInternalServerError, codeInternal, "Error updating download link")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return newAPIError(http.StatusGone, codeDownloadLimitReached, "Download link has reached its download limit")
+	}
+	return nil
+}
+
+// isRangeContinuation 请求是否为从非零位置开始的范围请求（续传）
+func isRangeContinuation(r *http.Request) bool {
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok {
+		return false
+	}
+	start, _, _ := strings.Cut(spec, "-")
+	offset, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
+	return err == nil && offset > 0
+}
+
+// deleteDownloadLinks 删除任务的全部分享链接
+func deleteDownloadLinks(taskID string) {
+	execWithRetry(`DELETE FROM download_links WHERE task_id = ?`, taskID)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 下载链接签名配置：
+//
+//	DOWNLOAD_SIGNING_SECRET  HMAC 密钥；未设置时启动时随机生成（重启后旧链接失效）
+//	PUBLIC_BASE_URL          对外访问地址，用于生成邮件等场景中的绝对链接
+var downloadSigningSecret = loadSigningSecret()
+
+func loadSigningSecret() []byte {
+	if secret := os.Getenv("DOWNLOAD_SIGNING_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal("无法生成下载签名密钥:", err)
+	}
+	return secret
+}
+
+// publicBaseURL 返回服务对外访问地址（不含末尾斜杠）
+func publicBaseURL() string {
+	if base := os.Getenv("PUBLIC_BASE_URL"); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port
+}
+
+// downloadSignature 计算下载链接的签名，link 为分享链接的 ID（见 sharelinks.go），其他链接为空
+func downloadSignature(taskID, file, link string, expires int64) string {
+	mac := hmac.New(sha256.New, downloadSigningSecret)
+	fmt.Fprintf(mac, "%s\n%s\n%d", taskID, file, expires)
+	if link != "" {
+		fmt.Fprintf(mac, "\n%s", link)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedDownloadURL 生成在 ttl 后过期的带签名下载链接
+func signedDownloadURL(taskID, file string, ttl time.Duration) string {
+	expires := time.Now().Add(ttl).Unix()
+	query := url.Values{}
+	query.Set("file", file)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("sig", downloadSignature(taskID, file, "", expires))
+	return publicBaseURL() + apiVersionPrefix + "/tasks/" + url.PathEscape(taskID) + "/download?" + query.Encode()
+}
+
+// verifyDownloadSignature 校验下载链接的签名和有效期
+func verifyDownloadSignature(taskID, file, link, expiresParam, sig string) bool {
+	expires, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	expected := downloadSignature(taskID, file, link, expires)
+	return hmac.Equal([]byte(expected), []byte(sig))
+}
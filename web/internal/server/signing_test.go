@@ -0,0 +1,67 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDownloadSignature(t *testing.T) {
+	saved := downloadSigningSecret
+	downloadSigningSecret = []byte("test-secret")
+	defer func() { downloadSigningSecret = saved }()
+
+	tests := []struct {
+		name, link, want string
+	}{
+		{"task link", "", "754d3e0cb91d68dcee76fb7857adbcb4361368a6fe395cc63f349b7e46f3aafb"},
+		{"share link", "link-1", "868986d9f2e40d961e976999863226c6376a71402858af7fd1447fc4f21a0278"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := downloadSignature("task-1", "out.pdf", tt.link, 1700000000); got != tt.want {
+				t.Errorf("downloadSignature() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDownloadSignature(t *testing.T) {
+	saved := downloadSigningSecret
+	defer func() { downloadSigningSecret = saved }()
+
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Minute).Unix()
+	expires := strconv.FormatInt(future, 10)
+	downloadSigningSecret = []byte("other-secret")
+	forged := downloadSignature("task-1", "out.pdf", "", future)
+	downloadSigningSecret = []byte("test-secret")
+	sig := downloadSignature("task-1", "out.pdf", "", future)
+	shareSig := downloadSignature("task-1", "out.pdf", "link-1", future)
+
+	tests := []struct {
+		name, taskID, file, link, expires, sig string
+		want                                   bool
+	}{
+		{"valid", "task-1", "out.pdf", "", expires, sig, true},
+		{"valid share link", "task-1", "out.pdf", "link-1", expires, shareSig, true},
+		{"expired", "task-1", "out.pdf", "", strconv.FormatInt(past, 10), downloadSignature("task-1", "out.pdf", "", past), false},
+		{"extended expiry", "task-1", "out.pdf", "", strconv.FormatInt(future+3600, 10), sig, false},
+		{"other task", "task-2", "out.pdf", "", expires, sig, false},
+		{"other file", "task-1", "mono.pdf", "", expires, sig, false},
+		{"link added", "task-1", "out.pdf", "link-1", expires, sig, false},
+		{"link removed", "task-1", "out.pdf", "", expires, shareSig, false},
+		{"other link", "task-1", "out.pdf", "link-2", expires, shareSig, false},
+		{"malformed expires", "task-1", "out.pdf", "", "tomorrow", sig, false},
+		{"missing expires", "task-1", "out.pdf", "", "", sig, false},
+		{"missing signature", "task-1", "out.pdf", "", expires, "", false},
+		{"wrong secret", "task-1", "out.pdf", "", expires, forged, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyDownloadSignature(tt.taskID, tt.file, tt.link, tt.expires, tt.sig); got != tt.want {
+				t.Errorf("verifyDownloadSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 任务规模分级：
+//
+//	SIZE_CLASSES_CONFIG  规模分级配置文件（JSON），未设置时使用 small（≤10 页）、medium（≤100 页）、large 三级，均沿用全局设置
+//
+// 提交时统计 PDF 的页数，按 pages 参数实际翻译的页数找到第一个 max_pages 不小于该页数的分级，记录在任务上（size_class）。
+// 每个分级可以设置执行超时、最多执行次数、优先级（同一队列中优先级高的任务先执行）和允许使用的服务商，
+// 未设置的项沿用全局设置。最后一个分级也设置了 max_pages 时，超过该页数的文档会被拒绝。
+var sizeClasses []*SizeClass
+
+// defaultSizeClasses 未配置 SIZE_CLASSES_CONFIG 时的分级
+var defaultSizeClasses = []*SizeClass{
+	{Name: "small", MaxPages: 10},
+	{Name: "medium", MaxPages: 100},
+	{Name: "large"},
+}
+
+// SizeClass 任务规模分级
+type SizeClass struct {
+	Name        string   `json:"name"`
+	MaxPages    int      `json:"max_pages,omitempty"`    // 页数上限，0 表示不限（只能用于最后一个分级）
+	Timeout     string   `json:"timeout,omitempty"`      // 单次执行的超时时间（Go duration 格式），超时后终止执行
+	MaxAttempts int      `json:"max_attempts,omitempty"` // 最多执行次数（含首次），0 表示使用 TASK_MAX_ATTEMPTS
+	Priority    int      `json:"priority,omitempty"`     // 越大越先执行，默认 0
+	Providers   []string `json:"providers,omitempty"`    // 允许的服务商（命名队列名，或 env 表示环境变量中的凭据），为空时不限
+
+	timeout time.Duration
+}
+
+var (
+	pdfPagesCountPattern = regexp.MustCompile(`/Type\s*/Pages\b[^>]*?/Count\s+(\d+)|/Count\s+(\d+)[^>]*?/Type\s*/Pages\b`)
+	pdfPageTypePattern   = regexp.MustCompile(`/Type\s*/Page\b`)
+)
+
+// loadSizeClasses 读取 SIZE_CLASSES_CONFIG，未配置时返回默认分级
+func loadSizeClasses() ([]*SizeClass, error) {
+	path := os.Getenv("SIZE_CLASSES_CONFIG")
+	if path == "" {
+		return defaultSizeClasses, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var classes []*SizeClass
+	if err := json.Unmarshal(content, &classes); err != nil {
+		return nil, fmt.Errorf("无法解析 %s: %v", path, err)
+	}
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("%s 中没有定义分级", path)
+	}
+
+	seen := make(map[string]bool)
+	for i, class := range classes {
+		if class.Name == "" {
+			return nil, fmt.Errorf("%s 中存在未命名的分级", path)
+		}
+		if seen[class.Name] {
+			return nil, fmt.Errorf("%s 中分级名 %s 重复", path, class.Name)
+		}
+		seen[class.Name] = true
+
+		if class.MaxPages < 0 || class.MaxAttempts < 0 {
+			return nil, fmt.Errorf("分级 %s 的 max_pages 和 max_attempts 不能为负数", class.Name)
+		}
+		if class.MaxPages == 0 && i != len(classes)-1 {
+			return nil, fmt.Errorf("只有最后一个分级可以不设置 max_pages（分级 %s）", class.Name)
+		}
+		if i > 0 && class.MaxPages != 0 && class.MaxPages <= classes[i-1].MaxPages {
+			return nil, fmt.Errorf("分级的 max_pages 必须递增（分级 %s）", class.Name)
+		}
+		if class.Timeout != "" {
+			if class.timeout, err = time.ParseDuration(class.Timeout); err != nil || class.timeout <= 0 {
+				return nil, fmt.Errorf("分级 %s 的 timeout 无效: %s", class.Name, class.Timeout)
+			}
+		}
+		for _, provider := range class.Providers {
+			if provider != envProviderName && findQueueConfig(provider) == nil {
+				return nil, fmt.Errorf("分级 %s 的服务商 %s 不存在", class.Name, provider)
+			}
+		}
+	}
+	return classes, nil
+}
+
+// findSizeClass 按名称查找分级，未找到（例如配置已变更）时返回 nil
+func findSizeClass(name string) *SizeClass {
+	for _, class := range sizeClasses {
+		if class.Name == name {
+			return class
+		}
+	}
+	return nil
+}
+
+// classifyTaskSize 统计 PDF 的页数并按 pages 参数选择的页数确定分级。
+// 无法统计页数时归入最后一个分级，返回的页数为 0
+func classifyTaskSize(path, pages string) (int, *SizeClass, *apiError) {
+	total := countPDFPages(path)
+	if total == 0 {
+		return 0, sizeClasses[len(sizeClasses)-1], nil
+	}
+	class, err := sizeClassForPages(total, pages)
+	if err != nil {
+		return 0, nil, err
+	}
+	return total, class, nil
+}
+
+// sizeClassForPages 返回 total 页的文档按 pages 参数翻译时的分级
+func sizeClassForPages(total int, pages string) (*SizeClass, *apiError) {
+	selected, err := selectedPageCount(pages, total)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, codeBadRequest, "%v", err)
+	}
+	for _, class := range sizeClasses {
+		if class.MaxPages == 0 || selected <= class.MaxPages {
+			return class, nil
+		}
+	}
+	limit := sizeClasses[len(sizeClasses)-1].MaxPages
+	return nil, newAPIError(http.StatusUnprocessableEntity, codeTooManyPages, "Document has %d pages to translate, more than the maximum of %d", selected, limit)
+}
+
+// selectedPageCount 返回 pages 参数（如 1,2,1-,-3,3-5）在 total 页的文档中选择的页数
+func selectedPageCount(pages string, total int) (int, error) {
+	pages = strings.TrimSpace(pages)
+	if pages == "" {
+		return total, nil
+	}
+	selected := make(map[int]bool)
+	for _, part := range strings.Split(pages, ",") {
+		part = strings.TrimSpace(part)
+		first, last := 1, total
+		var err error
+		if from, to, ok := strings.Cut(part, "-"); ok {
+			if from != "" {
+				first, err = strconv.Atoi(strings.TrimSpace(from))
+			}
+			if err == nil && to != "" {
+				last, err = strconv.Atoi(strings.TrimSpace(to))
+			}
+		} else {
+			first, err = strconv.Atoi(part)
+			last = first
+		}
+		if err != nil || first < 1 || last < first {
+			return 0, fmt.Errorf("invalid pages: %s", part)
+		}
+		for page := first; page <= min(last, total); page++ {
+			selected[page] = true
+		}
+	}
+	if len(selected) == 0 {
+		return 0, fmt.Errorf("pages %s selects no pages of the %d-page document", pages, total)
+	}
+	return len(selected), nil
+}
+
+// countPDFPages 返回 PDF 的页数：取页面树根节点（/Type /Pages 中最大的 /Count），
+// 找不到时统计 /Type /Page 对象数，包括压缩对象流中的对象。无法确定时返回 0
+func countPDFPages(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	chunks := [][]byte{data}
+	for _, loc := range objectStreamPattern.FindAllIndex(data, -1) {
+		r, err := zlib.NewReader(bytes.NewReader(data[loc[1]:]))
+		if err != nil {
+			continue
+		}
+		inflated, _ := io.ReadAll(io.LimitReader(r, maxObjectStreamSize))
+		r.Close()
+		chunks = append(chunks, inflated)
+	}
+
+	count, pageObjects := 0, 0
+	for _, chunk := range chunks {
+		for _, m := range pdfPagesCountPattern.FindAllSubmatch(chunk, -1) {
+			value := m[1]
+			if value == nil {
+				value = m[2]
+			}
+			if n, err := strconv.Atoi(string(value)); err == nil && n > count {
+				count = n
+			}
+		}
+		pageObjects += len(pdfPageTypePattern.FindAll(chunk, -1))
+	}
+	if count > 0 {
+		return count
+	}
+	return pageObjects
+}
+
+// applySizeClassProviders 任务所在队列的服务商不在分级允许的范围内时，改用第一个允许的队列。
+// 任务自带 API Key 时不受限制
+func applySizeClassProviders(task *Task, class *SizeClass) *apiError {
+	if len(class.Providers) == 0 || taskProviderName(task) == "" || containsString(class.Providers, taskProviderName(task)) {
+		return nil
+	}
+	for _, qc := range queueConfigs {
+		if containsString(class.Providers, queueProviderName(qc)) {
+			task.Queue = qc.Name
+			return nil
+		}
+	}
+	return newAPIError(http.StatusServiceUnavailable, codeQueueUnavailable, "No queue is allowed for size class %s", class.Name)
+}
+
+// taskMaxAttemptsFor 返回任务最多执行次数：分级设置 > TASK_MAX_ATTEMPTS
+func taskMaxAttemptsFor(task *Task) int {
+	if class := findSizeClass(task.SizeClass); class != nil && class.MaxAttempts > 0 {
+		return class.MaxAttempts
+	}
+	return taskMaxAttempts
+}
+
+// taskTimeout 返回任务单次执行的超时时间，0 表示不限
+func taskTimeout(task *Task) time.Duration {
+	if class := findSizeClass(task.SizeClass); class != nil {
+		return class.timeout
+	}
+	return 0
+}
+
+// taskPriority 返回任务在队列中的优先级
+func taskPriority(task *Task) int {
+	if class := findSizeClass(task.SizeClass); class != nil {
+		return class.Priority
+	}
+	return 0
+}
+
+// sizeClassPriorities 返回所有分级用到的优先级（含 0），从高到低
+func sizeClassPriorities() []int {
+	seen := map[int]bool{0: true}
+	priorities := []int{0}
+	for _, class := range sizeClasses {
+		if !seen[class.Priority] {
+			seen[class.Priority] = true
+			priorities = append(priorities, class.Priority)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+	return priorities
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sqliteStore SQLite 数据库（默认）。全文索引使用 FTS5 的 trigram 分词器，外部内容表通过触发器与原表保持同步；
+// 备份用 VACUUM INTO 复制，服务运行中也能得到一致的快照。
+type sqliteStore struct {
+	path string
+}
+
+func (s *sqliteStore) Name() string { return "sqlite" }
+
+func (s *sqliteStore) Open() (*sql.DB, error) {
+	return sql.Open("sqlite", s.path)
+}
+
+func (s *sqliteStore) Types() columnTypes {
+	return columnTypes{
+		ID:      "INTEGER PRIMARY KEY AUTOINCREMENT",
+		Key:     "TEXT",
+		Text:    "TEXT",
+		Integer: "INTEGER",
+		Real:    "REAL",
+		Time:    "DATETIME",
+		Cast:    "INTEGER",
+	}
+}
+
+func (s *sqliteStore) CreateIndex(name, table, columns, where string, unique bool) error {
+	return createIndexIfNotExists(name, table, columns, where, unique)
+}
+
+func (s *sqliteStore) Upsert(conflict ...string) string {
+	return conflictTarget(conflict) + ` DO UPDATE SET`
+}
+
+func (s *sqliteStore) InsertIgnore(conflict ...string) string {
+	return conflictTarget(conflict) + ` DO NOTHING`
+}
+
+func (s *sqliteStore) CreateTrigger(name, table, event, body string) error {
+	_, err := db.Exec(`CREATE TRIGGER IF NOT EXISTS ` + name + ` AFTER ` + event + ` ON ` + table + ` BEGIN
+		` + body + `;
+	END`)
+	return err
+}
+
+func (s *sqliteStore) CreateVersionTrigger(name, table, column string) error {
+	// 递归触发默认关闭，不会再次触发自身
+	_, err := db.Exec(`CREATE TRIGGER IF NOT EXISTS ` + name + ` AFTER UPDATE ON ` + table + `
+		WHEN new.` + column + ` = old.` + column + ` BEGIN
+			UPDATE ` + table + ` SET ` + column + ` = old.` + column + ` + 1 WHERE rowid = new.rowid;
+		END`)
+	return err
+}
+
+func (s *sqliteStore) CreateSearchIndex(name, table string, columns []string) error {
+	var exists int
+	db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&exists)
+
+	list := strings.Join(columns, ", ")
+	newValues := "new." + strings.Join(columns, ", new.")
+	oldValues := "old." + strings.Join(columns, ", old.")
+	insert := `INSERT INTO ` + name + `(rowid, ` + list + `) VALUES (new.rowid, ` + newValues + `)`
+	remove := `INSERT INTO ` + name + `(` + name + `, rowid, ` + list + `) VALUES ('delete', old.rowid, ` + oldValues + `)`
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS ` + name + ` USING fts5(` + list + `, content='` + table + `', content_rowid='rowid', tokenize='trigram')`,
+		`CREATE TRIGGER IF NOT EXISTS ` + name + `_insert AFTER INSERT ON ` + table + ` BEGIN
+			` + insert + `;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS ` + name + `_delete AFTER DELETE ON ` + table + ` BEGIN
+			` + remove + `;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS ` + name + `_update AFTER UPDATE OF ` + list + ` ON ` + table + ` BEGIN
+			` + remove + `;
+			` + insert + `;
+		END`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	// 首次创建时为已有数据建立索引
+	if exists == 0 {
+		if _, err := db.Exec(`INSERT INTO ` + name + `(` + name + `) VALUES ('rebuild')`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) SearchCondition(name, alias string, columns []string, q string) (string, []interface{}) {
+	// 整体作为短语匹配，避免查询中的 FTS 语法字符被解释
+	phrase := `"` + strings.ReplaceAll(q, `"`, `""`) + `"`
+	return qualifyColumn(alias, "rowid") + ` IN (SELECT rowid FROM ` + name + ` WHERE ` + name + ` MATCH ?)`, []interface{}{phrase}
+}
+
+func (s *sqliteStore) Snapshot(database *sql.DB, path string) error {
+	_, err := database.Exec(`VACUUM INTO ?`, path)
+	return err
+}
+
+func (s *sqliteStore) Restore(snapshot string, force bool) error {
+	if _, err := os.Stat(s.path); err == nil && !force {
+		return fmt.Errorf("数据库 %s 已存在，确认要覆盖时使用 -force", s.path)
+	}
+	if err := os.Rename(snapshot, s.path); err != nil {
+		return err
+	}
+	// 旧数据库的预写日志不能应用到恢复的数据库上
+	os.Remove(s.path + "-wal")
+	os.Remove(s.path + "-shm")
+	return nil
+}
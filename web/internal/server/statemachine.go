@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"log"
+)
+
+// 任务状态机：
+//
+//	scheduled ──▶ queued ──▶ running ──▶ success
+//	    │            │          │
+//	    └────────────┴──────────┴──────▶ failed
+//	running ──▶ scheduled（失败后退避重试）、queued（服务重启时恢复）
+//
+// 新任务的状态为 queued 或 scheduled。其后的状态变更（接口、worker、调度器、清理器）都通过
+// transitionTask 写入，非法的转换被拒绝；新增状态时在 taskTransitions 中登记其可转换到的状态。
+var taskTransitions = map[string][]string{
+	"scheduled": {"queued", "failed"},
+	"queued":    {"running", "failed"},
+	"running":   {"success", "failed", "scheduled", "queued"},
+	"success":   nil,
+	"failed":    nil,
+}
+
+// validTaskStatuses 所有任务状态，用于校验筛选参数和生成接口文档
+var validTaskStatuses = func() map[string]bool {
+	statuses := make(map[string]bool, len(taskTransitions))
+	for status := range taskTransitions {
+		statuses[status] = true
+	}
+	return statuses
+}()
+
+// canTransition 返回任务能否从 from 转换到 to
+func canTransition(from, to string) bool {
+	for _, next := range taskTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionError 状态转换被拒绝：转换不合法，或数据库中的状态已被其他更新改变
+type transitionError struct {
+	taskID string
+	from   string
+	to     string
+	actual string // 数据库中的当前状态，转换本身不合法时为空
+}
+
+func (e *transitionError) Error() string {
+	if e.actual == "" {
+		return fmt.Sprintf("illegal transition of task %s from %s to %s", e.taskID, e.from, e.to)
+	}
+	return fmt.Sprintf("task %s is %s, not %s; transition to %s skipped", e.taskID, e.actual, e.from, e.to)
+}
+
+// transitionTask 将任务的状态从 task.Status 改为 to，同时按 sets（如 "error = ?"）更新其他列。
+// 只有数据库中的状态仍为 task.Status 时才写入，否则（被其他实例、清理器处理或已删除）返回 *transitionError。
+// 写入失败时已由 writeTaskState 暂存重试，视为已生效。成功后 task.Status 更新为 to
+func transitionTask(task *Task, to string, sets string, args ...interface{}) error {
+	from := task.Status
+	if !canTransition(from, to) {
+		return &transitionError{taskID: task.ID, from: from, to: to}
+	}
+
+	query := "UPDATE tasks SET status = ?"
+	if sets != "" {
+		query += ", " + sets
+	}
+	query += " WHERE id = ? AND status = ?"
+	queryArgs := append(append([]interface{}{to}, args...), task.ID, from)
+
+	res, err := writeTaskState(task.ID, query, queryArgs...)
+	if err == nil {
+		if n, _ := res.RowsAffected(); n == 0 {
+			actual := "deleted"
+			db.QueryRow(`SELECT status FROM tasks WHERE id = ?`, task.ID).Scan(&actual)
+			return &transitionError{taskID: task.ID, from: from, to: to, actual: actual}
+		}
+	}
+	task.Status = to
+	publishTaskStatus(task.ID, from, to)
+	recordTransitionEvent(task, from, to)
+	return nil
+}
+
+// applyTransition 执行状态转换，被拒绝时记录日志并返回 false
+func applyTransition(task *Task, to string, sets string, args ...interface{}) bool {
+	if err := transitionTask(task, to, sets, args...); err != nil {
+		log.Printf("任务状态未更新: %v", err)
+		return false
+	}
+	return true
+}
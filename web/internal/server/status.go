@@ -0,0 +1,47 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// TaskStatus 任务的状态和进度，供前端高频轮询
+type TaskStatus struct {
+	Status     string `json:"status"`
+	Progress   int    `json:"progress"`              // 0-100
+	Stage      string `json:"stage,omitempty"`       // 执行中（或失败时）所处的阶段：layout、translation 或 typesetting
+	ETASeconds *int   `json:"eta_seconds,omitempty"` // 预计的剩余秒数，无法估算时省略
+
+	NextWindowAt *time.Time `json:"next_window_at,omitempty"` // 排队中的任务所在队列下一个执行时段的开始时间，队列当前可以执行时省略
+}
+
+// 只返回任务的状态和进度，不读取参数、输出文件等字段。
+// 进度和阶段由执行任务的 worker 解析 babeldoc 的输出后写入数据库，其他节点执行的任务同样可以查询
+func taskStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	var status TaskStatus
+	var stage, queue sql.NullString
+	err := db.QueryRow(`SELECT status, progress, stage, queue FROM tasks WHERE id = ?`, r.PathValue("id")).Scan(&status.Status, &status.Progress, &stage, &queue)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	status.Stage = stage.String
+	if status.Status == "queued" {
+		status.NextWindowAt = queueNextWindow(queue.String)
+	}
+	if status.Status == "running" {
+		if task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, r.PathValue("id"))); err == nil {
+			status.ETASeconds = task.ETASeconds
+		}
+	}
+	json.NewEncoder(w).Encode(&status)
+}
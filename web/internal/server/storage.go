@@ -0,0 +1,441 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 对象存储：上传的输入文件和任务的输出文件在对象存储中保存一份持久副本，本地的 DATA_DIR 只作为缓存，
+// 容器可以无状态运行（重建后从对象存储取回需要的文件），API 节点和 worker 节点也不需要共享磁盘。
+//
+//	STORAGE_BACKEND     local（默认，只使用 DATA_DIR 下的本地文件）、dir、s3、gcs 或 azure
+//	STORAGE_DIR         dir 后端的目录（例如挂载的网络存储）
+//	STORAGE_S3          s3 后端的位置 bucket/prefix（需配置 S3_* 环境变量，见 s3.go）
+//	STORAGE_GCS         gcs 后端的位置 bucket/prefix（需配置 GCS_* 环境变量，见 gcs.go）
+//	STORAGE_AZURE       azure 后端的位置 container/prefix（需配置 AZURE_STORAGE_* 环境变量，见 azure.go）
+//	STORAGE_CACHE_TTL   已结束任务的文件在本地保留的时长（默认 1h），之后删除本地副本，需要时重新从对象存储取回；0 表示不删除
+//	STORAGE_REDIRECT_DOWNLOADS  为 true 时，本地没有副本的输出文件以 302 重定向到对象存储的签名链接下载，不经过本服务（dir 后端不支持）
+//	STORAGE_SIGNED_URL_TTL      签名链接的有效期（默认 15m）
+//
+// 对象的 key 为目录前缀加上文件在 UPLOAD_DIR、OUTPUT_DIR 等目录中的相对路径（uploads/...、outputs/...，见 storageKey）。
+// 提交任务时上传输入文件（失败时提交失败），任务成功时上传输出文件（失败时任务失败）；读取文件前本地没有副本时自动取回。
+// 预上传文件、草稿、任务日志和附加字体仍保存在本地。
+var (
+	storageBackend          = envOrDefault("STORAGE_BACKEND", "local")
+	storageCacheTTL         = parseDurationEnv("STORAGE_CACHE_TTL", time.Hour)
+	storageRedirectDownload = os.Getenv("STORAGE_REDIRECT_DOWNLOADS") == "true"
+	storageSignedURLTTL     = parseDurationEnv("STORAGE_SIGNED_URL_TTL", 15*time.Minute)
+
+	// objectStorage 对象存储，STORAGE_BACKEND 为 local 时为 nil
+	objectStorage Storage
+)
+
+const storageCacheCheckInterval = 10 * time.Minute
+
+// errSignedURLUnsupported 存储不支持签名链接（dir 后端）
+var errSignedURLUnsupported = errors.New("signed URLs are not supported by this storage")
+
+// Storage 保存文件副本的存储（目录、S3 兼容存储、Google Cloud Storage 或 Azure Blob），key 为以 / 分隔的相对路径。
+// 对象存储和冷存储（见 coldstorage.go）都通过它读写
+type Storage interface {
+	// Put 上传本地文件 path 为 key
+	Put(key, path string) error
+	// Get 下载 key 到本地文件 path，写入完成前不会出现不完整的文件
+	Get(key, path string) error
+	// Delete 删除 key，不存在时不返回错误
+	Delete(key string) error
+	// List 列出 key 以 prefix 开头的对象
+	List(prefix string) ([]StoredObject, error)
+	// SignedURL 返回在 expires 内有效、不需要凭据即可下载 key 的链接，filename 不为空时作为下载的文件名
+	SignedURL(key, filename string, expires time.Duration) (string, error)
+	String() string
+}
+
+// StoredObject 存储中的一个对象
+type StoredObject struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// loadObjectStore 按 STORAGE_* 创建对象存储，使用本地文件时返回 nil
+func loadObjectStore() (Storage, error) {
+	switch storageBackend {
+	case "local", "":
+		return nil, nil
+	case "dir":
+		return newStorage("dir", os.Getenv("STORAGE_DIR"))
+	case "s3":
+		return newStorage("s3", os.Getenv("STORAGE_S3"))
+	case "gcs":
+		return newStorage("gcs", os.Getenv("STORAGE_GCS"))
+	case "azure":
+		return newStorage("azure", os.Getenv("STORAGE_AZURE"))
+	}
+	return nil, fmt.Errorf("不支持的 STORAGE_BACKEND: %s", storageBackend)
+}
+
+// newStorage 按后端类型和位置创建存储：dir 的位置为目录，s3、gcs 为 bucket/prefix，azure 为 container/prefix
+func newStorage(backend, location string) (Storage, error) {
+	if location == "" {
+		return nil, fmt.Errorf("%s 存储需要设置位置", backend)
+	}
+	switch backend {
+	case "dir":
+		if err := os.MkdirAll(location, 0755); err != nil {
+			return nil, err
+		}
+		return &dirStorage{dir: location}, nil
+	case "s3":
+		bucket, prefix := parseS3Location(location)
+		if bucket == "" {
+			return nil, fmt.Errorf("S3 位置无效: %s", location)
+		}
+		client, err := newS3ClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return &s3Storage{client: client, bucket: bucket, prefix: prefix}, nil
+	case "gcs":
+		bucket, prefix := parseBucketLocation(location, "gs://")
+		if bucket == "" {
+			return nil, fmt.Errorf("GCS 位置无效: %s", location)
+		}
+		client, err := newGCSClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return &gcsStorage{client: client, bucket: bucket, prefix: prefix}, nil
+	case "azure":
+		container, prefix := parseBucketLocation(location, "azure://")
+		if container == "" {
+			return nil, fmt.Errorf("Azure 位置无效: %s", location)
+		}
+		client, err := newAzureClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return &azureStorage{client: client, container: container, prefix: prefix}, nil
+	}
+	return nil, fmt.Errorf("不支持的存储后端: %s", backend)
+}
+
+// parseBucketLocation 解析 "bucket/prefix" 或带有 scheme 的 "<scheme>bucket/prefix"
+func parseBucketLocation(location, scheme string) (bucket, prefix string) {
+	parts := strings.SplitN(strings.TrimPrefix(location, scheme), "/", 2)
+	bucket = parts[0]
+	if len(parts) == 2 {
+		prefix = strings.Trim(parts[1], "/")
+	}
+	return bucket, prefix
+}
+
+// joinKeyPrefix 在 key 前加上存储位置的前缀
+func joinKeyPrefix(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
+
+// storageKey 返回文件在对象存储中的 key：所在目录的前缀（uploads、outputs、bundles）加上相对该目录的路径，
+// 与 UPLOAD_DIR、OUTPUT_DIR 的实际位置无关
+func storageKey(path string) (string, bool) {
+	roots := []struct{ dir, prefix string }{
+		{uploadDir, "uploads"},
+		{outputDir, "outputs"},
+		{bundlesDir, "bundles"},
+	}
+	for _, root := range roots {
+		rel, err := filepath.Rel(root.dir, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		return root.prefix + "/" + filepath.ToSlash(rel), true
+	}
+	return "", false
+}
+
+// persistFile 上传文件到对象存储，未启用对象存储时不做任何事
+func persistFile(path string) error {
+	if objectStorage == nil {
+		return nil
+	}
+	key, ok := storageKey(path)
+	if !ok {
+		return fmt.Errorf("%s 不在上传、输出或分享包目录下", path)
+	}
+	return objectStorage.Put(key, path)
+}
+
+// ensureLocal 本地没有文件时从对象存储取回，取回失败时记录日志并返回错误（调用方随后按文件不存在处理）
+func ensureLocal(path string) error {
+	if objectStorage == nil {
+		return nil
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return nil
+	}
+	key, ok := storageKey(path)
+	if !ok {
+		return nil
+	}
+	if err := objectStorage.Get(key, path); err != nil {
+		log.Printf("无法从对象存储取回 %s: %v", key, err)
+		return err
+	}
+	return nil
+}
+
+// redirectToSignedURL 启用 STORAGE_REDIRECT_DOWNLOADS 且本地没有副本时，以 302 重定向到对象存储的签名链接，返回是否已重定向
+func redirectToSignedURL(w http.ResponseWriter, r *http.Request, path, filename string) bool {
+	if !storageRedirectDownload || objectStorage == nil || outputCompression != nil {
+		return false
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return false
+	}
+	key, ok := storageKey(path)
+	if !ok {
+		return false
+	}
+	signed, err := objectStorage.SignedURL(key, filename, storageSignedURLTTL)
+	if err != nil {
+		if !errors.Is(err, errSignedURLUnsupported) {
+			log.Printf("无法生成 %s 的签名链接，从对象存储取回后下载: %v", key, err)
+		}
+		return false
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, signed, http.StatusFound)
+	return true
+}
+
+// removeStoredFile 删除文件在对象存储中的副本
+func removeStoredFile(path string) {
+	if objectStorage == nil {
+		return
+	}
+	key, ok := storageKey(path)
+	if !ok {
+		return
+	}
+	if err := objectStorage.Delete(key); err != nil {
+		log.Printf("无法删除对象存储中的 %s: %v", key, err)
+	}
+}
+
+// storageCacheCleaner 定期删除已结束任务在本地超过 STORAGE_CACHE_TTL 未更新的文件
+func storageCacheCleaner() {
+	if objectStorage == nil || storageCacheTTL <= 0 {
+		return
+	}
+	log.Printf("已启用对象存储 %s，已结束任务的本地文件保留 %s", objectStorage, storageCacheTTL)
+	for {
+		evictLocalCopies()
+		time.Sleep(storageCacheCheckInterval)
+	}
+}
+
+func evictLocalCopies() {
+	rows, err := db.Query(`SELECT ` + taskColumns + ` FROM tasks WHERE status IN ('success', 'failed') AND storage_tier IS NULL`)
+	if err != nil {
+		log.Printf("无法查询已结束的任务: %v", err)
+		return
+	}
+	var tasks []*Task
+	for rows.Next() {
+		if task, err := scanTask(rows); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	rows.Close()
+
+	evicted := 0
+	for _, task := range tasks {
+		paths := []string{taskInputPath(task)}
+		if task.Status == "success" {
+			for _, file := range taskOutputFiles(task) {
+				paths = append(paths, taskOutputPath(task, file))
+			}
+		}
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil || time.Since(info.ModTime()) < storageCacheTTL {
+				continue
+			}
+			// 先确保对象存储中有副本（包括启用对象存储之前生成的文件），再删除本地文件
+			if err := persistFile(path); err != nil {
+				log.Printf("无法上传 %s 到对象存储，保留本地文件: %v", path, err)
+				continue
+			}
+			if os.Remove(path) == nil {
+				evicted++
+			}
+		}
+		if task.Status == "success" {
+			removeOutputDir(task.OutputDir)
+		}
+	}
+	if evicted > 0 {
+		log.Printf("已删除 %d 个已上传到对象存储的本地文件", evicted)
+	}
+}
+
+// dirStorage 以目录作为存储
+type dirStorage struct {
+	dir string
+}
+
+func (s *dirStorage) Put(key, path string) error {
+	return copyFileAtomic(path, filepath.Join(s.dir, filepath.FromSlash(key)))
+}
+
+func (s *dirStorage) Get(key, path string) error {
+	return copyFileAtomic(filepath.Join(s.dir, filepath.FromSlash(key)), path)
+}
+
+func (s *dirStorage) Delete(key string) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	err := os.Remove(path)
+	os.Remove(filepath.Dir(path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *dirStorage) List(prefix string) ([]StoredObject, error) {
+	var objects []StoredObject
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		// 写入中的临时文件不列出
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) && !strings.HasPrefix(d.Name(), ".tmp-") {
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			objects = append(objects, StoredObject{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return objects, err
+}
+
+func (s *dirStorage) SignedURL(key, filename string, expires time.Duration) (string, error) {
+	return "", errSignedURLUnsupported
+}
+
+func (s *dirStorage) String() string { return s.dir }
+
+// s3Storage 以 S3 兼容存储的 bucket/prefix 作为存储
+type s3Storage struct {
+	client *s3Client
+	bucket string
+	prefix string
+}
+
+func (s *s3Storage) Put(key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return s.client.putObject(s.bucket, joinKeyPrefix(s.prefix, key), f, info.Size(), "application/pdf")
+}
+
+func (s *s3Storage) Get(key, path string) error {
+	body, err := s.client.getObject(s.bucket, joinKeyPrefix(s.prefix, key))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return writeFileAtomic(path, body)
+}
+
+func (s *s3Storage) Delete(key string) error {
+	return s.client.deleteObject(s.bucket, joinKeyPrefix(s.prefix, key))
+}
+
+func (s *s3Storage) List(prefix string) ([]StoredObject, error) {
+	objects, err := s.client.listObjects(s.bucket, joinKeyPrefix(s.prefix, prefix))
+	return trimObjectPrefix(objects, s.prefix), err
+}
+
+func (s *s3Storage) SignedURL(key, filename string, expires time.Duration) (string, error) {
+	return s.client.presignGet(s.bucket, joinKeyPrefix(s.prefix, key), filename, expires, time.Now().UTC())
+}
+
+func (s *s3Storage) String() string { return "s3://" + s.bucket + "/" + s.prefix }
+
+// trimObjectPrefix 去掉列出的 key 中存储位置的前缀
+func trimObjectPrefix(objects []StoredObject, prefix string) []StoredObject {
+	if prefix == "" {
+		return objects
+	}
+	for i := range objects {
+		objects[i].Key = strings.TrimPrefix(objects[i].Key, prefix+"/")
+	}
+	return objects
+}
+
+// attachmentDisposition 签名链接下载时使用的 Content-Disposition
+func attachmentDisposition(filename string) string {
+	return fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", strings.ReplaceAll(filename, `"`, ""), url.PathEscape(filename))
+}
+
+// copyFileAtomic 复制文件，先写入临时文件再重命名，不会留下不完整的目标文件
+func copyFileAtomic(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeFileAtomic(dst, f)
+}
+
+func writeFileAtomic(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
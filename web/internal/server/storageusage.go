@@ -0,0 +1,218 @@
+package server
+
+import (
+	"encoding/json"
+	"io/fs"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 磁盘用量：GET /api/v1/storage（也可以通过 /api/storage 访问，需要管理令牌）返回各目录的合计用量、
+// 所在卷的剩余空间，以及按占用空间从大到小排列的任务（输入、输出、日志、分享包），便于在磁盘写满前找到占用空间的任务。
+// 用量按本地文件统计：已移到冷存储或只保留在对象存储中的文件不计入。
+// babeldoc 自身的缓存目录（见 babeldoccache.go）单独列出，并计入合计。
+
+const (
+	defaultStorageTaskLimit = 50
+	maxStorageTaskLimit     = 1000
+)
+
+// StorageUsage 磁盘用量
+type StorageUsage struct {
+	Totals      StorageTotals       `json:"totals"`
+	Volumes     []StorageVolume     `json:"volumes"`
+	TaskCount   int                 `json:"task_count"` // 占用磁盘空间的任务数
+	Tasks       []*TaskStorageUsage `json:"tasks"`      // 占用空间最多的任务，数量由 limit 参数决定
+	GeneratedAt time.Time           `json:"generated_at"`
+
+	BabeldocCache *BabeldocCacheUsage `json:"babeldoc_cache,omitempty"` // babeldoc 的缓存目录，不存在时省略
+}
+
+// StorageTotals 各部分的合计字节数
+type StorageTotals struct {
+	Inputs         int64 `json:"inputs"`          // 任务的输入文件（相同内容的文件只计一次）
+	PendingUploads int64 `json:"pending_uploads"` // 尚未提交的预上传文件
+	Outputs        int64 `json:"outputs"`         // 输出文件，包括执行中任务的临时目录
+	Logs           int64 `json:"logs"`
+	Bundles        int64 `json:"bundles"`        // 加密分享包
+	Database       int64 `json:"database"`       // 任务数据库（含 WAL）
+	BabeldocCache  int64 `json:"babeldoc_cache"` // babeldoc 的翻译缓存、字体和模型
+	Total          int64 `json:"total"`
+}
+
+// StorageVolume 数据目录所在的一个卷
+type StorageVolume struct {
+	Paths          []string `json:"paths"` // 位于该卷上的数据目录
+	TotalBytes     uint64   `json:"total_bytes"`
+	AvailableBytes uint64   `json:"available_bytes"`
+	UsedPercent    float64  `json:"used_percent"`
+}
+
+// TaskStorageUsage 单个任务占用的字节数
+type TaskStorageUsage struct {
+	TaskID      string `json:"task_id"`
+	Filename    string `json:"filename"`
+	Status      string `json:"status"`
+	Input       int64  `json:"input"`
+	InputShared bool   `json:"input_shared,omitempty"` // 输入文件与其他任务共用（见 blobs.go），删除该任务不会释放这部分空间
+	Outputs     int64  `json:"outputs"`
+	Logs        int64  `json:"logs"`
+	Bundles     int64  `json:"bundles"`
+	Total       int64  `json:"total"`
+}
+
+// 磁盘用量
+func storageUsageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	limit := defaultStorageTaskLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxStorageTaskLimit {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "limit must be between 0 and "+strconv.Itoa(maxStorageTaskLimit))
+			return
+		}
+		limit = n
+	}
+
+	usage, err := collectStorageUsage()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	if len(usage.Tasks) > limit {
+		usage.Tasks = usage.Tasks[:limit]
+	}
+	json.NewEncoder(w).Encode(usage)
+}
+
+func collectStorageUsage() (*StorageUsage, error) {
+	usage := &StorageUsage{GeneratedAt: time.Now(), Volumes: diskVolumes(), Tasks: []*TaskStorageUsage{}}
+
+	pendingDir := filepath.Join(uploadDir, "pending")
+	usage.Totals.PendingUploads = dirSize(pendingDir)
+	usage.Totals.Inputs = dirSize(uploadDir) - usage.Totals.PendingUploads
+	usage.Totals.Outputs = dirSize(outputDir)
+	usage.Totals.Logs = dirSize(logsDir)
+	usage.Totals.Bundles = dirSize(bundlesDir)
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		usage.Totals.Database += fileSize(dbPath + suffix)
+	}
+	if usage.BabeldocCache = collectBabeldocCacheUsage(); usage.BabeldocCache != nil {
+		usage.Totals.BabeldocCache = usage.BabeldocCache.Total
+	}
+	t := &usage.Totals
+	t.Total = t.Inputs + t.PendingUploads + t.Outputs + t.Logs + t.Bundles + t.Database + t.BabeldocCache
+
+	rows, err := db.Query(`SELECT ` + taskColumns + ` FROM tasks`)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []*Task
+	for rows.Next() {
+		if task, err := scanTask(rows); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	rows.Close()
+
+	shared := sharedBlobs()
+	for _, task := range tasks {
+		tu := &TaskStorageUsage{TaskID: task.ID, Filename: task.Filename, Status: task.Status}
+		tu.Input = fileSize(taskInputPath(task))
+		tu.InputShared = tu.Input > 0 && shared[task.InputSHA256]
+		for _, file := range taskOutputFiles(task) {
+			tu.Outputs += fileSize(taskOutputPath(task, file))
+		}
+		// 执行中任务的临时输出目录
+		tu.Outputs += dirSize(filepath.Join(outputDir, task.ID))
+		tu.Logs = fileSize(taskLogPath(task.ID)) + fileSize(legacyTaskLogPath(task.ID))
+		tu.Bundles = dirSize(filepath.Join(bundlesDir, task.ID))
+		tu.Total = tu.Input + tu.Outputs + tu.Logs + tu.Bundles
+		if tu.Total > 0 {
+			usage.Tasks = append(usage.Tasks, tu)
+		}
+	}
+	sort.SliceStable(usage.Tasks, func(i, j int) bool { return usage.Tasks[i].Total > usage.Tasks[j].Total })
+	usage.TaskCount = len(usage.Tasks)
+	return usage, nil
+}
+
+// sharedBlobs 返回被多个任务引用的输入文件
+func sharedBlobs() map[string]bool {
+	shared := make(map[string]bool)
+	rows, err := db.Query(`SELECT sha256 FROM upload_blobs WHERE refs > 1`)
+	if err != nil {
+		return shared
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sum string
+		if rows.Scan(&sum) == nil {
+			shared[sum] = true
+		}
+	}
+	return shared
+}
+
+// diskVolumes 返回数据目录所在的卷，位于同一个卷上的目录合并为一项
+func diskVolumes() []StorageVolume {
+	volumes := []StorageVolume{}
+	byDevice := make(map[uint64]int)
+	paths := []string{uploadDir, outputDir, logsDir, filepath.Dir(dbPath), bundlesDir}
+	if babeldocCacheDir != "" {
+		paths = append(paths, babeldocCacheTarget())
+	}
+	for _, path := range paths {
+		total, available, device, err := diskSpace(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("无法查询 %s 所在卷的空间: %v", path, err)
+			}
+			continue
+		}
+		if i, ok := byDevice[device]; ok {
+			volumes[i].Paths = append(volumes[i].Paths, path)
+			continue
+		}
+		volume := StorageVolume{Paths: []string{path}, TotalBytes: total, AvailableBytes: available}
+		if total > 0 {
+			volume.UsedPercent = math.Round(float64(total-available)/float64(total)*1000) / 10
+		}
+		byDevice[device] = len(volumes)
+		volumes = append(volumes, volume)
+	}
+	return volumes
+}
+
+// dirSize 返回目录下所有文件的大小之和，目录不存在时为 0
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return 0
+	}
+	return info.Size()
+}
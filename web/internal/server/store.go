@@ -0,0 +1,472 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// 任务数据库：默认使用 DB_PATH 指定的 SQLite 文件（见 datadirs.go），也可以用 DATABASE_URL 指定 SQLite、PostgreSQL 或 MySQL。
+//
+//	DATABASE_URL  数据库地址，设置后优先于 DB_PATH：
+//	              sqlite:///绝对路径 或 sqlite:相对路径
+//	              postgres://用户:密码@主机:5432/数据库?sslmode=disable（PostgreSQL 14 及以上，见 postgres.go）
+//	              mysql://用户:密码@主机:3306/数据库（MySQL 8.0.29 及以上，见 mysql.go）
+//
+// 普通的查询和写入语句在三种数据库中通用（PostgreSQL 的连接只把 ? 占位符换成 $n）。各数据库写法不同的部分由 Store 给出：
+// 建表的列类型、索引、upsert 子句、触发器和全文索引，以及备份用的快照。
+// 多实例部署时各实例连接同一个 PostgreSQL 或 MySQL 数据库即可，不再需要在共享卷上放置 SQLite 文件。
+const databaseURLEnv = "DATABASE_URL"
+
+// Store 任务数据库后端
+type Store interface {
+	// Name 返回数据库类型：sqlite、postgres 或 mysql
+	Name() string
+	// Open 打开数据库
+	Open() (*sql.DB, error)
+	// Types 返回建表和新增列时使用的列类型
+	Types() columnTypes
+	// CreateIndex 在 table 的 columns（逗号分隔）上创建名为 name 的索引，已存在时跳过。
+	// where 为部分索引的条件（可以为空）；MySQL 不支持部分索引，建立整列的索引
+	CreateIndex(name, table, columns, where string, unique bool) error
+	// Upsert 返回接在 INSERT ... VALUES (...) 之后的子句开头：与 conflict 列上的唯一约束冲突时改为执行其后的赋值，
+	// 赋值中以 excluded.列名 引用要插入的值，以 表名.列名 引用已有的值
+	Upsert(conflict ...string) string
+	// InsertIgnore 返回接在 INSERT ... VALUES (...) 之后的子句：与 conflict 列上的唯一约束冲突时不插入
+	InsertIgnore(conflict ...string) string
+	// CreateTrigger 在 table 上创建名为 name 的触发器：event（INSERT、UPDATE 或 DELETE）之后对每一行执行语句 body，
+	// body 中以 new.列名、old.列名 引用该行
+	CreateTrigger(name, table, event, body string) error
+	// CreateVersionTrigger 创建 table 的行版本号触发器：更新语句本身没有修改 column 时将其加一
+	CreateVersionTrigger(name, table, column string) error
+	// CreateSearchIndex 为 table 的 columns 建立名为 name 的全文索引，支持不区分大小写的子串匹配
+	CreateSearchIndex(name, table string, columns []string) error
+	// SearchCondition 返回通过 name 索引在 columns 中搜索 q 的条件，alias 为查询中该表的别名（可以为空）
+	SearchCondition(name, alias string, columns []string, q string) (string, []interface{})
+	// Snapshot 把数据库的一致快照写入 SQLite 文件 path（备份中的 tasks.db，见 backup.go）
+	Snapshot(database *sql.DB, path string) error
+	// Restore 用 SQLite 快照替换数据库的内容；force 为 false 且数据库中已有数据时返回错误
+	Restore(snapshot string, force bool) error
+}
+
+// columnTypes 各类数据在建表语句中使用的列类型
+type columnTypes struct {
+	// ID 自增整数主键，包含 PRIMARY KEY
+	ID string
+	// Key 主键、唯一约束或索引中的文本列（MySQL 不能在 LONGTEXT 列上建立普通索引）
+	Key string
+	// Text 其他文本列。MySQL 的 LONGTEXT 列不能有字面量默认值，建表时写成表达式 DEFAULT ('')；
+	// SQLite 新增列时不支持表达式默认值，新增的 Text 列不设默认值
+	Text string
+	// Integer 整数列，布尔值也以 0/1 保存在整数列中
+	Integer string
+	// Real 浮点数列
+	Real string
+	// Time 时间列
+	Time string
+	// Cast 把文本转换为整数时 CAST(... AS 类型) 中的类型
+	Cast string
+}
+
+// dbStore 当前使用的数据库后端，由 openDatabase 设置
+var dbStore Store
+
+// parseDatabaseURL 解析 DATABASE_URL，返回对应的数据库后端
+func parseDatabaseURL(raw string) (Store, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s 无效: %w", databaseURLEnv, err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "sqlite", "sqlite3", "file":
+		path := u.Opaque
+		if path == "" {
+			path = u.Host + u.Path
+		}
+		if path == "" {
+			return nil, fmt.Errorf("%s 没有指定数据库文件: %s", databaseURLEnv, raw)
+		}
+		return &sqliteStore{path: path}, nil
+	case "postgres", "postgresql":
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return nil, fmt.Errorf("%s 需要指定 PostgreSQL 的主机和数据库名: %s", databaseURLEnv, u.Redacted())
+		}
+		return &postgresStore{dsn: raw}, nil
+	case "mysql":
+		dsn, err := mysqlDSN(u)
+		if err != nil {
+			return nil, fmt.Errorf("%s 无效: %w", databaseURLEnv, err)
+		}
+		return &mysqlStore{dsn: dsn}, nil
+	case "":
+		return nil, fmt.Errorf("%s 缺少协议，SQLite 数据库请使用 sqlite:<路径>: %s", databaseURLEnv, raw)
+	default:
+		return nil, fmt.Errorf("%s 的协议 %s 不受支持，可以使用 sqlite、postgres 或 mysql", databaseURLEnv, u.Scheme)
+	}
+}
+
+// databasePath 返回 SQLite 数据库文件的路径：DATABASE_URL 指定了 SQLite 数据库时使用其路径，否则为 DB_PATH。
+// 使用 PostgreSQL 或 MySQL 时该路径所在的目录只用于存放备份的临时文件
+func databasePath() string {
+	if raw := os.Getenv(databaseURLEnv); raw != "" {
+		if s, err := parseDatabaseURL(raw); err == nil {
+			if sqlite, ok := s.(*sqliteStore); ok {
+				return absPath(sqlite.path)
+			}
+		}
+		// 地址无效时由 checkDatabaseURL 在启动时报告
+	}
+	return dataPath("DB_PATH", "tasks.db")
+}
+
+// checkDatabaseURL 检查 DATABASE_URL，无效或指定了不支持的数据库时返回错误
+func checkDatabaseURL() error {
+	_, err := newStore()
+	return err
+}
+
+// newStore 根据 DATABASE_URL 创建数据库后端，未设置时使用 DB_PATH 的 SQLite 数据库
+func newStore() (Store, error) {
+	raw := os.Getenv(databaseURLEnv)
+	if raw == "" {
+		return &sqliteStore{path: dbPath}, nil
+	}
+	s, err := parseDatabaseURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	if isSQLite(s) {
+		// 与 databasePath 一致，使用绝对路径
+		return &sqliteStore{path: dbPath}, nil
+	}
+	return s, nil
+}
+
+// openDatabase 打开数据库
+func openDatabase() (*sql.DB, error) {
+	s, err := newStore()
+	if err != nil {
+		return nil, err
+	}
+	dbStore = s
+	return s.Open()
+}
+
+// likeSearchCondition 返回用 LIKE 在 columns 中搜索子串 q 的条件，alias 为查询中该表的别名（可以为空）。
+// PostgreSQL 的 LIKE 区分大小写，两边都转为小写后再匹配，在各数据库中都不区分大小写
+func likeSearchCondition(alias string, columns []string, q string) (string, []interface{}) {
+	pattern := "%" + escapeLike(q) + "%"
+	conditions := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		conditions[i] = `LOWER(` + qualifyColumn(alias, column) + `) LIKE LOWER(?) ESCAPE '\'`
+		args[i] = pattern
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+func qualifyColumn(alias, column string) string {
+	if alias == "" {
+		return column
+	}
+	return alias + "." + column
+}
+
+// createIndexIfNotExists 用 CREATE INDEX IF NOT EXISTS 创建索引（SQLite 和 PostgreSQL）
+func createIndexIfNotExists(name, table, columns, where string, unique bool) error {
+	stmt := `CREATE INDEX IF NOT EXISTS `
+	if unique {
+		stmt = `CREATE UNIQUE INDEX IF NOT EXISTS `
+	}
+	stmt += name + ` ON ` + table + `(` + columns + `)`
+	if where != "" {
+		stmt += ` WHERE ` + where
+	}
+	_, err := db.Exec(stmt)
+	return err
+}
+
+// conflictTarget 返回 ON CONFLICT(...) 子句（SQLite 和 PostgreSQL）
+func conflictTarget(columns []string) string {
+	return `ON CONFLICT(` + strings.Join(columns, ", ") + `)`
+}
+
+// snapshotTables 把 tables 中的表复制到新建的 SQLite 文件 path，用于 PostgreSQL 和 MySQL 的备份。
+// 所有表在同一个可重复读事务中读取，得到一致的快照；列类型按 SQLite 的类型亲和性映射，主键保持不变
+func snapshotTables(database *sql.DB, path string, tables []string, primaryKeys func(tx *sql.Tx, table string) ([]string, error)) error {
+	tx, err := database.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	snapshot, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+
+	for _, table := range tables {
+		keys, err := primaryKeys(tx, table)
+		if err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		if err := copyTable(tx, snapshot, table, keys); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// copyTable 在 SQLite 快照中创建 table 并复制所有行
+func copyTable(tx *sql.Tx, snapshot *sql.DB, table string, keys []string) error {
+	rows, err := tx.Query(`SELECT * FROM ` + quoteIdent(table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	defs := make([]string, len(types))
+	columns := make([]string, len(types))
+	for i, t := range types {
+		columns[i] = quoteIdent(t.Name())
+		defs[i] = columns[i] + " " + sqliteColumnType(t.DatabaseTypeName())
+	}
+	if len(keys) > 0 {
+		quoted := make([]string, len(keys))
+		for i, key := range keys {
+			quoted[i] = quoteIdent(key)
+		}
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(quoted, ", ")+")")
+	}
+	if _, err := snapshot.Exec(`CREATE TABLE ` + quoteIdent(table) + ` (` + strings.Join(defs, ", ") + `)`); err != nil {
+		return err
+	}
+
+	stx, err := snapshot.Begin()
+	if err != nil {
+		return err
+	}
+	defer stx.Rollback()
+	insert, err := stx.Prepare(`INSERT INTO ` + quoteIdent(table) + ` (` + strings.Join(columns, ", ") + `) VALUES (?` + strings.Repeat(", ?", len(columns)-1) + `)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			// 文本协议返回的值都是 []byte，按文本保存，由列的类型亲和性转换为数值
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		if _, err := insert.Exec(values...); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return stx.Commit()
+}
+
+// sqliteColumnType 把其他数据库的列类型映射为 SQLite 快照中的列类型
+func sqliteColumnType(name string) string {
+	name = strings.ToUpper(name)
+	switch {
+	case strings.Contains(name, "INT"):
+		return "INTEGER"
+	case strings.Contains(name, "FLOAT"), strings.Contains(name, "DOUBLE"), strings.Contains(name, "REAL"),
+		strings.Contains(name, "NUMERIC"), strings.Contains(name, "DECIMAL"):
+		return "REAL"
+	case strings.Contains(name, "TIME"), strings.Contains(name, "DATE"):
+		return "DATETIME"
+	default:
+		return "TEXT"
+	}
+}
+
+// restoreTables 用 SQLite 快照中的数据替换 database 中的同名表，用于 PostgreSQL 和 MySQL 的恢复。
+// 表结构需要已经创建；只复制两边都有的表和列，全文索引等 SQLite 内部表会被跳过
+func restoreTables(database *sql.DB, snapshotPath string, force bool) error {
+	snapshot, err := sql.Open("sqlite", snapshotPath)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+
+	if !force {
+		var count int
+		if err := database.QueryRow(`SELECT COUNT(*) FROM tasks`).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("数据库中已有 %d 个任务，确认要覆盖时使用 -force", count)
+		}
+	}
+
+	var tables []string
+	rows, err := snapshot.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND sql NOT LIKE 'CREATE VIRTUAL TABLE%' ORDER BY name`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// 先清空所有表再插入，删除时触发的清理（如 task_content_cleanup）不会影响已恢复的行
+	targetColumns := make(map[string][]string)
+	for _, table := range tables {
+		columns, err := tableColumns(tx, table)
+		if err != nil {
+			// FTS5 的影子表等在目标数据库中不存在的表
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM ` + quoteIdent(table)); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		targetColumns[table] = columns
+	}
+	for _, table := range tables {
+		columns, ok := targetColumns[table]
+		if !ok {
+			continue
+		}
+		if err := restoreTable(tx, snapshot, table, columns); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// tableColumns 返回 table 的列名，表不存在时返回错误。在事务中用保存点隔离，查询失败不影响事务中的其他语句
+func tableColumns(tx *sql.Tx, table string) ([]string, error) {
+	if _, err := tx.Exec(`SAVEPOINT table_columns`); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(`SELECT * FROM ` + quoteIdent(table) + ` WHERE 1 = 0`)
+	if err != nil {
+		tx.Exec(`ROLLBACK TO SAVEPOINT table_columns`)
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	rows.Close()
+	tx.Exec(`RELEASE SAVEPOINT table_columns`)
+	return columns, err
+}
+
+// scanStrings 读取单列的字符串结果并关闭 rows
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// openStoreForRestore 恢复到 PostgreSQL 或 MySQL 前打开数据库并创建表结构
+func openStoreForRestore(s Store) error {
+	database, err := s.Open()
+	if err != nil {
+		return err
+	}
+	if err := database.Ping(); err != nil {
+		database.Close()
+		return err
+	}
+	dbStore, db = s, database
+	createTable()
+	return nil
+}
+
+// restoreTable 把快照中 table 的行插入目标数据库，只复制目标表中存在的列
+func restoreTable(tx *sql.Tx, snapshot *sql.DB, table string, columns []string) error {
+	rows, err := snapshot.Query(`SELECT * FROM ` + quoteIdent(table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	snapshotColumns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	target := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		target[strings.ToLower(column)] = true
+	}
+	var keep []int
+	var quoted []string
+	for i, column := range snapshotColumns {
+		if target[strings.ToLower(column)] {
+			keep = append(keep, i)
+			quoted = append(quoted, quoteIdent(column))
+		}
+	}
+	if len(keep) == 0 {
+		return nil
+	}
+
+	insert, err := tx.Prepare(`INSERT INTO ` + quoteIdent(table) + ` (` + strings.Join(quoted, ", ") + `) VALUES (?` + strings.Repeat(", ?", len(keep)-1) + `)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	values := make([]interface{}, len(snapshotColumns))
+	dest := make([]interface{}, len(snapshotColumns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	args := make([]interface{}, len(keep))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, index := range keep {
+			args[i] = values[index]
+		}
+		if _, err := insert.Exec(args...); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// quoteIdent 给标识符加上双引号（MySQL 连接启用了 ANSI_QUOTES）
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// isSQLite 是否为 SQLite 数据库
+func isSQLite(s Store) bool {
+	_, ok := s.(*sqliteStore)
+	return ok
+}
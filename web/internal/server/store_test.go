@@ -0,0 +1,99 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDatabaseURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Store
+		wantErr bool
+	}{
+		{raw: "sqlite:///var/lib/babeldoc/tasks.db", want: &sqliteStore{path: "/var/lib/babeldoc/tasks.db"}},
+		{raw: "sqlite:data/tasks.db", want: &sqliteStore{path: "data/tasks.db"}},
+		{raw: "SQLite3:///tmp/tasks.db", want: &sqliteStore{path: "/tmp/tasks.db"}},
+		{raw: "file:tasks.db", want: &sqliteStore{path: "tasks.db"}},
+		{
+			raw:  "postgres://babeldoc:secret@db:5432/babeldoc?sslmode=disable",
+			want: &postgresStore{dsn: "postgres://babeldoc:secret@db:5432/babeldoc?sslmode=disable"},
+		},
+		{raw: "postgresql://db/babeldoc", want: &postgresStore{dsn: "postgresql://db/babeldoc"}},
+		{
+			raw:  "mysql://babeldoc:secret@db/babeldoc",
+			want: &mysqlStore{dsn: "babeldoc:secret@tcp(db:3306)/babeldoc?parseTime=true&sql_mode=%27ANSI_QUOTES%2CPIPES_AS_CONCAT%2CNO_BACKSLASH_ESCAPES%2CSTRICT_TRANS_TABLES%27"},
+		},
+		{
+			raw:  "mysql://babeldoc@db:3307/babeldoc?parseTime=false&sql_mode=TRADITIONAL",
+			want: &mysqlStore{dsn: "babeldoc@tcp(db:3307)/babeldoc?sql_mode=TRADITIONAL"},
+		},
+		{raw: "sqlite:", wantErr: true},
+		{raw: "tasks.db", wantErr: true},
+		{raw: "redis://localhost:6379/0", wantErr: true},
+		{raw: "postgres://db", wantErr: true},
+		{raw: "mysql:///babeldoc", wantErr: true},
+		{raw: "mysql://db/babeldoc?timeout=soon", wantErr: true},
+		{raw: "://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := parseDatabaseURL(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDatabaseURL(%q) = %#v, want error", tt.raw, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDatabaseURL(%q): %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDatabaseURL(%q) = %#v, want %#v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebindPlaceholders(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{
+			`SELECT id FROM tasks WHERE status = ? AND user_id = ?`,
+			`SELECT id FROM tasks WHERE status = $1 AND user_id = $2`,
+		},
+		{
+			`SELECT id FROM tasks WHERE filename = '?' AND "what?" = ? AND tags LIKE '%''?%'`,
+			`SELECT id FROM tasks WHERE filename = '?' AND "what?" = $1 AND tags LIKE '%''?%'`,
+		},
+		{
+			`SELECT COUNT(*) FROM tasks`,
+			`SELECT COUNT(*) FROM tasks`,
+		},
+	}
+	for _, tt := range tests {
+		if got := rebindPlaceholders(tt.query); got != tt.want {
+			t.Errorf("rebindPlaceholders(%q)\n got %q\nwant %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestConflictClauses(t *testing.T) {
+	tests := []struct {
+		store                Store
+		upsert, insertIgnore string
+	}{
+		{&sqliteStore{}, `ON CONFLICT(model, lang_in) DO UPDATE SET`, `ON CONFLICT(model, lang_in) DO NOTHING`},
+		{&postgresStore{}, `ON CONFLICT(model, lang_in) DO UPDATE SET`, `ON CONFLICT(model, lang_in) DO NOTHING`},
+		{&mysqlStore{}, `AS excluded ON DUPLICATE KEY UPDATE`, `ON DUPLICATE KEY UPDATE model = model`},
+	}
+	for _, tt := range tests {
+		if got := tt.store.Upsert("model", "lang_in"); got != tt.upsert {
+			t.Errorf("%s: Upsert() = %q, want %q", tt.store.Name(), got, tt.upsert)
+		}
+		if got := tt.store.InsertIgnore("model", "lang_in"); got != tt.insertIgnore {
+			t.Errorf("%s: InsertIgnore() = %q, want %q", tt.store.Name(), got, tt.insertIgnore)
+		}
+	}
+}
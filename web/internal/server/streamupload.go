@@ -0,0 +1,170 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// 流式接收上传：逐个读取 multipart 表单的各部分，文件直接写入上传目录（同时计算 SHA-256），
+// 不再像 ParseMultipartForm 那样先缓冲到内存或系统临时目录、之后再复制一次，大文件只写一次磁盘。
+// 文件先以 .upload-*.part 的临时名称保存在目标目录，提交成功时改名为任务的输入文件。
+
+// maxFormFieldsSize multipart 表单中普通字段的总大小上限
+const maxFormFieldsSize = 1 << 20
+
+// streamedFile 接收时已写入磁盘的上传文件
+type streamedFile struct {
+	name   string // 原始文件名
+	path   string // 临时文件路径
+	size   int64
+	sha256 []byte
+}
+
+// streamMultipart 读取 multipart 表单：普通字段收集到返回的 url.Values，名为 fileField 的文件写入 dir 下的临时文件。
+// 不是 multipart 请求时返回 http.ErrNotMultipart；出错时已写入的文件被删除
+func streamMultipart(r *http.Request, fileField, dir string) (url.Values, []*streamedFile, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, err
+	}
+	form := url.Values{}
+	var files []*streamedFile
+	fieldsSize := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			removeStreamedFiles(files)
+			return nil, nil, err
+		}
+		name := part.FormName()
+		if name == "" {
+			part.Close()
+			continue
+		}
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, int64(maxFormFieldsSize-fieldsSize)+1))
+			part.Close()
+			if err != nil {
+				removeStreamedFiles(files)
+				return nil, nil, err
+			}
+			if fieldsSize += len(value); fieldsSize > maxFormFieldsSize {
+				removeStreamedFiles(files)
+				return nil, nil, multipart.ErrMessageTooLarge
+			}
+			form.Add(name, string(value))
+			continue
+		}
+		if name != fileField {
+			// 其他文件字段不使用，直接丢弃
+			io.Copy(io.Discard, part)
+			part.Close()
+			continue
+		}
+		file, err := saveStreamedPart(part, dir)
+		part.Close()
+		if err != nil {
+			removeStreamedFiles(files)
+			return nil, nil, err
+		}
+		files = append(files, file)
+	}
+	return form, files, nil
+}
+
+// saveStreamedPart 将一个文件部分写入 dir 下的临时文件
+func saveStreamedPart(part *multipart.Part, dir string) (*streamedFile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	file := &streamedFile{
+		name: filepath.Base(part.FileName()),
+		path: filepath.Join(dir, ".upload-"+hex.EncodeToString(buf)+".part"),
+	}
+	dst, err := os.Create(file.path)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	file.size, err = io.Copy(io.MultiWriter(dst, hash), part)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.path)
+		return nil, err
+	}
+	file.sha256 = hash.Sum(nil)
+	return file, nil
+}
+
+// removeStreamedFiles 删除尚未改名的临时文件
+func removeStreamedFiles(files []*streamedFile) {
+	for _, f := range files {
+		os.Remove(f.path)
+	}
+}
+
+// multipartError 将读取 multipart 表单的错误转换为 API 错误
+func multipartError(err error) error {
+	if isBodyTooLarge(err) {
+		return errFileTooLarge()
+	}
+	if errors.Is(err, multipart.ErrMessageTooLarge) {
+		return newAPIError(http.StatusRequestEntityTooLarge, codeUploadTooLarge, "form fields too large")
+	}
+	return fmt.Errorf("invalid multipart form: %v", err)
+}
+
+// saveSubmissionFile 将提交的文件保存到 path，返回内容的 SHA-256
+func saveSubmissionFile(input *submissionInput, path string) ([]byte, error) {
+	if input.saved != nil {
+		if err := os.Rename(input.saved.path, path); err == nil {
+			return input.saved.sha256, nil
+		}
+	}
+	dst, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, hash), input.file)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// nextFilePart 跳过其他字段，返回名为 field 的第一个文件部分，没有时返回 http.ErrMissingFile
+func nextFilePart(reader *multipart.Reader, field string) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// TaskUpdate 修改尚未开始的任务，未提供的字段保持不变；model 为空字符串时恢复使用默认模型。
+// notes 整体替换任务的备注（空对象表示清除），任何状态的任务都可以修改。
+// 提供 version 时只在任务的当前版本号与之相同时修改
+type TaskUpdate struct {
+	LangOut *string    `json:"lang_out,omitempty"`
+	Pages   *string    `json:"pages,omitempty"`
+	Model   *string    `json:"model,omitempty"`
+	Notes   *TaskNotes `json:"notes,omitempty"`
+	Version int        `json:"version,omitempty"`
+}
+
+// 修改排队中或计划执行的任务参数，以及任意任务的备注
+func updateTaskHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	taskID := r.PathValue("id")
+
+	var update TaskUpdate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&update); err != nil {
+		writeAPIError(w, invalidJSONError(err))
+		return
+	}
+
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, taskID))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	if update.Version < 0 {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "version must be a positive integer")
+		return
+	}
+	if update.Version > 0 && update.Version != task.Version {
+		writeVersionConflict(w, task.Version)
+		return
+	}
+	if update.Notes != nil {
+		update.Notes.normalize()
+		task.Notes = update.Notes
+		if task.Notes.IsEmpty() {
+			task.Notes = nil
+		}
+		if update.LangOut == nil && update.Pages == nil && update.Model == nil {
+			updateTaskNotes(w, task, update.Version)
+			return
+		}
+	}
+	if task.Status != "queued" && task.Status != "scheduled" {
+		writeTaskStartedError(w, task.Status)
+		return
+	}
+
+	if update.LangOut != nil {
+		_, langOut, err := normalizeLanguagePair(task.LangIn, *update.LangOut)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		task.LangOut = langOut
+	}
+	if update.Pages != nil {
+		task.Pages = strings.TrimSpace(*update.Pages)
+		// 按新的页码范围重新确定规模分级，排队中的任务在队列中的位置不变
+		if task.PageCount > 0 {
+			class, apiErr := sizeClassForPages(task.PageCount, task.Pages)
+			if apiErr != nil {
+				writeAPIError(w, apiErr)
+				return
+			}
+			task.SizeClass = class.Name
+		}
+	}
+	if update.Model != nil {
+		params := make(map[string]string)
+		if task.Params != "" {
+			json.Unmarshal([]byte(task.Params), &params)
+		}
+		if model := strings.TrimSpace(*update.Model); model != "" {
+			params["openai-model"] = model
+		} else {
+			delete(params, "openai-model")
+		}
+		paramsJSON, _ := json.Marshal(params)
+		task.Params = TaskParams(paramsJSON)
+	}
+
+	// 只在任务读取后未被修改时更新，避免与领取任务的 worker 或其他客户端竞争
+	res, err := execWithRetry(`UPDATE tasks SET lang_out = ?, pages = ?, params = ?, size_class = ?, notes = ?, version = version + 1 WHERE id = ? AND version = ?`,
+		task.LangOut, task.Pages, task.Params, task.SizeClass, notesColumn(task.Notes), task.ID, task.Version)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		current, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, task.ID))
+		switch {
+		case err == sql.ErrNoRows:
+			writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		case current.Status != "queued" && current.Status != "scheduled":
+			writeTaskStartedError(w, current.Status)
+		default:
+			writeVersionConflict(w, current.Version)
+		}
+		return
+	}
+	task.Version++
+
+	task.QueuePaused = task.Status == "queued" && isQueuePaused()
+	json.NewEncoder(w).Encode(task)
+}
+
+// updateTaskNotes 只修改备注。执行中的任务的版本号随进度不断变化，因此只在请求提供了 version 时检查
+func updateTaskNotes(w http.ResponseWriter, task *Task, version int) {
+	query, args := `UPDATE tasks SET notes = ? WHERE id = ?`, []interface{}{notesColumn(task.Notes), task.ID}
+	if version > 0 {
+		query += ` AND version = ?`
+		args = append(args, version)
+	}
+	res, err := execWithRetry(query, args...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var current int
+		if err := db.QueryRow(`SELECT version FROM tasks WHERE id = ?`, task.ID).Scan(&current); err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, codeTaskNotFound, "Task not found")
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		} else {
+			writeVersionConflict(w, current)
+		}
+		return
+	}
+
+	// 返回修改后的任务（版本号由触发器递增）
+	updated, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, task.ID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	updated.QueuePaused = updated.Status == "queued" && isQueuePaused()
+	json.NewEncoder(w).Encode(updated)
+}
+
+// notesColumn 将备注编码为 notes 列的值，没有备注时为 NULL
+func notesColumn(notes *TaskNotes) interface{} {
+	if notes.IsEmpty() {
+		return nil
+	}
+	data, _ := json.Marshal(notes)
+	return string(data)
+}
+
+func writeTaskStartedError(w http.ResponseWriter, status string) {
+	writeErrorDetails(w, http.StatusConflict, codeTaskNotEditable,
+		"Only queued or scheduled tasks can be edited (task is "+status+")", map[string]interface{}{"status": status})
+}
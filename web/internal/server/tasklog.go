@@ -0,0 +1,393 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 任务日志：服务的提示和 babeldoc 的每行输出都记录为一条结构化记录，按 JSON Lines 保存在 logs/<任务 ID>.jsonl。
+// GET /api/v1/tasks/{id}/logs 默认仍返回纯文本（每条记录一行，标准错误输出带 [STDERR] 前缀），
+// format=json 返回记录数组，format=jsonl 原样返回 JSON Lines；level 参数只返回不低于该级别的记录。
+// 早期版本的纯文本日志（logs/<任务 ID>.log）仍可读取，每行视为一条记录，时间取文件的修改时间。
+//
+//	TASK_LOG_TEXT  为 true 时同时写入纯文本日志 logs/<任务 ID>.log（与早期版本格式相同），供直接查看或 tail 日志文件的工具使用
+//
+// 轮询日志时传入上次返回的 offset（日志文件中已读取的字节数），只返回之后新写入的记录；
+// lines 限制返回的记录数，与 offset 一起使用时返回 offset 之后的前 lines 条，单独使用时返回最后 lines 条。
+
+// LogRecord 任务日志中的一条记录
+type LogRecord struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`           // debug（进度条刷新）、info、warning、error
+	Stage   string    `json:"stage,omitempty"` // 输出时任务所处的阶段：layout、translation、typesetting
+	Source  string    `json:"source"`          // service（服务的提示）、stdout、stderr
+	Attempt int       `json:"attempt,omitempty"`
+	Message string    `json:"message"`
+	// Progress 进度条刷新的记录中解析出的翻译进度（0-100）
+	Progress *int `json:"progress,omitempty"`
+}
+
+const (
+	logSourceService = "service"
+	logSourceStdout  = "stdout"
+	logSourceStderr  = "stderr"
+)
+
+var logLevelOrder = map[string]int{"debug": 0, "info": 1, "warning": 2, "error": 3}
+
+var taskLogText = os.Getenv("TASK_LOG_TEXT") == "true"
+
+var (
+	// Python logging / rich 的级别前缀，例如 "ERROR:babeldoc:..."、"[10/16/26 12:00:00] WARNING  ..."
+	logLevelPattern = regexp.MustCompile(`^\s*(?:\[[^\]]*\]\s*)?(DEBUG|INFO|WARNING|WARN|ERROR|CRITICAL|Traceback)\b`)
+)
+
+func taskLogPath(taskID string) string {
+	return filepath.Join(logsDir, taskID+".jsonl")
+}
+
+// legacyTaskLogPath 早期版本的纯文本日志
+func legacyTaskLogPath(taskID string) string {
+	return filepath.Join(logsDir, taskID+".log")
+}
+
+// taskLogger 写入一个任务的日志，可以被多个 goroutine 同时调用
+type taskLogger struct {
+	mu      sync.Mutex
+	file    *os.File
+	text    *os.File // TASK_LOG_TEXT 启用时的纯文本日志
+	attempt int
+	stage   string
+	onWrite func(n int) // 每次写入后调用，n 为写入的字节数
+}
+
+// openTaskLog 打开任务日志，重试时追加到已有日志之后。返回日志当前的大小
+func openTaskLog(task *Task, onWrite func(n int)) (*taskLogger, int64, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if task.Attempts > 1 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(taskLogPath(task.ID), flags, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	var offset int64
+	if info, err := file.Stat(); err == nil {
+		offset = info.Size()
+	}
+	logger := &taskLogger{file: file, attempt: task.Attempts, onWrite: onWrite}
+	if taskLogText {
+		if logger.text, err = os.OpenFile(legacyTaskLogPath(task.ID), flags, 0644); err != nil {
+			file.Close()
+			return nil, 0, err
+		}
+	}
+	return logger, offset, nil
+}
+
+// setStage 记录之后的输出所处的阶段，阶段只会前进
+func (l *taskLogger) setStage(stage string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if taskStageOrder[stage] > taskStageOrder[l.stage] {
+		l.stage = stage
+	}
+}
+
+// write 把一段文本按行记录，空行忽略
+func (l *taskLogger) write(source, text string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buf, textBuf []byte
+	for _, line := range strings.Split(text, "\n") {
+		line = cleanLogLine(line)
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		entry := &LogRecord{
+			Time:    time.Now(),
+			Level:   classifyLogLine(source, line),
+			Stage:   l.stage,
+			Source:  source,
+			Attempt: l.attempt,
+			Message: line,
+		}
+		if progress, ok := parseProgressLine(line); ok {
+			entry.Progress = &progress
+		}
+		record, _ := json.Marshal(entry)
+		buf = append(append(buf, record...), '\n')
+		if source == logSourceStderr {
+			textBuf = append(textBuf, "[STDERR] "...)
+		}
+		textBuf = append(append(textBuf, line...), '\n')
+	}
+	if len(buf) == 0 {
+		return
+	}
+	n, _ := l.file.Write(buf)
+	l.file.Sync()
+	if l.text != nil {
+		l.text.Write(textBuf)
+	}
+	if l.onWrite != nil {
+		l.onWrite(n)
+	}
+}
+
+func (l *taskLogger) Close() error {
+	if l.text != nil {
+		l.text.Close()
+	}
+	return l.file.Close()
+}
+
+// cleanLogLine 去掉终端控制序列，进度条刷新使用 \r，只保留最后一段
+func cleanLogLine(line string) string {
+	line = ansiEscapePattern.ReplaceAllString(line, "")
+	line = strings.TrimRight(line, "\r")
+	if i := strings.LastIndex(line, "\r"); i >= 0 {
+		line = line[i+1:]
+	}
+	return line
+}
+
+// classifyLogLine 判断一行输出的级别
+func classifyLogLine(source, line string) string {
+	if m := logLevelPattern.FindStringSubmatch(line); m != nil {
+		switch m[1] {
+		case "DEBUG":
+			return "debug"
+		case "INFO":
+			return "info"
+		case "WARNING", "WARN":
+			return "warning"
+		default:
+			return "error"
+		}
+	}
+	if source == logSourceService && strings.HasPrefix(line, "警告") {
+		return "warning"
+	}
+	if _, ok := parseProgressLine(line); ok {
+		return "debug"
+	}
+	if _, ok := parseStageLine(line); ok {
+		return "debug"
+	}
+	return "info"
+}
+
+// writeStaticTaskLog 一次写入已结束任务的完整日志（例如示例任务）
+func writeStaticTaskLog(task *Task, text string, at time.Time) error {
+	var buf []byte
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		record, _ := json.Marshal(&LogRecord{
+			Time: at, Level: classifyLogLine(logSourceService, line), Source: logSourceService, Attempt: 1, Message: line,
+		})
+		buf = append(append(buf, record...), '\n')
+	}
+	return os.WriteFile(taskLogPath(task.ID), buf, 0644)
+}
+
+// logQuery 日志查询条件
+type logQuery struct {
+	minLevel string
+	offset   int64 // 从日志文件的该字节位置开始读取
+	limit    int   // 最多返回的记录数，0 表示不限
+	tail     bool  // limit 取最后的记录而不是最前的记录
+}
+
+// logPage 一次日志查询的结果
+type logPage struct {
+	Records []*LogRecord `json:"records"`
+	Offset  int64        `json:"offset"`          // 下次查询传入的 offset
+	More    bool         `json:"more,omitempty"`  // 受 lines 限制，offset 之后还有未返回的内容
+	Reset   bool         `json:"reset,omitempty"` // offset 超出日志大小（日志已被重新创建），已从头读取
+}
+
+// readTaskLog 读取任务日志中符合条件的记录，日志不存在时返回 os.ErrNotExist。
+// 只读取完整的行，正在写入的最后一行留到下次读取
+func readTaskLog(taskID string, q logQuery) (*logPage, error) {
+	file, err := os.Open(taskLogPath(taskID))
+	legacy := false
+	if os.IsNotExist(err) {
+		file, err = os.Open(legacyTaskLogPath(taskID))
+		legacy = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	modTime := info.ModTime()
+	page := &logPage{Records: []*LogRecord{}, Offset: q.offset}
+	if q.offset > info.Size() {
+		page.Offset, page.Reset = 0, true
+	}
+	if _, err := file.Seek(page.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		if q.limit > 0 && !q.tail && len(page.Records) == q.limit {
+			// 后面是否还有内容
+			if _, err := reader.Peek(1); err == nil {
+				page.More = true
+			}
+			break
+		}
+		raw, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		page.Offset += int64(len(raw))
+
+		var record LogRecord
+		if legacy {
+			line, source := cleanLogLine(strings.TrimRight(string(raw), "\n")), logSourceStdout
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if rest, ok := strings.CutPrefix(line, "[STDERR] "); ok {
+				line, source = rest, logSourceStderr
+			} else if strings.HasPrefix(line, "==>") {
+				source = logSourceService
+			}
+			record = LogRecord{Time: modTime, Level: classifyLogLine(source, line), Source: source, Message: line}
+		} else if err := json.Unmarshal(raw, &record); err != nil {
+			continue
+		}
+		if logLevelOrder[record.Level] >= logLevelOrder[q.minLevel] {
+			page.Records = append(page.Records, &record)
+			if q.tail && len(page.Records) > q.limit*2 {
+				page.Records = append([]*LogRecord(nil), page.Records[len(page.Records)-q.limit:]...)
+			}
+		}
+	}
+	if q.tail && len(page.Records) > q.limit {
+		page.Records = page.Records[len(page.Records)-q.limit:]
+	}
+	return page, nil
+}
+
+// taskLogModTime 返回任务日志最后写入的时间
+func taskLogModTime(taskID string) (time.Time, bool) {
+	for _, path := range []string{taskLogPath(taskID), legacyTaskLogPath(taskID)} {
+		if info, err := os.Stat(path); err == nil {
+			return info.ModTime(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// removeTaskLog 删除任务日志
+func removeTaskLog(taskID string) {
+	os.Remove(taskLogPath(taskID))
+	os.Remove(legacyTaskLogPath(taskID))
+}
+
+// 获取任务日志
+func taskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := r.PathValue("id")
+	if taskID == "" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "Invalid task ID")
+		return
+	}
+	level := strings.ToLower(r.URL.Query().Get("level"))
+	if level == "" {
+		level = "debug"
+	}
+	if _, ok := logLevelOrder[level]; !ok {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "level must be one of debug, info, warning, error")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "text" && format != "json" && format != "jsonl" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "format must be one of text, json, jsonl")
+		return
+	}
+
+	q := logQuery{minLevel: level}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		q.offset = offset
+	}
+	if value := r.URL.Query().Get("lines"); value != "" {
+		lines, err := strconv.Atoi(value)
+		if err != nil || lines <= 0 {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "lines must be a positive integer")
+			return
+		}
+		q.limit = lines
+		q.tail = r.URL.Query().Get("offset") == ""
+	}
+
+	page, err := readTaskLog(taskID, q)
+	if err != nil {
+		if os.IsNotExist(err) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("日志文件不存在或任务尚未开始"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error reading log")
+		return
+	}
+
+	// 纯文本和 JSON Lines 格式通过响应头返回下次查询的位置
+	w.Header().Set("X-Log-Offset", strconv.FormatInt(page.Offset, 10))
+	if page.More {
+		w.Header().Set("X-Log-More", "true")
+	}
+	if page.Reset {
+		w.Header().Set("X-Log-Reset", "true")
+	}
+
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, record := range page.Records {
+			enc.Encode(record)
+		}
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		var b strings.Builder
+		for _, record := range page.Records {
+			if record.Source == logSourceStderr {
+				b.WriteString("[STDERR] ")
+			}
+			b.WriteString(record.Message)
+			b.WriteByte('\n')
+		}
+		w.Write([]byte(b.String()))
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 纯文本版本：GET /api/v1/tasks/{id}/text 返回译文的纯文本（format=txt，默认）或 Markdown（format=md），
+// 网络较差时无需下载动辄上百 MB 的 PDF 即可阅读，也便于屏幕阅读器朗读。
+//
+// 默认使用单语版本，file 参数指定其他输出文件。文本在第一次请求时用 pdftotext（poppler-utils）提取，
+// 缓存在 DATA_DIR/text/<任务 ID>/ 下，输出文件更新后重新提取；删除任务时一并删除。
+// pdftotext 按行输出，同一段落中的行重新连接（中文、日文之间不加空格，英文行尾的连字符去掉），段落之间空一行；
+// Markdown 版本以文件名为标题，每页一个二级标题。客户端支持时以 gzip 压缩传输。
+// 输出文件归档后已提取的文本仍可访问，否则需要先取回。找不到 pdftotext 时返回 503。
+var (
+	textVariantsDir = filepath.Join(dataDir, "text")
+
+	// 每个缓存文件一个锁，同一文件的并发请求只提取一次
+	textVariantLocks sync.Map
+
+	// Markdown 中需要转义的行首标记：标题、引用、列表和编号列表
+	markdownBlockPrefix = regexp.MustCompile(`^(#|>|[-+*]\s|\d+[.)]\s)`)
+)
+
+var markdownEscape = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+).Replace
+
+// taskTextHandler 返回译文的纯文本或 Markdown 版本
+func taskTextHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "txt"
+	}
+	if format != "txt" && format != "md" {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "format must be txt or md")
+		return
+	}
+	task, file := previewTask(w, r)
+	if task == nil {
+		return
+	}
+
+	cachePath := filepath.Join(textVariantsDir, task.ID, file+".txt")
+	if task.StorageTier != "" {
+		// 已归档：只能返回之前提取的文本
+		if _, err := os.Stat(cachePath); err == nil {
+			serveTextVariant(w, r, file, cachePath, format)
+			return
+		}
+		writeRestoring(w, task)
+		return
+	}
+
+	path := taskOutputPath(task, file)
+	ensureLocal(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+		return
+	}
+	if cached, err := os.Stat(cachePath); err == nil && !cached.ModTime().Before(info.ModTime()) {
+		serveTextVariant(w, r, file, cachePath, format)
+		return
+	}
+	if !hasPdftotext() {
+		writeError(w, http.StatusServiceUnavailable, codeTextUnavailable, "pdftotext is not installed on the server")
+		return
+	}
+
+	lock, _ := textVariantLocks.LoadOrStore(cachePath, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	// 等待期间其他请求可能已经提取完成
+	if cached, err := os.Stat(cachePath); err != nil || cached.ModTime().Before(info.ModTime()) {
+		if apiErr := extractTextVariant(path, cachePath); apiErr != nil {
+			writeAPIError(w, apiErr)
+			return
+		}
+	}
+	serveTextVariant(w, r, file, cachePath, format)
+}
+
+// extractTextVariant 用 pdftotext 把输出文件的文本（页之间以换页符分隔）保存到 cachePath
+func extractTextVariant(path, cachePath string) *apiError {
+	source, cleanup, err := decompressedOutputCopy(path)
+	if err != nil {
+		return newAPIError(http.StatusNotFound, codeFileNotFound, "File not found")
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdftotextTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "pdftotext", "-enc", "UTF-8", "-q", source, "-").Output()
+	if err != nil {
+		log.Printf("无法提取 %s 的文本: %v", path, err)
+		return newAPIError(http.StatusInternalServerError, codeInternal, "Error extracting text")
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return newAPIError(http.StatusInternalServerError, codeInternal, "Error creating text directory")
+	}
+	if err := writeFileAtomic(cachePath, bytes.NewReader(out)); err != nil {
+		return newAPIError(http.StatusInternalServerError, codeInternal, "Error saving text")
+	}
+	return nil
+}
+
+// serveTextVariant 把缓存的文本整理为段落后返回
+func serveTextVariant(w http.ResponseWriter, r *http.Request, file, cachePath, format string) {
+	raw, err := os.ReadFile(cachePath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, codeFileNotFound, "File not found")
+		return
+	}
+	pages := textPages(string(raw))
+
+	var b strings.Builder
+	name := strings.TrimSuffix(file, filepath.Ext(file))
+	if format == "md" {
+		fmt.Fprintf(&b, "# %s\n", markdownEscape(name))
+		for i, paragraphs := range pages {
+			fmt.Fprintf(&b, "\n## 第 %d 页\n", i+1)
+			for _, p := range paragraphs {
+				if markdownBlockPrefix.MatchString(p) {
+					p = `\` + p
+				}
+				b.WriteString("\n" + markdownEscape(p) + "\n")
+			}
+		}
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	} else {
+		for _, paragraphs := range pages {
+			for _, p := range paragraphs {
+				if b.Len() > 0 {
+					b.WriteString("\n")
+				}
+				b.WriteString(p + "\n")
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%s.%s", filepath.Base(name), format))
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		io.WriteString(w, b.String())
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	io.WriteString(gz, b.String())
+	gz.Close()
+}
+
+// textPages 把 pdftotext 的输出按换页符分页，每页按空行分段，并把段落中的行重新连接
+func textPages(raw string) [][]string {
+	pages := strings.Split(raw, "\f")
+	// pdftotext 在最后一页之后也输出换页符
+	if len(pages) > 1 && strings.TrimSpace(pages[len(pages)-1]) == "" {
+		pages = pages[:len(pages)-1]
+	}
+	result := make([][]string, 0, len(pages))
+	for _, page := range pages {
+		var paragraphs []string
+		var current string
+		for _, line := range strings.Split(page, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				if current != "" {
+					paragraphs = append(paragraphs, current)
+					current = ""
+				}
+				continue
+			}
+			current = joinTextLines(current, line)
+		}
+		if current != "" {
+			paragraphs = append(paragraphs, current)
+		}
+		result = append(result, paragraphs)
+	}
+	return result
+}
+
+// joinTextLines 连接同一段落中的两行
+func joinTextLines(prev, next string) string {
+	if prev == "" {
+		return next
+	}
+	last, _ := utf8.DecodeLastRuneInString(prev)
+	first, _ := utf8.DecodeRuneInString(next)
+	switch {
+	case last == '-' && unicode.IsLower(first):
+		// 英文单词在行尾断开
+		return strings.TrimSuffix(prev, "-") + next
+	case isCJKRune(last) || isCJKRune(first):
+		return prev + next
+	default:
+		return prev + " " + next
+	}
+}
+
+// isCJKRune 是否为中文、日文文字或全角标点，这些字符之间不加空格（韩文以空格分词，不在此列）
+func isCJKRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+// deleteTaskTextVariants 删除任务的纯文本缓存
+func deleteTaskTextVariants(taskID string) {
+	os.RemoveAll(filepath.Join(textVariantsDir, taskID))
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// 任务各阶段耗时：提交时记录接收并保存上传文件的耗时，执行时记录排队等待、babeldoc 启动、版面分析、翻译、排版
+// 和移动输出文件的耗时，保存在 timings 列（JSON），只在任务详情中返回。
+// 自动重试时排队等待累计所有次数，执行阶段按最近一次执行重新记录；阶段按 babeldoc 输出的阶段信息划分，
+// 没有输出某个阶段（例如模拟翻译器、被跳过的阶段）时省略。
+
+// 耗时的阶段名（版面分析、翻译、排版沿用 taskStage* 常量）
+const (
+	timingStartup    = "startup"
+	timingOutputMove = "output_move"
+)
+
+// TaskTimings 任务各阶段的耗时（秒），未经过的阶段省略
+type TaskTimings struct {
+	Upload      *float64 `json:"upload,omitempty"`      // 接收并保存上传的文件
+	QueueWait   *float64 `json:"queue_wait,omitempty"`  // 从提交（计划任务、重试为计划时间）到开始执行，重试时累计
+	Startup     *float64 `json:"startup,omitempty"`     // 启动 babeldoc 到输出第一个阶段
+	Layout      *float64 `json:"layout,omitempty"`      // 版面分析
+	Translation *float64 `json:"translation,omitempty"` // 翻译
+	Typesetting *float64 `json:"typesetting,omitempty"` // 排版
+	OutputMove  *float64 `json:"output_move,omitempty"` // 查找并移动输出文件
+	Attempt     int      `json:"attempt,omitempty"`     // 执行阶段的耗时所属的执行次数
+}
+
+// add 累加阶段的耗时
+func (tt *TaskTimings) add(stage string, d time.Duration) {
+	var field **float64
+	switch stage {
+	case timingStartup:
+		field = &tt.Startup
+	case taskStageLayout:
+		field = &tt.Layout
+	case taskStageTranslation:
+		field = &tt.Translation
+	case taskStageTypesetting:
+		field = &tt.Typesetting
+	case timingOutputMove:
+		field = &tt.OutputMove
+	default:
+		return
+	}
+	seconds := d.Seconds()
+	if *field != nil {
+		seconds += **field
+	}
+	*field = roundedSeconds(seconds)
+}
+
+// roundedSeconds 保留两位小数
+func roundedSeconds(seconds float64) *float64 {
+	seconds = math.Round(seconds*100) / 100
+	return &seconds
+}
+
+// loadTaskTimings 读取任务的阶段耗时，没有记录时返回 nil
+func loadTaskTimings(taskID string) *TaskTimings {
+	var data *string
+	if err := db.QueryRow(`SELECT timings FROM tasks WHERE id = ?`, taskID).Scan(&data); err != nil || data == nil || *data == "" {
+		return nil
+	}
+	var timings TaskTimings
+	if err := json.Unmarshal([]byte(*data), &timings); err != nil {
+		return nil
+	}
+	return &timings
+}
+
+func saveTaskTimings(taskID string, timings *TaskTimings) {
+	data, _ := json.Marshal(timings)
+	if _, err := execWithRetry(`UPDATE tasks SET timings = ? WHERE id = ?`, string(data), taskID); err != nil {
+		log.Printf("无法记录任务 %s 的阶段耗时: %v", taskID, err)
+	}
+}
+
+// taskTimer 记录一次执行中各阶段的耗时，可以被多个 goroutine 同时调用
+type taskTimer struct {
+	mu      sync.Mutex
+	taskID  string
+	timings TaskTimings
+	stage   string // 当前阶段，为空表示未在计时
+	since   time.Time
+}
+
+// startTaskTimer 在任务开始执行时调用：累计排队等待时间，清除上次执行的阶段耗时
+func startTaskTimer(task *Task) *taskTimer {
+	t := &taskTimer{taskID: task.ID}
+	if previous := loadTaskTimings(task.ID); previous != nil {
+		t.timings.Upload = previous.Upload
+		t.timings.QueueWait = previous.QueueWait
+	}
+	queuedAt := task.CreatedAt
+	if task.RunAt != nil && task.RunAt.After(queuedAt) {
+		queuedAt = *task.RunAt
+	}
+	if task.StartedAt != nil && task.StartedAt.After(queuedAt) {
+		wait := task.StartedAt.Sub(queuedAt).Seconds()
+		if t.timings.QueueWait != nil {
+			wait += *t.timings.QueueWait
+		}
+		t.timings.QueueWait = roundedSeconds(wait)
+	}
+	t.timings.Attempt = task.Attempts
+	saveTaskTimings(t.taskID, &t.timings)
+	return t
+}
+
+// enter 结束当前阶段并开始 stage。babeldoc 的阶段只会前进，重绘之前阶段的进度条时忽略
+func (t *taskTimer) enter(stage string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if order, ok := taskStageOrder[stage]; ok && order <= taskStageOrder[t.stage] {
+		return
+	}
+	if stage == t.stage {
+		return
+	}
+	now := time.Now()
+	if t.stage != "" {
+		t.timings.add(t.stage, now.Sub(t.since))
+	}
+	t.stage, t.since = stage, now
+	saveTaskTimings(t.taskID, &t.timings)
+}
+
+// finish 结束当前阶段
+func (t *taskTimer) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stage == "" {
+		return
+	}
+	t.timings.add(t.stage, time.Since(t.since))
+	t.stage = ""
+	saveTaskTimings(t.taskID, &t.timings)
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// token 用量指标：babeldoc 结束时输出本次执行消耗的 token 数（Prompt tokens / Completion tokens / Total tokens），
+// worker 解析后按服务商和模型累加到 token_spend 表，并按价格估算费用。GET /metrics（需要管理令牌，设置了 ADMIN_LISTEN 时只在管理地址提供）
+// 以 Prometheus 文本格式导出这些计数器，可以在 Grafana 中与基础设施指标一起绘图和告警。
+// 计数器保存在数据库中，服务重启、多个 worker 进程或删除任务都不会使其减少。
+//
+//	MODEL_PRICES  各模型每百万 token 的价格（JSON），例如 {"gpt-4o-mini": {"prompt": 0.15, "completion": 0.6}}；
+//	              未配置价格的模型只统计 token 数，估算费用为 0。费用在记录时按当时的价格计算，之后修改价格不影响已累计的费用
+//
+// 服务商为队列或环境变量配置的服务商名（见 providers.go），使用提交表单中的 API Key 或 Base URL 时为 custom，模拟翻译器为 mock。
+const customProviderName = "custom"
+
+// ModelPrice 模型每百万 token 的价格
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+var modelPrices = loadModelPrices()
+
+// tokenUsagePattern 匹配 babeldoc 输出的 token 用量，例如 "Prompt tokens: 1234"、"total_tokens=5678"
+var tokenUsagePattern = regexp.MustCompile(`(?i)\b(prompt|completion|total)[ _]tokens?(?:[ _]count)?\s*[:=]\s*(\d+)`)
+
+func loadModelPrices() map[string]ModelPrice {
+	prices := make(map[string]ModelPrice)
+	value := os.Getenv("MODEL_PRICES")
+	if value == "" {
+		return prices
+	}
+	if err := json.Unmarshal([]byte(value), &prices); err != nil {
+		log.Printf("无法解析 MODEL_PRICES，不估算费用: %v", err)
+		return make(map[string]ModelPrice)
+	}
+	return prices
+}
+
+func createTokenSpendTable() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS token_spend (
+		provider ` + t.Key + ` NOT NULL,
+		model ` + t.Key + ` NOT NULL,
+		prompt_tokens ` + t.Integer + ` NOT NULL DEFAULT 0,
+		completion_tokens ` + t.Integer + ` NOT NULL DEFAULT 0,
+		total_tokens ` + t.Integer + ` NOT NULL DEFAULT 0,
+		estimated_cost ` + t.Real + ` NOT NULL DEFAULT 0,
+		runs ` + t.Integer + ` NOT NULL DEFAULT 0,
+		updated_at ` + t.Time + ` NOT NULL,
+		PRIMARY KEY (provider, model)
+	)`)
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+}
+
+// parseTokenUsageLine 从 babeldoc 的一行输出中解析 token 用量，kind 为 prompt、completion 或 total
+func parseTokenUsageLine(line string) (kind string, n int64, ok bool) {
+	m := tokenUsagePattern.FindStringSubmatch(ansiEscapePattern.ReplaceAllString(line, ""))
+	if m == nil {
+		return "", 0, false
+	}
+	n, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.ToLower(m[1]), n, true
+}
+
+// tokenCollector 收集一次执行输出的 token 用量，可以被多个 goroutine 同时调用。
+// babeldoc 输出的是累计值，同一种用量出现多次时取最后一次
+type tokenCollector struct {
+	mu                        sync.Mutex
+	prompt, completion, total int64
+}
+
+func (c *tokenCollector) add(kind string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch kind {
+	case "prompt":
+		c.prompt = n
+	case "completion":
+		c.completion = n
+	case "total":
+		c.total = n
+	}
+}
+
+// save 把本次执行的用量累加到服务商和模型的计数器，没有输出用量时不记录
+func (c *tokenCollector) save(taskID, provider, model string) {
+	c.mu.Lock()
+	prompt, completion, total := c.prompt, c.completion, c.total
+	c.mu.Unlock()
+	if total < prompt+completion {
+		total = prompt + completion
+	}
+	if total == 0 {
+		return
+	}
+
+	// 只有总数时按输入价格估算
+	price := modelPrices[model]
+	cost := float64(prompt)*price.Prompt/1e6 + float64(completion)*price.Completion/1e6
+	if prompt+completion == 0 {
+		cost = float64(total) * price.Prompt / 1e6
+	}
+
+	_, err := execWithRetry(`INSERT INTO token_spend (provider, model, prompt_tokens, completion_tokens, total_tokens, estimated_cost, runs, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?)
+		`+dbStore.Upsert("provider", "model")+`
+			prompt_tokens = token_spend.prompt_tokens + excluded.prompt_tokens,
+			completion_tokens = token_spend.completion_tokens + excluded.completion_tokens,
+			total_tokens = token_spend.total_tokens + excluded.total_tokens,
+			estimated_cost = token_spend.estimated_cost + excluded.estimated_cost,
+			runs = token_spend.runs + 1,
+			updated_at = excluded.updated_at`,
+		provider, model, prompt, completion, total, cost, time.Now())
+	if err != nil {
+		log.Printf("无法记录任务 %s 的 token 用量: %v", taskID, err)
+		return
+	}
+	message := fmt.Sprintf("%s / %s 消耗 %d token（输入 %d，输出 %d）", provider, model, total, prompt, completion)
+	if cost > 0 {
+		message += fmt.Sprintf("，估算费用 %.4f", cost)
+	}
+	recordTaskEvent(taskID, "task.tokens", message)
+}
+
+// Prometheus 文本格式的指标
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`SELECT provider, model, prompt_tokens, completion_tokens, total_tokens, estimated_cost, runs
+		FROM token_spend ORDER BY provider, model`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	var tokens, costs, runs strings.Builder
+	for rows.Next() {
+		var provider, model string
+		var prompt, completion, total, count int64
+		var cost float64
+		if err := rows.Scan(&provider, &model, &prompt, &completion, &total, &cost, &count); err != nil {
+			continue
+		}
+		labels := fmt.Sprintf(`provider="%s",model="%s"`, escapeLabelValue(provider), escapeLabelValue(model))
+		fmt.Fprintf(&tokens, "babeldoc_tokens_total{%s,type=\"prompt\"} %d\n", labels, prompt)
+		fmt.Fprintf(&tokens, "babeldoc_tokens_total{%s,type=\"completion\"} %d\n", labels, completion)
+		// 只输出了总数的执行无法区分输入和输出
+		if other := total - prompt - completion; other > 0 {
+			fmt.Fprintf(&tokens, "babeldoc_tokens_total{%s,type=\"unknown\"} %d\n", labels, other)
+		}
+		fmt.Fprintf(&costs, "babeldoc_estimated_cost_total{%s} %s\n", labels, strconv.FormatFloat(math.Round(cost*1e6)/1e6, 'f', -1, 64))
+		fmt.Fprintf(&runs, "babeldoc_token_usage_runs_total{%s} %d\n", labels, count)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "# HELP babeldoc_tokens_total Tokens consumed by translations, by provider, model and type.")
+	fmt.Fprintln(w, "# TYPE babeldoc_tokens_total counter")
+	fmt.Fprint(w, tokens.String())
+	fmt.Fprintln(w, "# HELP babeldoc_estimated_cost_total Estimated spend according to MODEL_PRICES, by provider and model.")
+	fmt.Fprintln(w, "# TYPE babeldoc_estimated_cost_total counter")
+	fmt.Fprint(w, costs.String())
+	fmt.Fprintln(w, "# HELP babeldoc_token_usage_runs_total Translation runs that reported token usage, by provider and model.")
+	fmt.Fprintln(w, "# TYPE babeldoc_token_usage_runs_total counter")
+	fmt.Fprint(w, runs.String())
+}
+
+// escapeLabelValue 按 Prometheus 文本格式转义标签值
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,329 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 平滑升级与停止：
+//
+//	GRACEFUL_SHUTDOWN_TIMEOUT  停止时等待进行中的请求（上传、下载、导出等）完成的最长时间（默认 5m）
+//
+// 收到 SIGHUP 时以相同的参数和环境变量启动新进程（os.Executable，替换可执行文件后即为新版本），
+// 监听套接字（包括 ADMIN_LISTEN）以继承的文件描述符交给新进程，升级期间新连接不会被拒绝。
+// 新进程准备好后，旧进程停止接受新连接、等待进行中的请求完成，WebSocket 客户端收到 1001（going away）关闭帧后重连到新进程。
+// 旧进程不再领取任务，正在执行的任务在旧进程中执行完毕后才退出；使用内存队列时，新进程在旧进程退出后
+// 重新检查排队中的任务（升级期间提交到旧进程的任务），并重置旧进程未能执行完（例如被强制终止）的任务。
+// 新进程启动失败时旧进程继续提供服务。
+//
+// 收到 SIGTERM 或 SIGINT 时同样停止领取任务并等待进行中的请求完成后退出，正在执行的任务会中断，下次启动时重新排队。
+var gracefulShutdownTimeout = parseDurationEnv("GRACEFUL_SHUTDOWN_TIMEOUT", 5*time.Minute)
+
+const (
+	listenerPublic = "public"
+	listenerAdmin  = "admin"
+
+	// upgradeListenersEnv 新进程继承的监听套接字名称（逗号分隔），依次为文件描述符 3、4……，
+	// 之后是就绪通知管道和旧进程存活管道
+	upgradeListenersEnv = "BABELDOC_UPGRADE_LISTENERS"
+
+	// upgradeReadyTimeout 等待新进程就绪的最长时间
+	upgradeReadyTimeout = 2 * time.Minute
+)
+
+// trackedServer 本进程提供服务的 HTTP 服务及其监听套接字
+type trackedServer struct {
+	name     string
+	srv      *http.Server
+	listener net.Listener
+}
+
+var (
+	upgradeMu          sync.Mutex
+	trackedServers     []*trackedServer
+	inheritedListeners map[string]net.Listener
+
+	upgradeReady  *os.File // 新进程就绪后写入一个字节，通知旧进程
+	upgradeParent *os.File // 旧进程退出后读到 EOF，nil 表示不是升级启动的进程
+	upgradeChild  *os.File // 旧进程持有的存活管道写端，退出时由系统关闭
+
+	// draining 为 true 后 worker 不再领取任务；runningTasks 统计正在执行的任务
+	draining     bool
+	runningTasks sync.WaitGroup
+)
+
+// initUpgrade 读取旧进程交接的监听套接字和管道
+func initUpgrade() {
+	value := os.Getenv(upgradeListenersEnv)
+	if value == "" {
+		return
+	}
+	// 不传给 babeldoc 等子进程
+	os.Unsetenv(upgradeListenersEnv)
+
+	inheritedListeners = make(map[string]net.Listener)
+	fd := uintptr(3)
+	for _, name := range strings.Split(value, ",") {
+		file := os.NewFile(fd, name)
+		fd++
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("无法使用旧进程交接的监听套接字 %s: %v", name, err)
+		}
+		inheritedListeners[name] = ln
+	}
+	upgradeReady = os.NewFile(fd, "upgrade-ready")
+	upgradeParent = os.NewFile(fd+1, "upgrade-parent")
+	log.Printf("平滑升级：已接管旧进程的监听套接字 %s", value)
+}
+
+// isUpgradeChild 本进程是否由旧进程在平滑升级时启动
+func isUpgradeChild() bool {
+	return upgradeParent != nil
+}
+
+// inheritedListener 返回旧进程交接的监听套接字
+func inheritedListener(name string) (net.Listener, bool) {
+	upgradeMu.Lock()
+	defer upgradeMu.Unlock()
+	ln, ok := inheritedListeners[name]
+	return ln, ok
+}
+
+// listen 返回 HTTP 服务的监听套接字，平滑升级时沿用旧进程的套接字
+func listen(name, addr string) (net.Listener, error) {
+	if ln, ok := inheritedListener(name); ok {
+		return ln, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// trackServer 记录提供服务的 HTTP 服务，停止和升级时据此交接套接字和等待请求完成
+func trackServer(name string, srv *http.Server, ln net.Listener) {
+	upgradeMu.Lock()
+	defer upgradeMu.Unlock()
+	trackedServers = append(trackedServers, &trackedServer{name: name, srv: srv, listener: ln})
+}
+
+// beginTask worker 开始执行任务前调用，停止领取任务后返回 false；返回 true 时执行完毕后必须调用 runningTasks.Done
+func beginTask() bool {
+	upgradeMu.Lock()
+	defer upgradeMu.Unlock()
+	if draining {
+		return false
+	}
+	runningTasks.Add(1)
+	return true
+}
+
+// stopTakingTasks 停止领取任务。共享队列中已取出但未执行的任务放回队列，交给新进程或其他实例
+func stopTakingTasks() {
+	upgradeMu.Lock()
+	draining = true
+	upgradeMu.Unlock()
+	if taskQueues[queueConfigs[0].Name].Durable() {
+		scheduler.requeueHeld()
+	}
+}
+
+// notifyUpgradeReady 通知旧进程本进程已准备好接受连接
+func notifyUpgradeReady() {
+	if upgradeReady == nil {
+		return
+	}
+	upgradeReady.Write([]byte{1})
+	upgradeReady.Close()
+	upgradeReady = nil
+}
+
+// recoverTasksAfterUpgrade 平滑升级启动的进程使用内存队列时，先恢复排队中的任务；
+// 旧进程仍在执行的任务等旧进程退出后，未执行完的重置为排队并与升级期间提交到旧进程的任务一起入队
+func recoverTasksAfterUpgrade() {
+	var inherited []string
+	rows, err := db.Query(`SELECT id FROM tasks WHERE status = 'running'`)
+	if err != nil {
+		log.Printf("无法查询执行中的任务: %v", err)
+	} else {
+		for rows.Next() {
+			var id string
+			if rows.Scan(&id) == nil {
+				inherited = append(inherited, id)
+			}
+		}
+		rows.Close()
+	}
+	if inherited == nil {
+		inherited = []string{}
+	}
+	enqueueQueuedTasks()
+
+	go func() {
+		io.Copy(io.Discard, upgradeParent)
+		upgradeParent.Close()
+		log.Printf("平滑升级：旧进程已退出")
+		resetInterruptedTasks(inherited)
+		enqueueQueuedTasks()
+	}()
+}
+
+// waitForSignals 处理停止和升级信号，返回后进程退出
+func waitForSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	for sig := range signals {
+		upgraded := sig == syscall.SIGHUP
+		if upgraded {
+			if err := startUpgrade(); err != nil {
+				log.Printf("平滑升级失败，继续提供服务: %v", err)
+				continue
+			}
+		} else {
+			log.Printf("收到 %v，停止服务（再次收到时立即退出）", sig)
+		}
+
+		stopTakingTasks()
+		done := make(chan struct{})
+		go func() {
+			shutdownServers(upgraded)
+			if upgraded {
+				log.Printf("平滑升级：等待正在执行的任务完成")
+				runningTasks.Wait()
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case sig := <-signals:
+			log.Printf("收到 %v，立即退出", sig)
+		}
+		return
+	}
+}
+
+// startUpgrade 启动新进程并交接监听套接字，新进程就绪后返回
+func startUpgrade() error {
+	if os.Getpid() == 1 {
+		// 作为容器的 1 号进程时，旧进程退出会导致容器停止
+		return errors.New("以 1 号进程运行时不支持平滑升级，请使用滚动更新")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	upgradeMu.Lock()
+	servers := append([]*trackedServer(nil), trackedServers...)
+	upgradeMu.Unlock()
+
+	var files []*os.File
+	var names []string
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, s := range servers {
+		filer, ok := s.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("监听套接字 %s 不支持交接", s.name)
+		}
+		file, err := filer.File()
+		if err != nil {
+			return fmt.Errorf("无法交接监听套接字 %s: %v", s.name, err)
+		}
+		files = append(files, file)
+		names = append(names, s.name)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+	parentR, parentW, err := os.Pipe()
+	if err != nil {
+		readyW.Close()
+		return err
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), upgradeListenersEnv+"="+strings.Join(names, ","))
+	cmd.ExtraFiles = append(append([]*os.File(nil), files...), readyW, parentR)
+	err = cmd.Start()
+	readyW.Close()
+	parentR.Close()
+	if err != nil {
+		parentW.Close()
+		return fmt.Errorf("无法启动新进程: %v", err)
+	}
+	go cmd.Wait()
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := readyR.Read(buf)
+		ready <- err
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			parentW.Close()
+			return errors.New("新进程在就绪前退出")
+		}
+	case <-time.After(upgradeReadyTimeout):
+		cmd.Process.Kill()
+		parentW.Close()
+		return errors.New("等待新进程就绪超时")
+	}
+
+	// 存活管道保持打开直到本进程退出
+	upgradeChild = parentW
+	log.Printf("平滑升级：新进程 %d 已就绪", cmd.Process.Pid)
+	return nil
+}
+
+// shutdownServers 停止接受新连接，等待进行中的请求完成，超时后强制关闭。handedOver 表示监听套接字已交给新进程
+func shutdownServers(handedOver bool) {
+	upgradeMu.Lock()
+	servers := append([]*trackedServer(nil), trackedServers...)
+	upgradeMu.Unlock()
+
+	// 已交接的 Unix 套接字文件由新进程继续使用，关闭时不能删除
+	for _, s := range servers {
+		if ln, ok := s.listener.(*net.UnixListener); ok && handedOver {
+			ln.SetUnlinkOnClose(false)
+		}
+	}
+	// WebSocket 连接已被接管，不在 Shutdown 的等待范围内，通知客户端重连
+	taskHub.closeAll()
+
+	ctx, cancel := context.WithTimeout(context.Background(), gracefulShutdownTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *trackedServer) {
+			defer wg.Done()
+			if err := s.srv.Shutdown(ctx); err != nil {
+				log.Printf("等待 %s 上的请求完成超时，强制关闭: %v", s.name, err)
+				s.srv.Close()
+			}
+		}(s)
+	}
+	wg.Wait()
+	log.Printf("已停止接受新连接，进行中的请求已完成")
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 上传准入控制：统计正在进行的上传数量及其预计占用的临时空间，超过限制时等待，等待超时后拒绝。
+//
+//	MAX_CONCURRENT_UPLOADS  同时进行的上传数上限（默认 8，0 表示不限制）
+//	UPLOAD_TEMP_SPACE_LIMIT 正在进行的上传合计占用的临时空间上限，字节（默认 1073741824，0 表示不限制）
+//	UPLOAD_WAIT_TIMEOUT     超过限制时的最长等待时间（默认 30s，0 表示立即拒绝）
+//
+// 每个上传按 Content-Length 预占空间，未提供时按单个文件的大小上限计算。
+var (
+	maxConcurrentUploads = parseIntEnv("MAX_CONCURRENT_UPLOADS", 8)
+	uploadTempSpaceLimit = parseSizeEnv("UPLOAD_TEMP_SPACE_LIMIT", 1<<30)
+	uploadWaitTimeout    = parseDurationEnv("UPLOAD_WAIT_TIMEOUT", 30*time.Second)
+)
+
+// UploadStats 正在进行的上传
+type UploadStats struct {
+	Active        int   `json:"active"`
+	ReservedBytes int64 `json:"reserved_bytes"`
+	MaxActive     int   `json:"max_active"`
+	MaxBytes      int64 `json:"max_bytes"`
+}
+
+type uploadGuard struct {
+	mu       sync.Mutex
+	active   int
+	reserved int64
+	// changed 在有上传结束时关闭，用于唤醒等待者
+	changed chan struct{}
+}
+
+var uploads = &uploadGuard{changed: make(chan struct{})}
+
+func (g *uploadGuard) fits(size int64) bool {
+	if maxConcurrentUploads > 0 && g.active >= maxConcurrentUploads {
+		return false
+	}
+	if uploadTempSpaceLimit > 0 && g.reserved+size > uploadTempSpaceLimit {
+		return false
+	}
+	return true
+}
+
+// acquire 预占一个上传名额和 size 字节的临时空间，超过限制时最多等待 timeout
+func (g *uploadGuard) acquire(r *http.Request, size int64, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		g.mu.Lock()
+		if g.fits(size) {
+			g.active++
+			g.reserved += size
+			g.mu.Unlock()
+			return true
+		}
+		changed := g.changed
+		g.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return false
+		case <-r.Context().Done():
+			return false
+		}
+	}
+}
+
+func (g *uploadGuard) release(size int64) {
+	g.mu.Lock()
+	g.active--
+	g.reserved -= size
+	close(g.changed)
+	g.changed = make(chan struct{})
+	g.mu.Unlock()
+}
+
+func (g *uploadGuard) stats() UploadStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return UploadStats{
+		Active:        g.active,
+		ReservedBytes: g.reserved,
+		MaxActive:     maxConcurrentUploads,
+		MaxBytes:      uploadTempSpaceLimit,
+	}
+}
+
+// limitUploads 为接收文件的接口加上准入控制
+func limitUploads(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		size := r.ContentLength
+		if size <= 0 || size > maxUploadSize {
+			size = maxUploadSize
+		}
+		if uploadTempSpaceLimit > 0 && size > uploadTempSpaceLimit {
+			size = uploadTempSpaceLimit
+		}
+
+		if !uploads.acquire(r, size, uploadWaitTimeout) {
+			stats := uploads.stats()
+			w.Header().Set("Retry-After", strconv.Itoa(int(max(uploadWaitTimeout, time.Second).Seconds())))
+			writeError(w, http.StatusServiceUnavailable, codeUploadsBusy,
+				fmt.Sprintf("Too many uploads in progress (%d active, %d bytes reserved), please retry later", stats.Active, stats.ReservedBytes))
+			return
+		}
+		defer uploads.release(size)
+		next(w, r)
+	}
+}
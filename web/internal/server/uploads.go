@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 预上传文件：先通过 POST /api/v1/uploads 上传 PDF 得到 upload_id，再在 JSON 提交中引用。
+// 文件保存在 uploadDir/pending/<upload_id>/ 下，提交时转为任务输入文件；
+// 超过 PENDING_UPLOAD_TTL（默认 24h）未被引用的文件会被清理（被提交草稿引用的文件除外）。
+var pendingUploadTTL = parseDurationEnv("PENDING_UPLOAD_TTL", 24*time.Hour)
+
+const pendingUploadCleanInterval = time.Hour
+
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func pendingUploadDir(uploadID string) string {
+	return filepath.Join(uploadDir, "pending", uploadID)
+}
+
+// 上传文件，请求体为包含 file 字段的 multipart 表单，或 Content-Type 为 application/pdf 的原始文件内容
+// （文件名取自 filename 参数或 Content-Disposition 头）
+func uploadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	var source io.Reader
+	var filename string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		// 直接从请求体读取 file 部分写入目标文件，不先缓冲整个表单
+		reader, err := r.MultipartReader()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "Invalid multipart form: "+err.Error())
+			return
+		}
+		part, err := nextFilePart(reader, "file")
+		if errors.Is(err, http.ErrMissingFile) {
+			writeError(w, http.StatusBadRequest, codeFileRequired, "Error retrieving file")
+			return
+		}
+		if err != nil {
+			if isBodyTooLarge(err) {
+				writeAPIError(w, errFileTooLarge())
+			} else {
+				writeError(w, http.StatusBadRequest, codeBadRequest, "Invalid multipart form: "+err.Error())
+			}
+			return
+		}
+		defer part.Close()
+		source, filename = part, part.FileName()
+	} else {
+		filename = r.URL.Query().Get("filename")
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil && filename == "" {
+			filename = params["filename"]
+		}
+		source = r.Body
+	}
+
+	filename = filepath.Base(filename)
+	if !strings.HasSuffix(strings.ToLower(filename), ".pdf") && !isImageFilename(filename) {
+		writeError(w, http.StatusBadRequest, codeUnsupportedFile, "Only PDF files and PNG/JPG images are allowed")
+		return
+	}
+
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	uploadID := hex.EncodeToString(buf)
+	dir := pendingUploadDir(uploadID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error creating file")
+		return
+	}
+
+	dst, err := os.Create(filepath.Join(dir, filename))
+	if err != nil {
+		os.RemoveAll(dir)
+		writeError(w, http.StatusInternalServerError, codeInternal, "Error creating file")
+		return
+	}
+	size, copyErr := io.Copy(dst, source)
+	dst.Close()
+	if copyErr != nil {
+		os.RemoveAll(dir)
+		if isBodyTooLarge(copyErr) {
+			writeAPIError(w, errFileTooLarge())
+		} else {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "Error saving file: "+copyErr.Error())
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"upload_id":  uploadID,
+		"filename":   filename,
+		"size":       size,
+		"expires_at": time.Now().Add(pendingUploadTTL),
+	})
+}
+
+// openPendingUpload 打开预上传的文件，返回文件及其原始文件名
+func openPendingUpload(uploadID string) (*os.File, string, error) {
+	if !uploadIDPattern.MatchString(uploadID) {
+		return nil, "", fmt.Errorf("invalid upload_id")
+	}
+	entries, err := os.ReadDir(pendingUploadDir(uploadID))
+	if err != nil || len(entries) != 1 {
+		return nil, "", newAPIError(http.StatusBadRequest, codeUploadNotFound, "upload not found: %s", uploadID)
+	}
+	name := entries[0].Name()
+	f, err := os.Open(filepath.Join(pendingUploadDir(uploadID), name))
+	if err != nil {
+		return nil, "", newAPIError(http.StatusBadRequest, codeUploadNotFound, "upload not found: %s", uploadID)
+	}
+	return f, name, nil
+}
+
+// removePendingUpload 删除已转为任务输入的预上传文件
+func removePendingUpload(uploadID string) {
+	if uploadIDPattern.MatchString(uploadID) {
+		os.RemoveAll(pendingUploadDir(uploadID))
+	}
+}
+
+// pendingUploadCleaner 定期删除过期的草稿和过期未使用的预上传文件（被草稿引用的文件保留到草稿过期，见 drafts.go）
+func pendingUploadCleaner() {
+	for {
+		cleanExpiredDrafts()
+		entries, _ := os.ReadDir(filepath.Join(uploadDir, "pending"))
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < pendingUploadTTL || draftReferencesUpload(entry.Name()) {
+				continue
+			}
+			if err := os.RemoveAll(pendingUploadDir(entry.Name())); err == nil {
+				log.Printf("已清理过期的预上传文件 %s", entry.Name())
+			}
+		}
+		time.Sleep(pendingUploadCleanInterval)
+	}
+}
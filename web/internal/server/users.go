@@ -0,0 +1,189 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 用户识别：
+//
+//	USER_ID_HEADER   由前置认证代理注入的用户标识请求头（默认 X-User-ID）
+//	USER_ORG_HEADER  由前置认证代理注入的组织标识请求头（默认 X-User-Org），关注只在同一组织内生效（见 follows.go）
+//
+// 请求未携带该请求头时使用浏览器 cookie（babeldoc_user）中的匿名标识，首次访问时自动生成。
+// 服务本身不做认证，用户标识只用于区分各自的偏好设置。
+var (
+	userIDHeader  = envOrDefault("USER_ID_HEADER", "X-User-ID")
+	userOrgHeader = envOrDefault("USER_ORG_HEADER", "X-User-Org")
+)
+
+const (
+	userCookieName   = "babeldoc_user"
+	userCookieMaxAge = 10 * 365 * 24 * 3600
+	maxUserIDLength  = 128
+)
+
+// 用户默认参数中不允许保存的字段
+var nonDefaultableFields = map[string]bool{
+	"file":        true,
+	"file_url":    true,
+	"external_id": true,
+	"run_at":      true,
+}
+
+// currentUserID 返回请求对应的用户标识，无法识别时返回空字符串
+func currentUserID(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get(userIDHeader)); id != "" && len(id) <= maxUserIDLength {
+		return id
+	}
+	if cookie, err := r.Cookie(userCookieName); err == nil && cookie.Value != "" && len(cookie.Value) <= maxUserIDLength {
+		return cookie.Value
+	}
+	return ""
+}
+
+// currentUserOrg 返回请求对应的组织标识，没有时返回空字符串
+func currentUserOrg(r *http.Request) string {
+	if org := strings.TrimSpace(r.Header.Get(userOrgHeader)); len(org) <= maxUserIDLength {
+		return org
+	}
+	return ""
+}
+
+// ensureUserID 与 currentUserID 相同，但在无法识别时生成匿名标识并写入 cookie
+func ensureUserID(w http.ResponseWriter, r *http.Request) string {
+	if id := currentUserID(r); id != "" {
+		return id
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	id := "anon-" + hex.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name:     userCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   userCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+// loadUserDefaults 读取用户保存的默认提交参数
+func loadUserDefaults(userID string) (map[string]string, error) {
+	defaults := map[string]string{}
+	if userID == "" {
+		return defaults, nil
+	}
+	var raw string
+	err := db.QueryRow(`SELECT defaults FROM user_defaults WHERE user_id = ?`, userID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return defaults, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(raw), &defaults)
+	return defaults, nil
+}
+
+// applyUserDefaults 将用户默认参数填入请求中未提供（或为空）的表单字段
+func applyUserDefaults(form url.Values, userID string) error {
+	defaults, err := loadUserDefaults(userID)
+	if err != nil {
+		return err
+	}
+	for key, value := range defaults {
+		if nonDefaultableFields[key] {
+			continue
+		}
+		if strings.TrimSpace(form.Get(key)) == "" {
+			form.Set(key, value)
+		}
+	}
+	return nil
+}
+
+// savedFormValues 将 JSON 对象转换为保存的表单字段：空字符串、false 和 null 不保存
+func savedFormValues(body map[string]interface{}) (map[string]string, error) {
+	values := make(map[string]string, len(body))
+	for key, value := range body {
+		switch v := value.(type) {
+		case string:
+			if v = strings.TrimSpace(v); v != "" {
+				values[key] = v
+			}
+		case bool:
+			if v {
+				values[key] = "true"
+			}
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil:
+		default:
+			return nil, fmt.Errorf("%s must be a string, number or boolean", key)
+		}
+	}
+	return values, nil
+}
+
+// 我的默认参数：GET 读取，PUT 覆盖保存（JSON 对象，键为提交表单的字段名），DELETE 清除
+func userDefaultsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := ensureUserID(w, r)
+
+	switch r.Method {
+	case http.MethodGet:
+		defaults, err := loadUserDefaults(userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"user_id": userID, "defaults": defaults})
+
+	case http.MethodPut, http.MethodPost:
+		var body map[string]interface{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+			writeAPIError(w, invalidJSONError(err))
+			return
+		}
+		for key := range body {
+			if nonDefaultableFields[key] {
+				writeError(w, http.StatusBadRequest, codeBadRequest, key+" cannot be saved as a default")
+				return
+			}
+		}
+		defaults, err := savedFormValues(body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		raw, _ := json.Marshal(defaults)
+		_, err = execWithRetry(`INSERT INTO user_defaults (user_id, defaults, updated_at) VALUES (?, ?, ?)
+			`+dbStore.Upsert("user_id")+` defaults = excluded.defaults, updated_at = excluded.updated_at`,
+			userID, string(raw), time.Now())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "user_id": userID, "defaults": defaults})
+
+	case http.MethodDelete:
+		if _, err := execWithRetry(`DELETE FROM user_defaults WHERE user_id = ?`, userID); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 用户个人策略：用户通过 /api/v1/me/settings 保存的设置（user_settings 表），在提交任务时记录到任务上，
+// 之后修改设置不影响已提交的任务。
+//
+//	USER_RETENTION_MIN  用户可设置的最短保留时长（默认 1h）
+//	USER_RETENTION_MAX  用户可设置的最长保留时长（默认与 RESULT_RETENTION 相同，只能缩短；两者都未设置时不限）
+//
+// 成功的任务按提交者的策略自动生成分享链接、删除上传的源文件（在结束后钩子执行完之后），
+// 设置了保留时长的任务按该时长而不是 RESULT_RETENTION 清理。
+var (
+	userRetentionMin = parseDurationEnv("USER_RETENTION_MIN", time.Hour)
+	userRetentionMax = parseDurationEnv("USER_RETENTION_MAX", resultRetention)
+)
+
+// UserSettings 用户的个人策略
+type UserSettings struct {
+	AutoShare        bool   `json:"auto_share"`                 // 任务成功后为每个输出文件生成分享链接
+	ShareExpiresIn   int    `json:"share_expires_in,omitempty"` // 自动生成的分享链接的有效期（秒），默认 DOWNLOAD_LINK_TTL
+	AutoDeleteSource bool   `json:"auto_delete_source"`         // 任务成功后删除上传的源文件
+	Retention        string `json:"retention,omitempty"`        // 任务结束后的保留时长（如 72h），覆盖 RESULT_RETENTION
+}
+
+// TaskPolicy 提交时记录在任务上的个人策略（保留时长单独保存在 retention_seconds 列）
+type TaskPolicy struct {
+	AutoShare        bool `json:"auto_share,omitempty"`
+	ShareExpiresIn   int  `json:"share_expires_in,omitempty"`
+	AutoDeleteSource bool `json:"auto_delete_source,omitempty"`
+}
+
+func createUserSettingsTable() {
+	t := dbStore.Types()
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS user_settings (
+		user_id ` + t.Key + ` PRIMARY KEY,
+		settings ` + t.Text + ` NOT NULL,
+		updated_at ` + t.Time + ` NOT NULL
+	)`)
+	if err != nil {
+		log.Fatal("无法创建表:", err)
+	}
+}
+
+// loadUserSettings 读取用户的个人策略，没有保存时返回零值
+func loadUserSettings(userID string) (*UserSettings, error) {
+	settings := &UserSettings{}
+	if userID == "" {
+		return settings, nil
+	}
+	var raw string
+	err := db.QueryRow(`SELECT settings FROM user_settings WHERE user_id = ?`, userID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(raw), settings)
+	return settings, nil
+}
+
+// validate 检查设置是否在管理员允许的范围内
+func (s *UserSettings) validate() error {
+	if s.ShareExpiresIn < 0 {
+		return fmt.Errorf("share_expires_in must not be negative")
+	}
+	if time.Duration(s.ShareExpiresIn)*time.Second > downloadLinkMaxTTL {
+		return fmt.Errorf("share_expires_in exceeds the maximum of %d seconds", int(downloadLinkMaxTTL.Seconds()))
+	}
+	if s.Retention == "" {
+		return nil
+	}
+	retention, err := time.ParseDuration(s.Retention)
+	if err != nil {
+		return fmt.Errorf("retention must be a duration such as 72h")
+	}
+	if retention < userRetentionMin {
+		return fmt.Errorf("retention must be at least %s", userRetentionMin)
+	}
+	if userRetentionMax > 0 && retention > userRetentionMax {
+		return fmt.Errorf("retention must be at most %s", userRetentionMax)
+	}
+	return nil
+}
+
+// retentionSeconds 设置的保留时长（秒），未设置或超出当前允许的范围时返回 0（使用 RESULT_RETENTION）
+func (s *UserSettings) retentionSeconds() int64 {
+	if s.Retention == "" || s.validate() != nil {
+		return 0
+	}
+	retention, _ := time.ParseDuration(s.Retention)
+	return int64(retention.Seconds())
+}
+
+// policy 提交时记录在任务上的策略，没有需要执行的操作时返回 nil
+func (s *UserSettings) policy() *TaskPolicy {
+	if !s.AutoShare && !s.AutoDeleteSource {
+		return nil
+	}
+	policy := &TaskPolicy{AutoShare: s.AutoShare, AutoDeleteSource: s.AutoDeleteSource}
+	if s.AutoShare {
+		policy.ShareExpiresIn = s.ShareExpiresIn
+	}
+	return policy
+}
+
+// applyTaskPolicy 任务成功后按提交者的策略生成分享链接、删除源文件
+func applyTaskPolicy(task *Task) {
+	policy := task.Policy
+	if policy == nil {
+		return
+	}
+	if policy.AutoShare {
+		ttl := downloadLinkTTL
+		if policy.ShareExpiresIn > 0 {
+			ttl = time.Duration(policy.ShareExpiresIn) * time.Second
+		}
+		if err := createPolicyShareLinks(task, ttl); err != nil {
+			log.Printf("无法为任务 %s 自动生成分享链接: %v", task.ID, err)
+			recordTaskEvent(task.ID, "policy.share_failed", "无法自动生成分享链接: "+err.Error())
+		} else {
+			recordTaskEvent(task.ID, "policy.shared", fmt.Sprintf("已按个人策略为 %d 个输出文件生成分享链接，%s 内有效", len(task.OutputFiles), ttl))
+		}
+	}
+	if policy.AutoDeleteSource {
+		if err := removeTaskInput(task); err != nil {
+			log.Printf("无法删除任务 %s 的源文件: %v", task.ID, err)
+			recordTaskEvent(task.ID, "policy.source_delete_failed", "无法删除源文件: "+err.Error())
+		} else {
+			recordTaskEvent(task.ID, "policy.source_deleted", "已按个人策略删除上传的源文件")
+		}
+	}
+}
+
+// createPolicyShareLinks 为任务的每个输出文件生成不限下载次数的分享链接，可以通过 GET /api/v1/tasks/{id}/links 查看
+func createPolicyShareLinks(task *Task, ttl time.Duration) error {
+	now := time.Now().Truncate(time.Second)
+	for _, file := range task.OutputFiles {
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		if _, err := execWithRetry(`INSERT INTO download_links (id, task_id, file, expires_at, max_downloads, created_at) VALUES (?, ?, ?, ?, 0, ?)`,
+			hex.EncodeToString(buf), task.ID, file, now.Add(ttl), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 我的个人策略：GET 读取，PUT 覆盖保存，DELETE 清除
+func userSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := ensureUserID(w, r)
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := loadUserSettings(userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		writeUserSettings(w, userID, settings)
+
+	case http.MethodPut:
+		var settings UserSettings
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&settings); err != nil {
+			writeAPIError(w, invalidJSONError(err))
+			return
+		}
+		if err := settings.validate(); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		raw, _ := json.Marshal(&settings)
+		_, err := execWithRetry(`INSERT INTO user_settings (user_id, settings, updated_at) VALUES (?, ?, ?)
+			`+dbStore.Upsert("user_id")+` settings = excluded.settings, updated_at = excluded.updated_at`,
+			userID, string(raw), time.Now())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		writeUserSettings(w, userID, &settings)
+
+	case http.MethodDelete:
+		if _, err := execWithRetry(`DELETE FROM user_settings WHERE user_id = ?`, userID); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// writeUserSettings 返回用户的设置及管理员允许的保留时长范围
+func writeUserSettings(w http.ResponseWriter, userID string, settings *UserSettings) {
+	bounds := map[string]interface{}{"min": userRetentionMin.String()}
+	if userRetentionMax > 0 {
+		bounds["max"] = userRetentionMax.String()
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":          userID,
+		"settings":         settings,
+		"retention_bounds": bounds,
+	})
+}
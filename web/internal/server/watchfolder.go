@@ -0,0 +1,263 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 监视目录：把 PDF 放入 WATCH_DIR 即自动提交翻译任务，译文复制到输出目录，无需操作界面或调用接口。
+//
+//	WATCH_DIR         监视的目录，未设置时不启用
+//	WATCH_OUTPUT_DIR  译文的输出目录（默认 <WATCH_DIR>/translated）
+//	WATCH_INTERVAL    扫描间隔（默认 5s）
+//	WATCH_USER        以该用户的身份提交，使用其默认参数和个人策略（见 users.go、usersettings.go）
+//
+// 只处理 WATCH_DIR 下（不含子目录）的 .pdf 文件，隐藏文件忽略；文件大小和修改时间在相邻两次扫描中不变才提交，
+// 避免提交仍在复制中的文件。同名的 .json 文件（paper.pdf 对应 paper.json 或 paper.pdf.json）作为任务设置，
+// 字段与 JSON 提交相同（见 jsonsubmit.go），但不能指定输入文件；设置文件需要在 PDF 之前放入。
+//
+// 提交前先把文件移入 <WATCH_DIR>/.processing，多个实例监视同一目录时只有一个能提交；提交成功后删除，
+// 提交失败时移入 <WATCH_DIR>/failed 并写入同名的 .error.txt。任务成功后输出文件复制到 WATCH_OUTPUT_DIR
+// （去掉任务 ID 前缀，同名文件覆盖），失败时在输出目录写入 <文件名>.error.txt。
+// 由独立的 worker 进程执行任务时，worker 也需要设置 WATCH_DIR 或 WATCH_OUTPUT_DIR 才能复制结果。
+var (
+	watchDir      = os.Getenv("WATCH_DIR")
+	watchInterval = parseDurationEnv("WATCH_INTERVAL", 5*time.Second)
+	watchUser     = os.Getenv("WATCH_USER")
+)
+
+const (
+	watchProcessingDir = ".processing"
+	watchFailedDir     = "failed"
+)
+
+// watchOutputDir 返回译文的输出目录，未启用监视目录时返回空字符串
+func watchOutputDir() string {
+	if dir := os.Getenv("WATCH_OUTPUT_DIR"); dir != "" {
+		return dir
+	}
+	if watchDir != "" {
+		return filepath.Join(watchDir, "translated")
+	}
+	return ""
+}
+
+// watchedFile 上一次扫描时文件的大小和修改时间
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// folderWatcher 定期扫描监视目录并提交其中已写入完成的 PDF
+func folderWatcher() {
+	if err := os.MkdirAll(filepath.Join(watchDir, watchProcessingDir), 0755); err != nil {
+		log.Printf("无法创建监视目录 %s: %v", watchDir, err)
+		return
+	}
+	recoverProcessingFiles()
+	log.Printf("监视目录 %s，译文输出到 %s", watchDir, watchOutputDir())
+
+	seen := make(map[string]watchedFile)
+	for {
+		entries, err := os.ReadDir(watchDir)
+		if err != nil {
+			log.Printf("无法读取监视目录 %s: %v", watchDir, err)
+		}
+		current := make(map[string]watchedFile)
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || !strings.EqualFold(filepath.Ext(name), ".pdf") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			state := watchedFile{size: info.Size(), modTime: info.ModTime()}
+			if previous, ok := seen[name]; ok && previous == state {
+				submitWatchedFile(name)
+				continue
+			}
+			current[name] = state
+		}
+		seen = current
+		time.Sleep(watchInterval)
+	}
+}
+
+// recoverProcessingFiles 把上次退出时尚未提交完的文件移回监视目录，重新提交
+func recoverProcessingFiles() {
+	entries, _ := os.ReadDir(filepath.Join(watchDir, watchProcessingDir))
+	for _, entry := range entries {
+		from := filepath.Join(watchDir, watchProcessingDir, entry.Name())
+		if err := os.Rename(from, filepath.Join(watchDir, entry.Name())); err == nil {
+			log.Printf("监视目录中的 %s 上次未提交完成，将重新提交", entry.Name())
+		}
+	}
+}
+
+// watchSidecar 返回 PDF 对应的设置文件名，没有时返回空字符串
+func watchSidecar(name string) string {
+	for _, candidate := range []string{strings.TrimSuffix(name, filepath.Ext(name)) + ".json", name + ".json"} {
+		if info, err := os.Stat(filepath.Join(watchDir, candidate)); err == nil && info.Mode().IsRegular() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// submitWatchedFile 把文件（及其设置文件）移入处理目录后提交任务
+func submitWatchedFile(name string) {
+	processing := filepath.Join(watchDir, watchProcessingDir)
+	pdfPath := filepath.Join(processing, name)
+	if err := os.Rename(filepath.Join(watchDir, name), pdfPath); err != nil {
+		// 已被其他实例取走
+		return
+	}
+	sidecar := watchSidecar(name)
+	if sidecar != "" {
+		if err := os.Rename(filepath.Join(watchDir, sidecar), filepath.Join(processing, sidecar)); err != nil {
+			sidecar = ""
+		}
+	}
+
+	taskID, err := createWatchTask(name, pdfPath, sidecar)
+	if err != nil {
+		log.Printf("无法提交监视目录中的 %s: %v", name, err)
+		moveWatchFailure(name, sidecar, err)
+		return
+	}
+	log.Printf("监视目录中的 %s 已提交为任务 %s", name, taskID)
+	os.Remove(pdfPath)
+	if sidecar != "" {
+		os.Remove(filepath.Join(processing, sidecar))
+	}
+}
+
+// createWatchTask 以设置文件中的字段和 WATCH_USER 的默认参数提交任务，返回任务 ID
+func createWatchTask(name, pdfPath, sidecar string) (string, error) {
+	form := url.Values{}
+	if sidecar != "" {
+		data, err := os.ReadFile(filepath.Join(watchDir, watchProcessingDir, sidecar))
+		if err != nil {
+			return "", err
+		}
+		var sub TaskSubmission
+		if err := json.Unmarshal(data, &sub); err != nil {
+			return "", fmt.Errorf("%s: %v", sidecar, err)
+		}
+		if sub.UploadID != "" || sub.DraftID != "" || sub.FileBase64 != "" || sub.FileURL != "" || sub.Filename != "" {
+			return "", fmt.Errorf("%s: input file fields are not allowed", sidecar)
+		}
+		if form, err = submissionForm(&sub); err != nil {
+			return "", fmt.Errorf("%s: %v", sidecar, err)
+		}
+	}
+	if err := applyUserDefaults(form, watchUser); err != nil {
+		log.Printf("无法读取用户默认参数: %v", err)
+	}
+
+	f, err := os.Open(pdfPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Size() > maxUploadSize {
+		return "", fmt.Errorf("file exceeds the maximum upload size of %d MB", maxUploadSize>>20)
+	}
+
+	// createTask 写出 JSON 响应，从中取得任务 ID 或错误信息
+	rec := &davResponseRecorder{header: make(http.Header)}
+	createTask(rec, &submissionInput{
+		form:        form,
+		file:        f,
+		filename:    name,
+		userID:      watchUser,
+		receivedAt:  time.Now(),
+		watchSource: name,
+	})
+	var result struct {
+		TaskID string `json:"task_id"`
+		Error  string `json:"error"`
+	}
+	json.Unmarshal(rec.body.Bytes(), &result)
+	if rec.status >= 300 || result.TaskID == "" {
+		return "", fmt.Errorf("HTTP %d: %s", rec.status, result.Error)
+	}
+	return result.TaskID, nil
+}
+
+// moveWatchFailure 把提交失败的文件移入 failed 目录并写入错误信息
+func moveWatchFailure(name, sidecar string, cause error) {
+	failed := filepath.Join(watchDir, watchFailedDir)
+	if err := os.MkdirAll(failed, 0755); err != nil {
+		log.Printf("无法创建目录 %s: %v", failed, err)
+		return
+	}
+	for _, file := range []string{name, sidecar} {
+		if file != "" {
+			os.Rename(filepath.Join(watchDir, watchProcessingDir, file), filepath.Join(failed, file))
+		}
+	}
+	os.WriteFile(filepath.Join(failed, name+".error.txt"), []byte(cause.Error()+"\n"), 0644)
+}
+
+// deliverWatchOutputs 把从监视目录提交的任务的输出文件复制到输出目录
+func deliverWatchOutputs(task *Task) {
+	dir := watchOutputDir()
+	if task.WatchSource == "" || dir == "" || task.Status != "success" {
+		return
+	}
+	var copied []string
+	for _, file := range taskOutputFiles(task) {
+		path := taskOutputPath(task, file)
+		ensureLocal(path)
+		name := strings.TrimPrefix(file, task.ID+"_")
+		if err := copyWatchOutput(path, filepath.Join(dir, name)); err != nil {
+			log.Printf("无法复制任务 %s 的输出文件 %s 到 %s: %v", task.ID, file, dir, err)
+			recordTaskEvent(task.ID, "watch.failed", fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		copied = append(copied, name)
+	}
+	// 重试成功后删除之前失败时写入的错误信息
+	os.Remove(filepath.Join(dir, task.WatchSource+".error.txt"))
+	recordTaskEvent(task.ID, "watch.delivered", strings.Join(copied, ", "))
+}
+
+// copyWatchOutput 复制输出文件（压缩保存的文件解压后复制，见 compression.go）
+func copyWatchOutput(src, dst string) error {
+	r, _, err := openOutputFile(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := writeFileAtomic(dst, r); err != nil {
+		return err
+	}
+	// 临时文件创建时只有属主可读
+	return os.Chmod(dst, 0644)
+}
+
+// writeWatchFailure 从监视目录提交的任务失败时在输出目录写入错误信息
+func writeWatchFailure(task *Task) {
+	dir := watchOutputDir()
+	if task.WatchSource == "" || dir == "" {
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("无法创建目录 %s: %v", dir, err)
+		return
+	}
+	message := fmt.Sprintf("task %s failed: %s\n", task.ID, task.Error)
+	if err := os.WriteFile(filepath.Join(dir, task.WatchSource+".error.txt"), []byte(message), 0644); err != nil {
+		log.Printf("无法写入任务 %s 的错误信息: %v", task.ID, err)
+	}
+}
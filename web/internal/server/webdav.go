@@ -0,0 +1,494 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// WebDAV：在 /dav/ 下以 WebDAV 提供任务的输入和输出文件，可以在 Finder、Windows 资源管理器或 davfs2 中挂载为网络驱动器。
+//
+//	WEBDAV           off（默认，不提供）、ro（只读）或 rw（读写）
+//	WEBDAV_USERNAME  Basic 认证的用户名和密码，设置了 WEBDAV_PASSWORD 时要求认证
+//	WEBDAV_PASSWORD
+//	WEBDAV_MAX_TASKS 根目录最多列出的任务数（最近提交的在前，默认 1000）
+//
+// 目录结构：根目录下每个任务一个目录（以任务 ID 命名），其中是任务的输出文件和 input/<原文件名>。
+// 已归档到冷存储的输出文件不列出，直接读取时在后台取回（与下载接口相同，返回 202）。
+// 读写模式下：向根目录写入 PDF 文件即以提交者的默认参数（见 users.go）提交一个翻译任务，上传后短时间内仍可以按原路径读取，
+// 便于客户端校验；删除任务目录即删除任务；其他写操作（修改文件、新建目录、移动、复制）不允许。
+// 客户端写入的隐藏文件（macOS 的 ._* 和 .DS_Store 等）直接丢弃。
+const (
+	webdavPrefix = "/dav"
+
+	// webdavUploadVisibility 写入根目录的文件在提交后多长时间内仍可以按原路径读取
+	webdavUploadVisibility = 10 * time.Minute
+)
+
+var (
+	webdavMode     = parseWebDAVMode(os.Getenv("WEBDAV"))
+	webdavUsername = os.Getenv("WEBDAV_USERNAME")
+	webdavPassword = os.Getenv("WEBDAV_PASSWORD")
+	webdavMaxTasks = parseIntEnv("WEBDAV_MAX_TASKS", 1000)
+)
+
+func parseWebDAVMode(value string) string {
+	switch value {
+	case "", "off":
+		return ""
+	case "ro", "rw":
+		return value
+	}
+	log.Printf("无效的 WEBDAV %q，不提供 WebDAV", value)
+	return ""
+}
+
+// davNode WebDAV 路径对应的目录或文件
+type davNode struct {
+	name    string
+	dir     bool
+	task    *Task  // 任务目录及其中的文件所属的任务
+	path    string // 文件的本地路径
+	size    int64
+	modTime time.Time
+}
+
+// PROPFIND 响应（RFC 4918）
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	Namespace string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"D:href"`
+	Propstat davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+type davProp struct {
+	DisplayName   string          `xml:"D:displayname"`
+	ResourceType  davResourceType `xml:"D:resourcetype"`
+	ContentLength *int64          `xml:"D:getcontentlength,omitempty"`
+	ContentType   string          `xml:"D:getcontenttype,omitempty"`
+	LastModified  string          `xml:"D:getlastmodified,omitempty"`
+	CreationDate  string          `xml:"D:creationdate,omitempty"`
+	ETag          string          `xml:"D:getetag,omitempty"`
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection,omitempty"`
+}
+
+// WebDAV 入口
+func webdavHandler(w http.ResponseWriter, r *http.Request) {
+	if webdavPassword != "" {
+		username, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(username), []byte(webdavUsername)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(webdavPassword)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="BabelDOC"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	segments := davSegments(r.URL.Path)
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Allow", davAllowedMethods())
+		w.Header().Set("MS-Author-Via", "DAV")
+		if webdavMode == "rw" {
+			// Finder 和 Windows 只在服务端支持锁（class 2）时以读写方式挂载
+			w.Header().Set("DAV", "1, 2")
+		} else {
+			w.Header().Set("DAV", "1")
+		}
+		w.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		davPropfind(w, r, segments)
+	case http.MethodGet, http.MethodHead:
+		davGet(w, r, segments)
+	case http.MethodPut, http.MethodDelete, "PROPPATCH", "LOCK", "UNLOCK", "MKCOL", "COPY", "MOVE":
+		if webdavMode != "rw" {
+			w.Header().Set("Allow", davAllowedMethods())
+			http.Error(w, "WebDAV is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		davWrite(w, r, segments)
+	default:
+		w.Header().Set("Allow", davAllowedMethods())
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func davAllowedMethods() string {
+	if webdavMode == "rw" {
+		return "OPTIONS, GET, HEAD, PROPFIND, PUT, DELETE, PROPPATCH, LOCK, UNLOCK"
+	}
+	return "OPTIONS, GET, HEAD, PROPFIND"
+}
+
+// davSegments 返回 /dav/ 之后的路径段
+func davSegments(urlPath string) []string {
+	rel := strings.Trim(strings.TrimPrefix(path.Clean("/"+urlPath), webdavPrefix), "/")
+	if rel == "" {
+		return nil
+	}
+	return strings.Split(rel, "/")
+}
+
+// davHref 返回路径段对应的 href，目录以 / 结尾
+func davHref(segments []string, dir bool) string {
+	href := webdavPrefix + "/"
+	for i, segment := range segments {
+		href += url.PathEscape(segment)
+		if i < len(segments)-1 || dir {
+			href += "/"
+		}
+	}
+	return href
+}
+
+// resolveDAVPath 返回路径对应的目录或文件，不存在时返回 nil
+func resolveDAVPath(segments []string) (*davNode, error) {
+	if len(segments) == 0 {
+		return &davNode{dir: true, modTime: time.Now()}, nil
+	}
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, segments[0]))
+	if err == sql.ErrNoRows {
+		if len(segments) == 1 {
+			return recentDAVUpload(segments[0])
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(segments) == 1:
+		return &davNode{name: task.ID, dir: true, task: task, modTime: taskModTime(task)}, nil
+	case len(segments) == 2 && segments[1] == "input":
+		return &davNode{name: "input", dir: true, task: task, modTime: task.CreatedAt}, nil
+	case len(segments) == 3 && segments[1] == "input" && segments[2] == task.Filename:
+		return davFileNode(task, task.Filename, taskInputPath(task)), nil
+	case len(segments) == 2:
+		for _, file := range taskOutputFiles(task) {
+			if file == segments[1] {
+				return davFileNode(task, file, taskOutputPath(task, file)), nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// recentDAVUpload 返回刚写入根目录的文件（提交的任务的输入文件）
+func recentDAVUpload(name string) (*davNode, error) {
+	task, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE filename = ? AND created_at > ?
+		ORDER BY created_at DESC LIMIT 1`, name, time.Now().Add(-webdavUploadVisibility)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return davFileNode(task, name, taskInputPath(task)), nil
+}
+
+// davFileNode 返回文件节点，本地没有副本时从对象存储取回；文件不存在（例如已归档）时大小为 0
+func davFileNode(task *Task, name, filePath string) *davNode {
+	node := &davNode{name: name, task: task, path: filePath, modTime: taskModTime(task)}
+	ensureLocal(filePath)
+	if info, err := statOutputFile(filePath); err == nil {
+		node.size, node.modTime = info.Size(), info.ModTime()
+	}
+	return node
+}
+
+func taskModTime(task *Task) time.Time {
+	if task.CompletedAt != nil {
+		return *task.CompletedAt
+	}
+	return task.CreatedAt
+}
+
+// davChildren 返回目录下的条目
+func davChildren(node *davNode) ([]*davNode, error) {
+	var children []*davNode
+	if node.task == nil {
+		rows, err := db.Query(`SELECT `+taskColumns+` FROM tasks ORDER BY created_at DESC LIMIT ?`, webdavMaxTasks)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			if task, err := scanTask(rows); err == nil {
+				children = append(children, &davNode{name: task.ID, dir: true, task: task, modTime: taskModTime(task)})
+			}
+		}
+		return children, rows.Err()
+	}
+
+	task := node.task
+	if node.name == "input" {
+		if child := davFileNode(task, task.Filename, taskInputPath(task)); child.size > 0 {
+			children = append(children, child)
+		}
+		return children, nil
+	}
+	children = append(children, &davNode{name: "input", dir: true, task: task, modTime: task.CreatedAt})
+	if task.StorageTier == "" {
+		for _, file := range taskOutputFiles(task) {
+			if child := davFileNode(task, file, taskOutputPath(task, file)); child.size > 0 {
+				children = append(children, child)
+			}
+		}
+	}
+	return children, nil
+}
+
+func davPropfind(w http.ResponseWriter, r *http.Request, segments []string) {
+	depth := r.Header.Get("Depth")
+	if depth == "infinity" {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, xml.Header+`<D:error xmlns:D="DAV:"><D:propfind-finite-depth/></D:error>`)
+		return
+	}
+	node, err := resolveDAVPath(segments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if node == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	// 请求体中指定的属性不做区分，总是返回全部属性
+	ms := davMultistatus{Namespace: "DAV:"}
+	ms.Responses = append(ms.Responses, davPropResponse(segments, node))
+	if node.dir && depth != "0" {
+		children, err := davChildren(node)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, child := range children {
+			ms.Responses = append(ms.Responses, davPropResponse(append(segments[:len(segments):len(segments)], child.name), child))
+		}
+	}
+
+	body, err := xml.Marshal(ms)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+}
+
+func davPropResponse(segments []string, node *davNode) davResponse {
+	prop := davProp{
+		DisplayName:  node.name,
+		LastModified: node.modTime.UTC().Format(http.TimeFormat),
+	}
+	if node.task != nil {
+		prop.CreationDate = node.task.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if node.dir {
+		prop.ResourceType.Collection = &struct{}{}
+	} else {
+		size := node.size
+		prop.ContentLength = &size
+		prop.ContentType = "application/pdf"
+		prop.ETag = fmt.Sprintf(`"%x-%x"`, node.size, node.modTime.UnixNano())
+	}
+	return davResponse{
+		Href:     davHref(segments, node.dir),
+		Propstat: davPropstat{Prop: prop, Status: "HTTP/1.1 200 OK"},
+	}
+}
+
+func davGet(w http.ResponseWriter, r *http.Request, segments []string) {
+	node, err := resolveDAVPath(segments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if node == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if !node.dir {
+		// 输出文件已归档时在后台取回
+		if node.path != taskInputPath(node.task) {
+			if task := archivedTask(node.task.ID); task != nil {
+				writeRestoring(w, task)
+				return
+			}
+		}
+		serveOutputFile(w, r, node.path, node.name)
+		return
+	}
+
+	// 浏览器直接访问目录时返回简单的文件列表
+	children, err := davChildren(node)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var b bytes.Buffer
+	b.WriteString("<!DOCTYPE html>\n<meta charset=\"utf-8\">\n<ul>\n")
+	if len(segments) > 0 {
+		b.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, child := range children {
+		href := davHref(append(segments[:len(segments):len(segments)], child.name), child.dir)
+		label := child.name
+		if child.dir {
+			label += "/"
+		}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(label))
+	}
+	b.WriteString("</ul>\n")
+	if r.Method == http.MethodGet {
+		w.Write(b.Bytes())
+	}
+}
+
+// davWrite 读写模式下的写操作
+func davWrite(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch r.Method {
+	case http.MethodPut:
+		if len(segments) != 1 {
+			http.Error(w, "Files can only be written to the root folder", http.StatusForbidden)
+			return
+		}
+		if strings.HasPrefix(segments[0], ".") {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		limitUploads(davPut)(w, r)
+
+	case http.MethodDelete:
+		if len(segments) != 1 {
+			http.Error(w, "Only task folders can be deleted", http.StatusForbidden)
+			return
+		}
+		err := deleteTask(segments[0], 0)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error deleting task", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case "PROPPATCH":
+		// 客户端写入文件后设置修改时间等属性，不保存，按成功处理
+		node, err := resolveDAVPath(segments)
+		if err != nil || node == nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		ms := davMultistatus{Namespace: "DAV:", Responses: []davResponse{{
+			Href:     davHref(segments, node.dir),
+			Propstat: davPropstat{Status: "HTTP/1.1 200 OK"},
+		}}}
+		body, _ := xml.Marshal(ms)
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(xml.Header))
+		w.Write(body)
+
+	case "LOCK":
+		// 只为满足客户端以读写方式挂载的要求，不真正加锁：写入根目录总是新建任务，不会覆盖已有文件
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		token := "opaquelocktoken:" + hex.EncodeToString(buf)
+		w.Header().Set("Lock-Token", "<"+token+">")
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		fmt.Fprintf(w, xml.Header+`<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>`+
+			`<D:locktype><D:write/></D:locktype><D:lockscope><D:exclusive/></D:lockscope><D:depth>0</D:depth>`+
+			`<D:timeout>Second-3600</D:timeout><D:locktoken><D:href>%s</D:href></D:locktoken>`+
+			`<D:lockroot><D:href>%s</D:href></D:lockroot></D:activelock></D:lockdiscovery></D:prop>`, token, html.EscapeString(davHref(segments, false)))
+
+	case "UNLOCK":
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Not supported", http.StatusForbidden)
+	}
+}
+
+// davPut 以写入根目录的文件提交任务
+func davPut(w http.ResponseWriter, r *http.Request) {
+	name := davSegments(r.URL.Path)[0]
+	form := url.Values{}
+	userID := currentUserID(r)
+	if err := applyUserDefaults(form, userID); err != nil {
+		log.Printf("无法读取用户默认参数: %v", err)
+	}
+
+	// createTask 写出 JSON 响应，WebDAV 客户端只需要状态码
+	rec := &davResponseRecorder{header: make(http.Header)}
+	createTask(rec, &submissionInput{
+		form:       form,
+		file:       http.MaxBytesReader(w, r.Body, maxUploadSize),
+		filename:   name,
+		userID:     userID,
+		orgID:      currentUserOrg(r),
+		receivedAt: time.Now(),
+	})
+	if rec.status >= 300 {
+		w.Header().Set("Content-Type", rec.header.Get("Content-Type"))
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// davResponseRecorder 记录 createTask 的响应
+type davResponseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *davResponseRecorder) Header() http.Header { return r.header }
+
+func (r *davResponseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *davResponseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
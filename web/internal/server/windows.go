@@ -0,0 +1,152 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 执行时段：队列配置中的 windows 限制 worker 只在一天中的某些时段领取任务，例如批量队列只在夜间
+// （"22:00-06:00"）运行，白天把机器和 API 额度留给交互式任务。结束时间早于开始时间表示跨过午夜。
+// 时段外提交的任务照常排队，任务的 next_window_at 为下一个时段的开始时间；时段结束时正在执行的任务会执行完毕。
+// 时间按队列的 window_timezone（IANA 时区名，例如 Asia/Shanghai）计算，未设置时使用服务的本地时区（TZ）。
+
+// windowCheckInterval 等待时段开始期间重新检查的最长间隔
+const windowCheckInterval = time.Minute
+
+// stageOutsideWindow worker 在等待所属队列的执行时段
+const stageOutsideWindow = "outside_window"
+
+// execWindow 一天中的一个执行时段，以距午夜的分钟数表示，end 小于 start 时跨过午夜
+type execWindow struct {
+	start, end int
+}
+
+// parseExecWindow 解析 "HH:MM-HH:MM"
+func parseExecWindow(s string) (execWindow, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return execWindow{}, fmt.Errorf("执行时段 %q 的格式应为 HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return execWindow{}, fmt.Errorf("执行时段 %q: %v", s, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return execWindow{}, fmt.Errorf("执行时段 %q: %v", s, err)
+	}
+	if start == end {
+		return execWindow{}, fmt.Errorf("执行时段 %q 的开始和结束时间相同", s)
+	}
+	return execWindow{start: start, end: end}, nil
+}
+
+// parseClock 解析 HH:MM，24:00 表示午夜
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("无效的时间 %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// contains 一天中的第 minute 分钟是否在时段内
+func (w execWindow) contains(minute int) bool {
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// loadWindows 解析队列配置的执行时段和时区
+func (qc *QueueConfig) loadWindows() error {
+	qc.location = time.Local
+	if qc.WindowTimezone != "" {
+		loc, err := time.LoadLocation(qc.WindowTimezone)
+		if err != nil {
+			return fmt.Errorf("window_timezone 无效: %v", err)
+		}
+		qc.location = loc
+	}
+	qc.windows = nil
+	for _, s := range qc.Windows {
+		w, err := parseExecWindow(s)
+		if err != nil {
+			return err
+		}
+		qc.windows = append(qc.windows, w)
+	}
+	return nil
+}
+
+// windowOpen 队列在 t 时是否可以领取任务，没有配置执行时段时总是可以
+func (qc *QueueConfig) windowOpen(t time.Time) bool {
+	if len(qc.windows) == 0 {
+		return true
+	}
+	t = t.In(qc.location)
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range qc.windows {
+		if w.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextWindowStart 返回 t 之后最近的时段开始时间，t 时已在时段内（或没有配置时段）时返回 nil
+func (qc *QueueConfig) nextWindowStart(t time.Time) *time.Time {
+	if qc.windowOpen(t) {
+		return nil
+	}
+	t = t.In(qc.location)
+	var next *time.Time
+	for day := 0; day <= 1; day++ {
+		midnight := time.Date(t.Year(), t.Month(), t.Day()+day, 0, 0, 0, 0, qc.location)
+		for _, w := range qc.windows {
+			start := time.Date(midnight.Year(), midnight.Month(), midnight.Day(), w.start/60, w.start%60, 0, 0, qc.location)
+			if start.After(t) && (next == nil || start.Before(*next)) {
+				next = &start
+			}
+		}
+	}
+	return next
+}
+
+// queueNextWindow 返回队列下一个执行时段的开始时间，队列当前可以领取任务时返回 nil
+func queueNextWindow(queueName string) *time.Time {
+	qc := findQueueConfig(queueName)
+	if qc == nil && len(queueConfigs) > 0 {
+		// 旧任务没有记录队列，归入第一个队列
+		qc = queueConfigs[0]
+	}
+	if qc == nil {
+		return nil
+	}
+	return qc.nextWindowStart(time.Now())
+}
+
+// waitForQueueWindow 在所属队列的执行时段之外阻塞 worker，并在心跳中标记为 outside_window
+func waitForQueueWindow(queueName string, hb *workerHeartbeat) {
+	qc := findQueueConfig(queueName)
+	if qc == nil || qc.windowOpen(time.Now()) {
+		return
+	}
+	hb.setStage(stageOutsideWindow)
+	for {
+		next := qc.nextWindowStart(time.Now())
+		if next == nil {
+			break
+		}
+		wait := time.Until(*next)
+		if wait > windowCheckInterval {
+			wait = windowCheckInterval
+		}
+		time.Sleep(wait)
+	}
+	hb.setStage(stageIdle)
+}
@@ -0,0 +1,435 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 任务状态推送：客户端连接 WebSocket（/api/ws 或 /api/v1/ws）后，服务端推送任务的状态变化和进度，
+// 无需再定时刷新任务列表。可以用 task_id 参数（逗号分隔）只订阅部分任务。消息为 JSON 文本帧（TaskChangeEvent）：
+//
+//	{"type": "status", "task_id": "...", "status": "running", "previous_status": "queued", "at": "..."}
+//	{"type": "progress", "task_id": "...", "status": "running", "progress": 45, "at": "..."}
+//	{"type": "deleted", "task_id": "...", "at": "..."}
+//
+// 新提交的任务推送 previous_status 为空的 status 消息。连接建立后的变化才会推送，客户端应在连接后加载一次列表。
+// 本实例上发生的变化立即推送；API 节点（或使用共享队列时）另外每 wsPollInterval 查询一次数据库，
+// 推送其他节点上的变化，其他节点执行中任务的进度来自 worker 心跳。
+// 客户端处理过慢（待发送的消息超过 wsSendBuffer 条）时服务端断开连接，客户端重连后重新加载列表即可。
+const (
+	wsGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsSendBuffer   = 256
+	wsPingInterval = 30 * time.Second
+	wsReadTimeout  = 75 * time.Second
+	wsWriteTimeout = 10 * time.Second
+	wsMaxFrameSize = 64 << 10
+	wsPollInterval = 2 * time.Second
+
+	wsMaxTrackedTasks = 10000
+)
+
+// WebSocket 帧类型
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// TaskChangeEvent 推送给 WebSocket 客户端的任务变化
+type TaskChangeEvent struct {
+	Type           string    `json:"type"` // status、progress 或 deleted
+	TaskID         string    `json:"task_id"`
+	Status         string    `json:"status,omitempty"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Progress       int       `json:"progress,omitempty"`
+	At             time.Time `json:"at"`
+}
+
+// taskHubState 已推送的任务状态，用于去重（同一变化可能既由本实例推送，又被轮询发现）
+type taskHubState struct {
+	status   string
+	progress int
+	seenAt   time.Time
+}
+
+// taskChangeHub 向所有 WebSocket 客户端分发任务变化
+type taskChangeHub struct {
+	mu      sync.Mutex
+	clients map[*wsClient]bool
+	states  map[string]*taskHubState
+	primed  bool // 轮询已记录过一次全部任务的状态
+}
+
+var taskHub = &taskChangeHub{
+	clients: make(map[*wsClient]bool),
+	states:  make(map[string]*taskHubState),
+}
+
+// publishTaskStatus 推送任务的状态变化，from 为空表示新任务
+func publishTaskStatus(taskID, from, to string) {
+	taskHub.publish(&TaskChangeEvent{Type: "status", TaskID: taskID, Status: to, PreviousStatus: from, At: time.Now()})
+}
+
+// publishTaskProgress 推送执行中任务的进度
+func publishTaskProgress(taskID string, progress int) {
+	taskHub.publish(&TaskChangeEvent{Type: "progress", TaskID: taskID, Status: "running", Progress: progress, At: time.Now()})
+}
+
+// publishTaskDeleted 推送任务被删除
+func publishTaskDeleted(taskID string) {
+	taskHub.publish(&TaskChangeEvent{Type: "deleted", TaskID: taskID, At: time.Now()})
+}
+
+func (h *taskChangeHub) publish(event *TaskChangeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) == 0 {
+		return
+	}
+
+	state := h.states[event.TaskID]
+	switch event.Type {
+	case "deleted":
+		delete(h.states, event.TaskID)
+	case "status":
+		if state != nil && state.status == event.Status {
+			return
+		}
+		if state != nil && event.PreviousStatus == "" {
+			event.PreviousStatus = state.status
+		}
+		h.states[event.TaskID] = &taskHubState{status: event.Status, seenAt: event.At}
+		h.pruneStates(event.At)
+	case "progress":
+		if state != nil && state.status == "running" && state.progress >= event.Progress {
+			return
+		}
+		h.states[event.TaskID] = &taskHubState{status: "running", progress: event.Progress, seenAt: event.At}
+	}
+
+	data, _ := json.Marshal(event)
+	for client := range h.clients {
+		if !client.subscribed(event.TaskID) {
+			continue
+		}
+		select {
+		case client.send <- data:
+		default:
+			// 客户端跟不上，断开后由客户端重连
+			delete(h.clients, client)
+			client.conn.Close()
+		}
+	}
+}
+
+// pruneStates 任务很多时清理已结束较久的任务状态
+func (h *taskChangeHub) pruneStates(now time.Time) {
+	if len(h.states) < wsMaxTrackedTasks {
+		return
+	}
+	for id, state := range h.states {
+		if (state.status == "success" || state.status == "failed") && now.Sub(state.seenAt) > 2*time.Minute {
+			delete(h.states, id)
+		}
+	}
+}
+
+func (h *taskChangeHub) add(client *wsClient) {
+	h.mu.Lock()
+	h.clients[client] = true
+	h.mu.Unlock()
+}
+
+func (h *taskChangeHub) remove(client *wsClient) {
+	h.mu.Lock()
+	delete(h.clients, client)
+	if len(h.clients) == 0 {
+		// 没有客户端时不再跟踪状态，下次有客户端时重新记录
+		h.states = make(map[string]*taskHubState)
+		h.primed = false
+	}
+	h.mu.Unlock()
+}
+
+// closeAll 通知所有客户端服务即将停止（关闭码 1001 going away）并断开，客户端重连到新进程
+func (h *taskChangeHub) closeAll() {
+	h.mu.Lock()
+	clients := make([]*wsClient, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		client.writeFrame(wsOpClose, []byte{0x03, 0xE9})
+		client.conn.Close()
+	}
+}
+
+// wsPoller 定期查询数据库，推送其他节点上的任务变化
+func wsPoller() {
+	ticker := time.NewTicker(wsPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		taskHub.poll()
+	}
+}
+
+func (h *taskChangeHub) poll() {
+	h.mu.Lock()
+	idle := len(h.clients) == 0
+	h.mu.Unlock()
+	if idle {
+		return
+	}
+
+	since := time.Now().Add(-time.Minute)
+	rows, err := db.Query(`SELECT id, status, progress FROM tasks
+		WHERE status IN ('scheduled', 'queued', 'running') OR completed_at >= ?`, since)
+	if err != nil {
+		log.Printf("无法查询任务状态变化: %v", err)
+		return
+	}
+	current := make(map[string]*taskHubState)
+	for rows.Next() {
+		state := &taskHubState{}
+		var id string
+		if err := rows.Scan(&id, &state.status, &state.progress); err != nil {
+			continue
+		}
+		current[id] = state
+	}
+	rows.Close()
+
+	h.mu.Lock()
+	if !h.primed {
+		// 第一次轮询只记录当前状态
+		for id, state := range current {
+			if h.states[id] == nil {
+				state.seenAt = time.Now()
+				h.states[id] = state
+			}
+		}
+		h.primed = true
+		h.mu.Unlock()
+		return
+	}
+	var events []*TaskChangeEvent
+	now := time.Now()
+	for id, state := range current {
+		known := h.states[id]
+		switch {
+		case known == nil || known.status != state.status:
+			from := ""
+			if known != nil {
+				from = known.status
+			}
+			events = append(events, &TaskChangeEvent{Type: "status", TaskID: id, Status: state.status, PreviousStatus: from, At: now})
+		case state.status == "running" && state.progress > known.progress:
+			events = append(events, &TaskChangeEvent{Type: "progress", TaskID: id, Status: "running", Progress: state.progress, At: now})
+		}
+	}
+	for id, known := range h.states {
+		if current[id] != nil {
+			continue
+		}
+		if known.status == "success" || known.status == "failed" {
+			// 结束超过一分钟的任务不再出现在查询结果中
+			if now.Sub(known.seenAt) > 2*time.Minute {
+				delete(h.states, id)
+			}
+			continue
+		}
+		events = append(events, &TaskChangeEvent{Type: "deleted", TaskID: id, At: now})
+	}
+	h.mu.Unlock()
+
+	for _, event := range events {
+		h.publish(event)
+	}
+}
+
+// wsClient 一个 WebSocket 连接
+type wsClient struct {
+	conn    net.Conn
+	send    chan []byte
+	taskIDs map[string]bool // 为空时订阅全部任务
+
+	writeMu sync.Mutex // 控制帧和数据帧由不同 goroutine 写出
+}
+
+func (c *wsClient) subscribed(taskID string) bool {
+	return len(c.taskIDs) == 0 || c.taskIDs[taskID]
+}
+
+// 建立 WebSocket 连接并推送任务变化
+func taskWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		writeError(w, http.StatusUpgradeRequired, codeBadRequest, "WebSocket upgrade required")
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, http.StatusBadRequest, codeBadRequest, "Unsupported WebSocket version")
+		return
+	}
+
+	client := &wsClient{send: make(chan []byte, wsSendBuffer), taskIDs: make(map[string]bool)}
+	for _, id := range strings.Split(r.URL.Query().Get("task_id"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			client.taskIDs[id] = true
+		}
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		// HTTP/2 连接不支持升级
+		writeError(w, http.StatusBadRequest, codeBadRequest, "WebSocket requires HTTP/1.1")
+		return
+	}
+	client.conn = conn
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	taskHub.add(client)
+	done := make(chan struct{})
+	go client.readLoop(rw.Reader, done)
+	client.writeLoop(done)
+	taskHub.remove(client)
+	conn.Close()
+}
+
+// writeLoop 发送推送消息和心跳，直到连接关闭
+func (c *wsClient) writeLoop(done chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-done:
+			return
+		case data := <-c.send:
+			err = c.writeFrame(wsOpText, data)
+		case <-ticker.C:
+			err = c.writeFrame(wsOpPing, nil)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readLoop 处理客户端的控制帧，连接关闭或超时后关闭 done。客户端发送的数据帧被忽略
+func (c *wsClient) readLoop(r *bufio.Reader, done chan struct{}) {
+	defer close(done)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		opcode, payload, err := readWSFrame(r)
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload)
+			return
+		case wsOpPing:
+			c.writeFrame(wsOpPong, payload)
+		}
+	}
+}
+
+func (c *wsClient) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, byte(n>>8), byte(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readWSFrame 读取一个客户端帧（客户端帧必须带掩码），分片的数据帧按各自的帧返回
+func readWSFrame(r *bufio.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, errors.New("unmasked client frame")
+	}
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxFrameSize {
+		return 0, nil, errors.New("frame too large")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// headerContainsToken 请求头中是否包含 token（逗号分隔，不区分大小写）
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+// WinZip AES 加密（AE-2，AES-256）：7-Zip、WinZip、WinRAR 和 bsdtar（libarchive）都能解压，macOS 自带的归档实用工具不支持。
+// archive/zip 不支持加密，这里先把文件压缩到临时文件，再以 CreateRaw 写入加密后的数据：
+//
+//	salt(16) | 密码校验值(2) | AES-CTR 加密的 deflate 数据 | HMAC-SHA1 校验码(10)
+//
+// 密钥由 PBKDF2-HMAC-SHA1（1000 次迭代）从密码和 salt 派生；AE-2 不记录 CRC，完整性由 HMAC 保证。
+const (
+	zipMethodAES      = 99
+	zipAESExtraID     = 0x9901
+	zipAESSaltSize    = 16
+	zipAESKeySize     = 32
+	zipAESMACSize     = 10
+	zipAESIterations  = 1000
+	zipAESStrength256 = 3
+)
+
+// addEncryptedFileToZip 以 AES-256 加密把文件写入 zip，name 为压缩包中的文件名
+func addEncryptedFileToZip(zw *zip.Writer, path, name, password string) error {
+	src, info, err := openOutputFile(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// 先压缩到临时文件，得到写入文件头所需的压缩后大小
+	tmp, err := os.CreateTemp("", "babeldoc-bundle-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	fw, _ := flate.NewWriter(tmp, flate.DefaultCompression)
+	if _, err := io.Copy(fw, src); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	compressedSize, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	salt := make([]byte, zipAESSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	keys, err := pbkdf2.Key(sha1.New, password, salt, zipAESIterations, 2*zipAESKeySize+2)
+	if err != nil {
+		return err
+	}
+	encKey, macKey, verifier := keys[:zipAESKeySize], keys[zipAESKeySize:2*zipAESKeySize], keys[2*zipAESKeySize:]
+
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], zipAESExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], 2) // AE-2
+	copy(extra[6:], "AE")
+	extra[8] = zipAESStrength256
+	binary.LittleEndian.PutUint16(extra[9:], zip.Deflate)
+
+	fh := &zip.FileHeader{
+		Name:               name,
+		Method:             zipMethodAES,
+		Flags:              0x1, // 加密
+		Extra:              extra,
+		CompressedSize64:   uint64(zipAESSaltSize + 2 + compressedSize + zipAESMACSize),
+		UncompressedSize64: uint64(info.Size()),
+	}
+	if hasNonASCII(name) {
+		fh.Flags |= 0x800
+	}
+	fh.ModifiedTime, fh.ModifiedDate = msDosTime(info.ModTime())
+	w, err := zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(salt); err != nil {
+		return err
+	}
+	if _, err := w.Write(verifier); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha1.New, macKey)
+	enc := &zipAESWriter{w: io.MultiWriter(w, mac), block: block}
+	if _, err := io.Copy(enc, tmp); err != nil {
+		return err
+	}
+	_, err = w.Write(mac.Sum(nil)[:zipAESMACSize])
+	return err
+}
+
+// zipAESWriter 以 WinZip 的 AES-CTR 变体加密：计数器为小端序，从 1 开始
+type zipAESWriter struct {
+	w         io.Writer
+	block     cipher.Block
+	counter   [aes.BlockSize]byte
+	keystream [aes.BlockSize]byte
+	used      int // keystream 中已使用的字节数
+	started   bool
+}
+
+func (e *zipAESWriter) Write(p []byte) (int, error) {
+	out := make([]byte, len(p))
+	for i := range p {
+		if !e.started || e.used == aes.BlockSize {
+			e.nextBlock()
+		}
+		out[i] = p[i] ^ e.keystream[e.used]
+		e.used++
+	}
+	if _, err := e.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *zipAESWriter) nextBlock() {
+	for i := range e.counter {
+		e.counter[i]++
+		if e.counter[i] != 0 {
+			break
+		}
+	}
+	e.block.Encrypt(e.keystream[:], e.counter[:])
+	e.used = 0
+	e.started = true
+}
+
+func hasNonASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+// msDosTime 转换为 zip 文件头使用的 MS-DOS 日期和时间
+func msDosTime(t time.Time) (uint16, uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	fTime := uint16(t.Hour()<<11 | t.Minute()<<5 | t.Second()>>1)
+	fDate := uint16((t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day())
+	return fTime, fDate
+}